@@ -6,8 +6,12 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/StitchMl/saga-demo/common/buildinfo"
 	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	"github.com/StitchMl/saga-demo/common/diagnostics"
+	"github.com/StitchMl/saga-demo/common/sessions"
 	events "github.com/StitchMl/saga-demo/common/types"
 	"github.com/google/uuid"
 )
@@ -101,11 +105,14 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 			inventorydb.DB.Users.Unlock()
 			inventorydb.DB.Users.RLock()
 
+			token, session := sessions.Issue(sid)
 			w.Header().Set(ContentType, ContentTypeJSON)
 			_ = json.NewEncoder(w).Encode(map[string]string{
 				"customer_id": sid,
 				"status":      "success",
 				"ns":          req.NS,
+				"token":       token,
+				"expires_at":  session.ExpiresAt.Format(time.RFC3339),
 			})
 			return
 		}
@@ -204,12 +211,17 @@ func main() {
 		log.Fatal("AUTH_SERVICE_PORT missing")
 	}
 
+	sessions.Start()
+
 	// REST API
 	http.HandleFunc("/register", registerHandler)
 	http.HandleFunc("/login", loginHandler)
 	http.HandleFunc("/validate", validateHandler)
+	http.HandleFunc("/validate_token", sessions.ValidateTokenHandler)
+	http.HandleFunc("/logout", sessions.LogoutHandler)
 	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/version", buildinfo.Handler("choreographer-auth-service"))
 
 	log.Printf("[Auth-C] listening on :%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Fatal(http.ListenAndServe(":"+port, diagnostics.Handler(http.DefaultServeMux)))
 }
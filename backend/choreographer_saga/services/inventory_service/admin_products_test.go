@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func adminCall(handler http.HandlerFunc, method, path, body string) (int, string) {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var resp events.ErrorResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec.Code, resp.ReasonCode
+}
+
+func inCatalog(id string) (events.Product, bool) {
+	rec := httptest.NewRecorder()
+	catalogHandler(rec, httptest.NewRequest(http.MethodGet, "/catalog", nil))
+	var products []events.Product
+	_ = json.Unmarshal(rec.Body.Bytes(), &products)
+	for _, p := range products {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return events.Product{}, false
+}
+
+// Invalid products and stock changes out of range are refused, valid ones reach the catalog at
+// once, and a product cannot be deleted while an order holds it.
+func TestAdminProducts(t *testing.T) {
+	bus := newTestBus(t)
+
+	for name, body := range map[string]string{
+		"missing id":     `{"name":"Desk lamp","price":19,"available":5}`,
+		"missing name":   `{"id":"desk-lamp","price":19,"available":5}`,
+		"negative stock": `{"id":"desk-lamp","name":"Desk lamp","price":19,"available":-1}`,
+	} {
+		if code, reason := adminCall(upsertProductHandler, http.MethodPost, "/admin/products", body); code != http.StatusBadRequest || reason != events.ReasonInvalidRequest {
+			t.Errorf("%s: answered %d %s, want 400 %s", name, code, reason, events.ReasonInvalidRequest)
+		}
+	}
+	if code, _ := adminCall(upsertProductHandler, http.MethodPost, "/admin/products", `{"id":"desk-lamp","name":"Desk lamp","price":19,"available":50}`); code != http.StatusCreated {
+		t.Fatalf("create answered %d, want 201", code)
+	}
+	if p, ok := inCatalog("desk-lamp"); !ok || p.Available != 50 {
+		t.Fatalf("catalog shows %+v (%t), want the new product with 50 available", p, ok)
+	}
+
+	if code, reason := adminCall(productAdminHandler, http.MethodPost, "/admin/products/desk-lamp/adjust_stock", `{"delta":-51}`); code != http.StatusConflict || reason != events.ReasonStockOutOfRange {
+		t.Errorf("adjustment below zero answered %d %s, want 409 %s", code, reason, events.ReasonStockOutOfRange)
+	}
+	if p, _ := inCatalog("desk-lamp"); p.Available != 50 {
+		t.Errorf("%d available after a refused adjustment, want 50", p.Available)
+	}
+
+	created := events.NewGenericEvent(events.OrderCreatedEvent, "admin-1", "Order created", events.OrderCreatedPayload{
+		OrderID: "admin-1", Items: []events.OrderItem{{ProductID: "desk-lamp", Quantity: 2}},
+	})
+	if err := bus.Inject(created); err != nil {
+		t.Fatal(err)
+	}
+	if code, reason := adminCall(productAdminHandler, http.MethodDelete, "/admin/products/desk-lamp", ""); code != http.StatusConflict || reason != events.ReasonProductReserved {
+		t.Errorf("delete of a reserved product answered %d %s, want 409 %s", code, reason, events.ReasonProductReserved)
+	}
+	revert := events.NewGenericEvent(events.RevertInventoryEvent, "admin-1", "Reverting inventory", events.InventoryRequestPayload{OrderID: "admin-1"})
+	if err := bus.Inject(revert); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := adminCall(productAdminHandler, http.MethodDelete, "/admin/products/desk-lamp", ""); code != http.StatusOK {
+		t.Errorf("delete answered %d, want 200", code)
+	}
+	if _, ok := inCatalog("desk-lamp"); ok {
+		t.Error("deleted product still in the catalog")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared"
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared/testutil"
+	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	events "github.com/StitchMl/saga-demo/common/types"
+	"github.com/StitchMl/saga-demo/common/warehouse"
+)
+
+// newTestBus subscribes the event handlers of the service to a fresh FakeBus, over the sample
+// catalog.
+func newTestBus(t *testing.T) *testutil.FakeBus {
+	t.Helper()
+	bus := testutil.NewFakeBus()
+	eventBus = bus
+	processed = shared.NewDedupe()
+	inventorydb.InitDB()
+	allocations = make(map[string]warehouse.Allocation)
+	reserved = make(map[string]events.InventoryRequestPayload)
+	lowStockWarned = make(map[string]bool)
+	subscribe(events.OrderCreatedEvent, handleOrderCreatedEvent)
+	subscribe(events.RevertInventoryEvent, handleRevertInventoryEvent, shared.WithAck())
+	return bus
+}
+
+func available(productID string) int {
+	inventorydb.DB.Products.RLock()
+	defer inventorydb.DB.Products.RUnlock()
+	return inventorydb.DB.Products.Data[productID].Available
+}
+
+// A reservation whose outcome failed to publish takes the stock once and is published on redelivery.
+func TestOrderCreatedRedeliveredAfterFailedPublish(t *testing.T) {
+	bus := newTestBus(t)
+	before := available("mouse-wireless")
+	event := events.NewGenericEvent(events.OrderCreatedEvent, "order-redelivered", "Order created", events.OrderCreatedPayload{
+		OrderID:    "order-redelivered",
+		CustomerID: "customer-1",
+		Items:      []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 2}},
+	})
+
+	bus.PublishErr = errors.New("broker unreachable")
+	if err := bus.Inject(event); err == nil {
+		t.Fatal("handler succeeded although the reservation could not be published")
+	}
+	bus.PublishErr = nil
+	if err := bus.Inject(event); err != nil {
+		t.Fatalf("redelivery failed: %v", err)
+	}
+
+	if got := available("mouse-wireless"); got != before-2 {
+		t.Errorf("available = %d, want %d: the stock must be taken once", got, before-2)
+	}
+	published := bus.PublishedOfType(events.InventoryReservedEvent)
+	if len(published) != 1 {
+		t.Fatalf("InventoryReserved published %d times, want 1", len(published))
+	}
+	var payload events.InventoryRequestPayload
+	if err := mapToStruct(published[0].Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Amount != 99 || len(payload.Items) != 1 {
+		t.Errorf("reservation = %+v, want 2 x mouse-wireless for 99", payload)
+	}
+}
+
+func TestHandleOrderCreated(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   interface{}
+		published events.EventType // "" when nothing is published
+		reason    string
+		permanent bool
+		taken     int // units of mouse-wireless reserved
+	}{
+		{
+			name:      "reserved",
+			payload:   events.OrderCreatedPayload{OrderID: "o-reserved", Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 3}}},
+			published: events.InventoryReservedEvent,
+			taken:     3,
+		},
+		{
+			name:      "unknown product",
+			payload:   events.OrderCreatedPayload{OrderID: "o-unknown", Items: []events.OrderItem{{ProductID: "no-such-product", Quantity: 1}}},
+			published: events.InventoryReservationFailedEvent,
+			reason:    events.ReasonUnknownProduct,
+		},
+		{
+			name:      "invalid quantity",
+			payload:   events.OrderCreatedPayload{OrderID: "o-zero", Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 0}}},
+			published: events.InventoryReservationFailedEvent,
+			reason:    events.ReasonInvalidQuantity,
+		},
+		{
+			name:      "insufficient stock",
+			payload:   events.OrderCreatedPayload{OrderID: "o-short", Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 51}}},
+			published: events.InventoryReservationFailedEvent,
+			reason:    events.ReasonInsufficientQty,
+		},
+		{
+			name:      "malformed payload",
+			payload:   map[string]interface{}{"order_id": 42},
+			permanent: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bus := newTestBus(t)
+			before := available("mouse-wireless")
+
+			err := bus.Inject(events.NewGenericEvent(events.OrderCreatedEvent, "order", "Order created", tc.payload))
+			if tc.permanent {
+				if !shared.IsPermanent(err) {
+					t.Fatalf("error = %v, want a permanent one", err)
+				}
+			} else if err != nil {
+				t.Fatalf("handler failed: %v", err)
+			}
+
+			published := bus.Published()
+			if tc.published == "" {
+				if len(published) != 0 {
+					t.Fatalf("published %v, want nothing", published)
+				}
+				return
+			}
+			if len(published) != 1 || published[0].Type != tc.published {
+				t.Fatalf("published %v, want one %s", published, tc.published)
+			}
+			if tc.reason != "" {
+				var payload events.OrderStatusUpdatePayload
+				if err := mapToStruct(published[0].Payload, &payload); err != nil {
+					t.Fatal(err)
+				}
+				if payload.ReasonCode != tc.reason {
+					t.Errorf("reason code = %q, want %q", payload.ReasonCode, tc.reason)
+				}
+			}
+			if got := before - available("mouse-wireless"); got != tc.taken {
+				t.Errorf("reserved %d units, want %d", got, tc.taken)
+			}
+		})
+	}
+}
+
+// A revert gives back the reserved stock once, however many times it is delivered.
+func TestHandleRevertInventory(t *testing.T) {
+	bus := newTestBus(t)
+	before := available("laptop-pro")
+	created := events.NewGenericEvent(events.OrderCreatedEvent, "o-revert", "Order created", events.OrderCreatedPayload{
+		OrderID: "o-revert", Items: []events.OrderItem{{ProductID: "laptop-pro", Quantity: 4}},
+	})
+	if err := bus.Inject(created); err != nil {
+		t.Fatal(err)
+	}
+	if got := available("laptop-pro"); got != before-4 {
+		t.Fatalf("available after the reservation = %d, want %d", got, before-4)
+	}
+
+	// Distinct events, e.g. from both the payment failure and a replay: the second is a no-op.
+	for i := 0; i < 2; i++ {
+		revert := events.NewGenericEvent(events.RevertInventoryEvent, "o-revert", "Reverting inventory",
+			events.InventoryRequestPayload{OrderID: "o-revert", Items: []events.OrderItem{{ProductID: "laptop-pro", Quantity: 40}}})
+		if err := bus.Inject(revert); err != nil {
+			t.Fatalf("revert %d failed: %v", i+1, err)
+		}
+	}
+	if got := available("laptop-pro"); got != before {
+		t.Errorf("available after the revert = %d, want %d", got, before)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared/testutil"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func orderLamps(t *testing.T, bus *testutil.FakeBus, orderID string, quantity int) {
+	t.Helper()
+	created := events.NewGenericEvent(events.OrderCreatedEvent, orderID, "Order created", events.OrderCreatedPayload{
+		OrderID: orderID, Items: []events.OrderItem{{ProductID: "desk-lamp", Quantity: quantity}},
+	})
+	if err := bus.Inject(created); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func lowStock(t *testing.T) []events.LowStockPayload {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	lowStockHandler(rec, httptest.NewRequest(http.MethodGet, "/low_stock", nil))
+	var low []events.LowStockPayload
+	if err := json.Unmarshal(rec.Body.Bytes(), &low); err != nil {
+		t.Fatal(err)
+	}
+	var lamps []events.LowStockPayload
+	for _, p := range low {
+		if p.ProductID == "desk-lamp" {
+			lamps = append(lamps, p)
+		}
+	}
+	return lamps
+}
+
+// A LowStock event is published once when a reservation takes a product below the threshold,
+// not again for the next orders, and again only after the stock went back above it.
+func TestLowStockOncePerCrossing(t *testing.T) {
+	bus := newTestBus(t)
+	threshold := lowStockThreshold
+	lowStockThreshold = 10
+	t.Cleanup(func() { lowStockThreshold = threshold })
+	if code, _ := adminCall(upsertProductHandler, http.MethodPost, "/admin/products", `{"id":"desk-lamp","name":"Desk lamp","price":19,"available":12}`); code != http.StatusCreated {
+		t.Fatalf("create answered %d", code)
+	}
+
+	orderLamps(t, bus, "low-1", 3)
+	orderLamps(t, bus, "low-2", 1)
+	warnings := bus.PublishedOfType(events.LowStockEvent)
+	if len(warnings) != 1 {
+		t.Fatalf("%d LowStock events after two orders below the threshold, want 1", len(warnings))
+	}
+	var payload events.LowStockPayload
+	raw, _ := json.Marshal(warnings[0].Payload)
+	_ = json.Unmarshal(raw, &payload)
+	if payload != (events.LowStockPayload{ProductID: "desk-lamp", Available: 9, Threshold: 10}) {
+		t.Errorf("LowStock payload = %+v, want desk-lamp at 9 of 10", payload)
+	}
+	if low := lowStock(t); len(low) != 1 || low[0].Available != 8 {
+		t.Errorf("/low_stock lists %+v, want desk-lamp at 8", low)
+	}
+
+	for _, id := range []string{"low-1", "low-2"} {
+		revert := events.NewGenericEvent(events.RevertInventoryEvent, id, "Reverting inventory", events.InventoryRequestPayload{OrderID: id})
+		if err := bus.Inject(revert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if low := lowStock(t); len(low) != 0 {
+		t.Errorf("/low_stock lists %+v after the stock went back to 12", low)
+	}
+
+	orderLamps(t, bus, "low-3", 4)
+	if n := len(bus.PublishedOfType(events.LowStockEvent)); n != 2 {
+		t.Errorf("%d LowStock events after crossing the threshold again, want 2", n)
+	}
+}
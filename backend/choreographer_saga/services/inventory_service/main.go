@@ -2,21 +2,64 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/StitchMl/saga-demo/choreographer_saga/shared"
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/buildinfo"
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/correlation"
 	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	"github.com/StitchMl/saga-demo/common/diagnostics"
+	"github.com/StitchMl/saga-demo/common/graceful"
+	"github.com/StitchMl/saga-demo/common/order_policy"
+	"github.com/StitchMl/saga-demo/common/responses"
 	events "github.com/StitchMl/saga-demo/common/types"
+	"github.com/StitchMl/saga-demo/common/warehouse"
 )
 
 const payloadErrorLogFmt = "Inventory Service: Error in payload: %v"
 
-var eventBus *shared.EventBus
+var (
+	// eventBus is used by the handlers; rabbitBus is the same bus, for health and admin endpoints.
+	eventBus  shared.Bus
+	rabbitBus *shared.EventBus
+)
+
+// Reservations by order: the warehouses each order's stock was taken from, so a revert restores
+// the same ones. Deleted by the revert. Guarded by inventorydb.DB.Products.
+var allocations = make(map[string]warehouse.Allocation)
+
+// InventoryReserved payload of every reservation, published again when the OrderCreated event is
+// redelivered, e.g. because the first publication failed. Deleted by the revert. Guarded by
+// inventorydb.DB.Products.
+var reserved = make(map[string]events.InventoryRequestPayload)
+
+// lowStockThreshold is the stock under which a product is announced with a LowStock event
+// (LOW_STOCK_THRESHOLD, default 10; 0 disables the events).
+var lowStockThreshold = 10
+
+// Products already announced as low on stock, cleared once their stock is back at the threshold,
+// so each crossing publishes a single event. Guarded by inventorydb.DB.Products.
+var lowStockWarned = make(map[string]bool)
 
 func main() {
 	inventorydb.InitDB()
+	if v := os.Getenv("LOW_STOCK_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("Invalid LOW_STOCK_THRESHOLD: %q", v)
+		}
+		lowStockThreshold = n
+	}
+	config.Set("LOW_STOCK_THRESHOLD", lowStockThreshold)
 
 	rabbitMQURL := os.Getenv("RABBITMQ_URL")
 	if rabbitMQURL == "" {
@@ -24,140 +67,416 @@ func main() {
 	}
 
 	var err error
-	eventBus, err = shared.NewEventBus(rabbitMQURL)
+	rabbitBus, err = shared.NewEventBus(rabbitMQURL)
 	if err != nil {
 		log.Fatalf("Unable to create EventBus: %v", err)
 	}
-	defer eventBus.Close()
+	eventBus = rabbitBus
 
+	rabbitBus.Produces(events.InventoryReservedEvent, events.InventoryReservationFailedEvent, events.LowStockEvent)
 	subscribe(events.OrderCreatedEvent, handleOrderCreatedEvent)
-	subscribe(events.RevertInventoryEvent, handleRevertInventoryEvent)
+	// A lost revert would leave the stock reserved for good, so it is acknowledged only once applied.
+	subscribe(events.RevertInventoryEvent, handleRevertInventoryEvent, shared.WithAck())
+	rabbitBus.StartVerifier()
 
 	http.HandleFunc("/products/prices", getProductPricesHandler)
 	http.HandleFunc("/catalog", catalogHandler)
+	http.HandleFunc("/low_stock", lowStockHandler)
+	http.HandleFunc("/admin/warehouses/stock", adminauth.Require(warehouseStockHandler))
+	http.HandleFunc("/admin/products", adminauth.Require(upsertProductHandler))
+	http.HandleFunc("/admin/products/", adminauth.Require(productAdminHandler))
+	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/ready", readyHandler)
+	http.HandleFunc("/version", buildinfo.Handler("choreographer-inventory-service"))
+	http.HandleFunc("/debug/subscriptions", rabbitBus.SubscriptionsHandler)
+	http.HandleFunc("/debug/topology", rabbitBus.TopologyHandler)
+	http.HandleFunc("/debug/quotas", rabbitBus.QuotaHandler)
+	http.HandleFunc("/debug/pending", rabbitBus.PendingHandler)
+	http.HandleFunc("/failed_deliveries", adminauth.Require(rabbitBus.FailedDeliveriesHandler))
+	http.HandleFunc("/failed_deliveries/redeliver", adminauth.Require(rabbitBus.RedeliverHandler))
+	http.HandleFunc("/admin/replay/", adminauth.Require(rabbitBus.ReplayHandler))
+	diagnostics.Publish("event_bus_queue_depths", func() interface{} { return rabbitBus.QueueDepths() })
+	http.HandleFunc("/debug/config", adminauth.Require(config.Handler))
 
 	port := os.Getenv("INVENTORY_SERVICE_PORT")
 	if port == "" {
 		log.Fatal("INVENTORY_SERVICE_PORT non impostata")
 	}
+	config.Set("INVENTORY_SERVICE_PORT", port)
 	log.Printf("Inventory service started on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	// On SIGTERM the consumers stop and the events being handled are allowed to finish
+	if err := graceful.ListenAndServe(":"+port, diagnostics.Handler(http.DefaultServeMux), rabbitBus.Shutdown); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func subscribe(t events.EventType, h shared.EventHandler) {
-	if err := eventBus.Subscribe(t, h); err != nil {
+// processed skips the events already handled, e.g. redelivered by RabbitMQ
+var processed = shared.NewDedupe()
+
+// subscribe: subscribes the handler on the durable queue of the service, skipping duplicates
+func subscribe(t events.EventType, h shared.EventHandler, opts ...shared.SubscribeOption) {
+	opts = append(opts, shared.Durable(),
+		shared.OnStarted(func() { setConsumerStopped(t, nil) }),
+		shared.OnStopped(func(err error) {
+			log.Printf("Inventory Service: consumer for %s stopped: %v", t, err)
+			setConsumerStopped(t, err)
+		}),
+	)
+	err := eventBus.Subscribe(t, processed.Once(string(t), h), opts...)
+	if err != nil {
 		log.Fatalf("Subscription error %s: %v", t, err)
 	}
 }
 
+// Consumers whose delivery stream has ended, keyed by event type
+var stoppedConsumers = struct {
+	sync.RWMutex
+	Errors map[events.EventType]error
+}{Errors: make(map[events.EventType]error)}
+
+// setConsumerStopped records (err != nil) or clears (err == nil) a stopped consumer.
+func setConsumerStopped(t events.EventType, err error) {
+	stoppedConsumers.Lock()
+	defer stoppedConsumers.Unlock()
+	if err == nil {
+		delete(stoppedConsumers.Errors, t)
+		return
+	}
+	stoppedConsumers.Errors[t] = err
+}
+
 // ---------- Gestori Eventi ----------
 
 // handleOrderCreatedEvent handles the order creation request
-func handleOrderCreatedEvent(event events.GenericEvent) {
+func handleOrderCreatedEvent(event events.GenericEvent) error {
 	var payload events.OrderCreatedPayload
 	if err := mapToStruct(event.Payload, &payload); err != nil {
-		log.Printf(payloadErrorLogFmt, err)
-		return
+		correlation.Logf(event.CorrelationID, payloadErrorLogFmt, err)
+		return shared.Permanent(err)
 	}
 
-	log.Printf("Inventory Service: Received OrderCreatedEvent %s for %d items", payload.OrderID, len(payload.Items))
+	correlation.Logf(event.CorrelationID, "Inventory Service: Received OrderCreatedEvent %s for %d items", payload.OrderID, len(payload.Items))
+
+	if v := order_policy.ValidateItems(payload.Items); v != nil {
+		return publishFailure(payload.OrderID, v.Message, v.ReasonCode, nil)
+	}
 
 	inventorydb.DB.Products.Lock()
 	defer inventorydb.DB.Products.Unlock()
 
+	// Already reserved: the stock is not taken twice, the outcome is published again.
+	if reservation, ok := reserved[payload.OrderID]; ok {
+		correlation.Logf(event.CorrelationID, "Inventory Service: Order %s already booked, publishing the reservation again", payload.OrderID)
+		return publish(events.InventoryReservedEvent, payload.OrderID, "Booked inventory", reservation)
+	}
+
 	var totalAmount float64
 	// First, calculate the total and check the prices
 	for i := range payload.Items {
 		product, ok := inventorydb.DB.Products.Data[payload.Items[i].ProductID]
 		if !ok {
-			publishFailure(payload.OrderID, "Product price not found for "+payload.Items[i].ProductID, nil)
-			return
+			return publishFailure(payload.OrderID, "Product price not found for "+payload.Items[i].ProductID, events.ReasonUnknownProduct, nil)
+		}
+		if v := order_policy.CheckPrice(product.ID, product.Price); v != nil {
+			return publishFailure(payload.OrderID, v.Message, v.ReasonCode, nil)
 		}
 		payload.Items[i].Price = product.Price
 		totalAmount += product.Price * float64(payload.Items[i].Quantity)
 	}
 
-	// Then, check availability and book
-	reservedItems := make([]events.OrderItem, 0, len(payload.Items))
+	// Then, check availability of every item and book
+	var shortages []events.StockShortage
 	for _, item := range payload.Items {
-		product := inventorydb.DB.Products.Data[item.ProductID]
-		if product.Available < item.Quantity {
-			// Restore any reserves
-			for _, r := range reservedItems {
-				p := inventorydb.DB.Products.Data[r.ProductID]
-				p.Available += r.Quantity
-				inventorydb.DB.Products.Data[r.ProductID] = p
-			}
-			publishFailure(payload.OrderID, "Insufficient quantity for "+item.ProductID, &totalAmount)
-			return
+		if product := inventorydb.DB.Products.Data[item.ProductID]; product.Available < item.Quantity {
+			shortages = append(shortages, order_policy.Shortage(item.ProductID, item.Quantity, product.Available))
 		}
-		product.Available -= item.Quantity
-		inventorydb.DB.Products.Data[item.ProductID] = product
-		reservedItems = append(reservedItems, item)
-	}
-
-	publish(events.InventoryReservedEvent, payload.OrderID, "Booked inventory",
-		events.InventoryRequestPayload{
-			OrderID:    payload.OrderID,
-			CustomerID: payload.CustomerID,
-			Items:      reservedItems,
-			Amount:     totalAmount,
-		},
-	)
+	}
+	if len(shortages) > 0 {
+		return publishShortage(payload.OrderID, shortages, totalAmount)
+	}
+	alloc, ok := warehouse.Allocate(inventorydb.DB.Products.Data, payload.Items)
+	if !ok {
+		return publishFailure(payload.OrderID, "The stock of the warehouses cannot cover the order", events.ReasonInsufficientQty, &totalAmount)
+	}
+	if err := warehouse.Take(inventorydb.DB.Products.Data, alloc); err != nil {
+		correlation.Logf(event.CorrelationID, "Inventory Service: Reservation for order %s rejected: %v", payload.OrderID, err)
+		return publishFailure(payload.OrderID, "Reservation rejected: "+err.Error(), events.ReasonStockOutOfRange, &totalAmount)
+	}
+	allocations[payload.OrderID] = alloc
+	reservation := events.InventoryRequestPayload{
+		OrderID:    payload.OrderID,
+		CustomerID: payload.CustomerID,
+		Items:      append([]events.OrderItem(nil), payload.Items...),
+		Amount:     totalAmount,
+	}
+	reserved[payload.OrderID] = reservation
+	for id := range alloc {
+		checkLowStock(payload.OrderID, id)
+	}
+	correlation.Logf(event.CorrelationID, "Inventory Service: Booked order %s from %v", payload.OrderID, alloc)
+
+	// On failure the event is requeued, and its redelivery publishes the reservation again.
+	return publish(events.InventoryReservedEvent, payload.OrderID, "Booked inventory", reservation)
 }
 
-// handleRevertInventoryEvent manages the inventory reversal request
-func handleRevertInventoryEvent(event events.GenericEvent) {
+// handleRevertInventoryEvent manages the inventory reversal request. It restores exactly the
+// recorded allocation of the order and deletes it, so a duplicated revert is a logged no-op;
+// the items in the payload are not trusted.
+func handleRevertInventoryEvent(event events.GenericEvent) error {
 	var payload events.InventoryRequestPayload
 	if err := mapToStruct(event.Payload, &payload); err != nil {
-		log.Printf(payloadErrorLogFmt, err)
-		return
+		correlation.Logf(event.CorrelationID, payloadErrorLogFmt, err)
+		return shared.Permanent(err)
 	}
 
 	inventorydb.DB.Products.Lock()
 	defer inventorydb.DB.Products.Unlock()
 
-	for _, item := range payload.Items {
-		if product, ok := inventorydb.DB.Products.Data[item.ProductID]; ok {
-			product.Available += item.Quantity
-			inventorydb.DB.Products.Data[item.ProductID] = product
+	alloc, ok := allocations[payload.OrderID]
+	if !ok {
+		correlation.Logf(event.CorrelationID, "Inventory Service: No reservation to revert for order %s, ignoring", payload.OrderID)
+		return nil
+	}
+	if err := warehouse.Restore(inventorydb.DB.Products.Data, alloc); err != nil {
+		correlation.Logf(event.CorrelationID, "Inventory Service: Revert for order %s rejected: %v", payload.OrderID, err)
+		return nil
+	}
+	delete(allocations, payload.OrderID)
+	delete(reserved, payload.OrderID)
+	for id := range alloc {
+		checkLowStock(payload.OrderID, id)
+	}
+	correlation.Logf(event.CorrelationID, "Inventory Service: Restored %v for Order %s.", alloc, payload.OrderID)
+	return nil
+}
+
+// checkLowStock publishes a LowStock event for each product that has just dropped below
+// lowStockThreshold, and forgets the products back at the threshold. The caller holds the lock.
+func checkLowStock(orderID string, productIDs ...string) {
+	if lowStockThreshold == 0 {
+		return
+	}
+	for _, id := range productIDs {
+		product, ok := inventorydb.DB.Products.Data[id]
+		switch {
+		case !ok || product.Available >= lowStockThreshold:
+			delete(lowStockWarned, id)
+		case !lowStockWarned[id]:
+			lowStockWarned[id] = true
+			log.Printf("Inventory Service: Stock of %s is low: %d available, threshold %d", id, product.Available, lowStockThreshold)
+			// Only logged on failure: the warning does not hold back the reservation.
+			_ = publish(events.LowStockEvent, orderID, "Low stock for "+id,
+				events.LowStockPayload{ProductID: id, Available: product.Available, Threshold: lowStockThreshold})
 		}
 	}
-	log.Printf("Inventory Service: Restored %d items for Order %s.", len(payload.Items), payload.OrderID)
 }
 
 // publishFailure is a helper to publish a booking failure event.
-func publishFailure(orderID, reason string, total *float64) {
+func publishFailure(orderID, reason, reasonCode string, total *float64) error {
 	payload := events.OrderStatusUpdatePayload{
-		OrderID: orderID,
-		Reason:  reason,
+		OrderID:    orderID,
+		Reason:     reason,
+		ReasonCode: reasonCode,
 	}
 	if total != nil {
 		payload.Total = *total
 	}
-	publish(events.InventoryReservationFailedEvent, orderID, "Inventory reservation failed", payload)
+	return publish(events.InventoryReservationFailedEvent, orderID, "Inventory reservation failed", payload)
 }
 
-// publish is a helper to publish an event.
-func publish(t events.EventType, id, msg string, pl events.EventPayload) {
+// publishShortage publishes the failure of a reservation short of stock, item by item.
+func publishShortage(orderID string, shortages []events.StockShortage, total float64) error {
+	return publish(events.InventoryReservationFailedEvent, orderID, "Inventory reservation failed", events.OrderStatusUpdatePayload{
+		OrderID:    orderID,
+		Total:      total,
+		Reason:     "Insufficient quantity for " + shortages[0].ProductID,
+		ReasonCode: events.ReasonInsufficientQty,
+		Shortages:  shortages,
+	})
+}
+
+// publish is a helper to publish an event. The error is returned to the event handlers, so
+// that the event they handle is requeued instead of losing the outcome.
+func publish(t events.EventType, id, msg string, pl events.EventPayload) error {
 	if err := eventBus.Publish(events.NewGenericEvent(t, id, msg, pl)); err != nil {
 		log.Printf("publication %s: %v", t, err)
+		return fmt.Errorf("publish %s: %w", t, err)
 	}
+	return nil
 }
 
 // ---------- Handler HTTP ----------
 
-// catalogHandler handles requests to get the product catalog
-func catalogHandler(w http.ResponseWriter, _ *http.Request) {
+// healthHandler reports 503 when the RabbitMQ connection is gone
+func healthHandler(w http.ResponseWriter, _ *http.Request) {
+	if !rabbitBus.Healthy() {
+		http.Error(w, "RabbitMQ connection lost", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("Inventory service OK"))
+}
+
+// readyHandler reports 503 while the event bus subscriptions cannot be verified
+func readyHandler(w http.ResponseWriter, _ *http.Request) {
+	if ok, reason := rabbitBus.Ready(); !ok {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	stoppedConsumers.RLock()
+	defer stoppedConsumers.RUnlock()
+	for t, err := range stoppedConsumers.Errors {
+		http.Error(w, fmt.Sprintf("consumer for %s stopped: %v", t, err), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("Inventory service ready"))
+}
+
+// catalogHandler handles requests to get the product catalog; ?warehouses=true adds the stock by warehouse
+func catalogHandler(w http.ResponseWriter, r *http.Request) {
+	withWarehouses, _ := strconv.ParseBool(r.URL.Query().Get("warehouses"))
+
 	inventorydb.DB.Products.RLock()
 	defer inventorydb.DB.Products.RUnlock()
 
-	list := make([]events.Product, 0, len(inventorydb.DB.Products.Data))
-	for _, p := range inventorydb.DB.Products.Data {
-		list = append(list, p)
-	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(list)
+	_ = json.NewEncoder(w).Encode(warehouse.Catalog(inventorydb.DB.Products.Data, withWarehouses))
+}
+
+// warehouseStockHandler sets the stock of a product in a warehouse
+func warehouseStockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req, ok := warehouse.DecodeStockRequest(w, r)
+	if !ok {
+		return
+	}
+
+	inventorydb.DB.Products.Lock()
+	defer inventorydb.DB.Products.Unlock()
+	product, ok := inventorydb.DB.Products.Data[req.ProductID]
+	if !ok {
+		responses.WriteNotFound(w, "product", req.ProductID)
+		return
+	}
+	product = warehouse.SetStock(product, req.WarehouseID, req.Available)
+	inventorydb.DB.Products.Data[req.ProductID] = product
+	checkLowStock("", req.ProductID)
+
+	log.Printf("Inventory Service: Stock of %s in %s set to %d", req.ProductID, req.WarehouseID, req.Available)
+	responses.WriteJSON(w, http.StatusOK, product)
+}
+
+// upsertProductHandler serves POST /admin/products, creating or updating a product.
+func upsertProductHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req, ok := warehouse.DecodeProductRequest(w, r)
+	if !ok {
+		return
+	}
+
+	inventorydb.DB.Products.Lock()
+	defer inventorydb.DB.Products.Unlock()
+	product, created := warehouse.Upsert(inventorydb.DB.Products.Data, req)
+	checkLowStock("", req.ID)
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	log.Printf("Inventory Service: Product %s saved (created: %t, stock of %s: %d)", req.ID, created, req.WarehouseID, req.Available)
+	responses.WriteJSON(w, status, product)
+}
+
+// productAdminHandler serves POST /admin/products/{id}/adjust_stock and DELETE /admin/products/{id}.
+func productAdminHandler(w http.ResponseWriter, r *http.Request) {
+	id, action := warehouse.ProductPath(r.URL.Path)
+	switch {
+	case r.Method == http.MethodPost && action == "adjust_stock":
+		adjustStock(w, r, id)
+	case r.Method == http.MethodDelete && action == "":
+		deleteProduct(w, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// adjustStock changes the stock of a product by a signed delta.
+func adjustStock(w http.ResponseWriter, r *http.Request, id string) {
+	req, ok := warehouse.DecodeAdjustRequest(w, r)
+	if !ok {
+		return
+	}
+
+	inventorydb.DB.Products.Lock()
+	defer inventorydb.DB.Products.Unlock()
+	if _, ok := inventorydb.DB.Products.Data[id]; !ok {
+		responses.WriteNotFound(w, "product", id)
+		return
+	}
+	product, err := warehouse.Adjust(inventorydb.DB.Products.Data, id, req)
+	if err != nil {
+		responses.WriteError(w, http.StatusConflict, events.ReasonStockOutOfRange, "Adjustment rejected: "+err.Error())
+		return
+	}
+	checkLowStock("", id)
+	log.Printf("Inventory Service: Stock of %s adjusted by %d, now %d", id, req.Delta, product.Available)
+	responses.WriteJSON(w, http.StatusOK, product)
+}
+
+// deleteProduct removes a product from the catalog, unless an active reservation holds it.
+func deleteProduct(w http.ResponseWriter, id string) {
+	inventorydb.DB.Products.Lock()
+	defer inventorydb.DB.Products.Unlock()
+	if _, ok := inventorydb.DB.Products.Data[id]; !ok {
+		responses.WriteNotFound(w, "product", id)
+		return
+	}
+	if orders := reservedBy(id); len(orders) > 0 {
+		responses.WriteError(w, http.StatusConflict, events.ReasonProductReserved,
+			"Product "+id+" is reserved by orders "+strings.Join(orders, ", "))
+		return
+	}
+	delete(inventorydb.DB.Products.Data, id)
+	checkLowStock("", id)
+	log.Printf("Inventory Service: Product %s deleted", id)
+	responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Product deleted"})
+}
+
+// reservedBy returns the orders, sorted, whose reserved stock is not reverted yet holding the product. The caller holds the lock.
+func reservedBy(productID string) []string {
+	var orders []string
+	for orderID, alloc := range allocations {
+		if _, ok := alloc[productID]; ok {
+			orders = append(orders, orderID)
+		}
+	}
+	sort.Strings(orders)
+	return orders
+}
+
+// lowStockHandler lists the products currently below lowStockThreshold, by id.
+func lowStockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	low := []events.LowStockPayload{}
+	inventorydb.DB.Products.RLock()
+	for id, product := range inventorydb.DB.Products.Data {
+		if product.Available < lowStockThreshold {
+			low = append(low, events.LowStockPayload{ProductID: id, Available: product.Available, Threshold: lowStockThreshold})
+		}
+	}
+	inventorydb.DB.Products.RUnlock()
+	sort.Slice(low, func(i, j int) bool { return low[i].ProductID < low[j].ProductID })
+	responses.WriteJSON(w, http.StatusOK, low)
 }
 
 // getProductPricesHandler manages requests to obtain product prices
@@ -167,7 +486,7 @@ func getProductPricesHandler(w http.ResponseWriter, r *http.Request) {
 		_ = json.NewEncoder(w).Encode(map[string]float64{"price": price})
 		return
 	}
-	http.Error(w, "product not found", http.StatusNotFound)
+	responses.WriteNotFound(w, "product", productID)
 }
 
 // mapToStruct performs a generic conversion from an interface{} to struct via JSON.
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Every endpoint reading a product answers an unknown id with the shared 404 body.
+func TestUnknownProductNotFound(t *testing.T) {
+	newTestBus(t)
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+	}{
+		{name: "prices", handler: getProductPricesHandler, method: http.MethodGet, target: "/products/prices?id=bogus-id"},
+		{name: "warehouse stock", handler: warehouseStockHandler, method: http.MethodPost, target: "/admin/warehouses/stock",
+			body: `{"product_id":"bogus-id","warehouse_id":"wh-north","available":1}`},
+		{name: "adjust stock", handler: productAdminHandler, method: http.MethodPost, target: "/admin/products/bogus-id/adjust_stock", body: `{"delta":1}`},
+		{name: "delete", handler: productAdminHandler, method: http.MethodDelete, target: "/admin/products/bogus-id"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tc.handler(rec, httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body)))
+			var body events.NotFoundResponse
+			if rec.Code != http.StatusNotFound || json.NewDecoder(rec.Body).Decode(&body) != nil {
+				t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+			}
+			if body != (events.NotFoundResponse{Code: events.CodeNotFound, Resource: "product", ID: "bogus-id"}) {
+				t.Errorf("body = %+v", body)
+			}
+		})
+	}
+}
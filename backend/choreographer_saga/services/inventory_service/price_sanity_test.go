@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// A product priced out of the sanity bounds fails the reservation without taking any stock.
+func TestOrderCreatedInsanePrice(t *testing.T) {
+	for _, price := range []float64{0, -5, 1e9} {
+		t.Run(fmt.Sprint(price), func(t *testing.T) {
+			bus := newTestBus(t)
+			inventorydb.DB.Products.Lock()
+			p := inventorydb.DB.Products.Data["mouse-wireless"]
+			p.Price = price
+			inventorydb.DB.Products.Data["mouse-wireless"] = p
+			inventorydb.DB.Products.Unlock()
+			before := available("mouse-wireless")
+
+			event := events.NewGenericEvent(events.OrderCreatedEvent, "order-insane-price", "Order created", events.OrderCreatedPayload{
+				OrderID:    "order-insane-price",
+				CustomerID: "customer-1",
+				Items:      []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 1}},
+			})
+			if err := bus.Inject(event); err != nil {
+				t.Fatal(err)
+			}
+
+			failures := bus.PublishedOfType(events.InventoryReservationFailedEvent)
+			if len(failures) != 1 {
+				t.Fatalf("InventoryReservationFailed published %d times, want 1", len(failures))
+			}
+			var payload events.OrderStatusUpdatePayload
+			if err := mapToStruct(failures[0].Payload, &payload); err != nil {
+				t.Fatal(err)
+			}
+			if payload.ReasonCode != events.ReasonPriceSanity {
+				t.Errorf("reason code %q, want %s", payload.ReasonCode, events.ReasonPriceSanity)
+			}
+			if n := len(bus.PublishedOfType(events.InventoryReservedEvent)); n != 0 {
+				t.Errorf("InventoryReserved published %d times", n)
+			}
+			if got := available("mouse-wireless"); got != before {
+				t.Errorf("available = %d, want %d", got, before)
+			}
+		})
+	}
+}
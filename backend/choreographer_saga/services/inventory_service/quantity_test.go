@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/order_policy"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Orders with negative, zero or oversized quantities fail their reservation without touching
+// the stock, and a revert carrying a negative quantity cannot take stock away.
+func TestQuantityGuards(t *testing.T) {
+	bus := newTestBus(t)
+	before := available("mouse-wireless")
+
+	for quantity, reason := range map[int]string{
+		-3:                                  events.ReasonInvalidQuantity,
+		0:                                   events.ReasonInvalidQuantity,
+		order_policy.MaxQuantityPerItem + 1: events.ReasonQuantityExceeded,
+	} {
+		orderID := "qty-" + reason
+		if quantity < 0 {
+			orderID += "-negative"
+		}
+		if err := bus.Inject(events.NewGenericEvent(events.OrderCreatedEvent, orderID, "Order created", events.OrderCreatedPayload{
+			OrderID: orderID, Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: quantity}},
+		})); err != nil {
+			t.Fatal(err)
+		}
+		failed := bus.PublishedOfType(events.InventoryReservationFailedEvent)
+		var payload events.OrderStatusUpdatePayload
+		if len(failed) == 0 || mapToStruct(failed[len(failed)-1].Payload, &payload) != nil || payload.OrderID != orderID || payload.ReasonCode != reason {
+			t.Errorf("quantity %d: failure %+v, want %s", quantity, payload, reason)
+		}
+		if len(bus.PublishedOfType(events.InventoryReservedEvent)) != 0 {
+			t.Errorf("quantity %d reserved", quantity)
+		}
+	}
+
+	if err := bus.Inject(events.NewGenericEvent(events.RevertInventoryEvent, "qty-revert", "Reverting inventory", events.InventoryRequestPayload{
+		OrderID: "qty-revert", Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: -20}},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if got := available("mouse-wireless"); got != before {
+		t.Errorf("%d available, want %d", got, before)
+	}
+}
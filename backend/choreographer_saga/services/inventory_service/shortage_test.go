@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// InventoryReservationFailed lists every item short of stock, suggesting the quantity left when
+// there is some, and no stock is taken.
+func TestOrderCreatedShortages(t *testing.T) {
+	bus := newTestBus(t)
+	inventorydb.DB.Products.Lock()
+	for id, n := range map[string]int{"mouse-wireless": 0, "laptop-pro": 2} {
+		p := inventorydb.DB.Products.Data[id]
+		p.Available = n
+		inventorydb.DB.Products.Data[id] = p
+	}
+	inventorydb.DB.Products.Unlock()
+
+	if err := bus.Inject(events.NewGenericEvent(events.OrderCreatedEvent, "o-shortages", "Order created", events.OrderCreatedPayload{
+		OrderID: "o-shortages",
+		Items: []events.OrderItem{
+			{ProductID: "mouse-wireless", Quantity: 1},
+			{ProductID: "laptop-pro", Quantity: 5},
+			{ProductID: "mechanical-keyboard", Quantity: 1},
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	published := bus.PublishedOfType(events.InventoryReservationFailedEvent)
+	if len(published) != 1 {
+		t.Fatalf("published %v, want one reservation failure", bus.Published())
+	}
+	var payload events.OrderStatusUpdatePayload
+	if err := mapToStruct(published[0].Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	want := []events.StockShortage{
+		{ProductID: "mouse-wireless", Requested: 1, Available: 0},
+		{ProductID: "laptop-pro", Requested: 5, Available: 2, SuggestedQuantity: 2},
+	}
+	if payload.ReasonCode != events.ReasonInsufficientQty || len(payload.Shortages) != len(want) {
+		t.Fatalf("payload = %+v", payload)
+	}
+	for i, s := range want {
+		if payload.Shortages[i] != s {
+			t.Errorf("shortage %d = %+v, want %+v", i, payload.Shortages[i], s)
+		}
+	}
+	if available("laptop-pro") != 2 || available("mechanical-keyboard") != 200 {
+		t.Error("a failed reservation took stock")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"maps"
+	"testing"
+
+	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func warehouses(productID string) map[string]int {
+	inventorydb.DB.Products.RLock()
+	defer inventorydb.DB.Products.RUnlock()
+	return maps.Clone(inventorydb.DB.Products.Data[productID].Warehouses)
+}
+
+// A reservation no warehouse can fill alone is split, and its revert restores each warehouse
+// to its stock before the reservation.
+func TestReservationSplitAndRevert(t *testing.T) {
+	bus := newTestBus(t)
+	before := warehouses("mouse-wireless")
+
+	if err := bus.Inject(events.NewGenericEvent(events.OrderCreatedEvent, "o-split", "Order created", events.OrderCreatedPayload{
+		OrderID: "o-split", Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 35}},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if got := allocations["o-split"]["mouse-wireless"]; !maps.Equal(got, map[string]int{"wh-north": 20, "wh-south": 15}) {
+		t.Errorf("allocation = %v, want 20 from wh-north and 15 from wh-south", got)
+	}
+	if got := warehouses("mouse-wireless"); got["wh-north"] != 0 || got["wh-south"] != 15 {
+		t.Errorf("stock after the reservation = %v", got)
+	}
+
+	if err := bus.Inject(events.NewGenericEvent(events.RevertInventoryEvent, "o-split", "Reverting inventory",
+		events.InventoryRequestPayload{OrderID: "o-split"})); err != nil {
+		t.Fatal(err)
+	}
+	if got := warehouses("mouse-wireless"); !maps.Equal(got, before) {
+		t.Errorf("stock after the revert = %v, want %v", got, before)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// sagaSummary returns the SagaCompleted payload published for an order.
+func sagaSummary(t *testing.T, published []events.GenericEvent, orderID string) events.SagaCompletedPayload {
+	t.Helper()
+	for _, e := range published {
+		if e.OrderID != orderID {
+			continue
+		}
+		var summary events.SagaCompletedPayload
+		if err := mapToStruct(e.Payload, &summary); err != nil {
+			t.Fatal(err)
+		}
+		return summary
+	}
+	t.Fatalf("no SagaCompleted for %s", orderID)
+	return events.SagaCompletedPayload{}
+}
+
+// The window of a failed saga runs from the timestamp of the failure event to the terminal
+// status; an approved order has none.
+func TestCompensationLatency(t *testing.T) {
+	bus := newTestBus(t, "latency-failed", "latency-approved")
+	before := compensationLatency.Snapshot()["PAYMENT_FAILED"]
+
+	failed := events.NewGenericEvent(events.PaymentFailedEvent, "latency-failed", "Payment failed",
+		events.OrderStatusUpdatePayload{OrderID: "latency-failed", Reason: "declined", ReasonCode: events.ReasonGatewayDeclined})
+	failed.Timestamp = time.Now().Add(-2 * time.Second)
+	approved := events.NewGenericEvent(events.PaymentProcessedEvent, "latency-approved", "Payment successful",
+		events.PaymentPayload{OrderID: "latency-approved", Amount: 10})
+	for _, e := range []events.GenericEvent{failed, approved} {
+		if err := bus.Inject(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	completed := bus.PublishedOfType(events.SagaCompletedEvent)
+	if ms := sagaSummary(t, completed, "latency-failed").CompensationLatencyMs; ms < 2000 || ms > 3000 {
+		t.Errorf("failed saga compensation latency %dms, want about 2000ms", ms)
+	}
+	if ms := sagaSummary(t, completed, "latency-approved").CompensationLatencyMs; ms != 0 {
+		t.Errorf("approved saga compensation latency %dms, want none", ms)
+	}
+	after := compensationLatency.Snapshot()["PAYMENT_FAILED"]
+	if after.Count != before.Count+1 || after.Sum-before.Sum < 2000 {
+		t.Errorf("histogram went from %d observations summing %.0f to %d summing %.0f, want one more of about 2000",
+			before.Count, before.Sum, after.Count, after.Sum)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared"
+	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// withInventoryPrices points the price lookups at a stub pricing every product at price.
+func withInventoryPrices(t *testing.T, price float64) {
+	t.Helper()
+	inventory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]float64{"price": price})
+	}))
+	t.Cleanup(inventory.Close)
+	prevURL, prevLimit := inventoryServiceURL, paymentAmountLimit
+	inventoryServiceURL, paymentAmountLimit = inventory.URL, 500
+	t.Cleanup(func() { inventoryServiceURL, paymentAmountLimit = prevURL, prevLimit })
+}
+
+func postCreateOrder(body, language string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/create_order", strings.NewReader(body))
+	if language != "" {
+		req.Header.Set("Accept-Language", language)
+	}
+	rec := httptest.NewRecorder()
+	createOrderHandler(rec, req)
+	return rec
+}
+
+func storedOrders() int {
+	inventorydb.DB.Orders.RLock()
+	defer inventorydb.DB.Orders.RUnlock()
+	return len(inventorydb.DB.Orders.Data)
+}
+
+// Both failure paths answer with the error envelope and leave no pending order behind.
+func TestCreateOrderFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		product    string
+		quantity   int
+		publishErr error
+		language   string
+		code       int
+		reason     string
+		message    string
+	}{
+		{name: "over the payment limit", product: "limit-en", quantity: 6, code: http.StatusBadRequest,
+			reason: events.ReasonLimitExceeded, message: "The amount 600.00 exceeds the limit of 500.00"},
+		{name: "over the payment limit in Italian", product: "limit-it", quantity: 6, language: "it-IT,it;q=0.9", code: http.StatusBadRequest,
+			reason: events.ReasonLimitExceeded, message: "L'importo 600.00 supera il limite di 500.00"},
+		{name: "unsupported language", product: "limit-fr", quantity: 6, language: "fr", code: http.StatusBadRequest,
+			reason: events.ReasonLimitExceeded, message: "The amount 600.00 exceeds the limit of 500.00"},
+		{name: "publish failed", product: "publish", quantity: 1, publishErr: errors.New("broker unreachable"),
+			code: http.StatusServiceUnavailable, reason: events.ReasonPublishFailed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bus := newTestBus(t)
+			bus.PublishErr = tc.publishErr
+			withInventoryPrices(t, 100)
+
+			body := fmt.Sprintf(`{"customer_id":"customer-1","items":[{"product_id":%q,"quantity":%d}]}`, tc.product, tc.quantity)
+			rec := postCreateOrder(body, tc.language)
+			if rec.Code != tc.code {
+				t.Fatalf("answered %d, want %d: %s", rec.Code, tc.code, rec.Body)
+			}
+			var resp events.ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.ReasonCode != tc.reason || resp.Message == "" || (tc.message != "" && resp.Message != tc.message) {
+				t.Errorf("error = %+v, want %s %q", resp, tc.reason, tc.message)
+			}
+			if n := storedOrders(); n != 0 {
+				t.Errorf("%d orders left behind", n)
+			}
+		})
+	}
+}
+
+// An order whose event breaks the publisher quota answers 413 or 429 with the quota broken.
+func TestCreateOrderQuotaExceeded(t *testing.T) {
+	for _, quota := range []struct {
+		name string
+		code int
+	}{{"max_payload_bytes", http.StatusRequestEntityTooLarge}, {"max_events_per_second", http.StatusTooManyRequests}} {
+		bus := newTestBus(t)
+		bus.PublishErr = &shared.QuotaError{Publisher: "choreographer-order-service", Quota: quota.name, Limit: "10", Actual: "11"}
+		withInventoryPrices(t, 10)
+
+		rec := postCreateOrder(`{"customer_id":"customer-1","items":[{"product_id":"quota","quantity":1}]}`, "")
+		if rec.Code != quota.code {
+			t.Errorf("%s: answered %d, want %d", quota.name, rec.Code, quota.code)
+			continue
+		}
+		var resp struct {
+			ReasonCode string            `json:"reason_code"`
+			Quota      shared.QuotaError `json:"quota"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.ReasonCode != events.ReasonQuotaExceeded || resp.Quota.Quota != quota.name || resp.Quota.Limit != "10" {
+			t.Errorf("%s: answered %+v", quota.name, resp)
+		}
+		if n := storedOrders(); n != 0 {
+			t.Errorf("%s: %d orders left behind", quota.name, n)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared"
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared/testutil"
+	"github.com/StitchMl/saga-demo/common/analytics"
+	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// newTestBus subscribes the event handlers of the service to a fresh FakeBus, with one pending
+// order per id and nothing published yet.
+func newTestBus(t *testing.T, orderIDs ...string) *testutil.FakeBus {
+	t.Helper()
+	bus := testutil.NewFakeBus()
+	eventBus = bus
+	processed = shared.NewDedupe()
+	inventorydb.DB.Orders.Lock()
+	inventorydb.DB.Orders.Data = make(map[string]events.Order)
+	for _, id := range orderIDs {
+		inventorydb.DB.Orders.Data[id] = events.Order{
+			OrderID:    id,
+			CustomerID: "customer-1",
+			Items:      []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 1}},
+			Status:     "pending",
+			CreatedAt:  time.Now(),
+		}
+	}
+	inventorydb.DB.Orders.Unlock()
+	terminalPublished.Lock()
+	terminalPublished.Events = make(map[string]map[events.EventType]bool)
+	terminalPublished.Unlock()
+	recentOrders.Lock()
+	recentOrders.Entries = make(map[string]recentOrder)
+	recentOrders.Unlock()
+	subscribe(events.InventoryReservedEvent, handleInventoryReservedEvent)
+	subscribe(events.PaymentProcessedEvent, handleOrderApprovedEvent)
+	subscribe(events.PaymentFailedEvent, handlePaymentFailedEvent)
+	subscribe(events.InventoryReservationFailedEvent, handleInventoryReservationFailed)
+	return bus
+}
+
+// The end-of-saga events that failed to publish are published on redelivery, once each.
+func TestTerminalEventsRepublishedOnRedelivery(t *testing.T) {
+	bus := newTestBus(t, "order-approved", "order-rejected")
+	approved := events.NewGenericEvent(events.PaymentProcessedEvent, "order-approved", "Payment successful",
+		events.PaymentPayload{OrderID: "order-approved", CustomerID: "customer-1", Amount: 49.5})
+	rejected := events.NewGenericEvent(events.PaymentFailedEvent, "order-rejected", "Payment failed",
+		events.OrderStatusUpdatePayload{OrderID: "order-rejected", Reason: "card declined", ReasonCode: events.ReasonGatewayDeclined})
+
+	bus.PublishErr = errors.New("broker unreachable")
+	for _, e := range []events.GenericEvent{approved, rejected} {
+		if err := bus.Inject(e); err == nil {
+			t.Fatalf("%s handled although nothing could be published", e.Type)
+		}
+	}
+	bus.PublishErr = nil
+	for _, e := range []events.GenericEvent{approved, rejected, approved, rejected} {
+		if err := bus.Inject(e); err != nil {
+			t.Fatalf("redelivery of %s failed: %v", e.Type, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		eventType events.EventType
+		want      int
+	}{
+		{events.OrderApprovedEvent, 1},
+		{events.OrderRejectedEvent, 1},
+		{events.SagaCompletedEvent, 2},
+		{events.RevertInventoryEvent, 1},
+	} {
+		if got := len(bus.PublishedOfType(tc.eventType)); got != tc.want {
+			t.Errorf("%s published %d times, want %d", tc.eventType, got, tc.want)
+		}
+	}
+	if order, _ := inventorydb.GetOrder("order-approved"); order.Status != "approved" {
+		t.Errorf("order-approved status = %q", order.Status)
+	}
+	if order, _ := inventorydb.GetOrder("order-rejected"); order.Status != "rejected" {
+		t.Errorf("order-rejected status = %q", order.Status)
+	}
+}
+
+// Once published, the outcome of an order is not published again by a later event for it.
+func TestOutcomePublishedOnce(t *testing.T) {
+	bus := newTestBus(t, "order-once")
+	failed := func() events.GenericEvent {
+		return events.NewGenericEvent(events.InventoryReservationFailedEvent, "order-once", "Inventory reservation failed",
+			events.OrderStatusUpdatePayload{OrderID: "order-once", Reason: "out of stock", ReasonCode: events.ReasonInsufficientQty})
+	}
+	// Two distinct events, e.g. republished by the inventory after a failed acknowledgement.
+	for i := 0; i < 2; i++ {
+		if err := bus.Inject(failed()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(bus.PublishedOfType(events.OrderRejectedEvent)); got != 1 {
+		t.Errorf("OrderRejected published %d times, want 1", got)
+	}
+}
+
+// The reason code of a failed payment reaches the order and its status response.
+func TestPaymentFailureReasonInOrderStatus(t *testing.T) {
+	for _, code := range []string{events.ReasonLimitExceeded, events.ReasonGatewayDeclined, events.ReasonInjectedFailure} {
+		t.Run(code, func(t *testing.T) {
+			bus := newTestBus(t, "order-"+code)
+			failed := events.NewGenericEvent(events.PaymentFailedEvent, "order-"+code, "Payment failed",
+				events.OrderStatusUpdatePayload{OrderID: "order-" + code, Reason: "refused", ReasonCode: code, Total: 20})
+			if err := bus.Inject(failed); err != nil {
+				t.Fatal(err)
+			}
+
+			rec := httptest.NewRecorder()
+			getOrderHandler(rec, httptest.NewRequest(http.MethodGet, "/orders/order-"+code, nil))
+			var order events.Order
+			if err := json.NewDecoder(rec.Body).Decode(&order); err != nil {
+				t.Fatal(err)
+			}
+			if order.Status != "rejected" || order.ReasonCode != code {
+				t.Errorf("order = %s (%s), want rejected with %s", order.Status, order.ReasonCode, code)
+			}
+		})
+	}
+}
+
+// Each order gets one SagaCompleted event and one analytics summary, whatever the path to its
+// terminal status and however many events arrive after it.
+func TestSagaCompletedOncePerOrder(t *testing.T) {
+	bus := newTestBus(t, "saga-approved", "saga-payment-failed", "saga-out-of-stock")
+	summaries := make(chan string, 16)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var summary events.SagaCompletedPayload
+		_ = json.NewDecoder(r.Body).Decode(&summary)
+		summaries <- summary.OrderID
+	}))
+	defer webhook.Close()
+	analytics.Wait()
+	analytics.SetWebhookURL(webhook.URL)
+	defer analytics.SetWebhookURL("")
+
+	deliveries := []events.GenericEvent{
+		events.NewGenericEvent(events.PaymentProcessedEvent, "saga-approved", "Payment successful",
+			events.PaymentPayload{OrderID: "saga-approved", Amount: 10}),
+		events.NewGenericEvent(events.PaymentFailedEvent, "saga-payment-failed", "Payment failed",
+			events.OrderStatusUpdatePayload{OrderID: "saga-payment-failed", Reason: "declined", ReasonCode: events.ReasonGatewayDeclined}),
+		events.NewGenericEvent(events.InventoryReservationFailedEvent, "saga-out-of-stock", "Inventory reservation failed",
+			events.OrderStatusUpdatePayload{OrderID: "saga-out-of-stock", Reason: "out of stock", ReasonCode: events.ReasonInsufficientQty}),
+		// Outcomes published again by the payment service, e.g. on a redelivery of its own event
+		events.NewGenericEvent(events.PaymentProcessedEvent, "saga-approved", "Payment successful",
+			events.PaymentPayload{OrderID: "saga-approved", Amount: 10}),
+		events.NewGenericEvent(events.PaymentFailedEvent, "saga-payment-failed", "Payment failed",
+			events.OrderStatusUpdatePayload{OrderID: "saga-payment-failed", Reason: "declined", ReasonCode: events.ReasonGatewayDeclined}),
+	}
+	for _, e := range deliveries {
+		if err := bus.Inject(e); err != nil {
+			t.Fatalf("%s for %s: %v", e.Type, e.OrderID, err)
+		}
+	}
+
+	published := make(map[string]int)
+	for _, e := range bus.PublishedOfType(events.SagaCompletedEvent) {
+		published[e.OrderID]++
+	}
+	// Summaries are posted in the background.
+	analytics.Wait()
+	ids := []string{"saga-approved", "saga-payment-failed", "saga-out-of-stock"}
+	posted := make(map[string]int)
+	for len(summaries) > 0 {
+		posted[<-summaries]++
+	}
+	for _, id := range ids {
+		if published[id] != 1 || posted[id] != 1 {
+			t.Errorf("%s: SagaCompleted published %d times and posted %d times, want once", id, published[id], posted[id])
+		}
+	}
+}
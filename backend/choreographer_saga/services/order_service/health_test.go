@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared"
+)
+
+// A bus without a live RabbitMQ connection makes both probes answer 503.
+func TestProbesWithoutBroker(t *testing.T) {
+	defer func(bus *shared.EventBus) { rabbitBus = bus }(rabbitBus)
+	rabbitBus = &shared.EventBus{}
+
+	for path, handler := range map[string]http.HandlerFunc{"/health": healthHandler, "/ready": readyHandler} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusServiceUnavailable || rec.Body.Len() == 0 {
+			t.Errorf("%s answered %d %q, want 503 with a reason", path, rec.Code, rec.Body)
+		}
+	}
+}
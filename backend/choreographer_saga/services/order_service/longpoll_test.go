@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func pollOrder(id, query string) (int, events.Order) {
+	rec := httptest.NewRecorder()
+	getOrderHandler(rec, httptest.NewRequest(http.MethodGet, "/orders/"+id+query, nil))
+	var order events.Order
+	_ = json.NewDecoder(rec.Body).Decode(&order)
+	return rec.Code, order
+}
+
+// The long-polls parked on a pending order all answer with the new status as soon as the saga
+// moves it; without a change they answer 304 once the wait is over.
+func TestLongPollOrderStatus(t *testing.T) {
+	bus := newTestBus(t, "poll-order", "poll-idle")
+
+	if code, order := pollOrder("poll-order", "?wait=30s&since_status=created"); code != http.StatusOK || order.Status != "pending" {
+		t.Fatalf("answered %d %q for a status already different, want 200 pending at once", code, order.Status)
+	}
+	start := time.Now()
+	if code, _ := pollOrder("poll-idle", "?wait=50ms&since_status=pending"); code != http.StatusNotModified || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("answered %d after %s, want 304 once the wait is over", code, time.Since(start))
+	}
+
+	var wg sync.WaitGroup
+	statuses := make(chan string, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, order := pollOrder("poll-order", "?wait=5s&since_status=pending")
+			if code != http.StatusOK {
+				statuses <- http.StatusText(code)
+				return
+			}
+			statuses <- order.Status
+		}()
+	}
+	time.Sleep(50 * time.Millisecond) // let the requests park
+	failed := events.NewGenericEvent(events.PaymentFailedEvent, "poll-order", "Payment failed",
+		events.OrderStatusUpdatePayload{OrderID: "poll-order", Reason: "refused", ReasonCode: events.ReasonGatewayDeclined, Total: 20})
+	if err := bus.Inject(failed); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	close(statuses)
+	for status := range statuses {
+		if status != "rejected" {
+			t.Errorf("a waiter got %q, want the rejected order", status)
+		}
+	}
+}
@@ -2,16 +2,34 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/StitchMl/saga-demo/choreographer_saga/shared"
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/analytics"
+	"github.com/StitchMl/saga-demo/common/buildinfo"
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/correlation"
 	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	"github.com/StitchMl/saga-demo/common/diagnostics"
+	"github.com/StitchMl/saga-demo/common/graceful"
+	"github.com/StitchMl/saga-demo/common/idgen"
+	"github.com/StitchMl/saga-demo/common/longpoll"
+	"github.com/StitchMl/saga-demo/common/maintenance"
+	"github.com/StitchMl/saga-demo/common/metrics"
+	"github.com/StitchMl/saga-demo/common/order_policy"
+	"github.com/StitchMl/saga-demo/common/ordernotes"
+	"github.com/StitchMl/saga-demo/common/responses"
 	events "github.com/StitchMl/saga-demo/common/types"
 )
 
@@ -21,10 +39,48 @@ const (
 )
 
 var (
-	eventBus           *shared.EventBus
-	paymentAmountLimit float64
+	// eventBus is used by the handlers; rabbitBus is the same bus, for health and admin endpoints.
+	eventBus            shared.Bus
+	rabbitBus           *shared.EventBus
+	paymentAmountLimit  float64
+	inventoryServiceURL string
+	priceCacheTTL       = 30 * time.Second
+	duplicateWindow     = 10 * time.Second
 )
 
+const (
+	// Attempts of a price lookup when the inventory service fails, and the first wait between them (doubled each time)
+	priceFetchAttempts = 3
+	priceFetchBackoff  = 200 * time.Millisecond
+	// Retry-After, in seconds, sent when the inventory service is unavailable
+	inventoryRetryAfter = "5"
+	// Retry-After, in seconds, sent when the event bus is still reconnecting to RabbitMQ
+	eventBusRetryAfter = "5"
+)
+
+// Prices fetched from the inventory service, which owns the catalog, keyed by ProductID
+var priceCache = struct {
+	sync.RWMutex
+	Entries map[string]cachedPrice
+}{Entries: make(map[string]cachedPrice)}
+
+type cachedPrice struct {
+	Price   float64
+	Expires time.Time
+}
+
+// Recent order submissions keyed by customer and items, so a retry of the same order
+// within duplicateWindow gets the first order back instead of creating a second one.
+var recentOrders = struct {
+	sync.Mutex
+	Entries map[string]recentOrder
+}{Entries: make(map[string]recentOrder)}
+
+type recentOrder struct {
+	OrderID string // empty while the first submission is still running
+	Expires time.Time
+}
+
 func main() {
 	// Initialise the global data store
 	inventorydb.InitDB()
@@ -45,37 +101,135 @@ func main() {
 		log.Fatalf("Invalid PAYMENT_AMOUNT_LIMIT: %v", err)
 	}
 
-	eventBus, err = shared.NewEventBus(rabbitMQURL)
+	inventoryServiceURL = os.Getenv("INVENTORY_SERVICE_URL")
+	if inventoryServiceURL == "" {
+		log.Fatal("INVENTORY_SERVICE_URL not set")
+	}
+	if v := os.Getenv("PRICE_CACHE_TTL_SECONDS"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			log.Fatalf("Invalid PRICE_CACHE_TTL_SECONDS: %q", v)
+		}
+		priceCacheTTL = time.Duration(secs) * time.Second
+	}
+	if v := os.Getenv("DUPLICATE_ORDER_WINDOW_SECONDS"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			log.Fatalf("Invalid DUPLICATE_ORDER_WINDOW_SECONDS: %q", v)
+		}
+		duplicateWindow = time.Duration(secs) * time.Second
+	}
+
+	config.Set("ORDER_SERVICE_PORT", port)
+	config.Set("PAYMENT_AMOUNT_LIMIT", paymentAmountLimit)
+	config.Set("INVENTORY_SERVICE_URL", inventoryServiceURL)
+	config.Set("PRICE_CACHE_TTL_SECONDS", priceCacheTTL)
+	config.Set("DUPLICATE_ORDER_WINDOW_SECONDS", duplicateWindow)
+
+	rabbitBus, err = shared.NewEventBus(rabbitMQURL)
 	if err != nil {
 		log.Fatalf("Unable to create EventBus: %v", err)
 	}
-	defer eventBus.Close()
+	eventBus = rabbitBus
+
+	rabbitBus.Produces(events.OrderCreatedEvent, events.RevertInventoryEvent, events.SagaCompletedEvent,
+		events.OrderApprovedEvent, events.OrderRejectedEvent)
 
 	// Subscriptions
+	subscribe(events.InventoryReservedEvent, handleInventoryReservedEvent)
 	subscribe(events.PaymentProcessedEvent, handleOrderApprovedEvent)
 	subscribe(events.PaymentFailedEvent, handlePaymentFailedEvent)
 	subscribe(events.InventoryReservationFailedEvent, handleInventoryReservationFailed)
+	rabbitBus.StartVerifier()
 
 	// REST endpoints
-	http.HandleFunc("/create_order", createOrderHandler)
+	http.HandleFunc("/create_order", maintenance.Guard(correlation.Middleware(createOrderHandler)))
 	http.HandleFunc("/orders/", getOrderHandler)
 	http.HandleFunc("/orders", listOrdersHandler)
-	http.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("Choreographer Order Service OK"))
-	})
+	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/ready", readyHandler)
+	http.HandleFunc("/version", buildinfo.Handler("choreographer-order-service"))
+	http.HandleFunc("/debug/subscriptions", rabbitBus.SubscriptionsHandler)
+	http.HandleFunc("/debug/topology", rabbitBus.TopologyHandler)
+	http.HandleFunc("/debug/quotas", rabbitBus.QuotaHandler)
+	http.HandleFunc("/debug/pending", rabbitBus.PendingHandler)
+	http.HandleFunc("/stats", statsHandler)
+	http.HandleFunc("/failed_deliveries", adminauth.Require(rabbitBus.FailedDeliveriesHandler))
+	http.HandleFunc("/failed_deliveries/redeliver", adminauth.Require(rabbitBus.RedeliverHandler))
+	http.HandleFunc("/admin/replay/", adminauth.Require(rabbitBus.ReplayHandler))
+	diagnostics.Publish("event_bus_queue_depths", func() interface{} { return rabbitBus.QueueDepths() })
+	diagnostics.Publish("compensation_latency_ms", func() interface{} { return compensationLatency.Snapshot() })
+	http.HandleFunc("/debug/config", adminauth.Require(config.Handler))
+	http.HandleFunc("/maintenance", maintenance.StatusHandler)
+	http.HandleFunc("/admin/maintenance", adminauth.Require(maintenance.AdminHandler))
 
 	log.Printf("Choreographer Order Service listening on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	// On SIGTERM the consumers stop and the events being handled are allowed to finish
+	if err := graceful.ListenAndServe(":"+port, diagnostics.Handler(http.DefaultServeMux), rabbitBus.Shutdown); err != nil {
+		log.Fatal(err)
+	}
 }
 
+// processed skips the events already handled, e.g. redelivered by RabbitMQ
+var processed = shared.NewDedupe()
+
 // subscribe: utility to subscribe to events with error handling
 func subscribe(t events.EventType, h shared.EventHandler) {
-	if err := eventBus.Subscribe(t, h); err != nil {
+	err := eventBus.Subscribe(t, processed.Once(string(t), h), shared.Durable(),
+		shared.OnStarted(func() { setConsumerStopped(t, nil) }),
+		shared.OnStopped(func(err error) {
+			log.Printf("Order Service: consumer for %s stopped: %v", t, err)
+			setConsumerStopped(t, err)
+		}),
+	)
+	if err != nil {
 		log.Fatalf("Subscription error %s: %v", t, err)
 	}
 }
 
+// Consumers whose delivery stream has ended, keyed by event type
+var stoppedConsumers = struct {
+	sync.RWMutex
+	Errors map[events.EventType]error
+}{Errors: make(map[events.EventType]error)}
+
+// setConsumerStopped records (err != nil) or clears (err == nil) a stopped consumer.
+func setConsumerStopped(t events.EventType, err error) {
+	stoppedConsumers.Lock()
+	defer stoppedConsumers.Unlock()
+	if err == nil {
+		delete(stoppedConsumers.Errors, t)
+		return
+	}
+	stoppedConsumers.Errors[t] = err
+}
+
+// healthHandler: reports 503 when the RabbitMQ connection is gone
+func healthHandler(w http.ResponseWriter, _ *http.Request) {
+	if !rabbitBus.Healthy() {
+		http.Error(w, "RabbitMQ connection lost", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("Choreographer Order Service OK"))
+}
+
+// readyHandler: reports 503 while the event bus subscriptions cannot be verified
+func readyHandler(w http.ResponseWriter, _ *http.Request) {
+	if ok, reason := rabbitBus.Ready(); !ok {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	stoppedConsumers.RLock()
+	defer stoppedConsumers.RUnlock()
+	for t, err := range stoppedConsumers.Errors {
+		http.Error(w, fmt.Sprintf("consumer for %s stopped: %v", t, err), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("Choreographer Order Service ready"))
+}
+
 // listOrdersHandler: returns all orders
 func listOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	cid := r.URL.Query().Get("customer_id")
@@ -93,56 +247,136 @@ func listOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(out)
 }
 
-// getOrderHandler: retrieves a single order
+// statusChanges: wakes up the long-poll requests of GET /orders/{id}
+var statusChanges = longpoll.NewNotifier()
+
+// notesHandler: serves the support notes of /orders/{id}/notes
+var notesHandler = adminauth.Require(ordernotes.Handler(func(id string) bool {
+	_, ok := inventorydb.GetOrder(id)
+	return ok
+}))
+
+// getOrderHandler: retrieves a single order, long-polling with ?wait=30s&since_status=pending,
+// with the notes on ?include=notes
 func getOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := ordernotes.IsNotesPath(r.URL.Path); ok {
+		notesHandler(w, r)
+		return
+	}
 	id := strings.TrimPrefix(r.URL.Path, "/orders/")
-	inventorydb.DB.Orders.RLock()
-	defer inventorydb.DB.Orders.RUnlock()
-	if order, ok := inventorydb.DB.Orders.Data[id]; ok {
-		w.Header().Set(contentType, contentTypeJSON)
-		_ = json.NewEncoder(w).Encode(order)
+	wait, since, err := longpoll.Params(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, events.ReasonInvalidRequest)
 		return
 	}
-	http.Error(w, "order not found", http.StatusNotFound)
+	order, ok := inventorydb.GetOrder(id)
+	if !ok {
+		responses.WriteNotFound(w, "order", id)
+		return
+	}
+	if wait > 0 && order.Status == since {
+		changed, err := statusChanges.WaitFor(r.Context(), id, wait, func() bool {
+			order, _ = inventorydb.GetOrder(id)
+			return order.Status != since
+		})
+		if err != nil {
+			http.Error(w, "too many requests waiting for this order", http.StatusTooManyRequests)
+			return
+		}
+		if !changed {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set(contentType, contentTypeJSON)
+	if ordernotes.Included(r) {
+		_ = json.NewEncoder(w).Encode(ordernotes.OrderDetail{Order: order, Notes: ordernotes.List(id)})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(order)
 }
 
 // createOrderHandler: create the PENDING order and publish the Saga start event.
 func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, events.ReasonMethodNotAllowed)
 		return
 	}
 
 	var order events.Order
 	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, events.ReasonInvalidRequest)
 		return
 	}
+	if v := order_policy.ValidateItems(order.Items); v != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, v.ReasonCode, v.Args...)
+		return
+	}
+
+	key := orderFingerprint(order)
+	orderID, inProgress := claimRecentOrder(key)
+	if inProgress {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, http.StatusConflict, events.ReasonInProgress)
+		return
+	}
+	if orderID != "" {
+		log.Printf("Order Service: Duplicate submission for customer %s, returning order %s", order.CustomerID, orderID)
+		writeOrderAccepted(w, orderID)
+		return
+	}
+	created := false
+	defer func() {
+		if !created {
+			releaseRecentOrder(key)
+		}
+	}()
 
-	// Synchronous pre-check: calculate total and check against payment limit
+	// Synchronous pre-check: calculate total and check against payment limit. Prices are needed for
+	// the limit, so unlike the orchestrated flow the order is refused while the inventory is down.
 	var totalAmount float64
+	var unknown []string
 	for _, item := range order.Items {
-		price, ok := inventorydb.GetProductPrice(item.ProductID)
+		price, ok, err := fetchProductPrice(item.ProductID)
+		if err != nil {
+			log.Printf("Order Service: Price lookup for %s failed: %v", item.ProductID, err)
+			w.Header().Set("Retry-After", inventoryRetryAfter)
+			writeError(w, r, http.StatusServiceUnavailable, events.ReasonInventoryDown)
+			return
+		}
 		if !ok {
-			http.Error(w, "Product price not found for "+item.ProductID, http.StatusBadRequest)
+			if !containsString(unknown, item.ProductID) {
+				unknown = append(unknown, item.ProductID)
+			}
+			continue
+		}
+		if v := order_policy.CheckPrice(item.ProductID, price); v != nil {
+			writeError(w, r, http.StatusUnprocessableEntity, v.ReasonCode, v.Args...)
 			return
 		}
 		totalAmount += price * float64(item.Quantity)
 	}
+	if len(unknown) > 0 {
+		writeUnknownProducts(w, r, unknown)
+		return
+	}
 
 	if totalAmount > paymentAmountLimit {
-		reason := fmt.Sprintf("The amount %.2f exceeds the limit of %.2f", totalAmount, paymentAmountLimit)
-		w.Header().Set(contentType, contentTypeJSON)
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(map[string]string{"message": reason})
+		writeError(w, r, http.StatusBadRequest, events.ReasonLimitExceeded, totalAmount, paymentAmountLimit)
 		return
 	}
 
-	order.OrderID = fmt.Sprintf("order-%d", time.Now().UnixNano())
 	order.Status = "pending"
+	order.CreatedAt = time.Now()
+	// Estimated from the pre-check prices; the inventory's total replaces it once the stock is reserved
+	order.Total = totalAmount
 
 	// *** WRITING in the shared data store ***
 	inventorydb.DB.Orders.Lock()
+	order.OrderID = idgen.NewUnique(idgen.FlowChoreographed, func(id string) bool {
+		_, ok := inventorydb.DB.Orders.Data[id]
+		return ok
+	})
 	inventorydb.DB.Orders.Data[order.OrderID] = order
 	inventorydb.DB.Orders.Unlock()
 
@@ -152,39 +386,263 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 		CustomerID: order.CustomerID,
 	}
 
-	if err := eventBus.Publish(
-		events.NewGenericEvent(events.OrderCreatedEvent, order.OrderID, "New order created", payload),
-	); err != nil {
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+	event := events.NewGenericEvent(events.OrderCreatedEvent, order.OrderID, "New order created", payload)
+	event.CorrelationID = correlation.FromContext(r.Context())
+	if err := shared.PublishRetry(eventBus, event); err != nil {
+		// Without the OrderCreated event no service would ever move the order out of
+		// "pending", so the record is rolled back instead of being left behind.
+		log.Printf("Order Service: Failed to publish OrderCreatedEvent for order %s, rolling back: %v", order.OrderID, err)
+		inventorydb.DB.Orders.Lock()
+		delete(inventorydb.DB.Orders.Data, order.OrderID)
+		inventorydb.DB.Orders.Unlock()
+		var quotaErr *shared.QuotaError
+		if errors.As(err, &quotaErr) {
+			w.Header().Set(contentType, contentTypeJSON)
+			w.WriteHeader(quotaErr.StatusCode())
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"reason_code": events.ReasonQuotaExceeded,
+				"message":     quotaErr.Error(),
+				"quota":       quotaErr,
+			})
+			return
+		}
+		if errors.Is(err, shared.ErrDisconnected) {
+			w.Header().Set("Retry-After", eventBusRetryAfter)
+		}
+		writeError(w, r, http.StatusServiceUnavailable, events.ReasonPublishFailed)
 		return
 	}
 
+	created = true
+	completeRecentOrder(key, order.OrderID)
+	writeOrderAccepted(w, order.OrderID)
+}
+
+// writeOrderAccepted writes the 202 response of an order whose saga was started.
+func writeOrderAccepted(w http.ResponseWriter, orderID string) {
+	w.Header().Set(contentType, contentTypeJSON)
 	w.WriteHeader(http.StatusAccepted)
 	_ = json.NewEncoder(w).Encode(map[string]string{
 		"message":  "Order received, SAGA initiated",
-		"order_id": order.OrderID,
+		"order_id": orderID,
 	})
 }
 
+// orderFingerprint identifies an order by customer and items, regardless of the item order.
+func orderFingerprint(order events.Order) string {
+	parts := make([]string, 0, len(order.Items))
+	for _, item := range order.Items {
+		parts = append(parts, fmt.Sprintf("%s:%d", item.ProductID, item.Quantity))
+	}
+	sort.Strings(parts)
+	return order.CustomerID + "|" + strings.Join(parts, ",")
+}
+
+// claimRecentOrder returns the order already created for key within duplicateWindow, or reports
+// that a submission for key is still running. Otherwise it claims key for the caller.
+func claimRecentOrder(key string) (orderID string, inProgress bool) {
+	recentOrders.Lock()
+	defer recentOrders.Unlock()
+	now := time.Now()
+	for k, e := range recentOrders.Entries {
+		if e.OrderID != "" && now.After(e.Expires) {
+			delete(recentOrders.Entries, k)
+		}
+	}
+	if e, ok := recentOrders.Entries[key]; ok {
+		return e.OrderID, e.OrderID == ""
+	}
+	recentOrders.Entries[key] = recentOrder{}
+	return "", false
+}
+
+// completeRecentOrder records the order created for a claimed key.
+func completeRecentOrder(key, orderID string) {
+	if duplicateWindow <= 0 {
+		releaseRecentOrder(key)
+		return
+	}
+	recentOrders.Lock()
+	recentOrders.Entries[key] = recentOrder{OrderID: orderID, Expires: time.Now().Add(duplicateWindow)}
+	recentOrders.Unlock()
+}
+
+// releaseRecentOrder drops the claim of a submission that did not create an order.
+func releaseRecentOrder(key string) {
+	recentOrders.Lock()
+	delete(recentOrders.Entries, key)
+	recentOrders.Unlock()
+}
+
+// fetchProductPrice returns the price of a product from the inventory service, using a short-lived cache.
+// ok is false when the inventory service does not know the product.
+func fetchProductPrice(productID string) (price float64, ok bool, err error) {
+	priceCache.RLock()
+	entry, cached := priceCache.Entries[productID]
+	priceCache.RUnlock()
+	if cached && time.Now().Before(entry.Expires) {
+		return entry.Price, true, nil
+	}
+
+	backoff := priceFetchBackoff
+	for attempt := 1; ; attempt++ {
+		price, ok, err = requestProductPrice(productID)
+		if err == nil || attempt == priceFetchAttempts {
+			break
+		}
+		log.Printf("Order Service: Price lookup for %s failed (attempt %d/%d), retrying in %s: %v", productID, attempt, priceFetchAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	if err != nil || !ok {
+		return price, ok, err
+	}
+
+	priceCache.Lock()
+	priceCache.Entries[productID] = cachedPrice{Price: price, Expires: time.Now().Add(priceCacheTTL)}
+	priceCache.Unlock()
+	return price, true, nil
+}
+
+// requestProductPrice makes a single price request to the inventory service.
+func requestProductPrice(productID string) (price float64, ok bool, err error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(inventoryServiceURL + "/products/prices?id=" + url.QueryEscape(productID))
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return 0, false, nil
+	default:
+		return 0, false, fmt.Errorf("inventory service responded with status %d", resp.StatusCode)
+	}
+	var body struct {
+		Price float64 `json:"price"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, false, fmt.Errorf("decode price: %w", err)
+	}
+	return body.Price, true, nil
+}
+
+// errorMessages holds the localized texts of the error responses, keyed by language and reason code.
+var errorMessages = map[string]map[string]string{
+	"en": {
+		events.ReasonMethodNotAllowed: "Only POST allowed",
+		events.ReasonInvalidRequest:   "Invalid request",
+		events.ReasonUnknownProduct:   "Unknown products: %s",
+		events.ReasonLimitExceeded:    "The amount %.2f exceeds the limit of %.2f",
+		events.ReasonPublishFailed:    "The order could not be submitted, please try again later",
+		events.ReasonTooManyItems:     "The order has %d items, the maximum is %d",
+		events.ReasonInvalidQuantity:  "Invalid quantity %d for product %s",
+		events.ReasonQuantityExceeded: "Quantity %d for product %s exceeds the maximum of %d",
+		events.ReasonInventoryDown:    "Prices are temporarily unavailable, please try again later",
+		events.ReasonPriceSanity:      "Price %.2f of product %s is outside the allowed range %.2f-%.2f",
+		events.ReasonInProgress:       "The same order is already being submitted, please wait",
+	},
+	"it": {
+		events.ReasonMethodNotAllowed: "Solo POST consentito",
+		events.ReasonInvalidRequest:   "Richiesta non valida",
+		events.ReasonUnknownProduct:   "Prodotti sconosciuti: %s",
+		events.ReasonLimitExceeded:    "L'importo %.2f supera il limite di %.2f",
+		events.ReasonPublishFailed:    "Impossibile inviare l'ordine, riprovare più tardi",
+		events.ReasonTooManyItems:     "L'ordine contiene %d articoli, il massimo è %d",
+		events.ReasonInvalidQuantity:  "Quantità %d non valida per il prodotto %s",
+		events.ReasonQuantityExceeded: "La quantità %d per il prodotto %s supera il massimo di %d",
+		events.ReasonInventoryDown:    "Prezzi temporaneamente non disponibili, riprovare più tardi",
+		events.ReasonPriceSanity:      "Il prezzo %.2f del prodotto %s è fuori dall'intervallo consentito %.2f-%.2f",
+		events.ReasonInProgress:       "Lo stesso ordine è già in fase di invio, attendere",
+	},
+}
+
+// messageLanguage picks the first language of Accept-Language that has translations, English otherwise.
+func messageLanguage(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		lang := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if _, ok := errorMessages[lang]; ok {
+			return lang
+		}
+	}
+	return "en"
+}
+
+// writeError: writes the JSON error envelope with a localized message
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, args ...interface{}) {
+	msg := fmt.Sprintf(errorMessages[messageLanguage(r)][code], args...)
+	w.Header().Set(contentType, contentTypeJSON)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(events.ErrorResponse{
+		ReasonCode: code,
+		Message:    msg,
+	})
+}
+
+// writeUnknownProducts: writes the 422 error envelope listing every unknown product id
+func writeUnknownProducts(w http.ResponseWriter, r *http.Request, ids []string) {
+	msg := fmt.Sprintf(errorMessages[messageLanguage(r)][events.ReasonUnknownProduct], strings.Join(ids, ", "))
+	w.Header().Set(contentType, contentTypeJSON)
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(events.ErrorResponse{
+		ReasonCode:      events.ReasonUnknownProduct,
+		Message:         msg,
+		UnknownProducts: ids,
+	})
+}
+
+// containsString reports whether s is in list.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// handleInventoryReservedEvent: records the total computed by the inventory, whatever the outcome of the payment
+func handleInventoryReservedEvent(event events.GenericEvent) error {
+	var payload events.InventoryRequestPayload
+	if err := mapToStruct(event.Payload, &payload); err != nil {
+		correlation.Logf(event.CorrelationID, "Order Service: Payload error InventoryReservedEvent: %v", err)
+		return shared.Permanent(err)
+	}
+	if payload.Amount <= 0 {
+		return nil
+	}
+	inventorydb.DB.Orders.Lock()
+	defer inventorydb.DB.Orders.Unlock()
+	if order, ok := inventorydb.DB.Orders.Data[payload.OrderID]; ok {
+		order.Total = payload.Amount
+		inventorydb.DB.Orders.Data[payload.OrderID] = order
+	}
+	return nil
+}
+
 // handleOrderApprovedEvent: update status -> approved
-func handleOrderApprovedEvent(event events.GenericEvent) {
+func handleOrderApprovedEvent(event events.GenericEvent) error {
 	var payload events.PaymentPayload
 	if err := mapToStruct(event.Payload, &payload); err != nil {
-		log.Printf("Order Service: Payload error OrderApprovedEvent: %v", err)
-		return
+		correlation.Logf(event.CorrelationID, "Order Service: Payload error OrderApprovedEvent: %v", err)
+		return shared.Permanent(err)
 	}
-	updateOrderStatus(payload.OrderID, "approved", "Payment successful", &payload.Amount)
+	order, terminal := updateOrderStatus(payload.OrderID, "approved", "Payment successful", "", &payload.Amount)
+	return finishSaga(order, terminal, []string{"ORDER_CREATED", "INVENTORY_RESERVED", "PAYMENT_PROCESSED"}, nil, time.Time{})
 }
 
 // handlePaymentFailedEvent: update status to rejected and trigger compensation
-func handlePaymentFailedEvent(event events.GenericEvent) {
+func handlePaymentFailedEvent(event events.GenericEvent) error {
 	var payload events.OrderStatusUpdatePayload
 	if err := mapToStruct(event.Payload, &payload); err != nil {
-		log.Printf("Order Service: Payload error for PaymentFailedEvent: %v", err)
-		return
+		correlation.Logf(event.CorrelationID, "Order Service: Payload error for PaymentFailedEvent: %v", err)
+		return shared.Permanent(err)
 	}
-	log.Printf("Order Service: Received PaymentFailedEvent for order %s. Reason: %s", payload.OrderID, payload.Reason)
-	updateOrderStatus(payload.OrderID, "rejected", payload.Reason, &payload.Total)
+	correlation.Logf(event.CorrelationID, "Order Service: Received PaymentFailedEvent for order %s. Reason: %s (%s)", payload.OrderID, payload.Reason, payload.ReasonCode)
+	order, terminal := updateOrderStatus(payload.OrderID, "rejected", payload.Reason, payload.ReasonCode, &payload.Total)
 
 	// Trigger inventory compensation
 	if order, ok := inventorydb.GetOrder(payload.OrderID); ok {
@@ -193,39 +651,156 @@ func handlePaymentFailedEvent(event events.GenericEvent) {
 			Items:   order.Items,
 			Reason:  "Payment failed, reverting inventory reservation.",
 		}
+		// On failure the event is requeued; a repeated revert is a no-op for the inventory.
 		if err := eventBus.Publish(events.NewGenericEvent(events.RevertInventoryEvent, order.OrderID, "Reverting inventory", revertPayload)); err != nil {
-			log.Printf("Order Service: Failed to publish RevertInventoryEvent for order %s: %v", order.OrderID, err)
+			correlation.Logf(event.CorrelationID, "Order Service: Failed to publish RevertInventoryEvent for order %s: %v", order.OrderID, err)
+			return fmt.Errorf("publish %s: %w", events.RevertInventoryEvent, err)
 		}
 	}
+	return finishSaga(order, terminal, []string{"ORDER_CREATED", "INVENTORY_RESERVED", "PAYMENT_FAILED"}, []string{"REVERT_INVENTORY"}, event.Timestamp)
 }
 
 // handleInventoryReservationFailed: update status → rejected
-func handleInventoryReservationFailed(event events.GenericEvent) {
+func handleInventoryReservationFailed(event events.GenericEvent) error {
 	var payload events.OrderStatusUpdatePayload
 	if err := mapToStruct(event.Payload, &payload); err != nil {
-		log.Printf("Order Service: Payload error for InventoryReservationFailedEvent: %v", err)
-		return
+		correlation.Logf(event.CorrelationID, "Order Service: Payload error for InventoryReservationFailedEvent: %v", err)
+		return shared.Permanent(err)
 	}
-	log.Printf("Order Service: Received InventoryReservationFailedEvent for order %s. Reason: %s", payload.OrderID, payload.Reason)
-	updateOrderStatus(payload.OrderID, "rejected", payload.Reason, &payload.Total)
+	correlation.Logf(event.CorrelationID, "Order Service: Received InventoryReservationFailedEvent for order %s. Reason: %s", payload.OrderID, payload.Reason)
+	if len(payload.Shortages) > 0 {
+		inventorydb.DB.Orders.Lock()
+		if order, ok := inventorydb.DB.Orders.Data[payload.OrderID]; ok {
+			order.Shortages = payload.Shortages
+			inventorydb.DB.Orders.Data[payload.OrderID] = order
+		}
+		inventorydb.DB.Orders.Unlock()
+	}
+	order, terminal := updateOrderStatus(payload.OrderID, "rejected", payload.Reason, payload.ReasonCode, &payload.Total)
+	return finishSaga(order, terminal, []string{"ORDER_CREATED", "INVENTORY_RESERVATION_FAILED"}, nil, event.Timestamp)
+}
+
+// isTerminal: reports whether an order status ends the saga
+func isTerminal(status string) bool {
+	return status == "approved" || status == "rejected"
 }
 
 // updateOrderStatus is a helper to change the order status in the DB.
-func updateOrderStatus(orderID, status, reason string, total *float64) {
+// It returns the updated order and whether this update moved it into a terminal status.
+func updateOrderStatus(orderID, status, reason, reasonCode string, total *float64) (events.Order, bool) {
 	inventorydb.DB.Orders.Lock()
 	defer inventorydb.DB.Orders.Unlock()
 
-	if order, exists := inventorydb.DB.Orders.Data[orderID]; exists {
-		order.Status = status
-		order.Reason = reason // Store the reason
-		if total != nil {
-			order.Total = *total
-		}
-		inventorydb.DB.Orders.Data[orderID] = order
-		log.Printf("Order Service: Order %s status updated to %s. Reason: %s", orderID, status, reason)
-	} else {
+	order, exists := inventorydb.DB.Orders.Data[orderID]
+	if !exists {
 		log.Printf("Order Service: Order %s not found for status update.", orderID)
+		return order, false
+	}
+	wasTerminal := isTerminal(order.Status)
+	order.Status = status
+	order.Reason = reason // Store the reason
+	order.ReasonCode = reasonCode
+	// A zero total from a failure event must not erase the one recorded at reservation time
+	if total != nil && *total > 0 {
+		order.Total = *total
+	}
+	inventorydb.DB.Orders.Data[orderID] = order
+	statusChanges.Notify(orderID)
+	log.Printf("Order Service: Order %s status updated to %s. Reason: %s", orderID, status, reason)
+	return order, !wasTerminal && isTerminal(status)
+}
+
+// Terminal events already published, by order, so a redelivered event publishes only those whose
+// publication failed
+var terminalPublished = struct {
+	sync.Mutex
+	Events map[string]map[events.EventType]bool
+}{Events: make(map[string]map[events.EventType]bool)}
+
+// publishTerminal: publishes an end-of-saga event of an order unless it was already published
+func publishTerminal(orderID string, t events.EventType, details string, payload events.EventPayload) error {
+	terminalPublished.Lock()
+	defer terminalPublished.Unlock()
+	if terminalPublished.Events[orderID][t] {
+		return nil
+	}
+	if err := eventBus.Publish(events.NewGenericEvent(t, orderID, details, payload)); err != nil {
+		log.Printf("Order Service: Failed to publish %s for order %s: %v", t, orderID, err)
+		return fmt.Errorf("publish %s: %w", t, err)
+	}
+	if terminalPublished.Events[orderID] == nil {
+		terminalPublished.Events[orderID] = make(map[events.EventType]bool)
+	}
+	terminalPublished.Events[orderID][t] = true
+	return nil
+}
+
+// finishSaga: publishes the outcome and the summary of an order in a terminal status. terminal
+// tells whether the event just moved it there; otherwise, e.g. on a redelivery after a failed
+// publication, only the events not published yet are. The error requeues the event.
+func finishSaga(order events.Order, terminal bool, steps, compensations []string, failedAt time.Time) error {
+	if !isTerminal(order.Status) {
+		return nil
+	}
+	if err := publishOrderOutcome(order); err != nil {
+		return err
+	}
+	return emitSagaCompleted(order, terminal, steps, compensations, failedAt)
+}
+
+// publishOrderOutcome: publishes OrderApproved or OrderRejected for an order in its terminal status
+func publishOrderOutcome(order events.Order) error {
+	eventType, details := events.OrderApprovedEvent, "Order approved"
+	if order.Status != "approved" {
+		eventType, details = events.OrderRejectedEvent, "Order rejected"
+	}
+	payload := events.OrderOutcomePayload{
+		OrderID:    order.OrderID,
+		CustomerID: order.CustomerID,
+		Total:      order.Total,
+		Reason:     order.Reason,
+		ReasonCode: order.ReasonCode,
+	}
+	return publishTerminal(order.OrderID, eventType, details, payload)
+}
+
+// compensationLatency: histogram of the compensation windows, by failing step
+var compensationLatency = metrics.NewHistogram(metrics.LatencyBucketsMs...)
+
+// statsHandler: serves GET /stats with the compensation latency histogram
+func statsHandler(w http.ResponseWriter, _ *http.Request) {
+	responses.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"compensation_latency_ms": compensationLatency.Snapshot(),
+	})
+}
+
+// emitSagaCompleted: publishes the end-of-saga summary and, when first is set, records its
+// latency and posts it to the analytics webhook.
+// failedAt is the timestamp of the failure event, zero for an approved order; the compensation
+// latency is approximated as the time from it to the terminal status, i.e. now.
+func emitSagaCompleted(order events.Order, first bool, steps, compensations []string, failedAt time.Time) error {
+	summary := events.SagaCompletedPayload{
+		OrderID:          order.OrderID,
+		Flow:             "choreographed",
+		Status:           order.Status,
+		Total:            order.Total,
+		DurationMs:       time.Since(order.CreatedAt).Milliseconds(),
+		StepsExecuted:    steps,
+		CompensationsRun: compensations,
+	}
+	if order.Status != "approved" {
+		summary.FailureReasonCode = order.ReasonCode
+	}
+	if !failedAt.IsZero() {
+		summary.CompensationLatencyMs = time.Since(failedAt).Milliseconds()
+	}
+	if first {
+		if !failedAt.IsZero() {
+			compensationLatency.Observe(steps[len(steps)-1], float64(summary.CompensationLatencyMs))
+		}
+		analytics.PostSagaCompleted(summary)
 	}
+	return publishTerminal(order.OrderID, events.SagaCompletedEvent, "Saga completed", summary)
 }
 
 // mapToStruct: utility to convert a generic payload into a specific struct.
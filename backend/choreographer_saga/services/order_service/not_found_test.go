@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func TestUnknownOrderNotFound(t *testing.T) {
+	newTestBus(t)
+	rec := httptest.NewRecorder()
+	getOrderHandler(rec, httptest.NewRequest(http.MethodGet, "/orders/bogus-id", nil))
+	var body events.NotFoundResponse
+	if rec.Code != http.StatusNotFound || json.NewDecoder(rec.Body).Decode(&body) != nil {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	if body != (events.NotFoundResponse{Code: events.CodeNotFound, Resource: "order", ID: "bogus-id"}) {
+		t.Errorf("body = %+v", body)
+	}
+}
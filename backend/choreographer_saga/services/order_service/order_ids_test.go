@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/idgen"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Orders created at the same time get distinct "cho-" IDs.
+func TestOrderIDsParallel(t *testing.T) {
+	newTestBus(t)
+	withInventoryCatalog(t, map[string]float64{"mouse-wireless": 10})
+	const orders = 20
+	ids := make([]string, orders)
+	var wg sync.WaitGroup
+	for i := 0; i < orders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := postCreateOrder(fmt.Sprintf(`{"customer_id":"customer-ids-%d","items":[{"product_id":"mouse-wireless","quantity":1}]}`, i), "")
+			var body struct {
+				OrderID string `json:"order_id"`
+			}
+			if rec.Code != http.StatusAccepted || json.NewDecoder(rec.Body).Decode(&body) != nil {
+				t.Errorf("order %d answered %d: %s", i, rec.Code, rec.Body)
+				return
+			}
+			ids[i] = body.OrderID
+		}(i)
+	}
+	wg.Wait()
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if idgen.Flow(id) != idgen.FlowChoreographed {
+			t.Errorf("order ID %q has no cho- prefix", id)
+		}
+		if seen[id] {
+			t.Errorf("order ID %s given twice", id)
+		}
+		seen[id] = true
+	}
+	if n := storedOrders(); n != orders {
+		t.Errorf("%d orders stored, want %d", n, orders)
+	}
+}
+
+// Orders stored before the switch to prefixed IDs can still be read.
+func TestLegacyOrderIDRead(t *testing.T) {
+	const legacy = "order-1700000000000000000"
+	newTestBus(t, legacy)
+	rec := httptest.NewRecorder()
+	getOrderHandler(rec, httptest.NewRequest(http.MethodGet, "/orders/"+legacy, nil))
+	var order events.Order
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&order) != nil {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	if order.OrderID != legacy {
+		t.Errorf("read order %q, want %q", order.OrderID, legacy)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Each way an order ends publishes its outcome with the order ID, the final total and the reason,
+// and a second PaymentProcessed for an approved order does not approve it again.
+func TestOrderOutcomeEvents(t *testing.T) {
+	bus := newTestBus(t, "outcome-paid", "outcome-declined", "outcome-out-of-stock")
+	paid := func() events.GenericEvent {
+		return events.NewGenericEvent(events.PaymentProcessedEvent, "outcome-paid", "Payment successful",
+			events.PaymentPayload{OrderID: "outcome-paid", CustomerID: "customer-1", Amount: 49.5})
+	}
+	for _, e := range []events.GenericEvent{
+		paid(),
+		paid(), // a distinct event, so the delivery dedupe does not catch it
+		events.NewGenericEvent(events.PaymentFailedEvent, "outcome-declined", "Payment failed",
+			events.OrderStatusUpdatePayload{OrderID: "outcome-declined", Reason: "card declined", ReasonCode: events.ReasonGatewayDeclined, Total: 20}),
+		events.NewGenericEvent(events.InventoryReservationFailedEvent, "outcome-out-of-stock", "Inventory reservation failed",
+			events.OrderStatusUpdatePayload{OrderID: "outcome-out-of-stock", Reason: "out of stock", ReasonCode: events.ReasonInsufficientQty, Total: 15}),
+	} {
+		if err := bus.Inject(e); err != nil {
+			t.Fatalf("%s for %s: %v", e.Type, e.OrderID, err)
+		}
+	}
+
+	outcomes := make(map[string]events.OrderOutcomePayload)
+	for _, eventType := range []events.EventType{events.OrderApprovedEvent, events.OrderRejectedEvent} {
+		for _, e := range bus.PublishedOfType(eventType) {
+			var payload events.OrderOutcomePayload
+			raw, _ := json.Marshal(e.Payload)
+			if err := json.Unmarshal(raw, &payload); err != nil {
+				t.Fatal(err)
+			}
+			key := string(eventType) + " " + e.OrderID
+			if _, dup := outcomes[key]; dup {
+				t.Errorf("%s published twice", key)
+			}
+			outcomes[key] = payload
+		}
+	}
+	for key, want := range map[string]events.OrderOutcomePayload{
+		"OrderApproved outcome-paid": {OrderID: "outcome-paid", CustomerID: "customer-1", Total: 49.5, Reason: "Payment successful"},
+		"OrderRejected outcome-declined": {OrderID: "outcome-declined", CustomerID: "customer-1", Total: 20,
+			Reason: "card declined", ReasonCode: events.ReasonGatewayDeclined},
+		"OrderRejected outcome-out-of-stock": {OrderID: "outcome-out-of-stock", CustomerID: "customer-1", Total: 15,
+			Reason: "out of stock", ReasonCode: events.ReasonInsufficientQty},
+	} {
+		if got, ok := outcomes[key]; !ok || got != want {
+			t.Errorf("%s = %+v (published %t), want %+v", key, got, ok, want)
+		}
+	}
+	if len(outcomes) != 3 {
+		t.Errorf("%d outcome events published for 3 orders", len(outcomes))
+	}
+}
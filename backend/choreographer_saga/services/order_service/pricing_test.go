@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// withInventoryCatalog points the price lookups at a stub inventory service knowing only the
+// given prices, or failing every request when prices is nil. It returns the number of lookups.
+func withInventoryCatalog(t *testing.T, prices map[string]float64) *atomic.Int32 {
+	t.Helper()
+	var lookups atomic.Int32
+	inventory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		if prices == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		price, ok := prices[r.URL.Query().Get("id")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]float64{"price": price})
+	}))
+	t.Cleanup(inventory.Close)
+	prevURL, prevLimit := inventoryServiceURL, paymentAmountLimit
+	inventoryServiceURL, paymentAmountLimit = inventory.URL, 500
+	t.Cleanup(func() { inventoryServiceURL, paymentAmountLimit = prevURL, prevLimit })
+	priceCache.Lock()
+	priceCache.Entries = make(map[string]cachedPrice)
+	priceCache.Unlock()
+	return &lookups
+}
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) events.ErrorResponse {
+	t.Helper()
+	var resp events.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// The order service seeds its own copy of the catalog, where 3 mice cost 148.50, while the
+// inventory service asks 200 each: the pre-check follows the inventory service, which is the one
+// charging the order.
+func TestPriceFromInventoryService(t *testing.T) {
+	inventorydb.InitDB()
+	newTestBus(t)
+	withInventoryCatalog(t, map[string]float64{"mouse-wireless": 200})
+	if local, _ := inventorydb.GetProductPrice("mouse-wireless"); local*3 > paymentAmountLimit {
+		t.Fatalf("local price %.2f does not diverge below the limit", local)
+	}
+
+	rec := postCreateOrder(`{"customer_id":"customer-1","items":[{"product_id":"mouse-wireless","quantity":3}]}`, "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("answered %d, want the limit of 500 exceeded at the inventory price: %s", rec.Code, rec.Body)
+	}
+	if resp := decodeError(t, rec); resp.ReasonCode != events.ReasonLimitExceeded || resp.Message != "The amount 600.00 exceeds the limit of 500.00" {
+		t.Errorf("error = %+v", resp)
+	}
+}
+
+// Prices are cached between orders; an unknown product and a failing inventory service are
+// told apart.
+func TestPriceLookups(t *testing.T) {
+	t.Run("cached between orders", func(t *testing.T) {
+		newTestBus(t)
+		lookups := withInventoryCatalog(t, map[string]float64{"cached": 10})
+		for _, body := range []string{
+			`{"customer_id":"customer-1","items":[{"product_id":"cached","quantity":1}]}`,
+			`{"customer_id":"customer-1","items":[{"product_id":"cached","quantity":2}]}`,
+		} {
+			if rec := postCreateOrder(body, ""); rec.Code >= 300 {
+				t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+			}
+		}
+		if n := lookups.Load(); n != 1 {
+			t.Errorf("inventory service asked %d times, want once", n)
+		}
+	})
+	t.Run("unknown product", func(t *testing.T) {
+		newTestBus(t)
+		withInventoryCatalog(t, map[string]float64{"known": 10})
+		rec := postCreateOrder(`{"customer_id":"customer-1","items":[{"product_id":"known","quantity":1},{"product_id":"missing","quantity":1},{"product_id":"gone","quantity":1},{"product_id":"missing","quantity":2}]}`, "")
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("answered %d, want 422", rec.Code)
+		}
+		if resp := decodeError(t, rec); resp.ReasonCode != events.ReasonUnknownProduct || strings.Join(resp.UnknownProducts, ",") != "missing,gone" {
+			t.Errorf("error = %+v, want every unknown product once", resp)
+		}
+		if n := storedOrders(); n != 0 {
+			t.Errorf("%d orders stored", n)
+		}
+	})
+	t.Run("inventory service down", func(t *testing.T) {
+		newTestBus(t)
+		lookups := withInventoryCatalog(t, nil)
+		rec := postCreateOrder(`{"customer_id":"customer-1","items":[{"product_id":"any","quantity":1}]}`, "")
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("answered %d (Retry-After %q), want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+		}
+		if resp := decodeError(t, rec); resp.ReasonCode != events.ReasonInventoryDown {
+			t.Errorf("error = %+v", resp)
+		}
+		if n := lookups.Load(); n != priceFetchAttempts {
+			t.Errorf("inventory service asked %d times, want %d", n, priceFetchAttempts)
+		}
+		if n := storedOrders(); n != 0 {
+			t.Errorf("%d orders stored", n)
+		}
+	})
+}
+
+// A price out of the sanity bounds rejects the order before it is created.
+func TestInsanePriceRejected(t *testing.T) {
+	for _, price := range []float64{0, -5, 1e9} {
+		newTestBus(t)
+		withInventoryCatalog(t, map[string]float64{"mouse-wireless": price})
+		rec := postCreateOrder(`{"customer_id":"customer-1","items":[{"product_id":"mouse-wireless","quantity":1}]}`, "")
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("price %.2f: answered %d, want 422", price, rec.Code)
+			continue
+		}
+		if resp := decodeError(t, rec); resp.ReasonCode != events.ReasonPriceSanity {
+			t.Errorf("price %.2f: error = %+v", price, resp)
+		}
+		if n := storedOrders(); n != 0 {
+			t.Errorf("price %.2f: %d orders stored", price, n)
+		}
+	}
+}
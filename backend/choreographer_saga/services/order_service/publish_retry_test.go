@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared"
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared/testutil"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// failingBus fails the first failures publications with err, then publishes to the fake bus.
+type failingBus struct {
+	*testutil.FakeBus
+	mu       sync.Mutex
+	err      error
+	failures int
+	attempts int
+}
+
+func (b *failingBus) Publish(e events.GenericEvent) error {
+	b.mu.Lock()
+	b.attempts++
+	fail := b.attempts <= b.failures
+	b.mu.Unlock()
+	if fail {
+		return b.err
+	}
+	return b.FakeBus.Publish(e)
+}
+
+// Creating an order retries the publications that can succeed later, such as during a
+// reconnection, and gives up at once on a quota, which a retry would only break again.
+func TestCreateOrderPublishRetry(t *testing.T) {
+	quota := &shared.QuotaError{Publisher: "choreographer-order-service", Quota: "max_events_per_second", Limit: "1", Actual: "2"}
+	tests := []struct {
+		name     string
+		err      error
+		failures int
+		code     int
+		attempts int
+	}{
+		{name: "reconnected", err: shared.ErrDisconnected, failures: 2, code: http.StatusAccepted, attempts: 3},
+		{name: "quota exceeded", err: quota, failures: 100, code: http.StatusTooManyRequests, attempts: 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bus := &failingBus{FakeBus: newTestBus(t), err: tc.err, failures: tc.failures}
+			eventBus = bus
+			withInventoryPrices(t, 10)
+
+			rec := postCreateOrder(fmt.Sprintf(`{"customer_id":"customer-1","items":[{"product_id":"retry-%d","quantity":1}]}`, tc.failures), "")
+			if rec.Code != tc.code {
+				t.Fatalf("answered %d, want %d: %s", rec.Code, tc.code, rec.Body)
+			}
+			if bus.attempts != tc.attempts {
+				t.Errorf("published %d times, want %d", bus.attempts, tc.attempts)
+			}
+			published := bus.PublishedOfType(events.OrderCreatedEvent)
+			if tc.code == http.StatusAccepted {
+				if id := acceptedOrderID(t, rec); len(published) != 1 || published[0].OrderID != id || storedOrders() != 1 {
+					t.Errorf("order %s: %d OrderCreated published, %d orders stored", id, len(published), storedOrders())
+				}
+			} else if len(published) != 0 || storedOrders() != 0 {
+				t.Errorf("%d OrderCreated published, %d orders stored, want none", len(published), storedOrders())
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// withFlakyInventory points the price lookups at a stub that fails its first request and then
+// prices every product at 10, calling before on each request. It returns the number of requests.
+func withFlakyInventory(t *testing.T, before func()) *atomic.Int32 {
+	t.Helper()
+	var requests atomic.Int32
+	inventory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if before != nil {
+			before()
+		}
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]float64{"price": 10})
+	}))
+	t.Cleanup(inventory.Close)
+	prevURL, prevLimit := inventoryServiceURL, paymentAmountLimit
+	inventoryServiceURL, paymentAmountLimit = inventory.URL, 500
+	t.Cleanup(func() { inventoryServiceURL, paymentAmountLimit = prevURL, prevLimit })
+	priceCache.Lock()
+	priceCache.Entries = make(map[string]cachedPrice)
+	priceCache.Unlock()
+	return &requests
+}
+
+func acceptedOrderID(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("answered %d, want 202: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		OrderID string `json:"order_id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.OrderID == "" {
+		t.Fatalf("no order id in %s (%v)", rec.Body, err)
+	}
+	return body.OrderID
+}
+
+const resubmittedOrder = `{"customer_id":"customer-1","items":[{"product_id":"mouse-wireless","quantity":1},{"product_id":"laptop-pro","quantity":2}]}`
+
+// The inventory service is down for the first lookup: the lookup is retried and the order goes
+// through, and the user's resubmission gets the same order back.
+func TestCreateOrderInventoryDownOnce(t *testing.T) {
+	bus := newTestBus(t)
+	requests := withFlakyInventory(t, nil)
+
+	first := acceptedOrderID(t, postCreateOrder(resubmittedOrder, ""))
+	if n := requests.Load(); n != 3 {
+		t.Errorf("inventory service asked %d times, want the failed lookup retried once and a second product", n)
+	}
+	// The same items in another order are the same submission.
+	again := acceptedOrderID(t, postCreateOrder(`{"customer_id":"customer-1","items":[{"product_id":"laptop-pro","quantity":2},{"product_id":"mouse-wireless","quantity":1}]}`, ""))
+	if again != first {
+		t.Errorf("resubmission created order %s, want %s back", again, first)
+	}
+	if n := storedOrders(); n != 1 {
+		t.Errorf("%d orders stored, want 1", n)
+	}
+	if n := len(bus.PublishedOfType(events.OrderCreatedEvent)); n != 1 {
+		t.Errorf("OrderCreated published %d times, want once", n)
+	}
+	if other := acceptedOrderID(t, postCreateOrder(`{"customer_id":"customer-2","items":[{"product_id":"mouse-wireless","quantity":1},{"product_id":"laptop-pro","quantity":2}]}`, "")); other == first {
+		t.Error("another customer got the order of customer-1")
+	}
+}
+
+// A resubmission arriving while the first attempt still waits on the inventory service is told
+// to come back instead of racing it.
+func TestCreateOrderResubmittedWhileInProgress(t *testing.T) {
+	newTestBus(t)
+	release := make(chan struct{})
+	waiting := make(chan struct{}, 1)
+	withFlakyInventory(t, func() {
+		select {
+		case waiting <- struct{}{}:
+		default:
+		}
+		<-release
+	})
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- postCreateOrder(resubmittedOrder, "") }()
+	select {
+	case <-waiting:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the first submission never reached the inventory service")
+	}
+
+	rec := postCreateOrder(resubmittedOrder, "")
+	if rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("answered %d (Retry-After %q), want 409 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	} else if resp := decodeError(t, rec); resp.ReasonCode != events.ReasonInProgress {
+		t.Errorf("error = %+v", resp)
+	}
+
+	close(release)
+	acceptedOrderID(t, <-done)
+	if n := storedOrders(); n != 1 {
+		t.Errorf("%d orders stored, want 1", n)
+	}
+}
+
+// A submission refused while the inventory service is down does not block the next attempt.
+func TestCreateOrderRetryAfterInventoryDown(t *testing.T) {
+	newTestBus(t)
+	withInventoryCatalog(t, nil)
+	if rec := postCreateOrder(resubmittedOrder, ""); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("answered %d, want 503", rec.Code)
+	}
+	withInventoryCatalog(t, map[string]float64{"mouse-wireless": 10, "laptop-pro": 10})
+	acceptedOrderID(t, postCreateOrder(resubmittedOrder, ""))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// The shortages of a failed reservation are kept on the rejected order.
+func TestReservationFailedKeepsShortages(t *testing.T) {
+	bus := newTestBus(t, "order-short")
+	shortages := []events.StockShortage{{ProductID: "mouse-wireless", Requested: 5, Available: 2, SuggestedQuantity: 2}}
+	if err := bus.Inject(events.NewGenericEvent(events.InventoryReservationFailedEvent, "order-short", "Inventory reservation failed",
+		events.OrderStatusUpdatePayload{OrderID: "order-short", Reason: "Insufficient quantity for mouse-wireless", ReasonCode: events.ReasonInsufficientQty, Shortages: shortages})); err != nil {
+		t.Fatal(err)
+	}
+	order, ok := inventorydb.GetOrder("order-short")
+	if !ok {
+		t.Fatal("order gone")
+	}
+	if order.Status != "rejected" || order.ReasonCode != events.ReasonInsufficientQty || len(order.Shortages) != 1 || order.Shortages[0] != shortages[0] {
+		t.Errorf("order = %+v, want it rejected with the shortage", order)
+	}
+}
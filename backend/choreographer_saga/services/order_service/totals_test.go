@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	inventorydb "github.com/StitchMl/saga-demo/common/data_store"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Every order keeps a total whatever its outcome: the estimate made at creation until the
+// inventory reserves the stock, and the inventory's total from then on, which a failure event
+// carrying no total does not erase.
+func TestOrderTotalForEveryOutcome(t *testing.T) {
+	reserved := func(orderID string) events.GenericEvent {
+		return events.NewGenericEvent(events.InventoryReservedEvent, orderID, "Inventory reserved",
+			events.InventoryRequestPayload{OrderID: orderID, Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 2}}, Amount: 42, CustomerID: "customer-1"})
+	}
+	tests := []struct {
+		name   string
+		events func(orderID string) []events.GenericEvent
+		status string
+		total  float64
+	}{
+		{name: "approved", status: "approved", total: 42, events: func(id string) []events.GenericEvent {
+			return []events.GenericEvent{reserved(id),
+				events.NewGenericEvent(events.PaymentProcessedEvent, id, "Payment processed", events.PaymentPayload{OrderID: id, CustomerID: "customer-1", Amount: 42})}
+		}},
+		{name: "payment failed", status: "rejected", total: 42, events: func(id string) []events.GenericEvent {
+			return []events.GenericEvent{reserved(id),
+				events.NewGenericEvent(events.PaymentFailedEvent, id, "Payment failed",
+					events.OrderStatusUpdatePayload{OrderID: id, Reason: "declined", ReasonCode: events.ReasonGatewayDeclined})}
+		}},
+		{name: "inventory failed", status: "rejected", total: 40, events: func(id string) []events.GenericEvent {
+			return []events.GenericEvent{events.NewGenericEvent(events.InventoryReservationFailedEvent, id, "Inventory reservation failed",
+				events.OrderStatusUpdatePayload{OrderID: id, Reason: "out of stock", ReasonCode: events.ReasonInsufficientQty})}
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bus := newTestBus(t)
+			withInventoryCatalog(t, map[string]float64{"mouse-wireless": 20})
+			rec := postCreateOrder(`{"customer_id":"customer-1","items":[{"product_id":"mouse-wireless","quantity":2}]}`, "")
+			if rec.Code >= 300 {
+				t.Fatalf("order creation answered %d: %s", rec.Code, rec.Body)
+			}
+			var created struct {
+				OrderID string `json:"order_id"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+				t.Fatal(err)
+			}
+			if order, _ := inventorydb.GetOrder(created.OrderID); order.Total != 40 {
+				t.Errorf("total %.2f at creation, want the estimate of 40", order.Total)
+			}
+
+			for _, e := range tc.events(created.OrderID) {
+				if err := bus.Inject(e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			order, _ := inventorydb.GetOrder(created.OrderID)
+			if order.Status != tc.status || order.Total != tc.total {
+				t.Errorf("order %s with total %.2f, want %s with %.2f", order.Status, order.Total, tc.status, tc.total)
+			}
+		})
+	}
+}
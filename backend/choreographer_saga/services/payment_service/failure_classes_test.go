@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/payment_gateway"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Each failure class gets its own reason code, in the PaymentFailed event and on the payment.
+func TestPaymentFailureClasses(t *testing.T) {
+	tests := []struct {
+		name        string
+		event       events.GenericEvent
+		serviceMax  float64
+		failureRate float64
+		want        string
+	}{
+		{name: "service limit", event: reservedEvent("class-service-limit", 1500), serviceMax: 1000, want: events.ReasonLimitExceeded},
+		{name: "gateway limit", event: reservedEvent("class-gateway-limit", 1e9), serviceMax: 2e9, want: events.ReasonLimitExceeded},
+		{
+			// The gateway refuses a payment without a customer: neither a limit nor a simulation.
+			name: "gateway decline",
+			event: events.NewGenericEvent(events.InventoryReservedEvent, "class-decline", "Booked inventory",
+				events.InventoryRequestPayload{OrderID: "class-decline", Amount: 10}),
+			serviceMax: 1000,
+			want:       events.ReasonGatewayDeclined,
+		},
+		{name: "failure marked on the order", event: reservedEvent(payment_gateway.FailPrefix+"class", 10), serviceMax: 1000, want: events.ReasonInjectedFailure},
+		{name: "random failure", event: reservedEvent("class-random", 10), serviceMax: 1000, failureRate: 1, want: events.ReasonInjectedFailure},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bus := newTestBus(t)
+			paymentAmountLimit = tc.serviceMax
+			payment_gateway.SetFailureRate(tc.failureRate)
+			defer payment_gateway.SetFailureRate(0)
+
+			if err := bus.Inject(tc.event); err != nil {
+				t.Fatal(err)
+			}
+			failures := bus.PublishedOfType(events.PaymentFailedEvent)
+			if len(failures) != 1 {
+				t.Fatalf("PaymentFailed published %d times, want 1", len(failures))
+			}
+			var payload events.OrderStatusUpdatePayload
+			if err := mapP(failures[0].Payload, &payload); err != nil {
+				t.Fatal(err)
+			}
+			if payload.ReasonCode != tc.want || payload.Reason == "" {
+				t.Errorf("event reason = %q (%q), want code %q", payload.Reason, payload.ReasonCode, tc.want)
+			}
+			if tx, _ := getTransaction(tc.event.OrderID); tx.ReasonCode != tc.want {
+				t.Errorf("payment reason code = %q, want %q", tx.ReasonCode, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared"
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared/testutil"
+	"github.com/StitchMl/saga-demo/common/payment_gateway"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// newTestBus subscribes the handlers of the service to a fresh FakeBus, as main does.
+func newTestBus(t *testing.T) *testutil.FakeBus {
+	t.Helper()
+	bus := testutil.NewFakeBus()
+	eventBus = bus
+	processed = shared.NewDedupe()
+	paymentAmountLimit = 1000
+	payment_gateway.SetFailureRate(0)
+	subscribe(events.InventoryReservedEvent, handleInventoryReserved)
+	subscribe(events.RevertInventoryEvent, handleRevertPayment)
+	return bus
+}
+
+func reservedEvent(orderID string, amount float64) events.GenericEvent {
+	return events.NewGenericEvent(events.InventoryReservedEvent, orderID, "Booked inventory", events.InventoryRequestPayload{
+		OrderID:    orderID,
+		CustomerID: "customer-1",
+		Amount:     amount,
+	})
+}
+
+// A payment whose outcome failed to publish is not charged again on redelivery, but its
+// outcome is published then.
+func TestInventoryReservedRedeliveredAfterFailedPublish(t *testing.T) {
+	bus := newTestBus(t)
+	event := reservedEvent("order-redelivered", 50)
+
+	bus.PublishErr = errors.New("broker unreachable")
+	if err := bus.Inject(event); err == nil {
+		t.Fatal("handler succeeded although the outcome could not be published")
+	}
+	bus.PublishErr = nil
+	if err := bus.Inject(event); err != nil {
+		t.Fatalf("redelivery failed: %v", err)
+	}
+	// Acknowledged by now: a further redelivery is skipped as a duplicate.
+	if err := bus.Inject(event); err != nil {
+		t.Fatalf("duplicate delivery failed: %v", err)
+	}
+
+	if got := len(bus.PublishedOfType(events.PaymentProcessedEvent)); got != 1 {
+		t.Errorf("PaymentProcessed published %d times, want 1", got)
+	}
+	tx, ok := getTransaction("order-redelivered")
+	if !ok || tx.Status != "processed" {
+		t.Fatalf("transaction = %+v, want processed", tx)
+	}
+	if tx.Attempts != 1 {
+		t.Errorf("payment sent to the gateway %d times, want 1", tx.Attempts)
+	}
+	if gw, _ := payment_gateway.GetTransaction("order-redelivered"); gw.Captured != 50 {
+		t.Errorf("gateway captured %.2f, want 50", gw.Captured)
+	}
+}
+
+// A payment above the limit is refused, and the refusal is published again when its first
+// publication failed.
+func TestInventoryReservedOverLimitRedeliveredAfterFailedPublish(t *testing.T) {
+	bus := newTestBus(t)
+	event := reservedEvent("order-over-limit", 5000)
+
+	bus.PublishErr = errors.New("broker unreachable")
+	if err := bus.Inject(event); err == nil {
+		t.Fatal("handler succeeded although the refusal could not be published")
+	}
+	bus.PublishErr = nil
+	if err := bus.Inject(event); err != nil {
+		t.Fatalf("redelivery failed: %v", err)
+	}
+
+	failures := bus.PublishedOfType(events.PaymentFailedEvent)
+	if len(failures) != 1 {
+		t.Fatalf("PaymentFailed published %d times, want 1", len(failures))
+	}
+	var payload events.OrderStatusUpdatePayload
+	if err := mapP(failures[0].Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ReasonCode != events.ReasonLimitExceeded {
+		t.Errorf("reason code = %q, want %q", payload.ReasonCode, events.ReasonLimitExceeded)
+	}
+	if _, charged := payment_gateway.GetTransaction("order-over-limit"); charged {
+		t.Error("payment above the limit reached the gateway")
+	}
+}
+
+func TestHandleInventoryReserved(t *testing.T) {
+	tests := []struct {
+		name      string
+		event     events.GenericEvent
+		published events.EventType
+		reason    string
+		status    string
+		permanent bool
+	}{
+		{
+			name:      "processed",
+			event:     reservedEvent("pay-ok", 120),
+			published: events.PaymentProcessedEvent,
+			status:    "processed",
+		},
+		{
+			name:      "over the service limit",
+			event:     reservedEvent("pay-limit", 1000.01),
+			published: events.PaymentFailedEvent,
+			reason:    events.ReasonLimitExceeded,
+			status:    "failed",
+		},
+		{
+			name:      "declined by the gateway",
+			event:     reservedEvent(payment_gateway.FailPrefix+"1", 10),
+			published: events.PaymentFailedEvent,
+			reason:    events.ReasonInjectedFailure,
+			status:    "failed",
+		},
+		{
+			name:      "malformed payload",
+			event:     events.NewGenericEvent(events.InventoryReservedEvent, "pay-bad", "Booked inventory", map[string]interface{}{"amount": "a lot"}),
+			permanent: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bus := newTestBus(t)
+			err := bus.Inject(tc.event)
+			if tc.permanent {
+				if !shared.IsPermanent(err) {
+					t.Fatalf("error = %v, want a permanent one", err)
+				}
+				if len(bus.Published()) != 0 {
+					t.Errorf("published %v, want nothing", bus.Published())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handler failed: %v", err)
+			}
+
+			published := bus.Published()
+			if len(published) != 1 || published[0].Type != tc.published {
+				t.Fatalf("published %v, want one %s", published, tc.published)
+			}
+			if tc.reason != "" {
+				var payload events.OrderStatusUpdatePayload
+				if err := mapP(published[0].Payload, &payload); err != nil {
+					t.Fatal(err)
+				}
+				if payload.ReasonCode != tc.reason {
+					t.Errorf("reason code = %q, want %q", payload.ReasonCode, tc.reason)
+				}
+			}
+			if tx, _ := getTransaction(tc.event.OrderID); tx.Status != tc.status {
+				t.Errorf("transaction status = %q, want %q", tx.Status, tc.status)
+			}
+		})
+	}
+}
+
+func TestHandleRevertPaymentWithoutCharge(t *testing.T) {
+	tests := []struct {
+		name      string
+		orderID   string
+		setup     func(bus *testutil.FakeBus)
+		published []events.EventType
+	}{
+		{
+			name:      "unknown payment",
+			orderID:   "revert-unknown",
+			published: []events.EventType{events.PaymentRevertSkippedEvent},
+		},
+		{
+			name:    "failed payment",
+			orderID: "revert-failed",
+			setup: func(bus *testutil.FakeBus) {
+				_ = bus.Inject(reservedEvent("revert-failed", 5000))
+				bus.Reset()
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bus := newTestBus(t)
+			if tc.setup != nil {
+				tc.setup(bus)
+			}
+			revert := events.NewGenericEvent(events.RevertInventoryEvent, tc.orderID, "Reverting inventory",
+				events.InventoryRequestPayload{OrderID: tc.orderID, Reason: "payment failed"})
+			if err := bus.Inject(revert); err != nil {
+				t.Fatalf("handler failed: %v", err)
+			}
+			var got []events.EventType
+			for _, e := range bus.Published() {
+				got = append(got, e.Type)
+			}
+			if len(got) != len(tc.published) || (len(got) > 0 && got[0] != tc.published[0]) {
+				t.Errorf("published %v, want %v", got, tc.published)
+			}
+		})
+	}
+}
@@ -2,14 +2,25 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/StitchMl/saga-demo/choreographer_saga/shared"
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/buildinfo"
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/correlation"
+	"github.com/StitchMl/saga-demo/common/diagnostics"
+	"github.com/StitchMl/saga-demo/common/graceful"
 	"github.com/StitchMl/saga-demo/common/payment_gateway"
+	"github.com/StitchMl/saga-demo/common/responses"
+	"github.com/StitchMl/saga-demo/common/transactions"
 	events "github.com/StitchMl/saga-demo/common/types"
 )
 
@@ -17,14 +28,61 @@ const payloadErr = "Payment Service: Payload error: %v"
 
 // In-memory database for payment transactions
 var (
-	eventBus           *shared.EventBus
+	// eventBus is used by the handlers; rabbitBus is the same bus, for health and admin endpoints.
+	eventBus           shared.Bus
+	rabbitBus          *shared.EventBus
 	paymentAmountLimit float64
 	txDB               = struct {
 		sync.RWMutex
-		Data map[string]string
-	}{Data: make(map[string]string)}
+		Data map[string]*events.Transaction
+	}{Data: make(map[string]*events.Transaction)}
 )
 
+// setStatus records the status of the payment of an order; the caller holds the lock.
+func setStatus(orderID, status string) *events.Transaction {
+	now := time.Now()
+	tx, ok := txDB.Data[orderID]
+	if !ok {
+		tx = &events.Transaction{OrderID: orderID, CreatedAt: now}
+		txDB.Data[orderID] = tx
+	}
+	tx.Status = status
+	tx.UpdatedAt = now
+	if status == "reverted" {
+		tx.RevertedAt = &now
+	}
+	return tx
+}
+
+// failed records a failed payment with its reason; the caller holds the lock.
+func failed(p events.InventoryRequestPayload, code, reason string) {
+	tx := setStatus(p.OrderID, "failed")
+	tx.CustomerID, tx.Amount = p.CustomerID, p.Amount
+	tx.ReasonCode, tx.Reason = code, reason
+}
+
+// listTransactions returns a copy of every transaction.
+func listTransactions() []events.Transaction {
+	txDB.RLock()
+	defer txDB.RUnlock()
+	out := make([]events.Transaction, 0, len(txDB.Data))
+	for _, tx := range txDB.Data {
+		out = append(out, *tx)
+	}
+	return out
+}
+
+// getTransaction returns a copy of the transaction of an order.
+func getTransaction(orderID string) (events.Transaction, bool) {
+	txDB.RLock()
+	defer txDB.RUnlock()
+	tx, ok := txDB.Data[orderID]
+	if !ok {
+		return events.Transaction{}, false
+	}
+	return *tx, true
+}
+
 func main() {
 	rabbitMQURL := os.Getenv("RABBITMQ_URL")
 	if rabbitMQURL == "" {
@@ -41,69 +99,140 @@ func main() {
 		log.Fatalf("Invalid PAYMENT_AMOUNT_LIMIT: %v", err)
 	}
 
-	eventBus, err = shared.NewEventBus(rabbitMQURL)
+	rabbitBus, err = shared.NewEventBus(rabbitMQURL)
 	if err != nil {
 		log.Fatalf("Unable to create EventBus: %v", err)
 	}
-	defer eventBus.Close()
+	eventBus = rabbitBus
 
+	rabbitBus.Produces(events.PaymentProcessedEvent, events.PaymentFailedEvent,
+		events.PaymentRevertMismatchEvent, events.PaymentRevertSkippedEvent, events.PaymentPartiallyRefundedEvent)
 	subscribe(events.InventoryReservedEvent, handleInventoryReserved)
 	subscribe(events.RevertInventoryEvent, handleRevertPayment)
+	rabbitBus.StartVerifier()
+
+	port := os.Getenv("PAYMENT_SERVICE_PORT")
+	if port == "" {
+		log.Fatal("PAYMENT_SERVICE_PORT not set")
+	}
+	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/transactions", transactions.ListHandler(listTransactions))
+	http.HandleFunc("/transactions/", transactions.GetHandler("/transactions/", getTransaction))
+	http.HandleFunc("/refund_partial", adminauth.Require(refundPartialHandler))
+	http.HandleFunc("/ready", readyHandler)
+	http.HandleFunc("/version", buildinfo.Handler("choreographer-payment-service"))
+	http.HandleFunc("/debug/subscriptions", rabbitBus.SubscriptionsHandler)
+	http.HandleFunc("/debug/topology", rabbitBus.TopologyHandler)
+	http.HandleFunc("/debug/quotas", rabbitBus.QuotaHandler)
+	http.HandleFunc("/debug/pending", rabbitBus.PendingHandler)
+	http.HandleFunc("/failed_deliveries", adminauth.Require(rabbitBus.FailedDeliveriesHandler))
+	http.HandleFunc("/failed_deliveries/redeliver", adminauth.Require(rabbitBus.RedeliverHandler))
+	http.HandleFunc("/admin/replay/", adminauth.Require(rabbitBus.ReplayHandler))
+	diagnostics.Publish("event_bus_queue_depths", func() interface{} { return rabbitBus.QueueDepths() })
+	http.HandleFunc("/debug/config", adminauth.Require(config.Handler))
 
-	log.Println("Payment Service initiated.")
-	select {}
+	config.Set("PAYMENT_SERVICE_PORT", port)
+	config.Set("PAYMENT_AMOUNT_LIMIT", paymentAmountLimit)
+	log.Printf("Payment Service initiated, listening on port %s", port)
+	// On SIGTERM the consumers stop and the events being handled are allowed to finish
+	if err := graceful.ListenAndServe(":"+port, diagnostics.Handler(http.DefaultServeMux), rabbitBus.Shutdown); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ---------- HTTP ----------
+
+// healthHandler reports 503 when the RabbitMQ connection is gone.
+func healthHandler(w http.ResponseWriter, _ *http.Request) {
+	if !rabbitBus.Healthy() {
+		http.Error(w, "RabbitMQ connection lost", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("Payment Service OK"))
+}
+
+// readyHandler reports 503 while the event bus subscriptions cannot be verified.
+func readyHandler(w http.ResponseWriter, _ *http.Request) {
+	if ok, reason := rabbitBus.Ready(); !ok {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("Payment Service ready"))
 }
 
 // ---------- handlers ----------
 
 // handleInventoryReserved handles the reserved inventory event and processes the payment.
-func handleInventoryReserved(event events.GenericEvent) {
+func handleInventoryReserved(event events.GenericEvent) error {
 	var payload events.InventoryRequestPayload
 	if err := mapP(event.Payload, &payload); err != nil {
-		log.Printf(payloadErr, err)
-		return
+		correlation.Logf(event.CorrelationID, payloadErr, err)
+		return shared.Permanent(err)
 	}
 
 	// Check payment limit
 	if payload.Amount > paymentAmountLimit {
 		reason := fmt.Sprintf("amount %.2f exceeds limit of %.2f", payload.Amount, paymentAmountLimit)
-		publish(events.PaymentFailedEvent, payload.OrderID, "Payment failed", events.OrderStatusUpdatePayload{
-			OrderID: payload.OrderID,
-			Reason:  reason,
-			Total:   payload.Amount,
+		txDB.Lock()
+		failed(payload, events.ReasonLimitExceeded, reason)
+		txDB.Unlock()
+		return publish(events.PaymentFailedEvent, payload.OrderID, "Payment failed", events.OrderStatusUpdatePayload{
+			OrderID:    payload.OrderID,
+			Reason:     reason,
+			ReasonCode: events.ReasonLimitExceeded,
+			Total:      payload.Amount,
 		})
-		return
 	}
 
-	txDB.RLock()
-	status, exists := txDB.Data[payload.OrderID]
-	txDB.RUnlock()
-	if exists && status == "processed" {
-		log.Printf("Payment for order %s already processed.", payload.OrderID)
-		return
+	txDB.Lock()
+	if tx, exists := txDB.Data[payload.OrderID]; exists && tx.Status == "processed" {
+		done := *tx
+		txDB.Unlock()
+		// Not charged again, but the outcome is published again: the delivery that charged it
+		// may have failed to publish it.
+		correlation.Logf(event.CorrelationID, "Payment for order %s already processed, publishing the outcome again.", payload.OrderID)
+		return publish(events.PaymentProcessedEvent, payload.OrderID, "Payment successful", events.PaymentPayload{
+			OrderID:    done.OrderID,
+			CustomerID: done.CustomerID,
+			Amount:     done.Amount,
+		})
 	}
+	tx := setStatus(payload.OrderID, "pending")
+	tx.CustomerID, tx.Amount = payload.CustomerID, payload.Amount
+	tx.Attempts++
+	txDB.Unlock()
 
 	err := payment_gateway.ProcessPayment(payload.OrderID, payload.CustomerID, payload.Amount)
 
 	txDB.Lock()
-	defer txDB.Unlock()
-
 	if err != nil {
-		txDB.Data[payload.OrderID] = "failed"
 		reason := err.Error()
+		code := events.ReasonGatewayDeclined
+		switch {
+		case errors.Is(err, payment_gateway.ErrAmountLimitExceeded):
+			code = events.ReasonLimitExceeded
+		case errors.Is(err, payment_gateway.ErrInjectedFailure):
+			code = events.ReasonInjectedFailure
+		}
+		failed(payload, code, reason)
+		txDB.Unlock()
 
 		// Publish payment failure, other services will react to it.
-		publish(events.PaymentFailedEvent, payload.OrderID, "Payment failed", events.OrderStatusUpdatePayload{
-			OrderID: payload.OrderID,
-			Reason:  reason,
-			Total:   payload.Amount,
+		return publish(events.PaymentFailedEvent, payload.OrderID, "Payment failed", events.OrderStatusUpdatePayload{
+			OrderID:    payload.OrderID,
+			Reason:     reason,
+			ReasonCode: code,
+			Total:      payload.Amount,
 		})
-		return
 	}
-	txDB.Data[payload.OrderID] = "processed"
+	setStatus(payload.OrderID, "processed")
+	txDB.Unlock()
 
-	// Publish payment success, order service will react to it.
-	publish(events.PaymentProcessedEvent, payload.OrderID, "Payment successful", events.PaymentPayload{
+	// Publish payment success, order service will react to it. On failure the event is requeued
+	// and its redelivery publishes it again, without charging.
+	return publish(events.PaymentProcessedEvent, payload.OrderID, "Payment successful", events.PaymentPayload{
 		OrderID:    payload.OrderID,
 		CustomerID: payload.CustomerID,
 		Amount:     payload.Amount,
@@ -111,23 +240,97 @@ func handleInventoryReserved(event events.GenericEvent) {
 }
 
 // handleRevertPayment handles the payment reversal request.
-func handleRevertPayment(event events.GenericEvent) {
+// When the local record and the gateway disagree (e.g. the local map was lost on a restart)
+// the gateway is trusted for the refund and an audit event is published for reconciliation.
+func handleRevertPayment(event events.GenericEvent) error {
 	var payload events.InventoryRequestPayload
 	if err := mapP(event.Payload, &payload); err != nil {
-		log.Printf(payloadErr, err)
-		return
+		correlation.Logf(event.CorrelationID, payloadErr, err)
+		return shared.Permanent(err)
 	}
 
-	log.Printf("Reverting payment for order %s", payload.OrderID)
-	err := payment_gateway.RevertPayment(payload.OrderID, payload.Reason)
-	if err != nil {
-		log.Printf("Failed to revert payment for order %s: %v", payload.OrderID, err)
-		// In a real scenario, this might require manual intervention or a retry mechanism.
+	var localStatus string
+	txDB.RLock()
+	tx, known := txDB.Data[payload.OrderID]
+	if known {
+		localStatus = tx.Status
+	}
+	txDB.RUnlock()
+	gatewayStatus, _ := payment_gateway.GetTransactionStatus(payload.OrderID)
+	charged := gatewayStatus == "completed"
+
+	if !charged && localStatus != "processed" {
+		if !known || localStatus == "pending" {
+			correlation.Logf(event.CorrelationID, "Payment Service: no settled local payment for order %s (%q), gateway status %q: revert skipped", payload.OrderID, localStatus, gatewayStatus)
+			return publishRevertAudit(events.PaymentRevertSkippedEvent, payload.OrderID, localStatus, gatewayStatus, "skipped", payload.Reason)
+		}
+		return nil
+	}
+
+	correlation.Logf(event.CorrelationID, "Reverting payment for order %s", payload.OrderID)
+	action := "reverted"
+	revertErr := payment_gateway.RevertPayment(payload.OrderID, payload.Reason)
+	if revertErr != nil {
+		correlation.Logf(event.CorrelationID, "Failed to revert payment for order %s: %v", payload.OrderID, revertErr)
+		action = "revert_failed"
+	}
+	if !charged {
+		action = "skipped"
+	}
+	var auditErr error
+	if charged != (localStatus == "processed") {
+		correlation.Logf(event.CorrelationID, "Payment Service: payment status mismatch for order %s: local %q, gateway %q", payload.OrderID, localStatus, gatewayStatus)
+		auditErr = publishRevertAudit(events.PaymentRevertMismatchEvent, payload.OrderID, localStatus, gatewayStatus, action, payload.Reason)
+	}
+	// The event is not acknowledged, so the revert is tried again on the next delivery.
+	if revertErr != nil {
+		return fmt.Errorf("revert payment for order %s: %w", payload.OrderID, revertErr)
 	}
 
 	txDB.Lock()
-	txDB.Data[payload.OrderID] = "reverted"
+	setStatus(payload.OrderID, "reverted")
 	txDB.Unlock()
+	return auditErr
+}
+
+// refundPartialHandler serves POST /refund_partial, giving back part of a processed payment
+// and publishing a PaymentPartiallyRefunded event.
+func refundPartialHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req, ok := transactions.DecodeRefundRequest(w, r)
+	if !ok {
+		return
+	}
+
+	txDB.Lock()
+	refund, ok := transactions.Refund(w, txDB.Data[req.OrderID], req)
+	txDB.Unlock()
+	if !ok {
+		log.Printf("Payment Service: partial refund of %.2f for order %s refused", req.Amount, req.OrderID)
+		return
+	}
+	log.Printf("Payment Service: refunded %.2f for order %s, %.2f left", refund.Amount, req.OrderID, refund.Remaining)
+	// The refund is made, so the client cannot retry it: the event waits for a reconnection for
+	// a while, and is only logged as lost after that.
+	event := events.NewGenericEvent(events.PaymentPartiallyRefundedEvent, req.OrderID, "Payment partially refunded", refund)
+	if err := shared.PublishRetry(eventBus, event); err != nil {
+		log.Printf("Payment Service: PaymentPartiallyRefunded for order %s lost: %v", req.OrderID, err)
+	}
+	responses.WriteJSON(w, http.StatusOK, refund)
+}
+
+// publishRevertAudit publishes a PaymentRevertSkipped/PaymentRevertMismatch event with both statuses.
+func publishRevertAudit(t events.EventType, orderID, localStatus, gatewayStatus, action, reason string) error {
+	return publish(t, orderID, "Payment revert needs reconciliation", events.PaymentRevertAuditPayload{
+		OrderID:       orderID,
+		LocalStatus:   localStatus,
+		GatewayStatus: gatewayStatus,
+		Action:        action,
+		Reason:        reason,
+	})
 }
 
 // ---------- util ----------
@@ -141,16 +344,22 @@ func mapP(src interface{}, dst interface{}) error {
 	return json.Unmarshal(b, dst)
 }
 
-// publish simplifies the publication of events
-func publish(t events.EventType, id, msg string, pl events.EventPayload) {
+// publish simplifies the publication of events. The error is returned to the event handlers,
+// so that the event they handle is requeued instead of losing the outcome.
+func publish(t events.EventType, id, msg string, pl events.EventPayload) error {
 	if err := eventBus.Publish(events.NewGenericEvent(t, id, msg, pl)); err != nil {
 		log.Printf("publish %s: %v", t, err)
+		return fmt.Errorf("publish %s: %w", t, err)
 	}
+	return nil
 }
 
+// processed skips the events already handled, e.g. redelivered by RabbitMQ
+var processed = shared.NewDedupe()
+
 // subscribe simplifies the subscription to events
 func subscribe(t events.EventType, h shared.EventHandler) {
-	if err := eventBus.Subscribe(t, h); err != nil {
+	if err := eventBus.Subscribe(t, processed.Once(string(t), h), shared.Durable()); err != nil {
 		log.Fatalf("subscribe %s: %v", t, err)
 	}
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/payment_gateway"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func revertEvent(orderID string) events.GenericEvent {
+	return events.NewGenericEvent(events.RevertInventoryEvent, orderID, "Revert", events.InventoryRequestPayload{
+		OrderID: orderID,
+		Reason:  "shipping failed",
+	})
+}
+
+// auditOf decodes the audit payloads among published that concern an order.
+func auditOf(t *testing.T, published []events.GenericEvent, orderID string) []events.PaymentRevertAuditPayload {
+	t.Helper()
+	var out []events.PaymentRevertAuditPayload
+	for _, e := range published {
+		if e.OrderID != orderID {
+			continue
+		}
+		var payload events.PaymentRevertAuditPayload
+		if err := mapP(e.Payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, payload)
+	}
+	return out
+}
+
+// The service restarted after charging the order, so it has no record of the payment: the
+// revert still refunds the charge the gateway holds and reports the mismatch.
+func TestRevertAfterRestartLostState(t *testing.T) {
+	bus := newTestBus(t)
+	orderID := "revert-lost-state"
+	if err := bus.Inject(reservedEvent(orderID, 50)); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := payment_gateway.GetTransactionStatus(orderID); status != "completed" {
+		t.Fatalf("gateway status %q after the payment", status)
+	}
+	txDB.Lock()
+	delete(txDB.Data, orderID)
+	txDB.Unlock()
+	bus.Reset()
+
+	err := bus.Inject(revertEvent(orderID))
+	gatewayStatus, _ := payment_gateway.GetTransactionStatus(orderID)
+	// The simulated gateway fails some refunds at random: the event is then retried.
+	wantAction, wantStatus := "reverted", "refunded"
+	if err != nil {
+		wantAction, wantStatus = "revert_failed", "failed_refund"
+	}
+	if gatewayStatus != wantStatus {
+		t.Errorf("gateway status %q, want %q", gatewayStatus, wantStatus)
+	}
+	audits := auditOf(t, bus.PublishedOfType(events.PaymentRevertMismatchEvent), orderID)
+	if len(audits) != 1 {
+		t.Fatalf("%d mismatch events, want 1", len(audits))
+	}
+	if a := audits[0]; a.LocalStatus != "" || a.GatewayStatus != "completed" || a.Action != wantAction || a.Reason != "shipping failed" {
+		t.Errorf("mismatch = %+v, want no local record, a completed charge and action %s", a, wantAction)
+	}
+}
+
+func TestRevertWithoutCharge(t *testing.T) {
+	t.Run("no payment anywhere", func(t *testing.T) {
+		bus := newTestBus(t)
+		if err := bus.Inject(revertEvent("revert-never-paid")); err != nil {
+			t.Fatal(err)
+		}
+		audits := auditOf(t, bus.PublishedOfType(events.PaymentRevertSkippedEvent), "revert-never-paid")
+		if len(audits) != 1 || audits[0].Action != "skipped" || audits[0].LocalStatus != "" || audits[0].GatewayStatus != "" {
+			t.Errorf("skipped events = %+v, want one with neither status", audits)
+		}
+		if n := len(bus.PublishedOfType(events.PaymentRevertMismatchEvent)); n != 0 {
+			t.Errorf("%d mismatch events", n)
+		}
+	})
+	t.Run("payment settled on both sides", func(t *testing.T) {
+		bus := newTestBus(t)
+		orderID := "revert-consistent"
+		if err := bus.Inject(reservedEvent(orderID, 50)); err != nil {
+			t.Fatal(err)
+		}
+		bus.Reset()
+		if err := bus.Inject(revertEvent(orderID)); err != nil {
+			t.Skipf("the simulated gateway failed the refund: %v", err)
+		}
+		if n := len(bus.Published()); n != 0 {
+			t.Errorf("published %v, want no audit event when both sides agree", bus.Published())
+		}
+		txDB.RLock()
+		status := txDB.Data[orderID].Status
+		txDB.RUnlock()
+		if status != "reverted" {
+			t.Errorf("local status %q, want reverted", status)
+		}
+	})
+}
+
+// A second revert of the same order, as when the revert is published again, refunds nothing
+// more and publishes nothing.
+func TestRevertTwice(t *testing.T) {
+	bus := newTestBus(t)
+	orderID := "revert-twice"
+	if err := bus.Inject(reservedEvent(orderID, 50)); err != nil {
+		t.Fatal(err)
+	}
+	// The simulated gateway fails some refunds at random: the event is retried until one succeeds.
+	var err error
+	for i := 0; i < 20; i++ {
+		if err = bus.Inject(revertEvent(orderID)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("revert never succeeded: %v", err)
+	}
+	bus.Reset()
+
+	if err := bus.Inject(revertEvent(orderID)); err != nil {
+		t.Fatalf("second revert: %v", err)
+	}
+	if published := bus.Published(); len(published) != 0 {
+		t.Errorf("second revert published %v", published)
+	}
+	if status, _ := payment_gateway.GetTransactionStatus(orderID); status != "refunded" {
+		t.Errorf("gateway status %q, want refunded", status)
+	}
+	txDB.RLock()
+	status := txDB.Data[orderID].Status
+	txDB.RUnlock()
+	if status != "reverted" {
+		t.Errorf("local status %q, want reverted", status)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/transactions"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// The payments taken from the events are served by GET /transactions, filtered by customer and
+// status, and by GET /transactions/{orderID}.
+func TestTransactionsEndpoints(t *testing.T) {
+	bus := newTestBus(t)
+	customer := fmt.Sprintf("customer-tx-%d", time.Now().UnixNano())
+	paid, refused := customer+"-paid", customer+"-refused"
+	for orderID, amount := range map[string]float64{paid: 50, refused: 5000} {
+		if err := bus.Inject(events.NewGenericEvent(events.InventoryReservedEvent, orderID, "Booked inventory",
+			events.InventoryRequestPayload{OrderID: orderID, CustomerID: customer, Amount: amount})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := transactions.ListHandler(listTransactions)
+	for query, want := range map[string]string{"": "", "&status=processed": paid, "&status=failed": refused} {
+		rec := httptest.NewRecorder()
+		list(rec, httptest.NewRequest(http.MethodGet, "/transactions?customer_id="+customer+query, nil))
+		var got []events.Transaction
+		_ = json.Unmarshal(rec.Body.Bytes(), &got)
+		switch {
+		case want == "" && len(got) != 2:
+			t.Errorf("customer listed %d transactions, want 2", len(got))
+		case want != "" && (len(got) != 1 || got[0].OrderID != want):
+			t.Errorf("%q listed %+v, want only %s", query, got, want)
+		}
+	}
+
+	get := transactions.GetHandler("/transactions/", getTransaction)
+	rec := httptest.NewRecorder()
+	get(rec, httptest.NewRequest(http.MethodGet, "/transactions/"+refused, nil))
+	var tx events.Transaction
+	_ = json.Unmarshal(rec.Body.Bytes(), &tx)
+	if rec.Code != http.StatusOK || tx.Status != "failed" || tx.Reason == "" || tx.Amount != 5000 {
+		t.Errorf("refused payment answered %d %+v, want failed with its reason", rec.Code, tx)
+	}
+	rec = httptest.NewRecorder()
+	get(rec, httptest.NewRequest(http.MethodGet, "/transactions/"+customer+"-unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown order answered %d, want 404", rec.Code)
+	}
+}
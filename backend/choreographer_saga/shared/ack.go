@@ -0,0 +1,101 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	events "github.com/StitchMl/saga-demo/common/types"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Settings of the deliveries: the messages a consumer may hold unacknowledged (EVENT_BUS_PREFETCH),
+// the most messages the queue of a WithAck subscription keeps (RabbitMQ drops the oldest beyond
+// it) and the wait before a failed event is requeued.
+var (
+	prefetch         = envInt("EVENT_BUS_PREFETCH", 16)
+	maxPending       = envInt("EVENT_BUS_MAX_PENDING", 1000)
+	ackRetryInterval = time.Duration(envInt("EVENT_BUS_ACK_RETRY_INTERVAL_MS", 1000)) * time.Millisecond
+)
+
+func init() {
+	config.Set("EVENT_BUS_PREFETCH", prefetch)
+	config.Set("EVENT_BUS_MAX_PENDING", maxPending)
+	config.Set("EVENT_BUS_ACK_RETRY_INTERVAL_MS", ackRetryInterval)
+}
+
+// WithAck makes the delivery retry until the handler succeeds: an event whose handler keeps
+// failing is put back in the queue and delivered again after EVENT_BUS_ACK_RETRY_INTERVAL_MS
+// every time, instead of going to the failed deliveries after one requeue.
+func WithAck() SubscribeOption {
+	return func(s *subscription) { s.ack = true }
+}
+
+// permanentError marks a handler error that another delivery cannot fix.
+type permanentError struct{ err error }
+
+func (p permanentError) Error() string { return p.err.Error() }
+func (p permanentError) Unwrap() error { return p.err }
+
+// Permanent wraps a handler error, e.g. a malformed payload, so that the event is neither
+// retried nor requeued and goes straight to OnRedeliveryExhausted or the failed deliveries.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent.
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// queueArgs returns the arguments of the queue of a subscription.
+func queueArgs(sub *subscription) amqp.Table {
+	if !sub.ack {
+		return nil
+	}
+	return amqp.Table{"x-max-length": int32(maxPending), "x-overflow": "drop-head"}
+}
+
+// settle runs the handler of a delivery and acknowledges the message only once the event is
+// dealt with, so an event in progress when the process dies is delivered again. After the
+// handler failed every attempt the message is requeued: always for a WithAck subscription,
+// once otherwise, the event then going to OnRedeliveryExhausted or the failed deliveries.
+func (eb *EventBus) settle(sub *subscription, d amqp.Delivery, e events.GenericEvent) {
+	attempts, err := eb.attempt(sub, e)
+	if err == nil {
+		if err := d.Ack(false); err != nil {
+			log.Printf("[EventBus] Ack of '%s' for order %s failed: %v", e.Type, e.OrderID, err)
+		}
+		return
+	}
+	if !IsPermanent(err) && (sub.ack || !d.Redelivered) {
+		log.Printf("[EventBus] Event '%s' for order %s not acknowledged after %d attempts, requeued in %s: %v",
+			e.Type, e.OrderID, attempts, ackRetryInterval, err)
+		time.Sleep(ackRetryInterval)
+		if err := d.Nack(false, true); err != nil {
+			log.Printf("[EventBus] Requeue of '%s' for order %s failed: %v", e.Type, e.OrderID, err)
+		}
+		return
+	}
+	eb.exhausted(sub, e, err, attempts)
+	if err := d.Ack(false); err != nil {
+		log.Printf("[EventBus] Ack of '%s' for order %s failed: %v", e.Type, e.OrderID, err)
+	}
+}
+
+// PendingHandler serves the number of messages waiting in the queue of every subscription,
+// with the cap applied to the acknowledged ones.
+func (eb *EventBus) PendingHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"pending":     eb.QueueDepths(),
+		"max_pending": maxPending,
+	})
+}
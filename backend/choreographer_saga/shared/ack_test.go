@@ -0,0 +1,208 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeBroker feeds a consumer as RabbitMQ does: a message nacked with requeue comes back
+// flagged as redelivered, and the stream closes once every message has been acknowledged.
+type fakeBroker struct {
+	stream chan amqp.Delivery
+	want   int
+
+	mu      sync.Mutex
+	pending map[uint64]amqp.Delivery
+	nextTag uint64
+	acked   map[string]int // by order
+	nacks   int
+	done    chan struct{}
+}
+
+func newFakeBroker(want int) *fakeBroker {
+	return &fakeBroker{
+		stream:  make(chan amqp.Delivery, 2*want),
+		want:    want,
+		pending: make(map[uint64]amqp.Delivery),
+		acked:   make(map[string]int),
+		done:    make(chan struct{}),
+	}
+}
+
+func (b *fakeBroker) publish(t *testing.T, orderID string, redelivered bool) {
+	body, err := json.Marshal(events.NewGenericEvent(events.OrderCreatedEvent, orderID, "test", nil))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b.mu.Lock()
+	b.nextTag++
+	d := amqp.Delivery{Acknowledger: b, DeliveryTag: b.nextTag, Body: body, Redelivered: redelivered}
+	b.pending[d.DeliveryTag] = d
+	b.mu.Unlock()
+	b.stream <- d
+}
+
+func (b *fakeBroker) Ack(tag uint64, _ bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d, ok := b.pending[tag]
+	if !ok {
+		return fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	delete(b.pending, tag)
+	var e events.GenericEvent
+	_ = json.Unmarshal(d.Body, &e)
+	b.acked[e.OrderID]++
+	if len(b.acked) == b.want && len(b.pending) == 0 {
+		close(b.done)
+	}
+	return nil
+}
+
+func (b *fakeBroker) Nack(tag uint64, _ bool, requeue bool) error {
+	b.mu.Lock()
+	d, ok := b.pending[tag]
+	delete(b.pending, tag)
+	b.nacks++
+	if ok && requeue {
+		b.nextTag++
+		d.DeliveryTag, d.Redelivered = b.nextTag, true
+		b.pending[d.DeliveryTag] = d
+	}
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	if requeue {
+		b.stream <- d
+	}
+	return nil
+}
+
+func (b *fakeBroker) Reject(tag uint64, requeue bool) error {
+	return b.Nack(tag, false, requeue)
+}
+
+func withFastDeliveries(t *testing.T) {
+	t.Helper()
+	prevAttempts, prevDelay, prevInterval := maxDeliveryAttempts, deliveryRetryDelay, ackRetryInterval
+	maxDeliveryAttempts, deliveryRetryDelay, ackRetryInterval = 1, time.Millisecond, time.Millisecond
+	t.Cleanup(func() {
+		maxDeliveryAttempts, deliveryRetryDelay, ackRetryInterval = prevAttempts, prevDelay, prevInterval
+	})
+}
+
+// Several publishers at once to a subscriber failing every other call: with WithAck each event
+// is requeued until the handler succeeds, and acknowledged exactly once.
+func TestAckFlappingSubscriber(t *testing.T) {
+	withFastDeliveries(t)
+	const publishers, perPublisher = 5, 10
+	broker := newFakeBroker(publishers * perPublisher)
+	eb := newStreamBus()
+
+	var calls atomic.Int32
+	var mu sync.Mutex
+	handled := make(map[string]int)
+	sub := &subscription{EventType: events.OrderCreatedEvent, handler: func(e events.GenericEvent) error {
+		if calls.Add(1)%2 == 1 {
+			return errors.New("subscriber flapping")
+		}
+		mu.Lock()
+		handled[e.OrderID]++
+		mu.Unlock()
+		return nil
+	}}
+	WithAck()(sub)
+	eb.delivering.Add(1)
+	go eb.deliver(sub, broker.stream)
+
+	var wg sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perPublisher; i++ {
+				broker.publish(t, fmt.Sprintf("order-%d-%d", p, i), false)
+			}
+		}(p)
+	}
+	wg.Wait()
+	select {
+	case <-broker.done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("not every event was acknowledged")
+	}
+	close(broker.stream)
+	eb.delivering.Wait()
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	mu.Lock()
+	defer mu.Unlock()
+	for p := 0; p < publishers; p++ {
+		for i := 0; i < perPublisher; i++ {
+			id := fmt.Sprintf("order-%d-%d", p, i)
+			if handled[id] != 1 || broker.acked[id] != 1 {
+				t.Errorf("%s handled %d times and acknowledged %d times, want once each", id, handled[id], broker.acked[id])
+			}
+		}
+	}
+	if broker.nacks == 0 {
+		t.Error("no event was requeued by the flapping subscriber")
+	}
+	if failed := eb.FailedDeliveries(); len(failed) != 0 {
+		t.Errorf("failed deliveries %+v, want none with WithAck", failed)
+	}
+}
+
+// Without WithAck a failing event is requeued once, then set aside.
+func TestNoAckRequeuedOnce(t *testing.T) {
+	withFastDeliveries(t)
+	broker := newFakeBroker(1)
+	eb := newStreamBus()
+	var calls atomic.Int32
+	sub := &subscription{EventType: events.OrderCreatedEvent, handler: func(events.GenericEvent) error {
+		calls.Add(1)
+		return errors.New("store down")
+	}}
+	eb.delivering.Add(1)
+	go eb.deliver(sub, broker.stream)
+
+	broker.publish(t, "order-no-ack", false)
+	select {
+	case <-broker.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event was never acknowledged")
+	}
+	close(broker.stream)
+	eb.delivering.Wait()
+
+	if n := calls.Load(); n != 2 {
+		t.Errorf("handler ran %d times, want the delivery and one redelivery", n)
+	}
+	if failed := eb.FailedDeliveries(); len(failed) != 1 || failed[0].OrderID != "order-no-ack" {
+		t.Errorf("failed deliveries = %+v", failed)
+	}
+}
+
+// The queue of a WithAck subscription is capped, dropping the oldest messages.
+func TestAckQueueCap(t *testing.T) {
+	if args := queueArgs(&subscription{}); args != nil {
+		t.Errorf("plain subscription queue args = %v, want none", args)
+	}
+	sub := &subscription{}
+	WithAck()(sub)
+	args := queueArgs(sub)
+	if args["x-max-length"] != int32(maxPending) || args["x-overflow"] != "drop-head" {
+		t.Errorf("queue args = %v, want a cap of %d dropping the oldest", args, maxPending)
+	}
+}
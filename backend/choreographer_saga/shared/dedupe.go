@@ -0,0 +1,112 @@
+package shared
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Bounds of the processed-event store: the most event IDs kept (EVENT_DEDUPE_MAX_ENTRIES), the
+// least recently seen being dropped first, and how long each is kept (EVENT_DEDUPE_TTL_SECONDS).
+var (
+	dedupeMaxEntries = envInt("EVENT_DEDUPE_MAX_ENTRIES", 10000)
+	dedupeTTL        = envSeconds("EVENT_DEDUPE_TTL_SECONDS", 3600)
+)
+
+func init() {
+	config.Set("EVENT_DEDUPE_MAX_ENTRIES", dedupeMaxEntries)
+	config.Set("EVENT_DEDUPE_TTL_SECONDS", dedupeTTL)
+}
+
+// Dedupe remembers the events already handled, by event ID, so that a redelivered event is
+// skipped instead of repeating its side effects. It is safe for concurrent use and bounded.
+type Dedupe struct {
+	mu      sync.Mutex
+	max     int
+	ttl     time.Duration
+	entries map[string]*list.Element // values of the list are *dedupeEntry
+	lru     *list.List               // most recently seen first
+}
+
+type dedupeEntry struct {
+	key  string
+	seen time.Time
+}
+
+// NewDedupe returns an empty store bounded by EVENT_DEDUPE_MAX_ENTRIES and EVENT_DEDUPE_TTL_SECONDS.
+func NewDedupe() *Dedupe {
+	return newDedupe(dedupeMaxEntries, dedupeTTL)
+}
+
+func newDedupe(max int, ttl time.Duration) *Dedupe {
+	return &Dedupe{max: max, ttl: ttl, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// Seen reports whether key was marked within the TTL.
+func (d *Dedupe) Seen(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	el, ok := d.entries[key]
+	if !ok {
+		return false
+	}
+	if time.Since(el.Value.(*dedupeEntry).seen) > d.ttl {
+		d.lru.Remove(el)
+		delete(d.entries, key)
+		return false
+	}
+	d.lru.MoveToFront(el)
+	return true
+}
+
+// Mark records key as handled, dropping the least recently seen keys beyond the bound.
+func (d *Dedupe) Mark(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if el, ok := d.entries[key]; ok {
+		el.Value.(*dedupeEntry).seen = time.Now()
+		d.lru.MoveToFront(el)
+		return
+	}
+	d.entries[key] = d.lru.PushFront(&dedupeEntry{key: key, seen: time.Now()})
+	for d.lru.Len() > d.max {
+		oldest := d.lru.Back()
+		d.lru.Remove(oldest)
+		delete(d.entries, oldest.Value.(*dedupeEntry).key)
+	}
+}
+
+// Len returns the number of keys kept, expired ones included until they are looked up or dropped.
+func (d *Dedupe) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lru.Len()
+}
+
+// Once wraps a handler so that it runs at most once per event ID: an event already handled is
+// logged as a duplicate and acknowledged without calling it. The event counts as handled only
+// when the handler succeeds, so a failed event is still retried. name keeps apart the handlers
+// that receive the same event. Events without an ID, e.g. from an older publisher or a replay,
+// always run.
+func (d *Dedupe) Once(name string, h EventHandler) EventHandler {
+	return func(e events.GenericEvent) error {
+		if e.EventID == "" {
+			return h(e)
+		}
+		key := name + "/" + e.EventID
+		if d.Seen(key) {
+			correlation.Logf(e.CorrelationID, "[EventBus] Event %s '%s' for order %s already handled by %s: duplicate, skipping",
+				e.EventID, e.Type, e.OrderID, name)
+			return nil
+		}
+		if err := h(e); err != nil {
+			return err
+		}
+		d.Mark(key)
+		return nil
+	}
+}
@@ -0,0 +1,118 @@
+package shared
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// countingHandler counts its calls and fails the first failures of them.
+func countingHandler(failures int) (EventHandler, *int) {
+	calls := 0
+	return func(events.GenericEvent) error {
+		calls++
+		if calls <= failures {
+			return errors.New("downstream unavailable")
+		}
+		return nil
+	}, &calls
+}
+
+func TestOnceSkipsDuplicates(t *testing.T) {
+	event := events.NewGenericEvent(events.PaymentProcessedEvent, "order-1", "test", nil)
+	withoutID := event
+	withoutID.EventID = ""
+	other := events.NewGenericEvent(events.PaymentProcessedEvent, "order-1", "test", nil)
+
+	tests := []struct {
+		name      string
+		delivered []events.GenericEvent
+		calls     int
+	}{
+		{name: "same event twice", delivered: []events.GenericEvent{event, event}, calls: 1},
+		{name: "distinct events", delivered: []events.GenericEvent{event, other}, calls: 2},
+		{name: "events without ID always run", delivered: []events.GenericEvent{withoutID, withoutID}, calls: 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h, calls := countingHandler(0)
+			once := newDedupe(10, time.Hour).Once("handler", h)
+			for _, e := range tc.delivered {
+				if err := once(e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if *calls != tc.calls {
+				t.Errorf("handler ran %d times, want %d", *calls, tc.calls)
+			}
+		})
+	}
+}
+
+// An event is marked as handled only once its handler succeeds: the redelivery of a failed
+// event runs the handler again, and the one after the success does not.
+func TestOnceMarksOnlyAfterSuccess(t *testing.T) {
+	d := newDedupe(10, time.Hour)
+	h, calls := countingHandler(1)
+	once := d.Once("handler", h)
+	event := events.NewGenericEvent(events.PaymentProcessedEvent, "order-1", "test", nil)
+
+	if err := once(event); err == nil {
+		t.Fatal("first delivery succeeded, want the handler error")
+	}
+	if d.Seen("handler/" + event.EventID) {
+		t.Fatal("failed event marked as handled")
+	}
+	if err := once(event); err != nil {
+		t.Fatalf("redelivery failed: %v", err)
+	}
+	if err := once(event); err != nil {
+		t.Fatalf("duplicate failed: %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("handler ran %d times, want 2: the failure and the redelivery", *calls)
+	}
+}
+
+// Handlers of the same event keep separate records.
+func TestOnceSeparatesHandlers(t *testing.T) {
+	d := newDedupe(10, time.Hour)
+	first, firstCalls := countingHandler(0)
+	second, secondCalls := countingHandler(0)
+	event := events.NewGenericEvent(events.PaymentProcessedEvent, "order-1", "test", nil)
+
+	_ = d.Once("first", first)(event)
+	_ = d.Once("second", second)(event)
+	if *firstCalls != 1 || *secondCalls != 1 {
+		t.Errorf("handlers ran %d and %d times, want 1 each", *firstCalls, *secondCalls)
+	}
+}
+
+func TestDedupeBounds(t *testing.T) {
+	t.Run("least recently seen dropped first", func(t *testing.T) {
+		d := newDedupe(2, time.Hour)
+		d.Mark("a")
+		d.Mark("b")
+		d.Seen("a") // b is now the least recently seen
+		d.Mark("c")
+		if d.Len() != 2 {
+			t.Errorf("Len = %d, want 2", d.Len())
+		}
+		if !d.Seen("a") || d.Seen("b") || !d.Seen("c") {
+			t.Error("want a and c kept, b dropped")
+		}
+	})
+	t.Run("expired after the TTL", func(t *testing.T) {
+		d := newDedupe(10, 10*time.Millisecond)
+		d.Mark("a")
+		time.Sleep(20 * time.Millisecond)
+		if d.Seen("a") {
+			t.Error("key still seen after its TTL")
+		}
+		if d.Len() != 0 {
+			t.Errorf("Len = %d, want 0 once the expired key is looked up", d.Len())
+		}
+	})
+}
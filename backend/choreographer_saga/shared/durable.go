@@ -0,0 +1,35 @@
+package shared
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/StitchMl/saga-demo/common/config"
+)
+
+// serviceName prefixes the names of the durable queues (SERVICE_NAME), so that every replica
+// of a service consumes from the same ones.
+var serviceName = os.Getenv("SERVICE_NAME")
+
+func init() {
+	config.Set("SERVICE_NAME", serviceName)
+}
+
+// Durable makes the subscription consume from a durable queue named after the service and the
+// subscription, e.g. "payment-service.InventoryReserved", instead of an anonymous queue deleted
+// with its consumer. Events published while the service restarts wait in the queue, and the
+// replicas of a service share it as competing consumers. It needs SERVICE_NAME.
+func Durable() SubscribeOption {
+	return func(s *subscription) { s.durable = true }
+}
+
+// queueName returns the name of the durable queue of a subscription, "" for an anonymous one.
+func queueName(sub *subscription) (string, error) {
+	if !sub.durable {
+		return "", nil
+	}
+	if serviceName == "" {
+		return "", fmt.Errorf("durable subscription to '%s' needs SERVICE_NAME", sub.EventType)
+	}
+	return serviceName + "." + string(sub.EventType), nil
+}
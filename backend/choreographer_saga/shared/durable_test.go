@@ -0,0 +1,89 @@
+package shared
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func TestQueueName(t *testing.T) {
+	defer func(name string) { serviceName = name }(serviceName)
+
+	tests := []struct {
+		name    string
+		service string
+		durable bool
+		want    string
+		wantErr bool
+	}{
+		{name: "anonymous", service: "payment-service", want: ""},
+		{name: "durable", service: "payment-service", durable: true, want: "payment-service.InventoryReserved"},
+		{name: "durable without SERVICE_NAME", durable: true, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			serviceName = tc.service
+			sub := &subscription{EventType: events.InventoryReservedEvent}
+			if tc.durable {
+				Durable()(sub)
+			}
+			got, err := queueName(sub)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("queueName error = %v, want error %t", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("queueName = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// A service restarted with the same SERVICE_NAME consumes from the same durable queue, and
+// receives the events published while it was down.
+func TestDurableQueueSurvivesRestart(t *testing.T) {
+	url := brokerURL(t)
+	defer func(name string) { serviceName = name }(serviceName)
+	serviceName = fmt.Sprintf("durable-test-%d", time.Now().UnixNano())
+
+	first, err := NewEventBus(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Subscribe(events.OrderCreatedEvent, func(events.GenericEvent) error { return nil }, Durable()); err != nil {
+		t.Fatal(err)
+	}
+	queue := first.subscriptions[0].Queue
+	if want := serviceName + "." + string(events.OrderCreatedEvent); queue != want {
+		t.Fatalf("queue = %q, want %q", queue, want)
+	}
+	first.Close() // the service goes down
+
+	publisher, err := NewEventBus(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+	defer func() {
+		_, channel := publisher.current()
+		_, _ = channel.QueueDelete(queue, false, false, false)
+	}()
+	if err := publisher.Publish(events.NewGenericEvent(events.OrderCreatedEvent, "while-down", "test", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := NewEventBus(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	handler, got := receiver()
+	if err := restarted.Subscribe(events.OrderCreatedEvent, handler, Durable()); err != nil {
+		t.Fatal(err)
+	}
+	if q := restarted.subscriptions[0].Queue; q != queue {
+		t.Errorf("restarted service consumes from %q, want the same queue %q", q, queue)
+	}
+	expectEvent(t, got, "while-down")
+}
@@ -3,47 +3,84 @@ package shared
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/correlation"
 	events "github.com/StitchMl/saga-demo/common/types"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-// EventHandler is a type of function that handles events.
-type EventHandler func(event events.GenericEvent)
+// EventHandler is a type of function that handles events. An error, like a panic, means the
+// event was not handled: it is retried and then put back in the queue, see settle. Errors that
+// another delivery cannot fix should be wrapped with Permanent.
+type EventHandler func(event events.GenericEvent) error
+
+// Bus is what the event handlers of a service need from the event bus. Services hold their bus
+// through it so that the handlers can be run against testutil.FakeBus instead of RabbitMQ.
+type Bus interface {
+	Publish(event events.GenericEvent) error
+	Subscribe(eventType events.EventType, handler EventHandler, opts ...SubscribeOption) error
+	Close()
+}
+
+var _ Bus = (*EventBus)(nil)
 
 // EventBus is an event bus based on RabbitMQ.
 type EventBus struct {
+	url            string
+	connMu         sync.RWMutex // guards conn and channel, replaced by a reconnection
 	conn           *amqp.Connection
 	channel        *amqp.Channel
 	exchange       string
 	subscribers    map[events.EventType][]EventHandler
 	publishTimeout time.Duration
+	quota          *quotaState
+
+	// Registry of the subscriptions made through Subscribe, used by the verifier.
+	subsMu        sync.RWMutex
+	subscriptions []*subscription
+	produces      []events.EventType // declared with Produces
+	undeclared    []events.EventType // published without being declared, already logged
+	verify        verifierState
+	failed        failedLog
+	history       eventHistory
+
+	// Consumers running, and whether Shutdown has stopped them for good.
+	delivering sync.WaitGroup
+	stopping   atomic.Bool
+
+	// Whether the connection was lost and not restored yet, and whether Close ended it for good.
+	// consumeMu keeps the reconnection and the verifier from re-subscribing at the same time.
+	reconnecting atomic.Bool
+	closed       atomic.Bool
+	consumeMu    sync.Mutex
+
+	// Correlation IDs of the orders seen in delivered events, copied into the events
+	// published for the same order so a saga keeps one ID across services.
+	corrMu       sync.Mutex
+	correlations map[string]correlationEntry
 }
 
-// NewEventBus creates a new instance of EventBus and connects to RabbitMQ.
-func NewEventBus(rabbitMQURL string) (*EventBus, error) {
-	conn, err := amqp.Dial(rabbitMQURL)
-	if err != nil {
-		return nil, fmt.Errorf("RabbitMQ connection failed: %w", err)
-	}
-	channel, err := conn.Channel()
-	if err != nil {
-		return nil, fmt.Errorf("dial: %w", err)
-	}
+type correlationEntry struct {
+	ID   string
+	Seen time.Time
+}
 
-	const exchangeName = "saga_events"
-	if err := channel.ExchangeDeclare(
-		exchangeName, "topic", true, false, false, false, nil,
-	); err != nil {
-		_ = conn.Close()
-		return nil, fmt.Errorf("exchange statement failed: %w", err)
-	}
+// correlationTTL is how long the correlation ID of an order is remembered.
+const correlationTTL = time.Hour
 
+// NewEventBus creates a new instance of EventBus and connects to RabbitMQ. When the connection
+// is later lost, the bus reconnects by itself and restores its subscriptions, see watch.
+func NewEventBus(rabbitMQURL string) (*EventBus, error) {
 	timeoutStr := os.Getenv("RABBITMQ_PUBLISH_TIMEOUT_SECONDS")
 	if timeoutStr == "" {
 		timeoutStr = "5" // Default timeout
@@ -54,77 +91,341 @@ func NewEventBus(rabbitMQURL string) (*EventBus, error) {
 		timeout = 5
 	}
 
-	log.Printf("[EventBus] Connected to RabbitMQ %s. Exchange '%s' declared.", rabbitMQURL, exchangeName)
-
-	return &EventBus{
-		conn:           conn,
-		channel:        channel,
-		exchange:       exchangeName,
+	eb := &EventBus{
+		url:            rabbitMQURL,
+		exchange:       "saga_events",
 		subscribers:    make(map[events.EventType][]EventHandler),
 		publishTimeout: time.Duration(timeout) * time.Second,
-	}, nil
+		quota:          loadQuota(),
+		correlations:   make(map[string]correlationEntry),
+	}
+	if err := eb.connect(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[EventBus] Connected to RabbitMQ %s. Exchange '%s' declared.", rabbitMQURL, eb.exchange)
+	config.SetSecret("RABBITMQ_URL", rabbitMQURL)
+	config.Set("RABBITMQ_PUBLISH_TIMEOUT_SECONDS", timeout)
+	config.Set("EVENT_BUS_MAX_DELIVERY_ATTEMPTS", maxDeliveryAttempts)
+	config.Set("EVENT_BUS_RECONNECT_MAX_DELAY_SECONDS", reconnectMaxDelay)
+	config.Set("EVENT_BUS_PUBLISH_RETRY_MS", publishRetryWindow)
+
+	go eb.watch()
+	return eb, nil
 }
 
-// Close closes the connection and the RabbitMQ channel.
+// Close closes the connection and the RabbitMQ channel. The bus does not reconnect afterwards.
 func (eb *EventBus) Close() {
-	if eb.channel != nil {
-		if err := eb.channel.Close(); err != nil {
+	eb.closed.Store(true)
+	conn, channel := eb.current()
+	if channel != nil {
+		if err := channel.Close(); err != nil {
 			log.Printf("[EventBus] Failed to close channel: %v", err)
 		}
 	}
-	if eb.conn != nil {
-		if err := eb.conn.Close(); err != nil {
+	if conn != nil {
+		if err := conn.Close(); err != nil {
 			log.Printf("[EventBus] Failed to close connection: %v", err)
 		}
 	}
 }
 
-// Publish publishes an event on RabbitMQ.
+// Shutdown stops consuming and waits, until ctx ends, for the handlers already running to
+// finish, then closes the connection. Publishing keeps working while the handlers drain.
+func (eb *EventBus) Shutdown(ctx context.Context) {
+	eb.stopping.Store(true)
+	_, channel := eb.current()
+	eb.subsMu.RLock()
+	for _, sub := range eb.subscriptions {
+		if err := channel.Cancel(sub.consumerTag, false); err != nil {
+			log.Printf("[EventBus] Failed to cancel the consumer of '%s': %v", sub.EventType, err)
+		}
+	}
+	eb.subsMu.RUnlock()
+
+	done := make(chan struct{})
+	go func() {
+		eb.delivering.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("[EventBus] Consumers drained")
+	case <-ctx.Done():
+		log.Println("[EventBus] Shutdown deadline reached with handlers still running")
+	}
+	eb.Close()
+}
+
+// IsConnected reports whether the RabbitMQ connection and channel are still open.
+func (eb *EventBus) IsConnected() bool {
+	conn, channel := eb.current()
+	return conn != nil && !conn.IsClosed() && channel != nil && !channel.IsClosed()
+}
+
+// Healthy reports whether the bus is connected and not in the middle of a reconnection,
+// i.e. whether events can be published and every subscription is consuming again.
+func (eb *EventBus) Healthy() bool {
+	return !eb.reconnecting.Load() && eb.IsConnected()
+}
+
+// errPublish wraps the errors of the broker refusing or timing out a publish.
+var errPublish = errors.New("publish message")
+
+// Publish publishes an event on RabbitMQ. Events breaking the publisher quota are
+// rejected with a *QuotaError, and every event with ErrDisconnected while the bus reconnects.
+// Publish tries once: the callers retry, see PublishRetry.
 func (eb *EventBus) Publish(event events.GenericEvent) error {
+	if event.CorrelationID == "" {
+		event.CorrelationID = eb.correlationOf(event.OrderID)
+	}
+	eb.rememberCorrelation(event.OrderID, event.CorrelationID)
+	eb.checkProduced(event.Type)
 	body, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("marshal event: %w", err)
 	}
+	if err := eb.quota.check(event.Type, len(body)); err != nil {
+		return err
+	}
+	if !eb.Healthy() {
+		return ErrDisconnected
+	}
+	_, channel := eb.current()
 	ctx, cancel := context.WithTimeout(context.Background(), eb.publishTimeout)
 	defer cancel()
-	if err := eb.channel.PublishWithContext(
+	if err := channel.PublishWithContext(
 		ctx,
 		eb.exchange,
 		string(event.Type),
 		false,
 		false,
 		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
+			ContentType:   "application/json",
+			AppId:         eb.quota.publisher,
+			DeliveryMode:  amqp.Persistent, // kept by the durable queues across a broker restart
+			CorrelationId: event.CorrelationID,
+			Body:          body,
 		}); err != nil {
-		return fmt.Errorf("publish message: %w", err)
+		return fmt.Errorf("%w: %w", errPublish, err)
+	}
+	eb.remember(event, true, "")
+	correlation.Logf(event.CorrelationID, "[EventBus] Published event '%s' for Order %s", event.Type, event.OrderID)
+	return nil
+}
+
+// SubscribeOption configures optional lifecycle callbacks of a subscription.
+type SubscribeOption func(*subscription)
+
+// OnStarted is called every time the consumer starts, including after a re-subscription.
+func OnStarted(f func()) SubscribeOption {
+	return func(s *subscription) { s.onStarted = f }
+}
+
+// OnStopped is called when the delivery stream of the consumer ends.
+func OnStopped(f func(err error)) SubscribeOption {
+	return func(s *subscription) { s.onStopped = f }
+}
+
+// OnRedeliveryExhausted is called with an event whose handler kept failing or panicking for
+// every delivery attempt. Without it the event goes to the failed-delivery log.
+func OnRedeliveryExhausted(f func(event events.GenericEvent)) SubscribeOption {
+	return func(s *subscription) { s.onExhausted = f }
+}
+
+// maxDeliveryAttempts bounds how many times a failing handler is retried for the same event.
+var maxDeliveryAttempts = envInt("EVENT_BUS_MAX_DELIVERY_ATTEMPTS", 3)
+
+// AllEvents subscribes to every event type, e.g. for auditing.
+const AllEvents events.EventType = "*"
+
+// Subscribe registers an EventHandler for a given EventType, or AllEvents, and starts consuming messages from RabbitMQ.
+func (eb *EventBus) Subscribe(eventType events.EventType, handler EventHandler, opts ...SubscribeOption) error {
+	return eb.SubscribeMany([]events.EventType{eventType}, handler, opts...)
+}
+
+// SubscribeMany registers one EventHandler for several event types. The types share a single
+// queue, so an event matching more than one of them, e.g. through AllEvents, is delivered once.
+func (eb *EventBus) SubscribeMany(types []events.EventType, handler EventHandler, opts ...SubscribeOption) error {
+	keys := routingKeys(types)
+	if len(keys) == 0 {
+		return fmt.Errorf("subscribe: no event types")
 	}
-	log.Printf("[EventBus] Published event '%s' for Order %s", event.Type, event.OrderID)
+	sub := &subscription{EventType: events.EventType(strings.Join(typeNames(types), ",")), RoutingKeys: keys, handler: handler}
+	for _, opt := range opts {
+		opt(sub)
+	}
+	if err := eb.consume(sub); err != nil {
+		return err
+	}
+	eb.subsMu.Lock()
+	eb.subscriptions = append(eb.subscriptions, sub)
+	eb.subsMu.Unlock()
 	return nil
 }
 
-// Subscribe registers an EventHandler for a given EventType and starts consuming messages from RabbitMQ.
-func (eb *EventBus) Subscribe(eventType events.EventType, handler EventHandler) error {
-	q, err := eb.channel.QueueDeclare("", false, true, false, false, nil)
+// routingKeys returns the distinct binding keys of the types; AllEvents binds "#" alone,
+// as it already covers every other type.
+func routingKeys(types []events.EventType) []string {
+	var keys []string
+	seen := make(map[events.EventType]bool, len(types))
+	for _, t := range types {
+		if t == AllEvents {
+			return []string{"#"}
+		}
+		if t != "" && !seen[t] {
+			seen[t] = true
+			keys = append(keys, string(t))
+		}
+	}
+	return keys
+}
+
+// typeNames returns the types as strings, for the label of a subscription.
+func typeNames(types []events.EventType) []string {
+	out := make([]string, 0, len(types))
+	for _, t := range types {
+		out = append(out, string(t))
+	}
+	return out
+}
+
+// consume declares the queue of a subscription, binds it and starts the consumer goroutine.
+func (eb *EventBus) consume(sub *subscription) error {
+	name, err := queueName(sub)
+	if err != nil {
+		return err
+	}
+	_, channel := eb.current()
+	// An anonymous queue goes away with its consumer; a durable one outlives it and the broker.
+	q, err := channel.QueueDeclare(name, sub.durable, !sub.durable, false, false, queueArgs(sub))
 	if err != nil {
 		return fmt.Errorf("queue declare: %w", err)
 	}
-	if err := eb.channel.QueueBind(q.Name, string(eventType), eb.exchange, false, nil); err != nil {
-		return fmt.Errorf("queue bind: %w", err)
+	for _, key := range sub.RoutingKeys {
+		if err := channel.QueueBind(q.Name, key, eb.exchange, false, nil); err != nil {
+			return fmt.Errorf("queue bind %s: %w", key, err)
+		}
 	}
-	messages, err := eb.channel.Consume(q.Name, "", true, false, false, false, nil)
+	tag := "consumer-" + q.Name
+	messages, err := channel.Consume(q.Name, tag, false, false, false, false, nil)
 	if err != nil {
 		return fmt.Errorf("consume: %w", err)
 	}
-	go func() {
-		for d := range messages {
-			var e events.GenericEvent
-			if err := json.Unmarshal(d.Body, &e); err != nil {
-				log.Printf("[EventBus] Failed to unmarshal event body: %v. Body: %s", err, string(d.Body))
-				continue
-			}
-			handler(e)
+	eb.subsMu.Lock()
+	sub.Queue = q.Name
+	sub.consumerTag = tag
+	eb.subsMu.Unlock()
+
+	if sub.onStarted != nil {
+		sub.onStarted()
+	}
+	eb.delivering.Add(1)
+	go eb.deliver(sub, messages)
+	return nil
+}
+
+// deliver runs the handler of a subscription for every message until the delivery stream ends.
+// The handler runs on the lanes of the subscription, in order for the events of the same order.
+func (eb *EventBus) deliver(sub *subscription, messages <-chan amqp.Delivery) {
+	defer eb.delivering.Done()
+	workers := newLanes(orderWorkers)
+	for d := range messages {
+		var e events.GenericEvent
+		if err := json.Unmarshal(d.Body, &e); err != nil {
+			log.Printf("[EventBus] Failed to unmarshal event body: %v. Body: %s", err, string(d.Body))
+			_ = d.Nack(false, false)
+			continue
+		}
+		if e.CorrelationID == "" {
+			e.CorrelationID = d.CorrelationId
+		}
+		eb.rememberCorrelation(e.OrderID, e.CorrelationID)
+		eb.remember(e, false, sub.Queue)
+		workers.dispatch(e.OrderID, func() {
+			eb.settle(sub, d, e)
+			eb.subsMu.Lock()
+			sub.LastDelivery = time.Now()
+			eb.subsMu.Unlock()
+		})
+	}
+	workers.close()
+
+	err := fmt.Errorf("delivery stream for '%s' closed", sub.EventType)
+	if eb.stopping.Load() {
+		log.Printf("[EventBus] Consumer of '%s' stopped for shutdown", sub.EventType)
+		return
+	}
+	if !eb.Healthy() {
+		err = fmt.Errorf("delivery stream for '%s' closed: RabbitMQ connection lost, resumed after reconnection", sub.EventType)
+	}
+	log.Printf("[EventBus] Consumer stopped: %v", err)
+	if sub.onStopped != nil {
+		sub.onStopped(err)
+	}
+}
+
+// rememberCorrelation records the correlation ID of an order, dropping the expired ones.
+func (eb *EventBus) rememberCorrelation(orderID, id string) {
+	if orderID == "" || id == "" {
+		return
+	}
+	eb.corrMu.Lock()
+	defer eb.corrMu.Unlock()
+	now := time.Now()
+	for k, c := range eb.correlations {
+		if now.Sub(c.Seen) > correlationTTL {
+			delete(eb.correlations, k)
+		}
+	}
+	eb.correlations[orderID] = correlationEntry{ID: id, Seen: now}
+}
+
+// correlationOf returns the correlation ID last seen for an order, or "".
+func (eb *EventBus) correlationOf(orderID string) string {
+	eb.corrMu.Lock()
+	defer eb.corrMu.Unlock()
+	return eb.correlations[orderID].ID
+}
+
+// exhausted hands an event whose handler failed on every attempt to OnRedeliveryExhausted,
+// or to the failed-delivery log without it.
+func (eb *EventBus) exhausted(sub *subscription, e events.GenericEvent, err error, attempts int) {
+	if sub.onExhausted != nil {
+		sub.onExhausted(e)
+		return
+	}
+	eb.recordFailure(sub, e, err, attempts)
+}
+
+// attempt runs the handler up to maxDeliveryAttempts times, waiting with exponential backoff
+// between attempts. It returns the attempts made and the last error, nil once the handler succeeds.
+// A Permanent error is not retried.
+// Only the worker of this order waits, so the other orders and subscriptions keep consuming.
+func (eb *EventBus) attempt(sub *subscription, e events.GenericEvent) (attempts int, err error) {
+	delay := deliveryRetryDelay
+	for attempts = 1; ; attempts++ {
+		if err = safeHandle(sub.handler, e); err == nil {
+			return attempts, nil
+		}
+		log.Printf("[EventBus] Handler for '%s' failed on order %s (attempt %d/%d): %v", e.Type, e.OrderID, attempts, maxDeliveryAttempts, err)
+		if attempts == maxDeliveryAttempts || IsPermanent(err) {
+			return attempts, err
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > maxDeliveryRetryDelay {
+			delay = maxDeliveryRetryDelay
+		}
+	}
+}
+
+// safeHandle calls the handler and returns its error, or an error if it panicked.
+func safeHandle(handler EventHandler, e events.GenericEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[EventBus] Handler panic: %v", r)
+			err = fmt.Errorf("handler panic: %v", r)
 		}
 	}()
-	return nil
+	return handler(e)
 }
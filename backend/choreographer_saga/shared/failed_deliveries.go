@@ -0,0 +1,145 @@
+package shared
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/alerting"
+	"github.com/StitchMl/saga-demo/common/config"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Delivery retries: the first wait between two attempts of a failing handler, doubled
+// after every attempt up to maxDeliveryRetryDelay.
+var deliveryRetryDelay = time.Duration(envInt("EVENT_BUS_RETRY_INITIAL_DELAY_MS", 100)) * time.Millisecond
+
+const maxDeliveryRetryDelay = 5 * time.Second
+
+func init() {
+	config.Set("EVENT_BUS_RETRY_INITIAL_DELAY_MS", deliveryRetryDelay)
+}
+
+// FailedDelivery is an event whose handler failed on every delivery attempt.
+type FailedDelivery struct {
+	EventType events.EventType    `json:"event_type"`
+	OrderID   string              `json:"order_id"`
+	Queue     string              `json:"queue"`
+	LastError string              `json:"last_error"`
+	Attempts  int                 `json:"attempts"`
+	FailedAt  time.Time           `json:"failed_at"`
+	Event     events.GenericEvent `json:"event"`
+
+	sub *subscription
+}
+
+// failedLog keeps the failed deliveries of the bus until they are redelivered.
+type failedLog struct {
+	mu      sync.Mutex
+	entries []*FailedDelivery
+}
+
+// recordFailure appends an exhausted delivery to the failed-delivery log.
+func (eb *EventBus) recordFailure(sub *subscription, e events.GenericEvent, lastErr error, attempts int) {
+	eb.failed.mu.Lock()
+	defer eb.failed.mu.Unlock()
+	eb.failed.entries = append(eb.failed.entries, &FailedDelivery{
+		EventType: e.Type,
+		OrderID:   e.OrderID,
+		Queue:     sub.Queue,
+		LastError: lastErr.Error(),
+		Attempts:  attempts,
+		FailedAt:  time.Now(),
+		Event:     e,
+		sub:       sub,
+	})
+	log.Printf("[EventBus] Event '%s' for order %s moved to the failed deliveries after %d attempts: %v", e.Type, e.OrderID, attempts, lastErr)
+	alerting.RetriesExhausted(alerting.Alert{
+		Operation:     "deliver " + string(e.Type),
+		Attempts:      attempts,
+		LastError:     lastErr.Error(),
+		CorrelationID: e.CorrelationID,
+		OrderID:       e.OrderID,
+	})
+}
+
+// FailedDeliveries returns a snapshot of the failed-delivery log.
+func (eb *EventBus) FailedDeliveries() []FailedDelivery {
+	eb.failed.mu.Lock()
+	defer eb.failed.mu.Unlock()
+	out := make([]FailedDelivery, 0, len(eb.failed.entries))
+	for _, f := range eb.failed.entries {
+		out = append(out, *f)
+	}
+	return out
+}
+
+// Redeliver runs the handler of every failed delivery again, with the same retries as a
+// normal delivery. Entries are removed when their handler succeeds. The subscriptions are
+// retried in parallel, so a slow handler does not delay the others.
+func (eb *EventBus) Redeliver() (delivered, failed int) {
+	eb.failed.mu.Lock()
+	pending := eb.failed.entries
+	eb.failed.entries = nil
+	eb.failed.mu.Unlock()
+
+	bySub := make(map[*subscription][]*FailedDelivery)
+	for _, f := range pending {
+		bySub[f.sub] = append(bySub[f.sub], f)
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		still []*FailedDelivery
+	)
+	for sub, entries := range bySub {
+		wg.Add(1)
+		go func(sub *subscription, entries []*FailedDelivery) {
+			defer wg.Done()
+			for _, f := range entries {
+				attempts, err := eb.attempt(sub, f.Event)
+				mu.Lock()
+				if err == nil {
+					delivered++
+				} else {
+					f.LastError = err.Error()
+					f.Attempts += attempts
+					f.FailedAt = time.Now()
+					still = append(still, f)
+				}
+				mu.Unlock()
+			}
+		}(sub, entries)
+	}
+	wg.Wait()
+
+	eb.failed.mu.Lock()
+	eb.failed.entries = append(still, eb.failed.entries...)
+	eb.failed.mu.Unlock()
+	return delivered, len(still)
+}
+
+// FailedDeliveriesHandler serves GET /failed_deliveries with the failed-delivery log.
+func (eb *EventBus) FailedDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(eb.FailedDeliveries())
+}
+
+// RedeliverHandler serves POST /failed_deliveries/redeliver, re-attempting every failed delivery.
+func (eb *EventBus) RedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	delivered, failed := eb.Redeliver()
+	log.Printf("[EventBus] Redelivery: %d delivered, %d still failing", delivered, failed)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"delivered": delivered, "failed": failed})
+}
@@ -0,0 +1,159 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeStream runs the consumer of sub on a delivery stream the test feeds and closes, as the
+// broker does when the channel or the connection goes away.
+func fakeStream(eb *EventBus, sub *subscription) chan<- amqp.Delivery {
+	messages := make(chan amqp.Delivery, 4)
+	eb.delivering.Add(1)
+	go eb.deliver(sub, messages)
+	return messages
+}
+
+func delivery(t *testing.T, orderID string, redelivered bool) amqp.Delivery {
+	t.Helper()
+	body, err := json.Marshal(events.NewGenericEvent(events.OrderCreatedEvent, orderID, "test", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amqp.Delivery{Body: body, Redelivered: redelivered}
+}
+
+func newStreamBus() *EventBus {
+	return &EventBus{correlations: make(map[string]correlationEntry)}
+}
+
+func TestOnStopped(t *testing.T) {
+	t.Run("stream closed", func(t *testing.T) {
+		eb := newStreamBus()
+		stopped := make(chan error, 1)
+		sub := &subscription{EventType: events.OrderCreatedEvent, handler: func(events.GenericEvent) error { return nil }}
+		OnStopped(func(err error) { stopped <- err })(sub)
+
+		close(fakeStream(eb, sub))
+		select {
+		case err := <-stopped:
+			if err == nil || !strings.Contains(err.Error(), "connection lost") {
+				t.Errorf("OnStopped(%v), want the lost connection", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("OnStopped not called when the delivery stream closed")
+		}
+	})
+	t.Run("shutdown", func(t *testing.T) {
+		eb := newStreamBus()
+		var called atomic.Bool
+		sub := &subscription{EventType: events.OrderCreatedEvent, handler: func(events.GenericEvent) error { return nil }}
+		OnStopped(func(error) { called.Store(true) })(sub)
+
+		eb.stopping.Store(true)
+		close(fakeStream(eb, sub))
+		eb.delivering.Wait()
+		if called.Load() {
+			t.Error("OnStopped called for a shutdown")
+		}
+	})
+}
+
+// An event whose handler keeps failing goes to OnRedeliveryExhausted once the attempts run out,
+// and to the failed deliveries without it.
+func TestOnRedeliveryExhausted(t *testing.T) {
+	defer func(attempts int, delay time.Duration) {
+		maxDeliveryAttempts, deliveryRetryDelay = attempts, delay
+	}(maxDeliveryAttempts, deliveryRetryDelay)
+	maxDeliveryAttempts, deliveryRetryDelay = 2, time.Millisecond
+
+	tests := []struct {
+		name        string
+		err         error
+		redelivered bool
+		withOption  bool
+		calls       int32
+	}{
+		{name: "redelivered event", err: errors.New("store down"), redelivered: true, withOption: true, calls: 2},
+		{name: "permanent error", err: Permanent(errors.New("malformed payload")), withOption: true, calls: 1},
+		{name: "no callback", err: errors.New("store down"), redelivered: true, calls: 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			eb := newStreamBus()
+			var calls atomic.Int32
+			sub := &subscription{EventType: events.OrderCreatedEvent, handler: func(events.GenericEvent) error {
+				calls.Add(1)
+				return tc.err
+			}}
+			exhausted := make(chan events.GenericEvent, 1)
+			if tc.withOption {
+				OnRedeliveryExhausted(func(e events.GenericEvent) { exhausted <- e })(sub)
+			}
+
+			messages := fakeStream(eb, sub)
+			messages <- delivery(t, "poison-order", tc.redelivered)
+			close(messages)
+			eb.delivering.Wait()
+
+			if n := calls.Load(); n != tc.calls {
+				t.Errorf("handler ran %d times, want %d", n, tc.calls)
+			}
+			failed := eb.FailedDeliveries()
+			if !tc.withOption {
+				if len(failed) != 1 || failed[0].OrderID != "poison-order" || failed[0].Attempts != int(tc.calls) {
+					t.Errorf("failed deliveries = %+v, want the event after %d attempts", failed, tc.calls)
+				}
+				return
+			}
+			select {
+			case e := <-exhausted:
+				if e.OrderID != "poison-order" {
+					t.Errorf("OnRedeliveryExhausted got order %s", e.OrderID)
+				}
+			default:
+				t.Fatal("OnRedeliveryExhausted not called")
+			}
+			if len(failed) != 0 {
+				t.Errorf("failed deliveries = %+v, want the event left to the callback", failed)
+			}
+		})
+	}
+}
+
+// OnStarted runs when the consumer starts and again once it is restored after a lost
+// connection, which in between ends the stream with OnStopped.
+func TestLifecycleAcrossReconnect(t *testing.T) {
+	url := brokerURL(t)
+	defer func(delay time.Duration) { reconnectInitialDelay = delay }(reconnectInitialDelay)
+	reconnectInitialDelay = 10 * time.Millisecond
+
+	eb, err := NewEventBus(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eb.Close()
+	var started, stopped atomic.Int32
+	handler, _ := receiver()
+	if err := eb.Subscribe(events.OrderCreatedEvent, handler,
+		OnStarted(func() { started.Add(1) }),
+		OnStopped(func(error) { stopped.Add(1) }),
+	); err != nil {
+		t.Fatal(err)
+	}
+	if started.Load() != 1 {
+		t.Fatalf("OnStarted called %d times on Subscribe", started.Load())
+	}
+
+	conn, _ := eb.current()
+	_ = conn.Close()
+	waitFor(t, time.Second, "OnStopped", func() bool { return stopped.Load() == 1 })
+	waitFor(t, 5*time.Second, "OnStarted after the reconnection", func() bool { return started.Load() == 2 })
+}
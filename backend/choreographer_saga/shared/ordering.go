@@ -0,0 +1,68 @@
+package shared
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/StitchMl/saga-demo/common/config"
+)
+
+// orderWorkers is the number of goroutines that run the handler of each subscription.
+// 1 delivers every event of a subscription one after the other.
+var orderWorkers = envInt("EVENT_BUS_ORDER_WORKERS", 4)
+
+// laneBuffer is how many events a worker may have waiting before the consumer blocks.
+const laneBuffer = 64
+
+func init() {
+	config.Set("EVENT_BUS_ORDER_WORKERS", orderWorkers)
+}
+
+// lanes spreads the events of a subscription over a fixed pool of workers, picked by a hash of
+// the order_id of the event envelope. The events of one order always go to the same worker, so
+// they reach the handler in the order they were received, while different orders run in parallel.
+// Events without an order_id all go to the first worker and keep their relative order.
+type lanes struct {
+	work []chan func()
+	wg   sync.WaitGroup
+}
+
+// newLanes starts n workers.
+func newLanes(n int) *lanes {
+	l := &lanes{work: make([]chan func(), n)}
+	for i := range l.work {
+		ch := make(chan func(), laneBuffer)
+		l.work[i] = ch
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			for f := range ch {
+				f()
+			}
+		}()
+	}
+	return l
+}
+
+// dispatch queues f on the worker of orderID.
+func (l *lanes) dispatch(orderID string, f func()) {
+	l.work[laneOf(orderID, len(l.work))] <- f
+}
+
+// close stops the workers once they have run what is queued.
+func (l *lanes) close() {
+	for _, ch := range l.work {
+		close(ch)
+	}
+	l.wg.Wait()
+}
+
+// laneOf returns the worker of an order ID among n.
+func laneOf(orderID string, n int) int {
+	if orderID == "" || n == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(orderID))
+	return int(h.Sum32() % uint32(n))
+}
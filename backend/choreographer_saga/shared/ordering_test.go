@@ -0,0 +1,131 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// sequenced is an event of orderID carrying its publish position.
+func sequenced(t *testing.T, orderID string, seq int) amqp.Delivery {
+	t.Helper()
+	body, err := json.Marshal(events.NewGenericEvent(events.OrderCreatedEvent, orderID, "test", map[string]int{"seq": seq}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amqp.Delivery{Body: body}
+}
+
+func seqOf(e events.GenericEvent) int {
+	var payload struct {
+		Seq int `json:"seq"`
+	}
+	raw, _ := json.Marshal(e.Payload)
+	_ = json.Unmarshal(raw, &payload)
+	return payload.Seq
+}
+
+// Events of one order reach the handler in publish order, however long each one takes; events
+// without an order_id keep their order too.
+func TestDeliveryOrderedPerOrder(t *testing.T) {
+	const perOrder = 30
+	orders := []string{"order-a", "order-b", "order-c", ""}
+	var mu sync.Mutex
+	got := make(map[string][]int)
+	var handled sync.WaitGroup
+	handled.Add(len(orders) * perOrder)
+	sub := &subscription{EventType: events.OrderCreatedEvent, handler: func(e events.GenericEvent) error {
+		time.Sleep(time.Duration(rand.Intn(300)) * time.Microsecond)
+		mu.Lock()
+		got[e.OrderID] = append(got[e.OrderID], seqOf(e))
+		mu.Unlock()
+		handled.Done()
+		return nil
+	}}
+	eb := newStreamBus()
+	stream := fakeStream(eb, sub)
+	for seq := 0; seq < perOrder; seq++ {
+		for _, id := range orders {
+			stream <- sequenced(t, id, seq)
+		}
+	}
+	handled.Wait()
+	close(stream)
+	eb.delivering.Wait()
+
+	for _, id := range orders {
+		if len(got[id]) != perOrder {
+			t.Errorf("order %q: %d events handled, want %d", id, len(got[id]), perOrder)
+			continue
+		}
+		for i, seq := range got[id] {
+			if seq != i {
+				t.Errorf("order %q handled in order %v, want publish order", id, got[id])
+				break
+			}
+		}
+	}
+}
+
+// An order whose handler is stuck does not hold up the orders of the other workers.
+func TestDeliveryOrdersInParallel(t *testing.T) {
+	if orderWorkers < 2 {
+		t.Skip("EVENT_BUS_ORDER_WORKERS=1 delivers every event in sequence")
+	}
+	slow, fast := "order-slow", ""
+	for i := 0; fast == ""; i++ {
+		if id := fmt.Sprintf("order-fast-%d", i); laneOf(id, orderWorkers) != laneOf(slow, orderWorkers) {
+			fast = id
+		}
+	}
+	release := make(chan struct{})
+	fastDone := make(chan struct{})
+	sub := &subscription{EventType: events.OrderCreatedEvent, handler: func(e events.GenericEvent) error {
+		if e.OrderID == slow {
+			<-release
+		} else {
+			close(fastDone)
+		}
+		return nil
+	}}
+	eb := newStreamBus()
+	stream := fakeStream(eb, sub)
+	stream <- sequenced(t, slow, 0)
+	stream <- sequenced(t, fast, 0)
+
+	select {
+	case <-fastDone:
+	case <-time.After(time.Second):
+		t.Error("the second order waited for the first one")
+	}
+	close(release)
+	close(stream)
+	eb.delivering.Wait()
+}
+
+func TestLaneOf(t *testing.T) {
+	if lane := laneOf("", 8); lane != 0 {
+		t.Errorf("events without an order go to worker %d, want 0", lane)
+	}
+	if lane := laneOf("order-a", 1); lane != 0 {
+		t.Errorf("single worker picked %d", lane)
+	}
+	used := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("order-%d", i)
+		lane := laneOf(id, 8)
+		if lane < 0 || lane >= 8 || lane != laneOf(id, 8) {
+			t.Fatalf("laneOf(%q) = %d, not a stable worker among 8", id, lane)
+		}
+		used[lane] = true
+	}
+	if len(used) < 4 {
+		t.Errorf("100 orders spread over %d of 8 workers", len(used))
+	}
+}
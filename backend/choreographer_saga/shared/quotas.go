@@ -0,0 +1,144 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// anonymousPublisher identifies a bus whose EVENT_BUS_PUBLISHER is not set.
+const anonymousPublisher = "anonymous"
+
+// defaultQuotaKey is the entry of the policy file applied to publishers without their own.
+const defaultQuotaKey = "*"
+
+// PublisherQuota limits what a publisher may put on the bus; zero values mean no limit.
+type PublisherQuota struct {
+	MaxPayloadBytes    int                `json:"max_payload_bytes,omitempty"`
+	MaxEventsPerSecond int                `json:"max_events_per_second,omitempty"`
+	AllowedEventTypes  []events.EventType `json:"allowed_event_types,omitempty"`
+}
+
+// QuotaError is returned by Publish when an event breaks the quota of its publisher.
+type QuotaError struct {
+	Publisher string `json:"publisher"`
+	Quota     string `json:"quota"`
+	Limit     string `json:"limit"`
+	Actual    string `json:"actual"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("publisher %s exceeded the %s quota (limit %s, got %s)", e.Publisher, e.Quota, e.Limit, e.Actual)
+}
+
+// StatusCode is the HTTP status a handler should answer with: 413 for oversized payloads, 429 otherwise.
+func (e *QuotaError) StatusCode() int {
+	if e.Quota == "max_payload_bytes" {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusTooManyRequests
+}
+
+// quotaState enforces the quota of the publisher of this bus.
+type quotaState struct {
+	publisher string
+	quota     *PublisherQuota // nil when no policy applies
+
+	mu          sync.Mutex
+	windowStart time.Time
+	windowCount int
+	violations  map[string]int // by quota name
+}
+
+// loadQuota reads the publisher from EVENT_BUS_PUBLISHER and its quota from the JSON policy
+// file in EVENT_BUS_QUOTA_FILE, a map of publisher name (or "*") to PublisherQuota.
+func loadQuota() *quotaState {
+	q := &quotaState{publisher: os.Getenv("EVENT_BUS_PUBLISHER"), violations: make(map[string]int)}
+	if q.publisher == "" {
+		q.publisher = anonymousPublisher
+	}
+	config.Set("EVENT_BUS_PUBLISHER", q.publisher)
+
+	path := os.Getenv("EVENT_BUS_QUOTA_FILE")
+	config.Set("EVENT_BUS_QUOTA_FILE", path)
+	if path == "" {
+		return q
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("[EventBus] Cannot read quota policy %s: %v", path, err)
+	}
+	var policy map[string]PublisherQuota
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		log.Fatalf("[EventBus] Invalid quota policy %s: %v", path, err)
+	}
+	if quota, ok := policy[q.publisher]; ok {
+		q.quota = &quota
+	} else if quota, ok := policy[defaultQuotaKey]; ok {
+		q.quota = &quota
+	}
+	log.Printf("[EventBus] Publisher %s, quota %+v", q.publisher, q.quota)
+	return q
+}
+
+// check returns a *QuotaError when publishing an event of type t with a body of size bytes breaks the quota.
+func (q *quotaState) check(t events.EventType, size int) error {
+	if q.quota == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	violation := func(quota, limit, actual string) error {
+		q.violations[quota]++
+		err := &QuotaError{Publisher: q.publisher, Quota: quota, Limit: limit, Actual: actual}
+		log.Printf("[EventBus] Rejected '%s': %v", t, err)
+		return err
+	}
+
+	if len(q.quota.AllowedEventTypes) > 0 {
+		allowed := false
+		for _, a := range q.quota.AllowedEventTypes {
+			allowed = allowed || a == t
+		}
+		if !allowed {
+			return violation("allowed_event_types", fmt.Sprint(q.quota.AllowedEventTypes), string(t))
+		}
+	}
+	if q.quota.MaxPayloadBytes > 0 && size > q.quota.MaxPayloadBytes {
+		return violation("max_payload_bytes", fmt.Sprint(q.quota.MaxPayloadBytes), fmt.Sprint(size))
+	}
+	if q.quota.MaxEventsPerSecond > 0 {
+		if now := time.Now(); now.Sub(q.windowStart) >= time.Second {
+			q.windowStart, q.windowCount = now, 0
+		}
+		if q.windowCount >= q.quota.MaxEventsPerSecond {
+			return violation("max_events_per_second", fmt.Sprint(q.quota.MaxEventsPerSecond), fmt.Sprint(q.windowCount+1))
+		}
+		q.windowCount++
+	}
+	return nil
+}
+
+// QuotaHandler serves GET /debug/quotas with the publisher, its quota and the violations counted so far.
+func (eb *EventBus) QuotaHandler(w http.ResponseWriter, _ *http.Request) {
+	eb.quota.mu.Lock()
+	violations := make(map[string]int, len(eb.quota.violations))
+	for k, v := range eb.quota.violations {
+		violations[k] = v
+	}
+	eb.quota.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"publisher":  eb.quota.publisher,
+		"quota":      eb.quota.quota,
+		"violations": violations,
+	})
+}
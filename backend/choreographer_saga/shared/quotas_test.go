@@ -0,0 +1,116 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// withQuotaPolicy writes policy to a file and loads the quota of publisher from it; an empty
+// publisher leaves EVENT_BUS_PUBLISHER unset.
+func withQuotaPolicy(t *testing.T, publisher, policy string) *quotaState {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EVENT_BUS_PUBLISHER", publisher)
+	t.Setenv("EVENT_BUS_QUOTA_FILE", path)
+	return loadQuota()
+}
+
+const quotaPolicy = `{
+	"order": {"max_payload_bytes": 100, "max_events_per_second": 2, "allowed_event_types": ["OrderCreated"]},
+	"*": {"max_payload_bytes": 10}
+}`
+
+func quotaBroken(t *testing.T, err error) *QuotaError {
+	t.Helper()
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("err = %v, want a *QuotaError", err)
+	}
+	return quotaErr
+}
+
+func TestQuotas(t *testing.T) {
+	t.Run("event type", func(t *testing.T) {
+		q := withQuotaPolicy(t, "order", quotaPolicy)
+		err := quotaBroken(t, q.check(events.PaymentProcessedEvent, 10))
+		if err.Quota != "allowed_event_types" || err.Publisher != "order" || err.StatusCode() != http.StatusTooManyRequests {
+			t.Errorf("err = %+v", err)
+		}
+	})
+	t.Run("payload size", func(t *testing.T) {
+		q := withQuotaPolicy(t, "order", quotaPolicy)
+		if err := q.check(events.OrderCreatedEvent, 100); err != nil {
+			t.Fatalf("a payload at the limit was rejected: %v", err)
+		}
+		err := quotaBroken(t, q.check(events.OrderCreatedEvent, 101))
+		if err.Quota != "max_payload_bytes" || err.Limit != "100" || err.Actual != "101" || err.StatusCode() != http.StatusRequestEntityTooLarge {
+			t.Errorf("err = %+v", err)
+		}
+	})
+	t.Run("events per second", func(t *testing.T) {
+		q := withQuotaPolicy(t, "order", quotaPolicy)
+		for i := 0; i < 2; i++ {
+			if err := q.check(events.OrderCreatedEvent, 10); err != nil {
+				t.Fatalf("event %d rejected: %v", i+1, err)
+			}
+		}
+		err := quotaBroken(t, q.check(events.OrderCreatedEvent, 10))
+		if err.Quota != "max_events_per_second" || err.Actual != "3" || err.StatusCode() != http.StatusTooManyRequests {
+			t.Errorf("err = %+v", err)
+		}
+	})
+	t.Run("unauthenticated publisher", func(t *testing.T) {
+		q := withQuotaPolicy(t, "", quotaPolicy)
+		if q.publisher != anonymousPublisher {
+			t.Fatalf("publisher %q, want %s", q.publisher, anonymousPublisher)
+		}
+		if err := q.check(events.PaymentProcessedEvent, 10); err != nil {
+			t.Errorf("the default quota restricts event types: %v", err)
+		}
+		if err := quotaBroken(t, q.check(events.OrderCreatedEvent, 11)); err.Quota != "max_payload_bytes" || err.Publisher != anonymousPublisher {
+			t.Errorf("err = %+v, want the default payload limit", err)
+		}
+	})
+	t.Run("no policy", func(t *testing.T) {
+		t.Setenv("EVENT_BUS_QUOTA_FILE", "")
+		q := loadQuota()
+		if err := q.check(events.OrderCreatedEvent, 1<<24); err != nil {
+			t.Errorf("rejected without a policy: %v", err)
+		}
+	})
+}
+
+// /debug/quotas counts the violations by quota.
+func TestQuotaHandler(t *testing.T) {
+	eb := &EventBus{quota: withQuotaPolicy(t, "order", quotaPolicy)}
+	_ = eb.quota.check(events.OrderCreatedEvent, 500)
+	_ = eb.quota.check(events.OrderCreatedEvent, 500)
+	_ = eb.quota.check(events.PaymentProcessedEvent, 10)
+
+	rec := httptest.NewRecorder()
+	eb.QuotaHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/quotas", nil))
+	var body struct {
+		Publisher  string          `json:"publisher"`
+		Quota      *PublisherQuota `json:"quota"`
+		Violations map[string]int  `json:"violations"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Publisher != "order" || body.Quota == nil || body.Quota.MaxPayloadBytes != 100 {
+		t.Errorf("publisher %q, quota %+v", body.Publisher, body.Quota)
+	}
+	if body.Violations["max_payload_bytes"] != 2 || body.Violations["allowed_event_types"] != 1 {
+		t.Errorf("violations = %v", body.Violations)
+	}
+}
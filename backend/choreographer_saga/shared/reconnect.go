@@ -0,0 +1,158 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/alerting"
+	events "github.com/StitchMl/saga-demo/common/types"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrDisconnected is returned by Publish while the connection to RabbitMQ is being restored.
+var ErrDisconnected = errors.New("event bus disconnected from RabbitMQ, reconnecting")
+
+// Backoff between two reconnection attempts: it starts at reconnectInitialDelay and doubles up
+// to EVENT_BUS_RECONNECT_MAX_DELAY_SECONDS.
+var (
+	reconnectInitialDelay = 500 * time.Millisecond
+	reconnectMaxDelay     = envSeconds("EVENT_BUS_RECONNECT_MAX_DELAY_SECONDS", 30)
+)
+
+// publishRetryWindow is how long PublishRetry waits for the bus to reconnect (EVENT_BUS_PUBLISH_RETRY_MS).
+var publishRetryWindow = time.Duration(envInt("EVENT_BUS_PUBLISH_RETRY_MS", 2000)) * time.Millisecond
+
+// dial opens the connections to RabbitMQ; tests replace it to make the connection flaky.
+var dial = amqp.Dial
+
+// PublishRetry publishes the event on bus, trying again with backoff while the bus is
+// disconnected or the broker fails the publish, for up to EVENT_BUS_PUBLISH_RETRY_MS, and
+// raises an alert when the attempts run out. It is meant for the publishers with no delivery to
+// requeue, e.g. HTTP handlers: event handlers return the error instead, so that the event they
+// handle is redelivered, and alerted on, by the bus.
+func PublishRetry(bus Bus, event events.GenericEvent) error {
+	deadline := time.Now().Add(publishRetryWindow)
+	delay := 100 * time.Millisecond
+	for attempts := 1; ; attempts++ {
+		err := bus.Publish(event)
+		if !errors.Is(err, ErrDisconnected) && !errors.Is(err, errPublish) {
+			return err
+		}
+		if time.Now().Add(delay).After(deadline) {
+			alerting.RetriesExhausted(alerting.Alert{
+				Operation:     "publish " + string(event.Type),
+				Attempts:      attempts,
+				LastError:     err.Error(),
+				CorrelationID: event.CorrelationID,
+				OrderID:       event.OrderID,
+			})
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// current returns the connection and the channel in use.
+func (eb *EventBus) current() (*amqp.Connection, *amqp.Channel) {
+	eb.connMu.RLock()
+	defer eb.connMu.RUnlock()
+	return eb.conn, eb.channel
+}
+
+// connect dials RabbitMQ, opens the channel, sets its prefetch and declares the exchange, then
+// makes them current.
+func (eb *EventBus) connect() error {
+	conn, err := dial(eb.url)
+	if err != nil {
+		return fmt.Errorf("RabbitMQ connection failed: %w", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("dial: %w", err)
+	}
+	if err := channel.ExchangeDeclare(
+		eb.exchange, "topic", true, false, false, false, nil,
+	); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("exchange statement failed: %w", err)
+	}
+	// Each consumer holds at most prefetch unacknowledged messages, so a slow handler leaves
+	// the rest of its queue on the broker.
+	if err := channel.Qos(prefetch, 0, false); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("qos: %w", err)
+	}
+	eb.connMu.Lock()
+	eb.conn, eb.channel = conn, channel
+	eb.connMu.Unlock()
+	return nil
+}
+
+// watch waits for the connection or its channel to close and restores both, then the
+// subscriptions, until Shutdown or Close ends the bus. A channel closed by the broker on a
+// live connection is recovered the same way, with a new connection.
+func (eb *EventBus) watch() {
+	for {
+		conn, channel := eb.current()
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+		var reason *amqp.Error
+		select {
+		case reason = <-connClosed:
+		case reason = <-channelClosed:
+		}
+		if eb.stopping.Load() || eb.closed.Load() {
+			return
+		}
+		log.Printf("[EventBus] RabbitMQ connection lost (%v), reconnecting", reason)
+		eb.reconnecting.Store(true)
+		_ = conn.Close()
+		if !eb.reconnect() {
+			return
+		}
+		eb.resubscribe()
+		eb.reconnecting.Store(false)
+	}
+}
+
+// reconnect dials again with exponential backoff until it succeeds, or returns false if the
+// bus is stopped in the meantime.
+func (eb *EventBus) reconnect() bool {
+	delay := reconnectInitialDelay
+	for attempt := 1; ; attempt++ {
+		if eb.stopping.Load() || eb.closed.Load() {
+			return false
+		}
+		err := eb.connect()
+		if err == nil {
+			log.Printf("[EventBus] Reconnected to RabbitMQ after %d attempt(s)", attempt)
+			return true
+		}
+		log.Printf("[EventBus] Reconnection attempt %d failed, retrying in %s: %v", attempt, delay, err)
+		time.Sleep(delay)
+		if delay *= 2; delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// resubscribe declares the queue of every recorded subscription on the new channel and starts
+// its consumer again. A subscription that fails here is retried by the verifier.
+func (eb *EventBus) resubscribe() {
+	eb.consumeMu.Lock()
+	defer eb.consumeMu.Unlock()
+	eb.subsMu.RLock()
+	subs := append([]*subscription(nil), eb.subscriptions...)
+	eb.subsMu.RUnlock()
+
+	for _, sub := range subs {
+		if err := eb.consume(sub); err != nil {
+			log.Printf("[EventBus] Re-subscription to '%s' after reconnection failed: %v", sub.EventType, err)
+		}
+	}
+	log.Printf("[EventBus] %d subscription(s) restored after reconnection", len(subs))
+}
@@ -0,0 +1,214 @@
+package shared
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/responses"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// HistoryEntry is an event the bus published or delivered, as kept for replays.
+type HistoryEntry struct {
+	ID        int64               `json:"id"`
+	Published bool                `json:"published"`        // published by this service
+	Queues    []string            `json:"queues,omitempty"` // subscriptions of this service it was delivered to
+	At        time.Time           `json:"at"`
+	Event     events.GenericEvent `json:"event"`
+}
+
+// ReplayResult is the outcome of re-sending one event of the history.
+type ReplayResult struct {
+	EventID   int64            `json:"event_id"`
+	EventType events.EventType `json:"event_type"`
+	Target    string           `json:"target"` // "all" or the queue it was handed to
+	Delivered bool             `json:"delivered"`
+	Attempts  int              `json:"attempts,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// eventHistory keeps the events of every order seen in the last correlationTTL.
+type eventHistory struct {
+	mu      sync.Mutex
+	nextID  int64
+	byOrder map[string][]*HistoryEntry
+	seen    map[string]time.Time
+}
+
+// remember adds e to the history of its order, or marks the entry already there for the
+// same event (same type and timestamp) as published or delivered to queue.
+func (eb *EventBus) remember(e events.GenericEvent, published bool, queue string) {
+	if e.OrderID == "" {
+		return
+	}
+	h := &eb.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if h.byOrder == nil {
+		h.byOrder = make(map[string][]*HistoryEntry)
+		h.seen = make(map[string]time.Time)
+	}
+	for k, t := range h.seen {
+		if now.Sub(t) > correlationTTL {
+			delete(h.seen, k)
+			delete(h.byOrder, k)
+		}
+	}
+	h.seen[e.OrderID] = now
+
+	var entry *HistoryEntry
+	for _, x := range h.byOrder[e.OrderID] {
+		if x.Event.Type == e.Type && x.Event.Timestamp.Equal(e.Timestamp) {
+			entry = x
+			break
+		}
+	}
+	if entry == nil {
+		h.nextID++
+		entry = &HistoryEntry{ID: h.nextID, At: now, Event: e}
+		h.byOrder[e.OrderID] = append(h.byOrder[e.OrderID], entry)
+	}
+	if published {
+		entry.Published = true
+	}
+	if queue != "" && !containsQueue(entry.Queues, queue) {
+		entry.Queues = append(entry.Queues, queue)
+	}
+}
+
+func containsQueue(queues []string, q string) bool {
+	for _, x := range queues {
+		if x == q {
+			return true
+		}
+	}
+	return false
+}
+
+// History returns a copy of the events recorded for an order, oldest first.
+func (eb *EventBus) History(orderID string) []HistoryEntry {
+	eb.history.mu.Lock()
+	defer eb.history.mu.Unlock()
+	out := make([]HistoryEntry, 0, len(eb.history.byOrder[orderID]))
+	for _, x := range eb.history.byOrder[orderID] {
+		c := *x
+		c.Queues = append([]string(nil), x.Queues...)
+		out = append(out, c)
+	}
+	return out
+}
+
+// Replay re-sends the recorded events of an order, or only the one with eventID when it is
+// not zero. With queue empty every event is published again, reaching all the subscribers of
+// every service; otherwise it is handed to the handler of that subscription of this service
+// only, with the usual delivery retries. The handlers receive the original event without its
+// event ID, so they must be ready for duplicates as they already are for RabbitMQ redeliveries.
+func (eb *EventBus) Replay(orderID string, eventID int64, queue string) []ReplayResult {
+	var sub *subscription
+	if queue != "" {
+		eb.subsMu.RLock()
+		for _, s := range eb.subscriptions {
+			if s.Queue == queue {
+				sub = s
+			}
+		}
+		eb.subsMu.RUnlock()
+	}
+
+	var results []ReplayResult
+	for _, entry := range eb.History(orderID) {
+		if eventID != 0 && entry.ID != eventID {
+			continue
+		}
+		res := ReplayResult{EventID: entry.ID, EventType: entry.Event.Type, Target: "all"}
+		// Without its event ID the event gets past the Dedupe of the handlers, as a replay is meant to run them again.
+		event := entry.Event
+		event.EventID = ""
+		switch {
+		case queue == "":
+			if err := eb.Publish(event); err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Delivered, res.Attempts = true, 1
+			}
+		case sub == nil:
+			res.Target, res.Error = queue, "no subscription of this service uses this queue"
+		case !routes(sub, entry.Event.Type):
+			res.Target, res.Error = queue, "the subscription does not receive this event type"
+		default:
+			res.Target = queue
+			attempts, err := eb.attempt(sub, event)
+			res.Attempts = attempts
+			if err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Delivered = true
+			}
+		}
+		log.Printf("[EventBus] Replayed event %d '%s' for order %s to %s: delivered=%t",
+			res.EventID, res.EventType, orderID, res.Target, res.Delivered)
+		results = append(results, res)
+	}
+	return results
+}
+
+// routes reports whether the subscription is bound to events of type t.
+func routes(sub *subscription, t events.EventType) bool {
+	for _, k := range sub.RoutingKeys {
+		if k == "#" || k == string(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplayHandler serves /admin/replay/{orderId}: GET lists the recorded events of the order,
+// POST re-sends them (?event_id= picks one, ?queue= hands them to one subscription of this
+// service instead of publishing them to all) and reports the outcome of each.
+func (eb *EventBus) ReplayHandler(w http.ResponseWriter, r *http.Request) {
+	orderID := strings.TrimPrefix(r.URL.Path, "/admin/replay/")
+	if orderID == "" || strings.Contains(orderID, "/") {
+		http.Error(w, "Order ID required", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	history := eb.History(orderID)
+	if len(history) == 0 {
+		responses.WriteNotFound(w, "order_events", orderID)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		_ = json.NewEncoder(w).Encode(history)
+		return
+	}
+
+	var eventID int64
+	if v := r.URL.Query().Get("event_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid event_id", http.StatusBadRequest)
+			return
+		}
+		eventID = id
+	}
+	results := eb.Replay(orderID, eventID, r.URL.Query().Get("queue"))
+	if len(results) == 0 {
+		if eventID != 0 {
+			responses.WriteNotFound(w, "order_event", strconv.FormatInt(eventID, 10))
+		} else {
+			responses.WriteNotFound(w, "order_events", orderID)
+		}
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"order_id": orderID, "replayed": results})
+}
@@ -0,0 +1,99 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestReplayUnknownOrderNotFound(t *testing.T) {
+	eb := &EventBus{}
+	rec := httptest.NewRecorder()
+	eb.ReplayHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/replay/bogus-id", nil))
+	var body events.NotFoundResponse
+	if rec.Code != http.StatusNotFound || json.NewDecoder(rec.Body).Decode(&body) != nil {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	if body != (events.NotFoundResponse{Code: events.CodeNotFound, Resource: "order_events", ID: "bogus-id"}) {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+// A payment event lost by the shipping subscriber is replayed to it alone, as recorded in the
+// history of the order; events it does not subscribe to are refused.
+func TestReplayToSubscriber(t *testing.T) {
+	const orderID, queue = "replay-order", "shipping_payment_processed"
+	handled := make(chan events.GenericEvent, 4)
+	shipping := &subscription{EventType: events.PaymentProcessedEvent, RoutingKeys: []string{string(events.PaymentProcessedEvent)},
+		Queue: queue, handler: func(e events.GenericEvent) error {
+			handled <- e
+			return nil
+		}}
+	eb := newStreamBus()
+	eb.subscriptions = []*subscription{shipping}
+	eb.remember(events.NewGenericEvent(events.OrderCreatedEvent, orderID, "order-service", nil), true, "")
+	paid := events.NewGenericEvent(events.PaymentProcessedEvent, orderID, "payment-service", events.PaymentPayload{OrderID: orderID, Amount: 30})
+	body, err := json.Marshal(paid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := fakeStream(eb, shipping)
+	stream <- amqp.Delivery{Body: body}
+	<-handled
+	close(stream)
+	eb.delivering.Wait()
+
+	history := eb.History(orderID)
+	if len(history) != 2 || !history[0].Published || history[1].Event.Type != events.PaymentProcessedEvent ||
+		len(history[1].Queues) != 1 || history[1].Queues[0] != queue {
+		t.Fatalf("history = %+v, want the published order and the payment delivered to %s", history, queue)
+	}
+	created, payment := history[0].ID, history[1].ID
+
+	replay := func(query string) (int, []ReplayResult) {
+		rec := httptest.NewRecorder()
+		eb.ReplayHandler(rec, httptest.NewRequest(http.MethodPost, "/admin/replay/"+orderID+"?"+query, nil))
+		var report struct {
+			Replayed []ReplayResult `json:"replayed"`
+		}
+		_ = json.NewDecoder(rec.Body).Decode(&report)
+		return rec.Code, report.Replayed
+	}
+
+	code, results := replay(fmt.Sprintf("event_id=%d&queue=%s", payment, queue))
+	if code != http.StatusOK || len(results) != 1 || !results[0].Delivered || results[0].Attempts != 1 || results[0].Target != queue {
+		t.Fatalf("replay answered %d %+v, want the payment delivered to %s", code, results, queue)
+	}
+	select {
+	case e := <-handled:
+		if e.Type != events.PaymentProcessedEvent || e.OrderID != orderID || e.EventID != "" || !e.Timestamp.Equal(paid.Timestamp) {
+			t.Errorf("shipping received %+v, want the recorded payment without its event ID", e)
+		}
+	default:
+		t.Fatal("the replayed payment did not reach the shipping subscriber")
+	}
+
+	if _, results := replay(fmt.Sprintf("event_id=%d&queue=%s", created, queue)); len(results) != 1 || results[0].Delivered ||
+		!strings.Contains(results[0].Error, "does not receive") {
+		t.Errorf("replaying the order creation to shipping gave %+v", results)
+	}
+	if _, results := replay(fmt.Sprintf("event_id=%d&queue=no-such-queue", payment)); len(results) != 1 || results[0].Delivered {
+		t.Errorf("replaying to an unknown queue gave %+v", results)
+	}
+	if len(handled) != 0 {
+		t.Error("a refused replay reached the shipping subscriber")
+	}
+	rec := httptest.NewRecorder()
+	eb.ReplayHandler(rec, httptest.NewRequest(http.MethodPost, "/admin/replay/"+orderID+"?event_id=999", nil))
+	var notFound events.NotFoundResponse
+	if rec.Code != http.StatusNotFound || json.NewDecoder(rec.Body).Decode(&notFound) != nil ||
+		notFound != (events.NotFoundResponse{Code: events.CodeNotFound, Resource: "order_event", ID: "999"}) {
+		t.Errorf("replaying an unknown event answered %d %s, want the shared 404 body", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,247 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// subscription is a consumer registered through Subscribe.
+type subscription struct {
+	EventType    events.EventType // label of the subscription: its types, comma-separated
+	RoutingKeys  []string
+	Queue        string
+	LastDelivery time.Time
+	LastVerified time.Time
+	handler      EventHandler
+	ack          bool // requeued until the handler succeeds, see WithAck
+	durable      bool // consumes from a named durable queue, see Durable
+	consumerTag  string
+
+	onStarted   func()
+	onStopped   func(err error)
+	onExhausted func(event events.GenericEvent)
+}
+
+// SubscriptionInfo is the public view of a registered subscription.
+type SubscriptionInfo struct {
+	EventType    events.EventType `json:"type"`
+	Queue        string           `json:"queue"`
+	RoutingKey   string           `json:"routing_key"`
+	LastDelivery *time.Time       `json:"last_delivery,omitempty"`
+	LastVerified *time.Time       `json:"last_verified,omitempty"`
+}
+
+// verifierState keeps the outcome of the background subscription verification.
+type verifierState struct {
+	lastSuccess  time.Time
+	failingSince time.Time
+	lastError    string
+	threshold    time.Duration
+}
+
+// Subscriptions returns a snapshot of the subscriptions registered on the bus.
+func (eb *EventBus) Subscriptions() []SubscriptionInfo {
+	eb.subsMu.RLock()
+	defer eb.subsMu.RUnlock()
+
+	out := make([]SubscriptionInfo, 0, len(eb.subscriptions))
+	for _, s := range eb.subscriptions {
+		info := SubscriptionInfo{EventType: s.EventType, Queue: s.Queue, RoutingKey: strings.Join(s.RoutingKeys, ",")}
+		if !s.LastDelivery.IsZero() {
+			t := s.LastDelivery
+			info.LastDelivery = &t
+		}
+		if !s.LastVerified.IsZero() {
+			t := s.LastVerified
+			info.LastVerified = &t
+		}
+		out = append(out, info)
+	}
+	return out
+}
+
+// VerifySubscriptions checks that the queue of every subscription still exists on the broker
+// and re-subscribes the ones that were lost (e.g. after a RabbitMQ restart).
+func (eb *EventBus) VerifySubscriptions() error {
+	if eb.stopping.Load() {
+		return nil
+	}
+	if eb.reconnecting.Load() {
+		err := errors.New("reconnecting to RabbitMQ")
+		eb.recordVerification(err)
+		return err
+	}
+	eb.consumeMu.Lock()
+	defer eb.consumeMu.Unlock()
+	conn, _ := eb.current()
+	eb.subsMu.RLock()
+	subs := append([]*subscription(nil), eb.subscriptions...)
+	eb.subsMu.RUnlock()
+
+	var failed []events.EventType
+	for _, sub := range subs {
+		eb.subsMu.RLock()
+		queue := sub.Queue
+		eb.subsMu.RUnlock()
+
+		// A failed passive declaration closes the channel, so each check uses its own.
+		ch, err := conn.Channel()
+		if err != nil {
+			eb.recordVerification(fmt.Errorf("open verification channel: %w", err))
+			return err
+		}
+		_, err = ch.QueueDeclarePassive(queue, false, true, false, false, nil)
+		if err == nil {
+			_ = ch.Close()
+		} else {
+			log.Printf("[EventBus] Queue %s for '%s' is missing (%v), re-subscribing", queue, sub.EventType, err)
+			if err := eb.consume(sub); err != nil {
+				log.Printf("[EventBus] Re-subscription to '%s' failed: %v", sub.EventType, err)
+				failed = append(failed, sub.EventType)
+				continue
+			}
+		}
+		eb.subsMu.Lock()
+		sub.LastVerified = time.Now()
+		eb.subsMu.Unlock()
+	}
+
+	if len(failed) > 0 {
+		err := fmt.Errorf("re-subscription failed for %v", failed)
+		eb.recordVerification(err)
+		return err
+	}
+	eb.recordVerification(nil)
+	return nil
+}
+
+// recordVerification stores the outcome of a verification round.
+func (eb *EventBus) recordVerification(err error) {
+	eb.subsMu.Lock()
+	defer eb.subsMu.Unlock()
+	if err == nil {
+		eb.verify.lastSuccess = time.Now()
+		eb.verify.failingSince = time.Time{}
+		eb.verify.lastError = ""
+		return
+	}
+	if eb.verify.failingSince.IsZero() {
+		eb.verify.failingSince = time.Now()
+	}
+	eb.verify.lastError = err.Error()
+}
+
+// StartVerifier periodically verifies the subscriptions in the background.
+// The interval and the failure threshold used by Ready are read from
+// EVENT_BUS_VERIFY_INTERVAL_SECONDS and EVENT_BUS_VERIFY_FAILURE_THRESHOLD_SECONDS.
+func (eb *EventBus) StartVerifier() {
+	interval := envSeconds("EVENT_BUS_VERIFY_INTERVAL_SECONDS", 30)
+	threshold := envSeconds("EVENT_BUS_VERIFY_FAILURE_THRESHOLD_SECONDS", 90)
+	config.Set("EVENT_BUS_VERIFY_INTERVAL_SECONDS", interval)
+	config.Set("EVENT_BUS_VERIFY_FAILURE_THRESHOLD_SECONDS", threshold)
+
+	eb.subsMu.Lock()
+	eb.verify.threshold = threshold
+	eb.subsMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := eb.VerifySubscriptions(); err != nil {
+				log.Printf("[EventBus] Subscription verification failed: %v", err)
+			}
+		}
+	}()
+	log.Printf("[EventBus] Subscription verifier started (interval %s, threshold %s)", interval, threshold)
+}
+
+// Ready reports whether the bus can be considered ready, with a reason when it is not.
+func (eb *EventBus) Ready() (bool, string) {
+	if !eb.Healthy() {
+		return false, "RabbitMQ connection lost"
+	}
+	eb.subsMu.RLock()
+	defer eb.subsMu.RUnlock()
+	if !eb.verify.failingSince.IsZero() && time.Since(eb.verify.failingSince) > eb.verify.threshold {
+		return false, "subscription verification failing since " +
+			eb.verify.failingSince.Format(time.RFC3339) + ": " + eb.verify.lastError
+	}
+	return true, ""
+}
+
+// SubscriptionsHandler serves GET /debug/subscriptions.
+func (eb *EventBus) SubscriptionsHandler(w http.ResponseWriter, _ *http.Request) {
+	eb.subsMu.RLock()
+	var lastVerification *time.Time
+	if !eb.verify.lastSuccess.IsZero() {
+		t := eb.verify.lastSuccess
+		lastVerification = &t
+	}
+	lastError := eb.verify.lastError
+	eb.subsMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"subscriptions":     eb.Subscriptions(),
+		"last_verification": lastVerification,
+		"last_error":        lastError,
+	})
+}
+
+// envSeconds reads a duration in seconds from the environment, falling back to def.
+func envSeconds(key string, def int) time.Duration {
+	return time.Duration(envInt(key, def)) * time.Second
+}
+
+// envInt reads a positive integer from the environment, falling back to def.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("[EventBus] Invalid %s value, using default %d", key, def)
+		return def
+	}
+	return n
+}
+
+// QueueDepths returns the number of messages waiting in the queue of every subscription,
+// keyed by event type. Queues that cannot be inspected are reported as -1.
+func (eb *EventBus) QueueDepths() map[events.EventType]int {
+	eb.subsMu.RLock()
+	subs := append([]*subscription(nil), eb.subscriptions...)
+	eb.subsMu.RUnlock()
+
+	conn, _ := eb.current()
+	depths := make(map[events.EventType]int, len(subs))
+	for _, sub := range subs {
+		eb.subsMu.RLock()
+		queue := sub.Queue
+		eb.subsMu.RUnlock()
+
+		depths[sub.EventType] = -1
+		// As in VerifySubscriptions, a failed passive declaration closes the channel.
+		ch, err := conn.Channel()
+		if err != nil {
+			continue
+		}
+		if q, err := ch.QueueDeclarePassive(queue, false, true, false, false, nil); err == nil {
+			depths[sub.EventType] = q.Messages
+			_ = ch.Close()
+		}
+	}
+	return depths
+}
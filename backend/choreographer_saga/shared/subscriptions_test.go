@@ -0,0 +1,135 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// debugSubscriptions decodes the /debug/subscriptions response of eb.
+func debugSubscriptions(t *testing.T, eb *EventBus) (lastVerification *time.Time, lastError string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	eb.SubscriptionsHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/subscriptions", nil))
+	var body struct {
+		LastVerification *time.Time `json:"last_verification"`
+		LastError        string     `json:"last_error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body.LastVerification, body.LastError
+}
+
+// A failing verification is reported from its first failure until one succeeds.
+func TestVerificationOutcome(t *testing.T) {
+	eb := &EventBus{}
+	eb.reconnecting.Store(true)
+	if err := eb.VerifySubscriptions(); err == nil {
+		t.Fatal("verification succeeded while reconnecting")
+	}
+	since := eb.verify.failingSince
+	if since.IsZero() {
+		t.Fatal("failure not recorded")
+	}
+	eb.recordVerification(errors.New("queue gone"))
+	if !eb.verify.failingSince.Equal(since) {
+		t.Error("a second failure moved the start of the failures")
+	}
+	if last, lastErr := debugSubscriptions(t, eb); last != nil || lastErr != "queue gone" {
+		t.Errorf("debug = %v, %q, want no verification and the last error", last, lastErr)
+	}
+
+	eb.recordVerification(nil)
+	if !eb.verify.failingSince.IsZero() {
+		t.Error("failures still recorded after a success")
+	}
+	if last, lastErr := debugSubscriptions(t, eb); last == nil || lastErr != "" {
+		t.Errorf("debug = %v, %q, want the verification time and no error", last, lastErr)
+	}
+}
+
+// Verification stops for good once the bus shuts down.
+func TestVerifyAfterShutdown(t *testing.T) {
+	eb := &EventBus{}
+	eb.stopping.Store(true)
+	eb.reconnecting.Store(true)
+	if err := eb.VerifySubscriptions(); err != nil {
+		t.Errorf("VerifySubscriptions = %v after shutdown, want nil", err)
+	}
+	if !eb.verify.failingSince.IsZero() {
+		t.Error("failure recorded after shutdown")
+	}
+}
+
+func TestReadyNotConnected(t *testing.T) {
+	if ready, reason := (&EventBus{}).Ready(); ready || reason == "" {
+		t.Errorf("Ready = %t, %q without a connection", ready, reason)
+	}
+}
+
+// Ready turns false once the verification has been failing for longer than the threshold.
+func TestReadyVerificationThreshold(t *testing.T) {
+	eb, err := NewEventBus(brokerURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eb.Close()
+	eb.verify.threshold = 50 * time.Millisecond
+
+	eb.recordVerification(errors.New("queue gone"))
+	if ready, reason := eb.Ready(); !ready {
+		t.Fatalf("not ready within the threshold: %s", reason)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if ready, reason := eb.Ready(); ready || !strings.Contains(reason, "queue gone") {
+		t.Errorf("Ready = %t, %q past the threshold, want the verification error", ready, reason)
+	}
+	eb.recordVerification(nil)
+	if ready, reason := eb.Ready(); !ready {
+		t.Errorf("not ready after a successful verification: %s", reason)
+	}
+}
+
+// A queue deleted on the broker is declared again by the verification, and its subscription
+// receives the events published afterwards.
+func TestVerifyResubscribesLostQueue(t *testing.T) {
+	eb, err := NewEventBus(brokerURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eb.Close()
+	handler, got := receiver()
+	if err := eb.Subscribe(events.OrderCreatedEvent, handler); err != nil {
+		t.Fatal(err)
+	}
+	lost := eb.Subscriptions()[0].Queue
+
+	conn, _ := eb.current()
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ch.QueueDelete(lost, false, false, false); err != nil {
+		t.Fatal(err)
+	}
+	_ = ch.Close()
+
+	if err := eb.VerifySubscriptions(); err != nil {
+		t.Fatalf("VerifySubscriptions = %v", err)
+	}
+	info := eb.Subscriptions()[0]
+	if info.LastVerified == nil {
+		t.Error("subscription not marked as verified")
+	}
+	if err := eb.Publish(events.NewGenericEvent(events.OrderCreatedEvent, "after-verify", "test", nil)); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, got, "after-verify")
+}
@@ -0,0 +1,114 @@
+// Package testutil provides an in-memory stand-in for the RabbitMQ event bus, so that the
+// event handlers of the choreographed services can be run without a broker.
+package testutil
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/StitchMl/saga-demo/choreographer_saga/shared"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// FakeBus implements shared.Bus in memory. It records every published event and delivers
+// injected events synchronously to the handlers subscribed to their type.
+type FakeBus struct {
+	mu        sync.Mutex
+	published []events.GenericEvent
+	handlers  map[events.EventType][]shared.EventHandler
+	closed    bool
+
+	// PublishErr, when set, is returned by Publish and the event is not recorded.
+	PublishErr error
+}
+
+var _ shared.Bus = (*FakeBus)(nil)
+
+// NewFakeBus returns an empty FakeBus.
+func NewFakeBus() *FakeBus {
+	return &FakeBus{handlers: make(map[events.EventType][]shared.EventHandler)}
+}
+
+// Publish records the event. It is not delivered to the subscribers: use Inject for that.
+func (b *FakeBus) Publish(event events.GenericEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.PublishErr != nil {
+		return b.PublishErr
+	}
+	b.published = append(b.published, event)
+	return nil
+}
+
+// Subscribe registers the handler for the type, or for every type with shared.AllEvents.
+// The options are ignored, as there is no consumer to start or stop.
+func (b *FakeBus) Subscribe(eventType events.EventType, handler shared.EventHandler, _ ...shared.SubscribeOption) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+	return nil
+}
+
+// Close marks the bus as closed.
+func (b *FakeBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+}
+
+// Closed reports whether Close was called.
+func (b *FakeBus) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Inject delivers the event to the handlers of its type and of shared.AllEvents, in
+// subscription order, and returns once they have all run, with their errors joined. Unlike
+// the real bus it does not retry a failing handler: call Inject again to redeliver the event.
+func (b *FakeBus) Inject(event events.GenericEvent) error {
+	b.mu.Lock()
+	handlers := append(append([]shared.EventHandler(nil), b.handlers[event.Type]...), b.handlers[shared.AllEvents]...)
+	b.mu.Unlock()
+	var errs []error
+	for _, h := range handlers {
+		if err := h(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribed reports whether a handler receives events of type t.
+func (b *FakeBus) Subscribed(t events.EventType) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.handlers[t]) > 0 || len(b.handlers[shared.AllEvents]) > 0
+}
+
+// Published returns a copy of the events published so far, oldest first.
+func (b *FakeBus) Published() []events.GenericEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]events.GenericEvent(nil), b.published...)
+}
+
+// PublishedOfType returns the published events of one type, oldest first.
+func (b *FakeBus) PublishedOfType(t events.EventType) []events.GenericEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []events.GenericEvent
+	for _, e := range b.published {
+		if e.Type == t {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Reset forgets the published events, keeping the subscriptions.
+func (b *FakeBus) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published = nil
+}
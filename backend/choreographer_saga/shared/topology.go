@@ -0,0 +1,78 @@
+package shared
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Topology describes the place of a service in the choreography: the event types it consumes,
+// from its subscriptions, and the ones it declared with Produces.
+type Topology struct {
+	Publisher string             `json:"publisher"`
+	Consumes  []events.EventType `json:"consumes"`
+	Produces  []events.EventType `json:"produces"`
+}
+
+// Produces declares the event types the service publishes. Publishing another type still works
+// but is logged, so the topology does not silently drift from the code.
+func (eb *EventBus) Produces(types ...events.EventType) {
+	eb.subsMu.Lock()
+	defer eb.subsMu.Unlock()
+	for _, t := range types {
+		if !containsType(eb.produces, t) {
+			eb.produces = append(eb.produces, t)
+		}
+	}
+}
+
+// checkProduced logs the first publication of a type missing from the Produces declaration.
+func (eb *EventBus) checkProduced(t events.EventType) {
+	eb.subsMu.Lock()
+	defer eb.subsMu.Unlock()
+	if len(eb.produces) == 0 || containsType(eb.produces, t) || containsType(eb.undeclared, t) {
+		return
+	}
+	eb.undeclared = append(eb.undeclared, t)
+	log.Printf("[EventBus] Warning: publishing '%s', which is not declared with Produces", t)
+}
+
+// Topology returns the consumed and produced event types, sorted.
+func (eb *EventBus) Topology() Topology {
+	eb.subsMu.RLock()
+	defer eb.subsMu.RUnlock()
+	topo := Topology{Publisher: eb.quota.publisher, Consumes: []events.EventType{}, Produces: []events.EventType{}}
+	for _, s := range eb.subscriptions {
+		for _, k := range s.RoutingKeys {
+			t := events.EventType(k)
+			if k == "#" {
+				t = AllEvents
+			}
+			if !containsType(topo.Consumes, t) {
+				topo.Consumes = append(topo.Consumes, t)
+			}
+		}
+	}
+	topo.Produces = append(topo.Produces, eb.produces...)
+	sort.Slice(topo.Consumes, func(i, j int) bool { return topo.Consumes[i] < topo.Consumes[j] })
+	sort.Slice(topo.Produces, func(i, j int) bool { return topo.Produces[i] < topo.Produces[j] })
+	return topo
+}
+
+// TopologyHandler serves /debug/topology with the Topology of the service.
+func (eb *EventBus) TopologyHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(eb.Topology())
+}
+
+func containsType(types []events.EventType, t events.EventType) bool {
+	for _, x := range types {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// paymentTopologyBus is an EventBus wired like the payment service, with its subscriptions
+// registered out of order.
+func paymentTopologyBus() *EventBus {
+	eb := newStreamBus()
+	eb.quota = &quotaState{publisher: "payment-service"}
+	eb.subscriptions = []*subscription{
+		{EventType: events.RevertInventoryEvent, RoutingKeys: []string{string(events.RevertInventoryEvent)}},
+		{EventType: events.InventoryReservedEvent, RoutingKeys: []string{string(events.InventoryReservedEvent)}},
+		{EventType: AllEvents, RoutingKeys: []string{"#"}},
+	}
+	eb.Produces(events.PaymentProcessedEvent, events.PaymentFailedEvent, events.PaymentRevertMismatchEvent)
+	eb.Produces(events.PaymentFailedEvent, events.PaymentRevertSkippedEvent)
+	return eb
+}
+
+// /debug/topology is compared with testdata/topology.golden, so a change to what a service
+// consumes or produces shows up in the diff; run the test with -update to accept it.
+func TestTopologyGolden(t *testing.T) {
+	rec := httptest.NewRecorder()
+	paymentTopologyBus().TopologyHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/topology", nil))
+	var got bytes.Buffer
+	if err := json.Indent(&got, rec.Body.Bytes(), "", "  "); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "topology.golden")
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("topology drifted from %s (run with -update to accept):\n%s", golden, got.String())
+	}
+}
+
+// Publishing a type missing from Produces is logged once; nothing is logged for declared types
+// or when the service declared nothing.
+func TestCheckProduced(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	eb := paymentTopologyBus()
+	eb.checkProduced(events.PaymentProcessedEvent)
+	eb.checkProduced(events.OrderCreatedEvent)
+	eb.checkProduced(events.OrderCreatedEvent)
+	if n := strings.Count(logged.String(), "not declared with Produces"); n != 1 || !strings.Contains(logged.String(), string(events.OrderCreatedEvent)) {
+		t.Errorf("logged %q, want one warning for %s", logged.String(), events.OrderCreatedEvent)
+	}
+
+	logged.Reset()
+	newStreamBus().checkProduced(events.OrderCreatedEvent)
+	if logged.Len() != 0 {
+		t.Errorf("logged %q for a service without a Produces declaration", logged.String())
+	}
+}
@@ -0,0 +1,83 @@
+package adminauth
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/google/uuid"
+)
+
+// Header is the request header carrying the admin token.
+const Header = "X-Admin-Token"
+
+// RequestIDHeader is the header used to correlate the audit log lines with a request.
+const RequestIDHeader = "X-Request-ID"
+
+// tokens accepted by Require; several comma-separated values in ADMIN_TOKEN allow rotation.
+var tokens [][]byte
+
+func init() {
+	SetTokens(os.Getenv("ADMIN_TOKEN"))
+}
+
+// SetTokens replaces the accepted tokens with the comma-separated list in raw.
+func SetTokens(raw string) {
+	config.SetSecret("ADMIN_TOKEN", raw)
+	tokens = nil
+	for _, t := range strings.Split(raw, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, []byte(t))
+		}
+	}
+	if len(tokens) == 0 {
+		log.Println("[AdminAuth] ADMIN_TOKEN not set, admin endpoints are disabled.")
+	}
+}
+
+// valid compares the presented token against every configured one in constant time.
+func valid(presented string) bool {
+	ok := 0
+	for _, t := range tokens {
+		ok |= subtle.ConstantTimeCompare([]byte(presented), t)
+	}
+	return ok == 1
+}
+
+// Require guards an admin handler with the admin token and writes an audit log line per request.
+func Require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := r.Header.Get(RequestIDHeader)
+		if reqID == "" {
+			reqID = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, reqID)
+
+		presented := r.Header.Get(Header)
+		switch {
+		case len(tokens) == 0:
+			audit(reqID, r, "denied (admin endpoints disabled)")
+			http.Error(w, "admin endpoints disabled", http.StatusForbidden)
+			return
+		case presented == "":
+			audit(reqID, r, "denied (missing token)")
+			http.Error(w, "missing "+Header, http.StatusUnauthorized)
+			return
+		case !valid(presented):
+			audit(reqID, r, "denied (invalid token)")
+			http.Error(w, "invalid admin token", http.StatusForbidden)
+			return
+		}
+		audit(reqID, r, "granted")
+		next(w, r)
+	}
+}
+
+// audit logs one admin action.
+func audit(reqID string, r *http.Request, outcome string) {
+	log.Printf("[AdminAudit] request_id=%s method=%s path=%s remote=%s outcome=%s",
+		reqID, r.Method, r.URL.Path, r.RemoteAddr, outcome)
+}
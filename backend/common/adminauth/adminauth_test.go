@@ -0,0 +1,68 @@
+package adminauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func call(token string) *httptest.ResponseRecorder {
+	handler := Require(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	req := httptest.NewRequest(http.MethodPost, "/admin/action", nil)
+	if token != "" {
+		req.Header.Set(Header, token)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestRequire(t *testing.T) {
+	defer SetTokens("")
+
+	tests := []struct {
+		name   string
+		tokens string
+		token  string
+		want   int
+	}{
+		{name: "admin endpoints disabled", tokens: "", token: "anything", want: http.StatusForbidden},
+		{name: "missing token", tokens: "secret", want: http.StatusUnauthorized},
+		{name: "wrong token", tokens: "secret", token: "guess", want: http.StatusForbidden},
+		{name: "prefix of the token", tokens: "secret", token: "secre", want: http.StatusForbidden},
+		{name: "valid token", tokens: "secret", token: "secret", want: http.StatusNoContent},
+		{name: "old token during rotation", tokens: "new-secret, secret", token: "secret", want: http.StatusNoContent},
+		{name: "new token during rotation", tokens: "new-secret, secret", token: "new-secret", want: http.StatusNoContent},
+		{name: "old token after rotation", tokens: "new-secret", token: "secret", want: http.StatusForbidden},
+		{name: "empty entries ignored", tokens: " , ", token: " ", want: http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			SetTokens(tc.tokens)
+			if rec := call(tc.token); rec.Code != tc.want {
+				t.Errorf("answered %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
+
+// Every admin request carries a request ID for the audit log: the caller's, or a new one.
+func TestRequireRequestID(t *testing.T) {
+	defer SetTokens("")
+	SetTokens("secret")
+
+	rec := call("guess")
+	if rec.Header().Get(RequestIDHeader) == "" {
+		t.Error("denied request without a request ID")
+	}
+
+	handler := Require(func(w http.ResponseWriter, _ *http.Request) {})
+	req := httptest.NewRequest(http.MethodPost, "/admin/action", nil)
+	req.Header.Set(Header, "secret")
+	req.Header.Set(RequestIDHeader, "req-42")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if got := rec.Header().Get(RequestIDHeader); got != "req-42" {
+		t.Errorf("request ID = %q, want the caller's", got)
+	}
+}
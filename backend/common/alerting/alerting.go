@@ -0,0 +1,102 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/config"
+)
+
+// Alert reports a critical operation that failed after all its attempts.
+type Alert struct {
+	Operation     string    `json:"operation"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	OrderID       string    `json:"order_id,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+	// Suppressed counts the alerts of the same operation dropped by the rate limit since the last one sent.
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// webhookURL is the optional endpoint receiving the alerts.
+var webhookURL = os.Getenv("ALERT_WEBHOOK_URL")
+
+// minInterval is the shortest time between two alerts of the same operation.
+var minInterval = time.Minute
+
+// Hook receives the alerts let through by the rate limit. It posts them to ALERT_WEBHOOK_URL
+// by default; it can be replaced to route alerts elsewhere.
+var Hook = PostWebhook
+
+// Last alert sent and alerts suppressed since, keyed by operation
+var limiter = struct {
+	sync.Mutex
+	Sent       map[string]time.Time
+	Suppressed map[string]int
+}{Sent: make(map[string]time.Time), Suppressed: make(map[string]int)}
+
+func init() {
+	if v := os.Getenv("ALERT_MIN_INTERVAL_SECONDS"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			log.Fatalf("Invalid ALERT_MIN_INTERVAL_SECONDS: %q", v)
+		}
+		minInterval = time.Duration(secs) * time.Second
+	}
+	// The URL may embed credentials of the receiving service.
+	config.SetSecret("ALERT_WEBHOOK_URL", webhookURL)
+	config.Set("ALERT_MIN_INTERVAL_SECONDS", minInterval)
+}
+
+// RetriesExhausted raises an alert for an operation whose attempts are exhausted. Alerts of the
+// same operation closer than ALERT_MIN_INTERVAL_SECONDS are counted and dropped.
+func RetriesExhausted(a Alert) {
+	limiter.Lock()
+	now := time.Now()
+	if last, ok := limiter.Sent[a.Operation]; ok && now.Sub(last) < minInterval {
+		limiter.Suppressed[a.Operation]++
+		limiter.Unlock()
+		log.Printf("[Alerting] Alert for %s suppressed by the rate limit: %s", a.Operation, a.LastError)
+		return
+	}
+	limiter.Sent[a.Operation] = now
+	a.Suppressed = limiter.Suppressed[a.Operation]
+	delete(limiter.Suppressed, a.Operation)
+	limiter.Unlock()
+
+	if a.Timestamp.IsZero() {
+		a.Timestamp = now
+	}
+	log.Printf("[Alerting] %s failed after %d attempts (order %s): %s", a.Operation, a.Attempts, a.OrderID, a.LastError)
+	go Hook(a)
+}
+
+// PostWebhook sends an alert to ALERT_WEBHOOK_URL, if configured.
+// Delivery is best-effort: failures are only logged.
+func PostWebhook(a Alert) {
+	if webhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(a)
+	if err != nil {
+		log.Printf("[Alerting] Failed to marshal alert for %s: %v", a.Operation, err)
+		return
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("[Alerting] Webhook unreachable for %s: %v", a.Operation, err)
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[Alerting] Webhook answered %d for %s", resp.StatusCode, a.Operation)
+	}
+}
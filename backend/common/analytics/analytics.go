@@ -0,0 +1,68 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// webhookURL is the optional analytics endpoint receiving the saga summaries.
+var webhookURL atomic.Pointer[string]
+
+// posting counts the summaries being sent, see Wait.
+var posting sync.WaitGroup
+
+func init() {
+	url := os.Getenv("ANALYTICS_WEBHOOK_URL")
+	webhookURL.Store(&url)
+	// The URL may embed credentials of the receiving service.
+	config.SetSecret("ANALYTICS_WEBHOOK_URL", url)
+}
+
+// SetWebhookURL replaces the endpoint read from ANALYTICS_WEBHOOK_URL; an empty url stops the posts.
+// Summaries already being sent still go to the previous endpoint.
+func SetWebhookURL(url string) {
+	webhookURL.Store(&url)
+	config.SetSecret("ANALYTICS_WEBHOOK_URL", url)
+}
+
+// PostSagaCompleted sends a saga summary to ANALYTICS_WEBHOOK_URL, if configured, in the
+// background. Delivery is best-effort: failures are only logged.
+func PostSagaCompleted(summary events.SagaCompletedPayload) {
+	url := *webhookURL.Load()
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(summary)
+	if err != nil {
+		log.Printf("[Analytics] Failed to marshal summary for order %s: %v", summary.OrderID, err)
+		return
+	}
+	posting.Add(1)
+	go func() {
+		defer posting.Done()
+		client := &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("[Analytics] Webhook unreachable for order %s: %v", summary.OrderID, err)
+			return
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("[Analytics] Webhook answered %d for order %s", resp.StatusCode, summary.OrderID)
+		}
+	}()
+}
+
+// Wait blocks until the summaries being sent have been delivered or have failed.
+func Wait() {
+	posting.Wait()
+}
@@ -0,0 +1,41 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// A summary goes to the endpoint set when it was posted, even if the endpoint changes before it
+// is sent, and Wait returns once it has been received.
+func TestPostSagaCompleted(t *testing.T) {
+	receiver := func(got chan<- string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var summary events.SagaCompletedPayload
+			_ = json.NewDecoder(r.Body).Decode(&summary)
+			got <- summary.OrderID
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	first, second := make(chan string, 4), make(chan string, 4)
+	defer SetWebhookURL("")
+
+	SetWebhookURL(receiver(first).URL)
+	PostSagaCompleted(events.SagaCompletedPayload{OrderID: "orc-1"})
+	SetWebhookURL(receiver(second).URL)
+	PostSagaCompleted(events.SagaCompletedPayload{OrderID: "orc-2"})
+	SetWebhookURL("")
+	PostSagaCompleted(events.SagaCompletedPayload{OrderID: "orc-3"})
+	Wait()
+
+	if len(first) != 1 || <-first != "orc-1" {
+		t.Error("first endpoint did not receive orc-1 alone")
+	}
+	if len(second) != 1 || <-second != "orc-2" {
+		t.Error("second endpoint did not receive orc-2 alone")
+	}
+}
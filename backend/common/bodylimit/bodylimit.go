@@ -0,0 +1,53 @@
+package bodylimit
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/responses"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// maxBytes is the largest request body accepted (MAX_REQUEST_BODY_BYTES, default 1 MiB).
+var maxBytes int64 = 1 << 20
+
+func init() {
+	if v := os.Getenv("MAX_REQUEST_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid MAX_REQUEST_BODY_BYTES: %q", v)
+		}
+		maxBytes = n
+	}
+	config.Set("MAX_REQUEST_BODY_BYTES", maxBytes)
+}
+
+// Handler wraps the server mux so no handler reads more than MAX_REQUEST_BODY_BYTES of a body.
+// A request announcing a larger Content-Length gets 413 before reaching next; a body that turns
+// out longer makes the handler's read fail, see TooLarge.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			WriteTooLarge(w)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TooLarge reports whether err comes from reading past the body limit.
+func TooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// WriteTooLarge writes the 413 error envelope.
+func WriteTooLarge(w http.ResponseWriter) {
+	responses.WriteError(w, http.StatusRequestEntityTooLarge, events.ReasonBodyTooLarge,
+		"Request body larger than "+strconv.FormatInt(maxBytes, 10)+" bytes")
+}
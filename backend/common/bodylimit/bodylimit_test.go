@@ -0,0 +1,55 @@
+package bodylimit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func TestHandler(t *testing.T) {
+	defer func(n int64) { maxBytes = n }(maxBytes)
+	maxBytes = 16
+
+	var readErr error
+	reached := false
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		if _, readErr = io.ReadAll(r.Body); TooLarge(readErr) {
+			WriteTooLarge(w)
+		}
+	}))
+
+	t.Run("announced too large", func(t *testing.T) {
+		reached = false
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 17))))
+		var resp events.ErrorResponse
+		if rec.Code != http.StatusRequestEntityTooLarge || json.NewDecoder(rec.Body).Decode(&resp) != nil || resp.ReasonCode != events.ReasonBodyTooLarge {
+			t.Errorf("answered %d: %s", rec.Code, rec.Body)
+		}
+		if reached {
+			t.Error("the handler ran")
+		}
+	})
+	t.Run("longer than announced", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 17)))
+		req.ContentLength = -1 // chunked
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if !TooLarge(readErr) || rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("read error %v, answered %d", readErr, rec.Code)
+		}
+	})
+	t.Run("within the limit", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 16))))
+		if readErr != nil || rec.Code != http.StatusOK {
+			t.Errorf("read error %v, answered %d", readErr, rec.Code)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package buildinfo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+// inject sets the build metadata as -ldflags "-X ..." would.
+func inject(t *testing.T, version, commit, buildTime string) {
+	t.Helper()
+	prevVersion, prevCommit, prevTime := Version, Commit, BuildTime
+	Version, Commit, BuildTime = version, commit, buildTime
+	t.Cleanup(func() { Version, Commit, BuildTime = prevVersion, prevCommit, prevTime })
+}
+
+func TestHandlerReturnsInjectedValues(t *testing.T) {
+	inject(t, "1.4.2", "3f2c9ab", "2026-10-15T09:00:00Z")
+
+	rec := httptest.NewRecorder()
+	Handler("orchestrator")(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("answered %d with %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var info Info
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	want := Info{Service: "orchestrator", Version: "1.4.2", Commit: "3f2c9ab", BuildTime: "2026-10-15T09:00:00Z", GoVersion: runtime.Version()}
+	if info != want {
+		t.Errorf("info = %+v, want %+v", info, want)
+	}
+
+	rec = httptest.NewRecorder()
+	Handler("orchestrator")(rec, httptest.NewRequest(http.MethodPost, "/version", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST answered %d, want 405", rec.Code)
+	}
+}
+
+// Without an injected commit the build keeps the defaults, and the commit comes from the VCS
+// stamp of the toolchain when there is one (never in test binaries).
+func TestGetDefaults(t *testing.T) {
+	inject(t, "dev", "unknown", "unknown")
+	info := Get("gateway")
+	if info.Service != "gateway" || info.Version != "dev" || info.BuildTime != "unknown" || info.Commit == "" {
+		t.Errorf("info = %+v", info)
+	}
+}
@@ -0,0 +1,93 @@
+package chaos
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/StitchMl/saga-demo/common/responses"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Faults a service can be armed with.
+const (
+	FaultPayment      = "payment"      // the payment gateway declines the next payments
+	FaultReservation  = "reservation"  // the inventory refuses the next reservations
+	FaultConfirmation = "confirmation" // the order service fails the next order approvals
+)
+
+// Number of upcoming calls that fail, per fault
+var armed = struct {
+	sync.Mutex
+	Data map[string]int
+}{Data: make(map[string]int)}
+
+// Arm makes the next n calls hit by fault fail, on top of those already armed.
+func Arm(fault string, n int) {
+	armed.Lock()
+	armed.Data[fault] += n
+	armed.Unlock()
+	log.Printf("[Chaos] Armed %d %s failure(s)", n, fault)
+}
+
+// Clear disarms every fault.
+func Clear() {
+	armed.Lock()
+	armed.Data = make(map[string]int)
+	armed.Unlock()
+}
+
+// Take reports whether the current call must fail because of fault, using up one armed failure.
+func Take(fault string) bool {
+	armed.Lock()
+	defer armed.Unlock()
+	if armed.Data[fault] == 0 {
+		return false
+	}
+	armed.Data[fault]--
+	log.Printf("[Chaos] Injecting %s failure, %d left", fault, armed.Data[fault])
+	return true
+}
+
+// Armed returns the failures left per fault.
+func Armed() map[string]int {
+	armed.Lock()
+	defer armed.Unlock()
+	out := make(map[string]int, len(armed.Data))
+	for k, v := range armed.Data {
+		if v > 0 {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// AdminHandler serves /admin/chaos: GET lists the armed faults, POST arms the ones in a body
+// like {"payment": 1}, DELETE clears them all.
+func AdminHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req map[string]int
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request body")
+			return
+		}
+		for _, n := range req {
+			if n <= 0 {
+				responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "failure counts must be positive")
+				return
+			}
+		}
+		for fault, n := range req {
+			Arm(fault, n)
+		}
+	case http.MethodDelete:
+		Clear()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, map[string]interface{}{"armed": Armed()})
+}
@@ -0,0 +1,68 @@
+package chaos
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Armed failures add up, are used one call at a time, and are all dropped by Clear.
+func TestArmTake(t *testing.T) {
+	Clear()
+	defer Clear()
+	Arm(FaultPayment, 1)
+	Arm(FaultPayment, 1)
+	Arm(FaultReservation, 1)
+	if got := Armed(); got[FaultPayment] != 2 || got[FaultReservation] != 1 || len(got) != 2 {
+		t.Fatalf("armed = %v", got)
+	}
+	for i, want := range []bool{true, true, false} {
+		if got := Take(FaultPayment); got != want {
+			t.Errorf("payment call %d failed %t, want %t", i, got, want)
+		}
+	}
+	if got := Armed(); len(got) != 1 {
+		t.Errorf("armed = %v, want the used up fault left out", got)
+	}
+	Clear()
+	if Take(FaultReservation) {
+		t.Error("a cleared fault still fails a call")
+	}
+	if Take(FaultConfirmation) {
+		t.Error("a fault never armed fails a call")
+	}
+}
+
+func adminCall(method, body string) (int, map[string]int) {
+	rec := httptest.NewRecorder()
+	AdminHandler(rec, httptest.NewRequest(method, "/admin/chaos", strings.NewReader(body)))
+	var resp struct {
+		Armed map[string]int `json:"armed"`
+	}
+	_ = json.NewDecoder(rec.Body).Decode(&resp)
+	return rec.Code, resp.Armed
+}
+
+func TestAdminHandler(t *testing.T) {
+	Clear()
+	defer Clear()
+	if code, armed := adminCall(http.MethodPost, `{"payment":2,"confirmation":1}`); code != http.StatusOK || armed[FaultPayment] != 2 || armed[FaultConfirmation] != 1 {
+		t.Errorf("POST answered %d with %v", code, armed)
+	}
+	for _, body := range []string{`{"payment":0}`, `{"reservation":-1}`, `not json`} {
+		if code, _ := adminCall(http.MethodPost, body); code != http.StatusBadRequest {
+			t.Errorf("POST %s answered %d, want 400", body, code)
+		}
+	}
+	if _, armed := adminCall(http.MethodGet, ""); armed[FaultPayment] != 2 || armed[FaultReservation] != 0 {
+		t.Errorf("GET lists %v, want the invalid requests to arm nothing", armed)
+	}
+	if code, armed := adminCall(http.MethodDelete, ""); code != http.StatusOK || len(armed) != 0 {
+		t.Errorf("DELETE answered %d with %v", code, armed)
+	}
+	if code, _ := adminCall(http.MethodPut, ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT answered %d", code)
+	}
+}
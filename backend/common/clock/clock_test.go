@@ -0,0 +1,70 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func fired(ch <-chan time.Time) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// The waiters of a Fake wake up once Advance reaches their deadline, and not before.
+func TestFakeAdvance(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+
+	short, long := fake.After(time.Second), fake.After(time.Minute)
+	if n := fake.Waiters(); n != 2 {
+		t.Fatalf("%d waiters, want 2", n)
+	}
+	fake.Advance(999 * time.Millisecond)
+	if fired(short) || fired(long) {
+		t.Fatal("a waiter woke up before its deadline")
+	}
+	fake.Advance(time.Millisecond)
+	if !fired(short) || fired(long) {
+		t.Fatal("only the one-second waiter should wake up at its deadline")
+	}
+	if n := fake.Waiters(); n != 1 {
+		t.Errorf("%d waiters left, want 1", n)
+	}
+	fake.Advance(time.Hour)
+	if !fired(long) {
+		t.Error("the one-minute waiter still waits an hour later")
+	}
+	if got := fake.Now(); !got.Equal(start.Add(time.Hour + time.Second)) {
+		t.Errorf("Now() = %s", got)
+	}
+	if !fired(fake.After(0)) {
+		t.Error("After(0) does not fire at once")
+	}
+}
+
+func TestFakeSleep(t *testing.T) {
+	fake := NewFake(time.Now())
+	done := make(chan struct{})
+	go func() {
+		fake.Sleep(5 * time.Second)
+		close(done)
+	}()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("Sleep returned before the clock moved")
+	case <-time.After(20 * time.Millisecond):
+	}
+	fake.Advance(5 * time.Second)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Sleep did not return once the clock moved past it")
+	}
+}
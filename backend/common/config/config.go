@@ -0,0 +1,64 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// redacted replaces the value of secret entries in the debug output.
+const redacted = "***"
+
+type entry struct {
+	Value  string
+	Secret bool
+}
+
+// Effective configuration of the running service, keyed by setting name
+var registry = struct {
+	sync.RWMutex
+	Values map[string]entry
+}{Values: make(map[string]entry)}
+
+// Set records the effective value of a setting.
+func Set(key string, value interface{}) {
+	set(key, value, false)
+}
+
+// SetSecret records a setting whose value must never be shown.
+func SetSecret(key string, value interface{}) {
+	set(key, value, true)
+}
+
+func set(key string, value interface{}, secret bool) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.Values[key] = entry{Value: fmt.Sprint(value), Secret: secret}
+}
+
+// Snapshot returns the recorded settings with the secret values redacted.
+// Unset secrets stay empty so that a missing value is still visible.
+func Snapshot() map[string]string {
+	registry.RLock()
+	defer registry.RUnlock()
+	out := make(map[string]string, len(registry.Values))
+	for k, e := range registry.Values {
+		if e.Secret && e.Value != "" {
+			out[k] = redacted
+			continue
+		}
+		out[k] = e.Value
+	}
+	return out
+}
+
+// Handler serves GET /debug/config; it must be guarded with adminauth.Require.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"config": Snapshot()})
+}
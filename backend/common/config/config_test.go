@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRedaction(t *testing.T) {
+	Set("TEST_TIMEOUT", "5s")
+	Set("TEST_RETRIES", 3)
+	SetSecret("TEST_TOKEN", "s3cr3t")
+	SetSecret("TEST_UNSET_TOKEN", "")
+
+	got := Snapshot()
+	want := map[string]string{"TEST_TIMEOUT": "5s", "TEST_RETRIES": "3", "TEST_TOKEN": "***", "TEST_UNSET_TOKEN": ""}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+
+	// A setting made secret later is redacted too.
+	SetSecret("TEST_TIMEOUT", "5s")
+	if v := Snapshot()["TEST_TIMEOUT"]; v != redacted {
+		t.Errorf("TEST_TIMEOUT = %q once secret", v)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	Set("TEST_URL", "http://inventory:8080")
+	SetSecret("TEST_WEBHOOK", "https://hooks.example.com/token-123")
+
+	rec := httptest.NewRecorder()
+	Handler(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("answered %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "token-123") {
+		t.Fatalf("secret value in the output: %s", rec.Body)
+	}
+	var body struct {
+		Config map[string]string `json:"config"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Config["TEST_URL"] != "http://inventory:8080" || body.Config["TEST_WEBHOOK"] != redacted {
+		t.Errorf("config = %v", body.Config)
+	}
+
+	rec = httptest.NewRecorder()
+	Handler(rec, httptest.NewRequest(http.MethodPost, "/debug/config", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST answered %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package correlation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Header carries the correlation ID of a saga across HTTP calls.
+const Header = "X-Correlation-ID"
+
+type contextKey struct{}
+
+// NewID returns a new correlation ID.
+func NewID() string {
+	return uuid.NewString()
+}
+
+// WithID returns a copy of ctx carrying the correlation ID.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the correlation ID carried by ctx, or "" if none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Middleware takes the correlation ID from the request header, or generates one when the
+// request enters the system without it, and makes it available through FromContext.
+// The ID is echoed in the response header.
+func Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if id == "" {
+			id = NewID()
+			r.Header.Set(Header, id)
+		}
+		w.Header().Set(Header, id)
+		next(w, r.WithContext(WithID(r.Context(), id)))
+	}
+}
+
+// Inject sets the correlation ID of ctx on an outgoing request.
+func Inject(ctx context.Context, req *http.Request) {
+	if id := FromContext(ctx); id != "" {
+		req.Header.Set(Header, id)
+	}
+}
+
+// Logf logs like log.Printf, prefixed with the correlation ID when there is one.
+func Logf(id, format string, args ...interface{}) {
+	if id == "" {
+		log.Printf(format, args...)
+		return
+	}
+	log.Printf("[cid=%s] %s", id, fmt.Sprintf(format, args...))
+}
+
+// Printf logs like log.Printf, prefixed with the correlation ID of ctx.
+func Printf(ctx context.Context, format string, args ...interface{}) {
+	Logf(FromContext(ctx), format, args...)
+}
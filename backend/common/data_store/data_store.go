@@ -27,9 +27,9 @@ var DB = struct {
 func InitDB() {
 	DB.Orders.Data = make(map[string]events.Order)
 	DB.Products.Data = map[string]events.Product{
-		"laptop-pro":          {ID: "laptop-pro", Name: "Laptop Pro", Description: "A powerful laptop for professionals.", Price: 1299.99, Available: 100, ImageURL: "https://m.media-amazon.com/images/I/61UcV2bDnoL._AC_SL1500_.jpg"},
-		"mouse-wireless":      {ID: "mouse-wireless", Name: "Mouse Wireless", Description: "Ergonomic and precise mouse.", Price: 49.50, Available: 50, ImageURL: "https://m.media-amazon.com/images/I/711bP+FjSQL._AC_SL1500_.jpg"},
-		"mechanical-keyboard": {ID: "mechanical-keyboard", Name: "Keyboard Mechanical", Description: "Keyboard with mechanical switches for gaming.", Price: 120.00, Available: 200, ImageURL: "https://m.media-amazon.com/images/I/71kq6u7NA4L._AC_SL1500_.jpg"},
+		"laptop-pro":          {ID: "laptop-pro", Name: "Laptop Pro", Description: "A powerful laptop for professionals.", Price: 1299.99, Available: 100, ImageURL: "https://m.media-amazon.com/images/I/61UcV2bDnoL._AC_SL1500_.jpg", Warehouses: map[string]int{"wh-north": 60, "wh-south": 40}},
+		"mouse-wireless":      {ID: "mouse-wireless", Name: "Mouse Wireless", Description: "Ergonomic and precise mouse.", Price: 49.50, Available: 50, ImageURL: "https://m.media-amazon.com/images/I/711bP+FjSQL._AC_SL1500_.jpg", Warehouses: map[string]int{"wh-north": 20, "wh-south": 30}},
+		"mechanical-keyboard": {ID: "mechanical-keyboard", Name: "Keyboard Mechanical", Description: "Keyboard with mechanical switches for gaming.", Price: 120.00, Available: 200, ImageURL: "https://m.media-amazon.com/images/I/71kq6u7NA4L._AC_SL1500_.jpg", Warehouses: map[string]int{"wh-north": 120, "wh-south": 80}},
 	}
 
 	u1hash, _ := events.HashPassword("pass1")
@@ -0,0 +1,67 @@
+package diagnostics
+
+import (
+	"expvar"
+	"net/http"
+	_ "net/http/pprof" // registers /debug/pprof/ on the default mux, exposed only through Handler
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/config"
+)
+
+// enabled is read from DEBUG_ENDPOINTS; the diagnostic endpoints answer 404 when it is false.
+var enabled bool
+
+func init() {
+	enabled, _ = strconv.ParseBool(os.Getenv("DEBUG_ENDPOINTS"))
+	config.Set("DEBUG_ENDPOINTS", enabled)
+
+	Publish("goroutines", func() interface{} { return runtime.NumGoroutine() })
+	Publish("gc", func() interface{} {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return map[string]interface{}{
+			"num_gc":          m.NumGC,
+			"pause_total_ns":  m.PauseTotalNs,
+			"last_gc_unix_ns": m.LastGC,
+			"heap_alloc":      m.HeapAlloc,
+			"heap_objects":    m.HeapObjects,
+		}
+	})
+}
+
+// Enabled reports whether DEBUG_ENDPOINTS turned the diagnostic endpoints on.
+func Enabled() bool {
+	return enabled
+}
+
+// Publish exposes the value returned by f under name in /debug/vars.
+func Publish(name string, f func() interface{}) {
+	expvar.Publish(name, expvar.Func(f))
+}
+
+// isDiagnostic reports whether path is one of the pprof or expvar endpoints.
+func isDiagnostic(path string) bool {
+	return path == "/debug/vars" || path == "/debug/pprof" || strings.HasPrefix(path, "/debug/pprof/")
+}
+
+// Handler wraps the server mux so /debug/pprof/ and /debug/vars answer 404 unless DEBUG_ENDPOINTS
+// is true, and require the admin token when it is. The other routes are passed to next unchanged.
+func Handler(next http.Handler) http.Handler {
+	guarded := adminauth.Require(next.ServeHTTP)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isDiagnostic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !enabled {
+			http.NotFound(w, r)
+			return
+		}
+		guarded(w, r)
+	})
+}
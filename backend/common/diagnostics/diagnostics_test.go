@@ -0,0 +1,74 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/adminauth"
+)
+
+func withEnabled(t *testing.T, on bool) {
+	t.Helper()
+	prev := enabled
+	enabled = on
+	t.Cleanup(func() { enabled = prev })
+}
+
+func get(path, token string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	mux.Handle("/debug/", http.DefaultServeMux)
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set(adminauth.Header, token)
+	}
+	rec := httptest.NewRecorder()
+	Handler(mux).ServeHTTP(rec, req)
+	return rec
+}
+
+var diagnosticPaths = []string{"/debug/vars", "/debug/pprof/", "/debug/pprof/goroutine?debug=1"}
+
+// Off by default, the diagnostic endpoints do not exist, even for the admin.
+func TestDiagnosticsDisabled(t *testing.T) {
+	withEnabled(t, false)
+	adminauth.SetTokens("admin-secret")
+	defer adminauth.SetTokens("")
+
+	for _, path := range diagnosticPaths {
+		if rec := get(path, "admin-secret"); rec.Code != http.StatusNotFound {
+			t.Errorf("%s answered %d, want 404", path, rec.Code)
+		}
+	}
+	if rec := get("/health", ""); rec.Code != http.StatusOK {
+		t.Errorf("/health answered %d through the handler", rec.Code)
+	}
+}
+
+// Enabled, they are served to the admin only.
+func TestDiagnosticsEnabled(t *testing.T) {
+	withEnabled(t, true)
+	adminauth.SetTokens("admin-secret")
+	defer adminauth.SetTokens("")
+
+	for _, path := range diagnosticPaths {
+		if rec := get(path, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s answered %d without the token", path, rec.Code)
+		}
+		if rec := get(path, "admin-secret"); rec.Code != http.StatusOK {
+			t.Errorf("%s answered %d to the admin", path, rec.Code)
+		}
+	}
+
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(get("/debug/vars", "admin-secret").Body).Decode(&vars); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"goroutines", "gc"} {
+		if _, ok := vars[name]; !ok {
+			t.Errorf("/debug/vars has no %s", name)
+		}
+	}
+}
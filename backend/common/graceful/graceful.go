@@ -0,0 +1,85 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/tlsconfig"
+)
+
+// Period is how long a shutdown waits for the work in flight (SHUTDOWN_GRACE_SECONDS, default 30).
+var Period = 30 * time.Second
+
+// inflight counts the work registered with Track.
+var inflight sync.WaitGroup
+
+func init() {
+	if v := os.Getenv("SHUTDOWN_GRACE_SECONDS"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			log.Fatalf("Invalid SHUTDOWN_GRACE_SECONDS: %q", v)
+		}
+		Period = time.Duration(secs) * time.Second
+	}
+	config.Set("SHUTDOWN_GRACE_SECONDS", Period)
+}
+
+// Track registers work a shutdown must wait for, such as a running saga; call the returned
+// function once it is over.
+func Track() (done func()) {
+	inflight.Add(1)
+	return inflight.Done
+}
+
+// ListenAndServe serves h on addr, over HTTPS when tlsconfig is set up for it, until SIGINT or
+// SIGTERM. It then stops accepting connections and, within Period, waits for the requests in
+// progress, runs the stop hooks (e.g. to stop consuming events) and waits for the work registered
+// with Track. It returns nil once the shutdown is over.
+func ListenAndServe(addr string, h http.Handler, stop ...func(ctx context.Context)) error {
+	srv := &http.Server{Addr: addr, Handler: h}
+	sigCtx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() { errc <- tlsconfig.ListenAndServe(srv) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-sigCtx.Done():
+	}
+
+	log.Printf("[Shutdown] Signal received, draining for up to %s", Period)
+	ctx, cancelDrain := context.WithTimeout(context.Background(), Period)
+	defer cancelDrain()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("[Shutdown] Requests still in progress: %v", err)
+	}
+	if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("[Shutdown] Server error: %v", err)
+	}
+	for _, f := range stop {
+		f(ctx)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		log.Println("[Shutdown] All work in flight completed")
+	case <-ctx.Done():
+		log.Printf("[Shutdown] Grace period of %s expired with work still in flight", Period)
+	}
+	return nil
+}
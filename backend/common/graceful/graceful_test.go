@@ -0,0 +1,107 @@
+package graceful
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// serveUntilSignal runs ListenAndServe with a handler starting a tracked "saga" of the given
+// length, starts one saga and sends SIGTERM. It returns when ListenAndServe returned, and
+// whether the saga and the stop hook had completed by then.
+func serveUntilSignal(t *testing.T, saga time.Duration) (sagaDone, stopped bool, took time.Duration) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	var finished, hooked atomic.Bool
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/saga" {
+			release := Track()
+			go func() {
+				defer release()
+				time.Sleep(saga)
+				finished.Store(true)
+			}()
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	returned := make(chan error, 1)
+	go func() {
+		returned <- ListenAndServe(addr, h, func(context.Context) { hooked.Store(true) })
+	}()
+
+	// The server answering means the signal handler is in place.
+	var resp *http.Response
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if resp, err = http.Get("http://" + addr + "/saga"); err == nil {
+			_ = resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server not up: %v", err)
+		}
+	}
+	start := time.Now()
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-returned:
+		if err != nil {
+			t.Fatalf("ListenAndServe: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenAndServe did not return after SIGTERM")
+	}
+	took = time.Since(start)
+	if _, err := http.Get("http://" + addr + "/"); err == nil {
+		t.Error("server still accepting connections after the shutdown")
+	}
+	return finished.Load(), hooked.Load(), took
+}
+
+// A saga started before SIGTERM completes before the server exits.
+func TestShutdownWaitsForSagas(t *testing.T) {
+	defer func(p time.Duration) { Period = p }(Period)
+	Period = 5 * time.Second
+
+	sagaDone, stopped, _ := serveUntilSignal(t, 300*time.Millisecond)
+	if !sagaDone {
+		t.Error("ListenAndServe returned before the saga completed")
+	}
+	if !stopped {
+		t.Error("stop hook not run")
+	}
+}
+
+// The wait ends with the grace period, even with a saga still running. It runs in a child
+// process, whose shutdown is left waiting for the saga.
+func TestShutdownGracePeriod(t *testing.T) {
+	if os.Getenv("GRACEFUL_CHILD") == "1" {
+		Period = 200 * time.Millisecond
+		sagaDone, _, took := serveUntilSignal(t, 2*time.Second)
+		if sagaDone {
+			t.Error("the saga completed within the grace period")
+		}
+		if took > time.Second {
+			t.Errorf("shutdown took %s with a grace period of %s", took, Period)
+		}
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestShutdownGracePeriod$")
+	cmd.Env = append(os.Environ(), "GRACEFUL_CHILD=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("%v: %s", err, out)
+	}
+}
@@ -0,0 +1,49 @@
+package idgen
+
+import (
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Flow prefixes of the order IDs.
+const (
+	FlowOrchestrated   = "orc"
+	FlowChoreographed  = "cho"
+	legacyPrefix       = "order"
+	maxCollisionChecks = 5
+)
+
+// New returns a "<flow>-<uuid>" ID.
+func New(flow string) string {
+	return flow + "-" + uuid.NewString()
+}
+
+// NewUnique returns a New ID for which taken reports false, generating another one on a collision.
+// taken is called with the caller's store locked, so the ID can be inserted right after.
+func NewUnique(flow string, taken func(id string) bool) string {
+	id := New(flow)
+	for i := 1; taken(id) && i < maxCollisionChecks; i++ {
+		log.Printf("[idgen] ID collision on %s, generating a new one", id)
+		id = New(flow)
+	}
+	return id
+}
+
+// Flow returns the flow prefix of an ID, or "" for legacy "order-<n>" IDs and unknown formats.
+func Flow(id string) string {
+	prefix, _, ok := strings.Cut(id, "-")
+	if !ok || prefix == legacyPrefix {
+		return ""
+	}
+	if prefix == FlowOrchestrated || prefix == FlowChoreographed {
+		return prefix
+	}
+	return ""
+}
+
+// IsLegacy reports whether id has the old "order-<UnixNano>" format.
+func IsLegacy(id string) bool {
+	return strings.HasPrefix(id, legacyPrefix+"-")
+}
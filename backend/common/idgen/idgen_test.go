@@ -0,0 +1,92 @@
+package idgen
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+)
+
+var idFormat = regexp.MustCompile(`^(orc|cho)-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+func TestNewFormat(t *testing.T) {
+	for _, flow := range []string{FlowOrchestrated, FlowChoreographed} {
+		id := New(flow)
+		if !idFormat.MatchString(id) {
+			t.Errorf("New(%q) = %q, want <flow>-<uuid>", flow, id)
+		}
+		if got := Flow(id); got != flow {
+			t.Errorf("Flow(%q) = %q, want %q", id, got, flow)
+		}
+		if IsLegacy(id) {
+			t.Errorf("%q taken for a legacy ID", id)
+		}
+	}
+}
+
+// IDs created from many goroutines at once never repeat.
+func TestNewUniqueParallel(t *testing.T) {
+	const workers, perWorker = 16, 500
+	var mu sync.Mutex
+	seen := make(map[string]bool, workers*perWorker)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				mu.Lock()
+				id := NewUnique(FlowOrchestrated, func(id string) bool { return seen[id] })
+				if seen[id] {
+					t.Errorf("%s generated twice", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != workers*perWorker {
+		t.Errorf("%d distinct IDs, want %d", len(seen), workers*perWorker)
+	}
+}
+
+// A taken ID is replaced, giving up after maxCollisionChecks attempts.
+func TestNewUniqueCollision(t *testing.T) {
+	var checked []string
+	id := NewUnique(FlowChoreographed, func(id string) bool {
+		checked = append(checked, id)
+		return len(checked) < 3
+	})
+	if len(checked) != 3 || id != checked[2] || checked[0] == checked[1] {
+		t.Errorf("returned %s after checking %v, want the third candidate", id, checked)
+	}
+
+	checked = nil
+	NewUnique(FlowChoreographed, func(id string) bool {
+		checked = append(checked, id)
+		return true
+	})
+	if len(checked) != maxCollisionChecks {
+		t.Errorf("checked %d candidates with every ID taken, want %d", len(checked), maxCollisionChecks)
+	}
+}
+
+func TestLegacyIDs(t *testing.T) {
+	for id, want := range map[string]struct {
+		flow   string
+		legacy bool
+	}{
+		"order-1700000000000000000": {"", true},
+		"orc-123":                   {FlowOrchestrated, false},
+		"cho-123":                   {FlowChoreographed, false},
+		"bogus":                     {"", false},
+		"xyz-123":                   {"", false},
+	} {
+		if got := Flow(id); got != want.flow {
+			t.Errorf("Flow(%q) = %q, want %q", id, got, want.flow)
+		}
+		if got := IsLegacy(id); got != want.legacy {
+			t.Errorf("IsLegacy(%q) = %t, want %t", id, got, want.legacy)
+		}
+	}
+}
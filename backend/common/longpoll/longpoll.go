@@ -0,0 +1,130 @@
+package longpoll
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/config"
+)
+
+// MaxWait caps the ?wait= of a long-poll request.
+const MaxWait = 60 * time.Second
+
+// MaxWaitersPerKey bounds the requests parked on the same key (LONG_POLL_MAX_WAITERS).
+var MaxWaitersPerKey = 16
+
+func init() {
+	if v := os.Getenv("LONG_POLL_MAX_WAITERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Printf("Invalid LONG_POLL_MAX_WAITERS value '%s', using default %d", v, MaxWaitersPerKey)
+		} else {
+			MaxWaitersPerKey = n
+		}
+	}
+	config.Set("LONG_POLL_MAX_WAITERS", MaxWaitersPerKey)
+}
+
+// ErrTooManyWaiters is returned when MaxWaitersPerKey requests already wait on a key.
+var ErrTooManyWaiters = errors.New("too many waiters")
+
+type topic struct {
+	changed chan struct{} // closed and replaced at every Notify
+	waiters int
+}
+
+// Notifier wakes up the requests waiting for a change of a key, e.g. an order status.
+type Notifier struct {
+	mu     sync.Mutex
+	topics map[string]*topic
+}
+
+// NewNotifier returns an empty Notifier.
+func NewNotifier() *Notifier {
+	return &Notifier{topics: make(map[string]*topic)}
+}
+
+// Notify wakes up every request waiting on key.
+func (n *Notifier) Notify(key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if t, ok := n.topics[key]; ok {
+		close(t.changed)
+		t.changed = make(chan struct{})
+	}
+}
+
+func (n *Notifier) subscribe(key string) (<-chan struct{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	t, ok := n.topics[key]
+	if !ok {
+		t = &topic{changed: make(chan struct{})}
+		n.topics[key] = t
+	}
+	if t.waiters >= MaxWaitersPerKey {
+		return nil, ErrTooManyWaiters
+	}
+	t.waiters++
+	return t.changed, nil
+}
+
+func (n *Notifier) unsubscribe(key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if t, ok := n.topics[key]; ok {
+		if t.waiters--; t.waiters == 0 {
+			delete(n.topics, key)
+		}
+	}
+}
+
+// WaitFor waits until done reports true, re-checking it at every Notify of key. It returns false
+// when wait expires or ctx is canceled first.
+func (n *Notifier) WaitFor(ctx context.Context, key string, wait time.Duration, done func() bool) (bool, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		// Subscribing before checking done ensures a concurrent Notify is never missed.
+		changed, err := n.subscribe(key)
+		if err != nil {
+			return false, err
+		}
+		if done() {
+			n.unsubscribe(key)
+			return true, nil
+		}
+		select {
+		case <-changed:
+			n.unsubscribe(key)
+		case <-timer.C:
+			n.unsubscribe(key)
+			return false, nil
+		case <-ctx.Done():
+			n.unsubscribe(key)
+			return false, nil
+		}
+	}
+}
+
+// Params parses ?wait=30s&since_status=pending. A zero wait means the request does not long-poll.
+func Params(r *http.Request) (time.Duration, string, error) {
+	q := r.URL.Query()
+	if q.Get("wait") == "" {
+		return 0, "", nil
+	}
+	wait, err := time.ParseDuration(q.Get("wait"))
+	if err != nil || wait < 0 {
+		return 0, "", errors.New("invalid wait duration")
+	}
+	if wait > MaxWait {
+		wait = MaxWait
+	}
+	return wait, q.Get("since_status"), nil
+}
@@ -0,0 +1,155 @@
+package longpoll
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitForImmediateChange(t *testing.T) {
+	n := NewNotifier()
+	start := time.Now()
+	changed, err := n.WaitFor(context.Background(), "order-1", time.Minute, func() bool { return true })
+	if err != nil || !changed {
+		t.Fatalf("WaitFor = %t, %v, want an immediate change", changed, err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("waited %s for a condition already true", elapsed)
+	}
+	if len(n.topics) != 0 {
+		t.Errorf("%d topics left after the wait", len(n.topics))
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	n := NewNotifier()
+	start := time.Now()
+	changed, err := n.WaitFor(context.Background(), "order-1", 50*time.Millisecond, func() bool { return false })
+	if err != nil || changed {
+		t.Fatalf("WaitFor = %t, %v, want a timeout", changed, err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("gave up after %s, before the wait", elapsed)
+	}
+
+	// A canceled request stops waiting as well.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if changed, err := n.WaitFor(ctx, "order-1", time.Minute, func() bool { return false }); err != nil || changed {
+		t.Errorf("WaitFor on a canceled context = %t, %v", changed, err)
+	}
+	if len(n.topics) != 0 {
+		t.Errorf("%d topics left after the waits", len(n.topics))
+	}
+}
+
+// One Notify wakes up every waiter of the key, and only those; a Notify that does not make the
+// condition true leaves them waiting.
+func TestWaitForConcurrentWakeup(t *testing.T) {
+	n := NewNotifier()
+	var status atomic.Value
+	status.Store("pending")
+	const waiters = 5
+
+	var wg sync.WaitGroup
+	results := make(chan bool, waiters)
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			changed, _ := n.WaitFor(context.Background(), "order-1", 5*time.Second, func() bool { return status.Load() != "pending" })
+			results <- changed
+		}()
+	}
+	other := make(chan bool, 1)
+	go func() {
+		changed, _ := n.WaitFor(context.Background(), "order-2", 300*time.Millisecond, func() bool { return false })
+		other <- changed
+	}()
+	waitForWaiters(t, n, "order-1", waiters)
+
+	n.Notify("order-1") // status unchanged: nobody returns
+	select {
+	case <-results:
+		t.Fatal("a waiter returned without a change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	status.Store("approved")
+	n.Notify("order-1")
+	wg.Wait()
+	close(results)
+	for changed := range results {
+		if !changed {
+			t.Error("a waiter timed out instead of seeing the change")
+		}
+	}
+	if <-other {
+		t.Error("the waiter of another order was woken up")
+	}
+}
+
+func TestWaitersCap(t *testing.T) {
+	prev := MaxWaitersPerKey
+	MaxWaitersPerKey = 2
+	defer func() { MaxWaitersPerKey = prev }()
+	n := NewNotifier()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		go func() { _, _ = n.WaitFor(ctx, "order-1", time.Minute, func() bool { return false }) }()
+	}
+	waitForWaiters(t, n, "order-1", 2)
+	if _, err := n.WaitFor(ctx, "order-1", time.Minute, func() bool { return false }); !errors.Is(err, ErrTooManyWaiters) {
+		t.Errorf("third waiter got %v, want ErrTooManyWaiters", err)
+	}
+	if changed, err := n.WaitFor(ctx, "order-2", time.Millisecond, func() bool { return true }); err != nil || !changed {
+		t.Errorf("waiter of another key got %t, %v", changed, err)
+	}
+}
+
+func TestParams(t *testing.T) {
+	tests := []struct {
+		query string
+		wait  time.Duration
+		since string
+		err   bool
+	}{
+		{query: "", wait: 0},
+		{query: "?wait=30s&since_status=pending", wait: 30 * time.Second, since: "pending"},
+		{query: "?wait=10m&since_status=pending", wait: MaxWait, since: "pending"},
+		{query: "?wait=soon", err: true},
+		{query: "?wait=-1s", err: true},
+	}
+	for _, tc := range tests {
+		wait, since, err := Params(httptest.NewRequest("GET", "/orders/order-1"+tc.query, nil))
+		if (err != nil) != tc.err || wait != tc.wait || since != tc.since {
+			t.Errorf("Params(%q) = %s, %q, %v", tc.query, wait, since, err)
+		}
+	}
+}
+
+func waitForWaiters(t *testing.T, n *Notifier, key string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		n.mu.Lock()
+		got := 0
+		if topic, ok := n.topics[key]; ok {
+			got = topic.waiters
+		}
+		n.mu.Unlock()
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d waiters on %s, want %d", got, key, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,113 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/responses"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// ReasonMaintenance is the reason code of the requests rejected in read-only mode.
+const ReasonMaintenance = "MAINTENANCE"
+
+// defaultRetryAfter is the Retry-After, in seconds, sent while read-only when none was given.
+const defaultRetryAfter = 60
+
+// Status is the read-only state of the service.
+type Status struct {
+	ReadOnly   bool       `json:"read_only"`
+	Since      *time.Time `json:"since,omitempty"`
+	RetryAfter int        `json:"retry_after_seconds,omitempty"`
+	Message    string     `json:"message,omitempty"`
+}
+
+var state = struct {
+	sync.RWMutex
+	Status
+}{}
+
+func init() {
+	if on, _ := strconv.ParseBool(os.Getenv("READ_ONLY")); on {
+		Set(true, defaultRetryAfter, "")
+	}
+	config.Set("READ_ONLY", Current().ReadOnly)
+}
+
+// Current returns the current read-only state.
+func Current() Status {
+	state.RLock()
+	defer state.RUnlock()
+	return state.Status
+}
+
+// Set enables or disables read-only mode.
+func Set(readOnly bool, retryAfter int, message string) Status {
+	state.Lock()
+	defer state.Unlock()
+	if !readOnly {
+		state.Status = Status{}
+		log.Println("[Maintenance] Read-only mode disabled.")
+		return state.Status
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+	if !state.ReadOnly {
+		now := time.Now()
+		state.Since = &now
+	}
+	state.ReadOnly = true
+	state.RetryAfter = retryAfter
+	state.Message = message
+	log.Printf("[Maintenance] Read-only mode enabled (retry after %ds).", retryAfter)
+	return state.Status
+}
+
+// Guard rejects the request with 503 while read-only. Requests already past the guard,
+// such as running sagas, are not affected.
+func Guard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := Current()
+		if !s.ReadOnly {
+			next(w, r)
+			return
+		}
+		message := s.Message
+		if message == "" {
+			message = "The service is in maintenance, new orders are not accepted"
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+		responses.WriteError(w, http.StatusServiceUnavailable, ReasonMaintenance, message)
+	}
+}
+
+// StatusHandler serves GET /maintenance with the current state.
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, Current())
+}
+
+// AdminHandler serves POST /admin/maintenance, toggling read-only mode with a body like
+// {"read_only": true, "retry_after_seconds": 120, "message": "..."}. It must be guarded with adminauth.Require.
+func AdminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req Status
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request body")
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, Set(req.ReadOnly, req.RetryAfter, req.Message))
+}
@@ -0,0 +1,123 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func readWrite(t *testing.T) {
+	t.Helper()
+	Set(false, 0, "")
+	t.Cleanup(func() { Set(false, 0, "") })
+}
+
+// A request that got past the guard before read-only mode was enabled completes; the ones
+// arriving afterwards are turned away until the mode is disabled.
+func TestGuardTogglingMidTraffic(t *testing.T) {
+	readWrite(t)
+	entered, release := make(chan struct{}), make(chan struct{})
+	guarded := Guard(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			close(entered)
+			<-release
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		guarded(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		return rec
+	}
+
+	inFlight := make(chan int, 1)
+	go func() { inFlight <- serve("/create_order?slow=1").Code }()
+	<-entered
+	Set(true, 120, "")
+
+	rec := serve("/create_order")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "120" {
+		t.Fatalf("answered %d (Retry-After %q) while read-only, want 503 with Retry-After 120", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	var envelope events.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil || envelope.ReasonCode != ReasonMaintenance || envelope.Message == "" {
+		t.Errorf("envelope = %+v (%v), want reason %s with a message", envelope, err, ReasonMaintenance)
+	}
+
+	close(release)
+	select {
+	case code := <-inFlight:
+		if code != http.StatusCreated {
+			t.Errorf("in-flight request answered %d, want 201", code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the in-flight request never completed")
+	}
+
+	Set(false, 0, "")
+	if rec := serve("/create_order"); rec.Code != http.StatusCreated {
+		t.Errorf("answered %d once read-only was disabled, want 201", rec.Code)
+	}
+}
+
+func TestSet(t *testing.T) {
+	readWrite(t)
+	first := Set(true, 0, "")
+	if !first.ReadOnly || first.RetryAfter != defaultRetryAfter || first.Since == nil {
+		t.Fatalf("status = %+v, want read-only since now with the default Retry-After", first)
+	}
+	// Changing the message of an enabled mode keeps the time it started.
+	second := Set(true, 30, "resetting the demo")
+	if !second.Since.Equal(*first.Since) || second.RetryAfter != 30 || second.Message != "resetting the demo" {
+		t.Errorf("status = %+v, want the first Since kept", second)
+	}
+	if off := Set(false, 30, "ignored"); off != (Status{}) {
+		t.Errorf("status = %+v once disabled, want the zero status", off)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	readWrite(t)
+	admin := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		AdminHandler(rec, httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader(body)))
+		return rec
+	}
+	status := func() Status {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		StatusHandler(rec, httptest.NewRequest(http.MethodGet, "/maintenance", nil))
+		var s Status
+		if err := json.NewDecoder(rec.Body).Decode(&s); rec.Code != http.StatusOK || err != nil {
+			t.Fatalf("GET /maintenance answered %d: %v", rec.Code, err)
+		}
+		return s
+	}
+
+	if rec := admin(`{"read_only":true,"retry_after_seconds":90,"message":"back soon"}`); rec.Code != http.StatusOK {
+		t.Fatalf("enabling answered %d", rec.Code)
+	}
+	if s := status(); !s.ReadOnly || s.RetryAfter != 90 || s.Message != "back soon" {
+		t.Errorf("status = %+v after enabling", s)
+	}
+	if rec := admin(`{"read_only":`); rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed body answered %d, want 400", rec.Code)
+	}
+	if !status().ReadOnly {
+		t.Error("a malformed request changed the mode")
+	}
+	if rec := admin(`{"read_only":false}`); rec.Code != http.StatusOK || status().ReadOnly {
+		t.Errorf("disabling answered %d, read-only %t", rec.Code, status().ReadOnly)
+	}
+
+	rec := httptest.NewRecorder()
+	AdminHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/maintenance", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /admin/maintenance answered %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+)
+
+// LatencyBucketsMs are bucket bounds suited to latencies in milliseconds.
+var LatencyBucketsMs = []float64{10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000}
+
+// Histogram counts observations in fixed buckets, separately for each label.
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	series map[string]*series
+}
+
+type series struct {
+	counts []int64 // one per bound, plus the overflow bucket
+	count  int64
+	sum    float64
+}
+
+// Bucket is the number of observations less than or equal to Le ("+Inf" for all of them).
+type Bucket struct {
+	Le    string `json:"le"`
+	Count int64  `json:"count"`
+}
+
+// Snapshot is the state of one label of a Histogram, with cumulative buckets.
+type Snapshot struct {
+	Buckets []Bucket `json:"buckets"`
+	Count   int64    `json:"count"`
+	Sum     float64  `json:"sum"`
+}
+
+// NewHistogram returns a Histogram with the given ascending bucket bounds.
+func NewHistogram(bounds ...float64) *Histogram {
+	return &Histogram{bounds: bounds, series: make(map[string]*series)}
+}
+
+// Observe records v under label.
+func (h *Histogram) Observe(label string, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[label]
+	if !ok {
+		s = &series{counts: make([]int64, len(h.bounds)+1)}
+		h.series[label] = s
+	}
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	s.counts[i]++
+	s.count++
+	s.sum += v
+}
+
+// Snapshot returns the current state of every label.
+func (h *Histogram) Snapshot() map[string]Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(map[string]Snapshot, len(h.series))
+	for label, s := range h.series {
+		snap := Snapshot{Count: s.count, Sum: s.sum}
+		var cumulative int64
+		for i, n := range s.counts {
+			cumulative += n
+			le := "+Inf"
+			if i < len(h.bounds) {
+				le = strconv.FormatFloat(h.bounds[i], 'f', -1, 64)
+			}
+			snap.Buckets = append(snap.Buckets, Bucket{Le: le, Count: cumulative})
+		}
+		out[label] = snap
+	}
+	return out
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import "testing"
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(10, 100)
+	for _, v := range []float64{5, 10, 11, 100, 1000} {
+		h.Observe("PROCESS_PAYMENT", v)
+	}
+	h.Observe("RESERVE_INVENTORY", 50)
+
+	snap := h.Snapshot()
+	if len(snap) != 2 {
+		t.Fatalf("%d labels, want 2", len(snap))
+	}
+	payment := snap["PROCESS_PAYMENT"]
+	if payment.Count != 5 || payment.Sum != 1126 {
+		t.Errorf("count %d, sum %.0f, want 5 and 1126", payment.Count, payment.Sum)
+	}
+	want := []Bucket{{Le: "10", Count: 2}, {Le: "100", Count: 4}, {Le: "+Inf", Count: 5}}
+	if len(payment.Buckets) != len(want) {
+		t.Fatalf("buckets = %+v, want %+v", payment.Buckets, want)
+	}
+	for i := range want {
+		if payment.Buckets[i] != want[i] {
+			t.Errorf("bucket %d = %+v, want %+v", i, payment.Buckets[i], want[i])
+		}
+	}
+	if inventory := snap["RESERVE_INVENTORY"]; inventory.Count != 1 || inventory.Buckets[0].Count != 0 || inventory.Buckets[1].Count != 1 {
+		t.Errorf("inventory label = %+v, want its own single observation", inventory)
+	}
+}
@@ -0,0 +1,141 @@
+package order_policy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/responses"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Configurable limits, shared by the gateway, the order services and the inventory services.
+var (
+	MaxItemsPerOrder   = 50
+	MaxQuantityPerItem = 100
+
+	// Sanity bounds for the unit price of a product, applied wherever prices are fetched.
+	MinItemPrice = 0.01
+	MaxItemPrice = 100000.0
+)
+
+func init() {
+	MaxItemsPerOrder = envLimit("MAX_ITEMS_PER_ORDER", MaxItemsPerOrder)
+	MaxQuantityPerItem = envLimit("MAX_QUANTITY_PER_ITEM", MaxQuantityPerItem)
+	MinItemPrice = envPrice("MIN_ITEM_PRICE", MinItemPrice)
+	MaxItemPrice = envPrice("MAX_ITEM_PRICE", MaxItemPrice)
+	if MinItemPrice > MaxItemPrice {
+		log.Fatalf("MIN_ITEM_PRICE (%.2f) is greater than MAX_ITEM_PRICE (%.2f)", MinItemPrice, MaxItemPrice)
+	}
+	config.Set("MAX_ITEMS_PER_ORDER", MaxItemsPerOrder)
+	config.Set("MAX_QUANTITY_PER_ITEM", MaxQuantityPerItem)
+	config.Set("MIN_ITEM_PRICE", MinItemPrice)
+	config.Set("MAX_ITEM_PRICE", MaxItemPrice)
+}
+
+// envLimit reads a positive integer limit from the environment, falling back to def.
+func envLimit(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s value '%s', using default %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+// envPrice reads a positive price bound from the environment, falling back to def.
+func envPrice(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		log.Printf("Invalid %s value '%s', using default %.2f", key, v, def)
+		return def
+	}
+	return f
+}
+
+// Violation describes why a list of items breaks the order policy.
+// Args are the values formatted into Message, in order, so callers can localize it.
+type Violation struct {
+	ReasonCode string
+	Message    string
+	Args       []interface{}
+}
+
+func (v *Violation) Error() string { return v.Message }
+
+func violation(code, format string, args ...interface{}) *Violation {
+	return &Violation{ReasonCode: code, Message: fmt.Sprintf(format, args...), Args: args}
+}
+
+// ValidateItems checks the number of line items and the quantity of each one.
+// It returns nil when the items are acceptable.
+func ValidateItems(items []events.OrderItem) *Violation {
+	if len(items) > MaxItemsPerOrder {
+		return violation(events.ReasonTooManyItems,
+			"The order has %d items, the maximum is %d", len(items), MaxItemsPerOrder)
+	}
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return violation(events.ReasonInvalidQuantity,
+				"Invalid quantity %d for product %s", item.Quantity, item.ProductID)
+		}
+		if item.Quantity > MaxQuantityPerItem {
+			return violation(events.ReasonQuantityExceeded,
+				"Quantity %d for product %s exceeds the maximum of %d", item.Quantity, item.ProductID, MaxQuantityPerItem)
+		}
+	}
+	return nil
+}
+
+// CheckPrice rejects a unit price outside [MinItemPrice, MaxItemPrice], logging the offending product.
+func CheckPrice(productID string, price float64) *Violation {
+	if price >= MinItemPrice && price <= MaxItemPrice {
+		return nil
+	}
+	log.Printf("Price sanity check failed for product %s: %.2f is outside [%.2f, %.2f]", productID, price, MinItemPrice, MaxItemPrice)
+	return violation(events.ReasonPriceSanity,
+		"Price %.2f of product %s is outside the allowed range %.2f-%.2f", price, productID, MinItemPrice, MaxItemPrice)
+}
+
+// Shortage describes an item short of stock, suggesting the available quantity when some is left.
+func Shortage(productID string, requested, available int) events.StockShortage {
+	if available < 0 {
+		available = 0
+	}
+	s := events.StockShortage{ProductID: productID, Requested: requested, Available: available}
+	if available > 0 && available < requested {
+		s.SuggestedQuantity = available
+	}
+	return s
+}
+
+// DedupeItems merges repeated product ids by summing their quantities, keeping the first-seen order.
+func DedupeItems(items []events.OrderItem) []events.OrderItem {
+	index := make(map[string]int, len(items))
+	out := make([]events.OrderItem, 0, len(items))
+	for _, item := range items {
+		if i, ok := index[item.ProductID]; ok {
+			out[i].Quantity += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(out)
+		out = append(out, item)
+	}
+	return out
+}
+
+// WriteViolation writes the violation as a 422 JSON error envelope.
+func WriteViolation(w http.ResponseWriter, v *Violation) {
+	responses.WriteError(w, http.StatusUnprocessableEntity, v.ReasonCode, v.Message)
+}
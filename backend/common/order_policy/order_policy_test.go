@@ -0,0 +1,103 @@
+package order_policy
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func items(n, quantity int) []events.OrderItem {
+	out := make([]events.OrderItem, n)
+	for i := range out {
+		out[i] = events.OrderItem{ProductID: fmt.Sprintf("p%d", i), Quantity: quantity}
+	}
+	return out
+}
+
+func TestValidateItems(t *testing.T) {
+	tests := []struct {
+		name   string
+		items  []events.OrderItem
+		reason string
+	}{
+		{name: "at the item cap", items: items(MaxItemsPerOrder, 1)},
+		{name: "one item over the cap", items: items(MaxItemsPerOrder+1, 1), reason: events.ReasonTooManyItems},
+		{name: "at the quantity cap", items: items(1, MaxQuantityPerItem)},
+		{name: "one over the quantity cap", items: items(1, MaxQuantityPerItem+1), reason: events.ReasonQuantityExceeded},
+		{name: "zero quantity", items: items(1, 0), reason: events.ReasonInvalidQuantity},
+		{name: "negative quantity", items: items(1, -1), reason: events.ReasonInvalidQuantity},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := ValidateItems(tc.items)
+			if tc.reason == "" {
+				if v != nil {
+					t.Errorf("rejected with %s: %s", v.ReasonCode, v.Message)
+				}
+				return
+			}
+			if v == nil || v.ReasonCode != tc.reason {
+				t.Fatalf("violation = %+v, want %s", v, tc.reason)
+			}
+			if v.Message == "" || len(v.Args) == 0 {
+				t.Errorf("violation %+v lacks the message or the args to localize it", v)
+			}
+		})
+	}
+}
+
+func TestDedupeItems(t *testing.T) {
+	got := DedupeItems([]events.OrderItem{
+		{ProductID: "b", Quantity: 1},
+		{ProductID: "a", Quantity: 2},
+		{ProductID: "b", Quantity: 3},
+		{ProductID: "a", Quantity: 4},
+		{ProductID: "c", Quantity: 5},
+	})
+	want := []events.OrderItem{{ProductID: "b", Quantity: 4}, {ProductID: "a", Quantity: 6}, {ProductID: "c", Quantity: 5}}
+	if !slices.Equal(got, want) {
+		t.Errorf("deduped = %v, want %v", got, want)
+	}
+}
+
+func TestCheckPrice(t *testing.T) {
+	tests := []struct {
+		price float64
+		ok    bool
+	}{
+		{price: 49.50, ok: true},
+		{price: MinItemPrice, ok: true},
+		{price: MaxItemPrice, ok: true},
+		{price: 0},
+		{price: -5},
+		{price: MaxItemPrice * 10},
+	}
+	for _, tc := range tests {
+		v := CheckPrice("mouse-wireless", tc.price)
+		if tc.ok != (v == nil) {
+			t.Errorf("CheckPrice(%.2f) = %+v, want accepted %t", tc.price, v, tc.ok)
+			continue
+		}
+		if v != nil && (v.ReasonCode != events.ReasonPriceSanity || len(v.Args) != 4) {
+			t.Errorf("CheckPrice(%.2f) = %+v", tc.price, v)
+		}
+	}
+}
+
+func TestShortage(t *testing.T) {
+	tests := []struct {
+		requested, available int
+		want                 events.StockShortage
+	}{
+		{requested: 5, available: 0, want: events.StockShortage{ProductID: "p", Requested: 5, Available: 0}},
+		{requested: 5, available: 3, want: events.StockShortage{ProductID: "p", Requested: 5, Available: 3, SuggestedQuantity: 3}},
+		{requested: 5, available: -2, want: events.StockShortage{ProductID: "p", Requested: 5, Available: 0}},
+	}
+	for _, tc := range tests {
+		if got := Shortage("p", tc.requested, tc.available); got != tc.want {
+			t.Errorf("Shortage(%d of %d) = %+v, want %+v", tc.requested, tc.available, got, tc.want)
+		}
+	}
+}
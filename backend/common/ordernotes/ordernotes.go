@@ -0,0 +1,103 @@
+package ordernotes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/responses"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// maxNoteLength is the longest note text accepted, in bytes.
+const maxNoteLength = 4000
+
+// Note is a free-text annotation left by support on an order.
+type Note struct {
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrderDetail is the order detail response with ?include=notes.
+type OrderDetail struct {
+	events.Order
+	Notes []Note `json:"notes"`
+}
+
+// Notes of every order, oldest first
+var store = struct {
+	sync.RWMutex
+	Data map[string][]Note
+}{Data: make(map[string][]Note)}
+
+// Add appends a note to an order.
+func Add(orderID string, n Note) {
+	store.Lock()
+	store.Data[orderID] = append(store.Data[orderID], n)
+	store.Unlock()
+}
+
+// List returns the notes of an order, oldest first.
+func List(orderID string) []Note {
+	store.RLock()
+	defer store.RUnlock()
+	return append([]Note{}, store.Data[orderID]...)
+}
+
+// Included reports whether the request asked for the notes with ?include=notes.
+func Included(r *http.Request) bool {
+	for _, part := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if strings.TrimSpace(part) == "notes" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotesPath reports whether path is /orders/{id}/notes, and returns the id.
+func IsNotesPath(path string) (string, bool) {
+	rest := strings.TrimPrefix(path, "/orders/")
+	id, ok := strings.CutSuffix(rest, "/notes")
+	return id, ok && id != "" && rest != path
+}
+
+// Handler serves GET and POST /orders/{id}/notes; exists reports whether the order is known.
+// POST takes {"author": "...", "text": "..."}; the author defaults to "admin".
+func Handler(exists func(orderID string) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := IsNotesPath(r.URL.Path)
+		if !exists(id) {
+			responses.WriteNotFound(w, "order", id)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			responses.WriteJSON(w, http.StatusOK, List(id))
+		case http.MethodPost:
+			var req struct {
+				Author string `json:"author"`
+				Text   string `json:"text"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request body")
+				return
+			}
+			req.Text = strings.TrimSpace(req.Text)
+			if req.Text == "" || len(req.Text) > maxNoteLength {
+				responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "text is required and at most 4000 bytes")
+				return
+			}
+			if req.Author == "" {
+				req.Author = "admin"
+			}
+			n := Note{Author: req.Author, Text: req.Text, CreatedAt: time.Now()}
+			Add(id, n)
+			responses.WriteJSON(w, http.StatusCreated, n)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package ordernotes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func known(id string) bool { return strings.HasPrefix(id, "known-") }
+
+func call(method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	Handler(known)(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// Notes are listed oldest first, the author defaulting to "admin".
+func TestNotesOrdering(t *testing.T) {
+	store.Lock()
+	delete(store.Data, "known-ordering")
+	store.Unlock()
+	for i, author := range []string{"alice", "", "bob"} {
+		rec := call(http.MethodPost, "/orders/known-ordering/notes", fmt.Sprintf(`{"author":%q,"text":"note %d"}`, author, i))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("note %d answered %d: %s", i, rec.Code, rec.Body)
+		}
+	}
+	rec := call(http.MethodGet, "/orders/known-ordering/notes", "")
+	var notes []Note
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&notes) != nil {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	if len(notes) != 3 {
+		t.Fatalf("%d notes, want 3", len(notes))
+	}
+	for i, want := range []string{"alice", "admin", "bob"} {
+		if notes[i].Author != want || notes[i].Text != fmt.Sprintf("note %d", i) {
+			t.Errorf("note %d = %+v, want note %d by %s", i, notes[i], i, want)
+		}
+		if i > 0 && notes[i].CreatedAt.Before(notes[i-1].CreatedAt) {
+			t.Errorf("note %d is older than note %d", i, i-1)
+		}
+	}
+}
+
+func TestNotesRejected(t *testing.T) {
+	rec := call(http.MethodPost, "/orders/missing/notes", `{"text":"hello"}`)
+	var body events.NotFoundResponse
+	if rec.Code != http.StatusNotFound || json.NewDecoder(rec.Body).Decode(&body) != nil ||
+		body != (events.NotFoundResponse{Code: events.CodeNotFound, Resource: "order", ID: "missing"}) {
+		t.Errorf("note on an unknown order answered %d: %s", rec.Code, rec.Body)
+	}
+	for _, text := range []string{`"  "`, `"` + strings.Repeat("x", maxNoteLength+1) + `"`} {
+		if rec := call(http.MethodPost, "/orders/known-rejected/notes", `{"text":`+text+`}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("note of %d bytes answered %d, want 400", len(text), rec.Code)
+		}
+	}
+	if n := len(List("known-rejected")); n != 0 {
+		t.Errorf("%d invalid notes stored", n)
+	}
+}
+
+func TestNotesPathAndInclude(t *testing.T) {
+	for path, want := range map[string]string{
+		"/orders/orc-1/notes": "orc-1",
+		"/orders//notes":      "",
+		"/orders/orc-1":       "",
+		"/other/orc-1/notes":  "",
+	} {
+		if id, ok := IsNotesPath(path); ok != (want != "") || (ok && id != want) {
+			t.Errorf("IsNotesPath(%q) = %q, %t", path, id, ok)
+		}
+	}
+	for query, want := range map[string]bool{"": false, "?include=notes": true, "?include=items,+notes": true, "?include=notesx": false} {
+		if got := Included(httptest.NewRequest(http.MethodGet, "/orders/orc-1"+query, nil)); got != want {
+			t.Errorf("Included(%q) = %t, want %t", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package payment_gateway
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Every failure branch returns its own error: the limit and the simulated declines can be told
+// apart with errors.Is, and reasons containing '%' come out as written.
+func TestPaymentErrors(t *testing.T) {
+	withFakeClock(t)
+	prevLimit := paymentAmountLimit
+	paymentAmountLimit = 2000
+	t.Cleanup(func() { paymentAmountLimit = prevLimit })
+
+	err := ProcessPayment("err-limit", "customer-1", 2500)
+	if !errors.Is(err, ErrAmountLimitExceeded) || errors.Is(err, ErrInjectedFailure) ||
+		err.Error() != "payment limit exceeded: amount 2500.00 exceeds the limit of 2000.00" {
+		t.Errorf("over the limit: %v", err)
+	}
+
+	SetFailureForOrder("err-forced", "declined: 100% of the daily budget used")
+	defer ClearFailureForOrder("err-forced")
+	err = ProcessPayment("err-forced", "customer-1", 10)
+	if !errors.Is(err, ErrInjectedFailure) || err.Error() != "simulated gateway failure: declined: 100% of the daily budget used" {
+		t.Errorf("forced failure: %v", err)
+	}
+
+	if err := ProcessPayment("", "customer-1", 10); err == nil || errors.Is(err, ErrInjectedFailure) || errors.Is(err, ErrAmountLimitExceeded) {
+		t.Errorf("payment without an order id: %v, want a plain error", err)
+	}
+
+	SetFailureRate(1)
+	seen := make(map[string]bool)
+	for i := 0; i < 200 && len(seen) < len(declineReasons); i++ {
+		err := ProcessPayment("err-random", "customer-1", 10)
+		if !errors.Is(err, ErrInjectedFailure) {
+			t.Fatalf("random failure: %v", err)
+		}
+		reason := strings.TrimPrefix(err.Error(), ErrInjectedFailure.Error()+": ")
+		if !slices.Contains(declineReasons, reason) {
+			t.Fatalf("random failure reason %q, want one of %q", reason, declineReasons)
+		}
+		seen[reason] = true
+	}
+	if len(seen) != len(declineReasons) {
+		t.Errorf("random failures gave %v, want each of %q", seen, declineReasons)
+	}
+}
@@ -0,0 +1,42 @@
+package payment_gateway
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// A forced failure makes every payment of its order fail until cleared, and an order with
+// FailPrefix always fails; GetTransaction shows the gateway state after each attempt.
+func TestForcedFailures(t *testing.T) {
+	withFakeClock(t)
+	const orderID = "forced-1"
+	forgetOrder(orderID)
+	forgetOrder(FailPrefix + "1")
+
+	if _, ok := GetTransaction(orderID); ok {
+		t.Fatal("transaction known before any payment")
+	}
+	SetFailureForOrder(orderID, "card stolen")
+	for i := 0; i < 3; i++ {
+		err := ProcessPayment(orderID, "customer-1", 10)
+		if !errors.Is(err, ErrInjectedFailure) || !strings.Contains(err.Error(), "card stolen") {
+			t.Fatalf("attempt %d: error %v, want the forced failure", i+1, err)
+		}
+	}
+	if tx, _ := GetTransaction(orderID); tx.Status != "failed" || tx.Captured != 0 {
+		t.Errorf("gateway state %+v, want failed with nothing captured", tx)
+	}
+
+	ClearFailureForOrder(orderID)
+	if err := ProcessPayment(orderID, "customer-1", 10); err != nil {
+		t.Fatalf("payment after clearing the failure: %v", err)
+	}
+	if tx, ok := GetTransaction(orderID); !ok || tx != (Transaction{OrderID: orderID, Status: "completed", Captured: 10}) {
+		t.Errorf("gateway state %+v, want completed with 10 captured", tx)
+	}
+
+	if err := ProcessPayment(FailPrefix+"1", "customer-1", 10); !errors.Is(err, ErrInjectedFailure) {
+		t.Errorf("%s1 paid with %v, want an injected failure", FailPrefix, err)
+	}
+}
@@ -1,13 +1,20 @@
 package payment_gateway
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"math/rand"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/StitchMl/saga-demo/common/chaos"
+	"github.com/StitchMl/saga-demo/common/clock"
+	"github.com/StitchMl/saga-demo/common/config"
 )
 
 // --------------------------------------------------------------------
@@ -17,14 +24,74 @@ import (
 var (
 	simulatedGatewayDB = struct {
 		sync.RWMutex
-		Transactions map[string]string // OrderID -> Status
-	}{Transactions: make(map[string]string)}
+		Transactions map[string]string  // OrderID -> Status
+		Captured     map[string]float64 // OrderID -> amount charged
+		Refunded     map[string]float64 // OrderID -> amount given back by partial refunds
+	}{Transactions: make(map[string]string), Captured: make(map[string]float64), Refunded: make(map[string]float64)}
 
 	// Configurable parameters
 	paymentAmountLimit float64
 	randomFailureRate  float64
 )
 
+// Clock paces the simulated gateway latency; tests may replace it with a clock.Fake.
+var Clock clock.Clock = clock.Real{}
+
+// ErrInjectedFailure is wrapped by the errors produced by the random failure simulation.
+var ErrInjectedFailure = errors.New("simulated gateway failure")
+
+// ErrAmountLimitExceeded is wrapped by the errors of payments above PAYMENT_GATEWAY_LIMIT.
+var ErrAmountLimitExceeded = errors.New("payment limit exceeded")
+
+// declineReasons are the reasons of the random failures.
+var declineReasons = []string{"insufficient funds", "card declined", "generic gateway error"}
+
+// FailPrefix marks the orders whose payments always fail, e.g. "FAIL-PAY-42".
+const FailPrefix = "FAIL-PAY-"
+
+// Forced failure reasons by order, set with SetFailureForOrder
+var forcedFailures = struct {
+	sync.Mutex
+	Data map[string]string
+}{Data: make(map[string]string)}
+
+// SetFailureForOrder makes every payment of an order fail with reason, whatever the random
+// failure rate, until ClearFailureForOrder.
+func SetFailureForOrder(orderID, reason string) {
+	forcedFailures.Lock()
+	forcedFailures.Data[orderID] = reason
+	forcedFailures.Unlock()
+}
+
+// ClearFailureForOrder removes the failure set by SetFailureForOrder.
+func ClearFailureForOrder(orderID string) {
+	forcedFailures.Lock()
+	delete(forcedFailures.Data, orderID)
+	forcedFailures.Unlock()
+}
+
+// SetFailureRate replaces the random failure rate read from PAYMENT_GATEWAY_FAILURE_RATE, e.g.
+// 0 in tests whose payments must go through. It is meant to be called before any payment.
+func SetFailureRate(rate float64) {
+	randomFailureRate = rate
+}
+
+// forcedFailure returns the reason the payment of an order must fail, if any.
+func forcedFailure(orderID string) (string, bool) {
+	forcedFailures.Lock()
+	defer forcedFailures.Unlock()
+	if reason, ok := forcedFailures.Data[orderID]; ok {
+		return reason, true
+	}
+	if strings.HasPrefix(orderID, FailPrefix) {
+		return "order marked with " + FailPrefix, true
+	}
+	return "", false
+}
+
+// ErrRefundRejected is wrapped by the errors of the refunds the gateway refuses to make.
+var ErrRefundRejected = errors.New("refund rejected")
+
 func init() {
 	rand.New(rand.NewSource(time.Now().UnixNano()))
 
@@ -47,6 +114,8 @@ func init() {
 		log.Fatalf("Invalid value for PAYMENT_GATEWAY_FAILURE_RATE: %v", err)
 	}
 
+	config.Set("PAYMENT_GATEWAY_LIMIT", paymentAmountLimit)
+	config.Set("PAYMENT_GATEWAY_FAILURE_RATE", randomFailureRate)
 	log.Println("[Simulated Payment Gateway] Initialised in memory.")
 }
 
@@ -69,22 +138,30 @@ func ProcessPayment(orderID, customerID string, amount float64) error {
 	simulatedGatewayDB.Transactions[orderID] = "pending"
 	simulatedGatewayDB.Unlock()
 
-	time.Sleep(time.Duration(50+rand.Intn(150)) * time.Millisecond)
+	Clock.Sleep(time.Duration(50+rand.Intn(150)) * time.Millisecond)
 
 	// Bankruptcy checks
 	if amount > paymentAmountLimit {
-		return updateAndReturnError(orderID, fmt.Sprintf("amount %.2f exceeds the limit of %.2f", amount, paymentAmountLimit))
+		return fail(orderID, fmt.Errorf("%w: amount %.2f exceeds the limit of %.2f", ErrAmountLimitExceeded, amount, paymentAmountLimit))
+	}
+
+	if reason, ok := forcedFailure(orderID); ok {
+		return fail(orderID, fmt.Errorf("%w: %s", ErrInjectedFailure, reason))
+	}
+
+	if chaos.Take(chaos.FaultPayment) {
+		return fail(orderID, fmt.Errorf("%w: declined by armed chaos fault", ErrInjectedFailure))
 	}
 
 	if rand.Float64() < randomFailureRate {
-		reasons := []string{"insufficient funds', 'card rejected', 'generic gateway error"}
-		reason := reasons[rand.Intn(len(reasons))]
-		return updateAndReturnError(orderID, reason)
+		reason := declineReasons[rand.Intn(len(declineReasons))]
+		return fail(orderID, fmt.Errorf("%w: %s", ErrInjectedFailure, reason))
 	}
 
 	// Success
 	simulatedGatewayDB.Lock()
 	simulatedGatewayDB.Transactions[orderID] = "completed"
+	simulatedGatewayDB.Captured[orderID] = amount
 	simulatedGatewayDB.Unlock()
 	return nil
 }
@@ -101,7 +178,7 @@ func RevertPayment(orderID, reason string) error {
 		return nil
 	}
 
-	time.Sleep(time.Duration(30+rand.Intn(70)) * time.Millisecond)
+	Clock.Sleep(time.Duration(30+rand.Intn(70)) * time.Millisecond)
 
 	if rand.Float64() < 0.05 { // Lower reimbursement failure rate
 		simulatedGatewayDB.Transactions[orderID] = "failed_refund"
@@ -112,14 +189,78 @@ func RevertPayment(orderID, reason string) error {
 	return nil
 }
 
+// RefundPayment gives back part of the amount charged for an order and returns the total refunded
+// so far. The refunds of an order can never exceed the amount captured; refunding all of it
+// leaves the transaction "refunded".
+func RefundPayment(orderID string, amount float64, reason string) (float64, error) {
+	if amount <= 0 {
+		return 0, fmt.Errorf("%w: the amount must be positive, got %.2f", ErrRefundRejected, amount)
+	}
+	simulatedGatewayDB.Lock()
+	defer simulatedGatewayDB.Unlock()
+
+	if status := simulatedGatewayDB.Transactions[orderID]; status != "completed" {
+		return 0, fmt.Errorf("%w: no completed payment for order %s (status %q)", ErrRefundRejected, orderID, status)
+	}
+	captured, refunded := simulatedGatewayDB.Captured[orderID], simulatedGatewayDB.Refunded[orderID]
+	remaining := math.Round((captured-refunded)*100) / 100
+	if amount > remaining {
+		return refunded, fmt.Errorf("%w: %.2f is more than the %.2f left of the %.2f charged for order %s",
+			ErrRefundRejected, amount, remaining, captured, orderID)
+	}
+
+	Clock.Sleep(time.Duration(30+rand.Intn(70)) * time.Millisecond)
+
+	refunded = math.Round((refunded+amount)*100) / 100
+	simulatedGatewayDB.Refunded[orderID] = refunded
+	if refunded >= captured {
+		simulatedGatewayDB.Transactions[orderID] = "refunded"
+	}
+	log.Printf("[Simulated Payment Gateway] Refunded %.2f of order %s (%.2f of %.2f). Reason: %s", amount, orderID, refunded, captured, reason)
+	return refunded, nil
+}
+
+// Transaction is the gateway state of the payment of an order.
+type Transaction struct {
+	OrderID  string  `json:"order_id"`
+	Status   string  `json:"status"` // pending, completed, failed, refunded, failed_refund
+	Captured float64 `json:"captured"`
+	Refunded float64 `json:"refunded"`
+}
+
+// GetTransaction returns the gateway state of the payment of an order and whether it exists.
+func GetTransaction(orderID string) (Transaction, bool) {
+	simulatedGatewayDB.RLock()
+	defer simulatedGatewayDB.RUnlock()
+	status, ok := simulatedGatewayDB.Transactions[orderID]
+	if !ok {
+		return Transaction{}, false
+	}
+	return Transaction{
+		OrderID:  orderID,
+		Status:   status,
+		Captured: simulatedGatewayDB.Captured[orderID],
+		Refunded: simulatedGatewayDB.Refunded[orderID],
+	}, true
+}
+
+// GetTransactionStatus returns the gateway status of the transaction of an order
+// (pending, completed, failed, refunded, failed_refund) and whether it exists.
+func GetTransactionStatus(orderID string) (string, bool) {
+	simulatedGatewayDB.RLock()
+	defer simulatedGatewayDB.RUnlock()
+	status, ok := simulatedGatewayDB.Transactions[orderID]
+	return status, ok
+}
+
 // --------------------------------------------------------------------
 //  Internal helper
 // --------------------------------------------------------------------
 
-// updateAndReturnError updates the transaction status to 'failed' and returns a formatted error.
-func updateAndReturnError(orderID, reason string) error {
+// fail marks the transaction of an order as failed and returns err.
+func fail(orderID string, err error) error {
 	simulatedGatewayDB.Lock()
 	defer simulatedGatewayDB.Unlock()
 	simulatedGatewayDB.Transactions[orderID] = "failed"
-	return fmt.Errorf(reason)
+	return err
 }
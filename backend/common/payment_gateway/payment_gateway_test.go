@@ -0,0 +1,94 @@
+package payment_gateway
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/clock"
+)
+
+// withFakeClock replaces the gateway clock with a fake one that jumps past every latency as soon
+// as a payment waits on it, so the simulation costs no wall-clock time.
+func withFakeClock(t *testing.T) {
+	t.Helper()
+	fake := clock.NewFake(time.Now())
+	prevClock, prevRate := Clock, randomFailureRate
+	Clock, randomFailureRate = fake, 0
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if fake.Waiters() > 0 {
+				fake.Advance(time.Second)
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		Clock, randomFailureRate = prevClock, prevRate
+	})
+}
+
+// forgetOrder drops the gateway state of an order left by an earlier run.
+func forgetOrder(orderID string) {
+	simulatedGatewayDB.Lock()
+	delete(simulatedGatewayDB.Transactions, orderID)
+	delete(simulatedGatewayDB.Captured, orderID)
+	delete(simulatedGatewayDB.Refunded, orderID)
+	simulatedGatewayDB.Unlock()
+}
+
+// The gateway latency runs on its clock: a payment waits until the clock moves.
+func TestPaymentLatencyOnClock(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	prevClock, prevRate := Clock, randomFailureRate
+	Clock, randomFailureRate = fake, 0
+	defer func() { Clock, randomFailureRate = prevClock, prevRate }()
+	forgetOrder("clock-latency")
+
+	done := make(chan error, 1)
+	go func() { done <- ProcessPayment("clock-latency", "customer-1", 10) }()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("payment returned %v before the clock moved", err)
+	case <-time.After(250 * time.Millisecond):
+	}
+	if status, _ := GetTransactionStatus("clock-latency"); status != "pending" {
+		t.Errorf("status %q while waiting, want pending", status)
+	}
+	fake.Advance(200 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := GetTransactionStatus("clock-latency"); status != "completed" {
+		t.Errorf("status %q, want completed", status)
+	}
+}
+
+// Fifty payments and refunds would take several seconds of simulated latency on the real clock.
+func TestFakeClockSkipsLatency(t *testing.T) {
+	withFakeClock(t)
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		orderID := fmt.Sprintf("clock-fast-%d", i)
+		forgetOrder(orderID)
+		if err := ProcessPayment(orderID, "customer-1", 10); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := RefundPayment(orderID, 10, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %s, want well under the %s of real latency", elapsed, 50*80*time.Millisecond)
+	}
+}
@@ -0,0 +1,30 @@
+package responses
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// WriteJSON writes v as a JSON response with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error in response coding: %v", err)
+	}
+}
+
+// WriteError writes the structured error envelope. Failures are signalled by the
+// status code (4xx/5xx); callers must not rely on a "status" field in the body.
+func WriteError(w http.ResponseWriter, status int, reasonCode, message string) {
+	WriteJSON(w, status, events.ErrorResponse{ReasonCode: reasonCode, Message: message})
+}
+
+// WriteNotFound writes the 404 returned by the read endpoints when the id of a resource
+// (e.g. "order", "saga", "product") is unknown.
+func WriteNotFound(w http.ResponseWriter, resource, id string) {
+	WriteJSON(w, http.StatusNotFound, events.NotFoundResponse{Code: events.CodeNotFound, Resource: resource, ID: id})
+}
@@ -0,0 +1,25 @@
+package responses
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func TestWriteNotFound(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteNotFound(rec, "order", "order-123")
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("answered %d with %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var body events.NotFoundResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body != (events.NotFoundResponse{Code: "not_found", Resource: "order", ID: "order-123"}) {
+		t.Errorf("body = %+v", body)
+	}
+}
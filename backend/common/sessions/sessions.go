@@ -0,0 +1,149 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/responses"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// TTL is how long a token issued by Issue stays valid (AUTH_TOKEN_TTL_SECONDS, default 3600).
+var TTL = time.Hour
+
+// Session is the customer a token was issued to.
+type Session struct {
+	CustomerID string    `json:"customer_id"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Sessions by token
+var store = struct {
+	sync.Mutex
+	Data map[string]Session
+}{Data: make(map[string]Session)}
+
+// Issue creates an opaque random token for a customer, valid for TTL.
+func Issue(customerID string) (string, Session) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("[Sessions] Cannot generate a token: %v", err)
+	}
+	token := hex.EncodeToString(b)
+	s := Session{CustomerID: customerID, ExpiresAt: time.Now().Add(TTL)}
+	store.Lock()
+	store.Data[token] = s
+	store.Unlock()
+	return token, s
+}
+
+// Lookup returns the session of a token that is known and not expired.
+func Lookup(token string) (Session, bool) {
+	store.Lock()
+	defer store.Unlock()
+	s, ok := store.Data[token]
+	if !ok || !time.Now().Before(s.ExpiresAt) {
+		return Session{}, false
+	}
+	return s, true
+}
+
+// Revoke forgets a token and reports whether it was known.
+func Revoke(token string) bool {
+	store.Lock()
+	defer store.Unlock()
+	_, ok := store.Data[token]
+	delete(store.Data, token)
+	return ok
+}
+
+// Start reads AUTH_TOKEN_TTL_SECONDS and removes the expired tokens in the background, every
+// minute or TTL if shorter. Auth services call it before issuing tokens.
+func Start() {
+	if v := os.Getenv("AUTH_TOKEN_TTL_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid AUTH_TOKEN_TTL_SECONDS: %q", v)
+		}
+		TTL = time.Duration(n) * time.Second
+	}
+	config.Set("AUTH_TOKEN_TTL_SECONDS", int(TTL.Seconds()))
+	interval := min(TTL, time.Minute)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			store.Lock()
+			for token, s := range store.Data {
+				if !now.Before(s.ExpiresAt) {
+					delete(store.Data, token)
+				}
+			}
+			store.Unlock()
+		}
+	}()
+}
+
+// BearerToken returns the token of an "Authorization: Bearer <token>" header, if any.
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// tokenFrom reads the token from the Authorization header, or from a {"token": "..."} body.
+func tokenFrom(r *http.Request) string {
+	if token := BearerToken(r); token != "" {
+		return token
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	return body.Token
+}
+
+// ValidateTokenHandler serves POST /validate_token: 200 with the customer of a valid token,
+// 401 when the token is unknown, revoked or expired.
+func ValidateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s, ok := Lookup(tokenFrom(r))
+	if !ok {
+		responses.WriteError(w, http.StatusUnauthorized, events.ReasonInvalidToken, "Invalid or expired token")
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"customer_id": s.CustomerID,
+		"expires_at":  s.ExpiresAt,
+		"valid":       true,
+	})
+}
+
+// LogoutHandler serves POST /logout, revoking the token. Revoking an unknown token succeeds too.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := tokenFrom(r)
+	if token == "" {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "token required")
+		return
+	}
+	Revoke(token)
+	responses.WriteJSON(w, http.StatusOK, map[string]string{"status": "logged_out"})
+}
@@ -0,0 +1,81 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validate(token string) int {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/validate_token", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	ValidateTokenHandler(rec, req)
+	return rec.Code
+}
+
+// A token is valid for its customer until it expires or is revoked by /logout.
+func TestTokenLifecycle(t *testing.T) {
+	token, s := Issue("customer-1")
+	other, _ := Issue("customer-2")
+	if token == other || len(token) != 64 {
+		t.Fatalf("tokens %q and %q, want distinct 32-byte hex tokens", token, other)
+	}
+	if got, ok := Lookup(token); !ok || got != s || got.CustomerID != "customer-1" {
+		t.Errorf("Lookup = %+v %t, want the session of customer-1", got, ok)
+	}
+	if code := validate(token); code != http.StatusOK {
+		t.Errorf("/validate_token answered %d, want 200", code)
+	}
+
+	rec := httptest.NewRecorder()
+	LogoutHandler(rec, httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(`{"token":"`+token+`"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/logout answered %d", rec.Code)
+	}
+	if code := validate(token); code != http.StatusUnauthorized {
+		t.Errorf("revoked token answered %d, want 401", code)
+	}
+	if _, ok := Lookup(other); !ok {
+		t.Error("logout revoked the token of another customer")
+	}
+	if code := validate("not-a-token"); code != http.StatusUnauthorized {
+		t.Errorf("unknown token answered %d, want 401", code)
+	}
+}
+
+func TestExpiredTokenRejected(t *testing.T) {
+	prev := TTL
+	TTL = 10 * time.Millisecond
+	t.Cleanup(func() { TTL = prev })
+
+	token, _ := Issue("customer-1")
+	if code := validate(token); code != http.StatusOK {
+		t.Fatalf("fresh token answered %d", code)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := Lookup(token); ok {
+		t.Error("expired token still looked up")
+	}
+	if code := validate(token); code != http.StatusUnauthorized {
+		t.Errorf("expired token answered %d, want 401", code)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	for header, want := range map[string]string{
+		"Bearer abc":  "abc",
+		"bearer  abc": "abc",
+		"Basic abc":   "",
+		"abc":         "",
+		"":            "",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", header)
+		if got := BearerToken(r); got != want {
+			t.Errorf("BearerToken(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/config"
+)
+
+// Server side: certificate served, and the CA client certificates must be signed by (mTLS).
+var (
+	certFile     = os.Getenv("TLS_CERT_FILE")
+	keyFile      = os.Getenv("TLS_KEY_FILE")
+	clientCAFile = os.Getenv("TLS_CLIENT_CA_FILE")
+)
+
+// Client side: extra CA trusted for the other services, and the certificate presented to them.
+var (
+	caFile         = os.Getenv("TLS_CA_FILE")
+	clientCertFile = os.Getenv("TLS_CLIENT_CERT_FILE")
+	clientKeyFile  = os.Getenv("TLS_CLIENT_KEY_FILE")
+)
+
+// transport is used by the clients returned by Client.
+var transport http.RoundTripper = http.DefaultTransport
+
+func init() {
+	config.Set("TLS_CERT_FILE", certFile)
+	config.Set("TLS_KEY_FILE", keyFile)
+	config.Set("TLS_CLIENT_CA_FILE", clientCAFile)
+	config.Set("TLS_CA_FILE", caFile)
+	config.Set("TLS_CLIENT_CERT_FILE", clientCertFile)
+	config.Set("TLS_CLIENT_KEY_FILE", clientKeyFile)
+
+	if (certFile == "") != (keyFile == "") {
+		log.Fatal("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if (clientCertFile == "") != (clientKeyFile == "") {
+		log.Fatal("TLS_CLIENT_CERT_FILE and TLS_CLIENT_KEY_FILE must be set together")
+	}
+	if clientCAFile != "" && certFile == "" {
+		log.Fatal("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if caFile == "" && clientCertFile == "" {
+		return
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		cfg.RootCAs = certPool(caFile)
+	}
+	if clientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+		if err != nil {
+			log.Fatalf("Invalid TLS_CLIENT_CERT_FILE/TLS_CLIENT_KEY_FILE: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = cfg
+	transport = t
+}
+
+// certPool returns the system roots plus the PEM certificates of file.
+func certPool(file string) *x509.CertPool {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		log.Fatalf("Cannot read CA file %s: %v", file, err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		log.Fatalf("No PEM certificate found in %s", file)
+	}
+	return pool
+}
+
+// Enabled reports whether the server side serves HTTPS.
+func Enabled() bool {
+	return certFile != ""
+}
+
+// ListenAndServe starts srv over HTTPS when TLS_CERT_FILE is set, requiring client certificates
+// signed by TLS_CLIENT_CA_FILE when that is set too, and over plain HTTP otherwise.
+func ListenAndServe(srv *http.Server) error {
+	if !Enabled() {
+		return srv.ListenAndServe()
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile != "" {
+		cfg.ClientCAs = certPool(clientCAFile)
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	srv.TLSConfig = cfg
+	log.Printf("[TLS] Serving HTTPS on %s (client certificates required: %t)", srv.Addr, clientCAFile != "")
+	return srv.ListenAndServeTLS(certFile, keyFile)
+}
+
+// Client returns an HTTP client for the calls to the other services: it trusts TLS_CA_FILE
+// and presents TLS_CLIENT_CERT_FILE, when they are set.
+func Client(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// CheckURL stops the service when the URL of another service is not an absolute http or https URL,
+// and warns when a client certificate is configured but the URL would send it nowhere.
+func CheckURL(name, raw string) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		log.Fatalf("Invalid %s %q: expected http://host[:port] or https://host[:port]", name, raw)
+	}
+	if u.Scheme == "http" && clientCertFile != "" {
+		log.Printf("[TLS] Warning: %s uses plain HTTP, the client certificate is not sent to it", name)
+	}
+}
@@ -0,0 +1,170 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// authority is a test CA able to sign server and client certificates.
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newAuthority(t *testing.T, dir, name string) *authority {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	key, der := sign(t, tmpl, nil, nil)
+	writePEM(t, filepath.Join(dir, name+".pem"), "CERTIFICATE", der)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &authority{cert: cert, key: key}
+}
+
+// issue writes name.pem and name-key.pem, a certificate for 127.0.0.1 signed by a.
+func (a *authority) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	key, der := sign(t, tmpl, a.cert, a.key)
+	writePEM(t, filepath.Join(dir, name+".pem"), "CERTIFICATE", der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, name+"-key.pem"), "EC PRIVATE KEY", keyDER)
+}
+
+// sign creates the certificate of tmpl with a new key, self-signed when parent is nil.
+func sign(t *testing.T, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, der
+}
+
+func writePEM(t *testing.T, file, kind string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// roundTrip serves HTTPS with ListenAndServe and calls it with Client, both set up from the
+// environment of the child process.
+func roundTrip(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			t.Error("request served without a client certificate")
+			return
+		}
+		_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	})}
+	go func() { _ = ListenAndServe(srv) }()
+	defer srv.Close()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if c, err := net.Dial("tcp", addr); err == nil {
+			_ = c.Close()
+			break
+		} else if time.Since(start) > 5*time.Second {
+			t.Fatalf("server not listening: %v", err)
+		}
+	}
+
+	resp, err := Client(5 * time.Second).Get("https://" + addr + "/")
+	if os.Getenv("TLS_CHILD") == "fail" {
+		if err == nil {
+			resp.Body.Close()
+			t.Fatalf("call answered %d, want the handshake refused", resp.StatusCode)
+		}
+		t.Logf("refused: %v", err)
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "client" {
+		t.Errorf("answered %d %q, want 200 from the server seeing the client certificate", resp.StatusCode, body)
+	}
+}
+
+// A service calls another over mTLS, and the handshake fails when the client does not trust the
+// server's CA or presents no certificate.
+func TestHTTPSRoundTrip(t *testing.T) {
+	if os.Getenv("TLS_CHILD") != "" {
+		roundTrip(t)
+		return
+	}
+	dir := t.TempDir()
+	ca := newAuthority(t, dir, "ca")
+	newAuthority(t, dir, "other-ca")
+	ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	ca.issue(t, dir, "client", x509.ExtKeyUsageClientAuth)
+	path := func(name string) string { return filepath.Join(dir, name) }
+	server := []string{"TLS_CERT_FILE=" + path("server.pem"), "TLS_KEY_FILE=" + path("server-key.pem"),
+		"TLS_CLIENT_CA_FILE=" + path("ca.pem")}
+	clientCert := []string{"TLS_CLIENT_CERT_FILE=" + path("client.pem"), "TLS_CLIENT_KEY_FILE=" + path("client-key.pem")}
+
+	for _, tc := range []struct {
+		name   string
+		expect string
+		env    []string
+	}{
+		{"mtls", "ok", append([]string{"TLS_CA_FILE=" + path("ca.pem")}, clientCert...)},
+		{"wrong CA", "fail", append([]string{"TLS_CA_FILE=" + path("other-ca.pem")}, clientCert...)},
+		{"no client certificate", "fail", []string{"TLS_CA_FILE=" + path("ca.pem")}},
+	} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHTTPSRoundTrip$", "-test.v")
+		cmd.Env = append(append(append(os.Environ(), "TLS_CHILD="+tc.expect), server...), tc.env...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("%s: %v\n%s", tc.name, err, out)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package transactions
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/payment_gateway"
+	"github.com/StitchMl/saga-demo/common/responses"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// ListHandler serves GET /transactions with the transactions returned by list, newest first,
+// filtered by ?customer_id= and ?status=.
+func ListHandler(list func() []events.Transaction) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		customerID := r.URL.Query().Get("customer_id")
+		status := r.URL.Query().Get("status")
+		out := []events.Transaction{}
+		for _, tx := range list() {
+			if (customerID == "" || tx.CustomerID == customerID) && (status == "" || tx.Status == status) {
+				out = append(out, tx)
+			}
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+		responses.WriteJSON(w, http.StatusOK, out)
+	}
+}
+
+// GetHandler serves GET {prefix}{orderID} with the transaction returned by get, 404 when unknown.
+func GetHandler(prefix string, get func(orderID string) (events.Transaction, bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		orderID := strings.TrimPrefix(r.URL.Path, prefix)
+		tx, ok := get(orderID)
+		if !ok {
+			responses.WriteNotFound(w, "transaction", orderID)
+			return
+		}
+		responses.WriteJSON(w, http.StatusOK, tx)
+	}
+}
+
+// DecodeRefundRequest reads a RefundRequest, writing a 400 when the order id is missing or the
+// amount is not positive.
+func DecodeRefundRequest(w http.ResponseWriter, r *http.Request) (events.RefundRequest, bool) {
+	var req events.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OrderID == "" || req.Amount <= 0 {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "order_id is required and amount must be positive")
+		return req, false
+	}
+	return req, true
+}
+
+// Refund makes a partial refund of tx at the gateway and records it, writing the error response
+// when the payment is not processed or the gateway refuses. The caller holds the lock of tx.
+func Refund(w http.ResponseWriter, tx *events.Transaction, req events.RefundRequest) (events.PaymentRefundPayload, bool) {
+	if tx == nil || tx.Status != "processed" {
+		responses.WriteError(w, http.StatusConflict, events.ReasonRefundRejected, "No processed payment for order "+req.OrderID)
+		return events.PaymentRefundPayload{}, false
+	}
+	refunded, err := payment_gateway.RefundPayment(req.OrderID, req.Amount, req.Reason)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, payment_gateway.ErrRefundRejected) {
+			status = http.StatusConflict
+		}
+		responses.WriteError(w, status, events.ReasonRefundRejected, err.Error())
+		return events.PaymentRefundPayload{}, false
+	}
+	tx.Refunded = refunded
+	tx.UpdatedAt = time.Now()
+	return events.PaymentRefundPayload{
+		OrderID:   req.OrderID,
+		Amount:    req.Amount,
+		Refunded:  refunded,
+		Remaining: math.Round((tx.Amount-refunded)*100) / 100,
+		Reason:    req.Reason,
+	}, true
+}
@@ -0,0 +1,80 @@
+package transactions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+var ledger = func() []events.Transaction {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	return []events.Transaction{
+		{OrderID: "o-1", CustomerID: "alice", Status: "processed", CreatedAt: start},
+		{OrderID: "o-2", CustomerID: "bob", Status: "failed", CreatedAt: start.Add(time.Minute)},
+		{OrderID: "o-3", CustomerID: "alice", Status: "failed", CreatedAt: start.Add(2 * time.Minute)},
+		{OrderID: "o-4", CustomerID: "alice", Status: "reverted", CreatedAt: start.Add(3 * time.Minute)},
+	}
+}
+
+func TestListHandlerFilters(t *testing.T) {
+	handler := ListHandler(ledger)
+	for query, want := range map[string][]string{
+		"":                                 {"o-4", "o-3", "o-2", "o-1"},
+		"?customer_id=alice":               {"o-4", "o-3", "o-1"},
+		"?status=failed":                   {"o-3", "o-2"},
+		"?customer_id=alice&status=failed": {"o-3"},
+		"?customer_id=carol":               {},
+	} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/transactions"+query, nil))
+		var got []events.Transaction
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got == nil {
+			t.Fatalf("%q: answered %d %s, want a JSON list", query, rec.Code, rec.Body)
+		}
+		ids := []string{}
+		for _, tx := range got {
+			ids = append(ids, tx.OrderID)
+		}
+		if !slices.Equal(ids, want) {
+			t.Errorf("%q listed %v, want %v newest first", query, ids, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/transactions", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST answered %d, want 405", rec.Code)
+	}
+}
+
+func TestGetHandler(t *testing.T) {
+	handler := GetHandler("/transactions/", func(orderID string) (events.Transaction, bool) {
+		for _, tx := range ledger() {
+			if tx.OrderID == orderID {
+				return tx, true
+			}
+		}
+		return events.Transaction{}, false
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/transactions/o-2", nil))
+	var tx events.Transaction
+	_ = json.Unmarshal(rec.Body.Bytes(), &tx)
+	if rec.Code != http.StatusOK || tx.CustomerID != "bob" || tx.Status != "failed" {
+		t.Errorf("o-2 answered %d %+v", rec.Code, tx)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/transactions/o-404", nil))
+	var resp events.NotFoundResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusNotFound || resp.Code != events.CodeNotFound || resp.Resource != "transaction" || resp.ID != "o-404" {
+		t.Errorf("unknown order answered %d %+v, want 404 naming the transaction", rec.Code, resp)
+	}
+}
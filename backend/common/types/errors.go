@@ -0,0 +1,62 @@
+package events
+
+// Reason codes used in error responses.
+const (
+	ReasonInvalidRequest   = "INVALID_REQUEST"
+	ReasonMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	ReasonUnknownProduct   = "UNKNOWN_PRODUCT"
+	ReasonPublishFailed    = "PUBLISH_FAILED"
+	ReasonTooManyItems     = "TOO_MANY_ITEMS"
+	ReasonInvalidQuantity  = "INVALID_QUANTITY"
+	ReasonQuantityExceeded = "QUANTITY_EXCEEDED"
+	ReasonInventoryDown    = "INVENTORY_UNAVAILABLE"
+	ReasonPriceSanity      = "PRICE_SANITY_FAILED"
+	ReasonInsufficientQty  = "INSUFFICIENT_STOCK"
+	ReasonOrderNotFound    = "ORDER_NOT_FOUND"
+	ReasonInvalidCustomer  = "INVALID_CUSTOMER"
+	ReasonRevertFailed     = "REVERT_FAILED"
+	ReasonReservationClash = "RESERVATION_MISMATCH"
+	ReasonQuotaExceeded    = "QUOTA_EXCEEDED"
+	ReasonInProgress       = "REQUEST_IN_PROGRESS"
+	ReasonBodyTooLarge     = "BODY_TOO_LARGE"
+	ReasonStockOutOfRange  = "STOCK_OUT_OF_RANGE"
+	ReasonHoldExpired      = "RESERVATION_EXPIRED"
+	ReasonProductReserved  = "PRODUCT_RESERVED"
+	ReasonRefundRejected   = "REFUND_REJECTED"
+	ReasonInvalidToken     = "INVALID_TOKEN"
+	ReasonRateLimited      = "RATE_LIMITED"
+	ReasonIdempotencyReuse = "IDEMPOTENCY_KEY_REUSED"
+)
+
+// ErrorResponse is the JSON envelope returned by the services when a request is rejected.
+type ErrorResponse struct {
+	ReasonCode string `json:"reason_code"`
+	Message    string `json:"message"`
+	OrderID    string `json:"order_id,omitempty"`
+	// Shortages lists the items that could not be reserved, with INSUFFICIENT_STOCK.
+	Shortages []StockShortage `json:"shortages,omitempty"`
+	// UnknownProducts lists the product ids not in the catalog, with UNKNOWN_PRODUCT.
+	UnknownProducts []string `json:"unknown_products,omitempty"`
+}
+
+// StockShortage is an item whose requested quantity exceeds the available stock.
+// SuggestedQuantity is set when some stock is left, so the client can retry with less.
+type StockShortage struct {
+	ProductID         string `json:"product_id"`
+	Requested         int    `json:"requested"`
+	Available         int    `json:"available"`
+	SuggestedQuantity int    `json:"suggested_quantity,omitempty"`
+}
+
+// TagPrecheckSkipped marks an order created without the product check because the inventory was unreachable.
+const TagPrecheckSkipped = "precheck_skipped"
+
+// CodeNotFound is the code of NotFoundResponse.
+const CodeNotFound = "not_found"
+
+// NotFoundResponse is the JSON body of the 404 returned by the read endpoints for an unknown id.
+type NotFoundResponse struct {
+	Code     string `json:"code"`
+	Resource string `json:"resource"`
+	ID       string `json:"id"`
+}
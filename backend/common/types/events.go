@@ -1,6 +1,10 @@
 package events
 
-import "time"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 // EventType defines the type of subscription event
 type EventType string
@@ -12,6 +16,20 @@ const (
 	PaymentProcessedEvent           EventType = "PaymentProcessed"
 	PaymentFailedEvent              EventType = "PaymentFailed"
 	RevertInventoryEvent            EventType = "RevertInventory"
+	SagaCompletedEvent              EventType = "SagaCompleted"
+	PaymentRevertSkippedEvent       EventType = "PaymentRevertSkipped"
+	PaymentRevertMismatchEvent      EventType = "PaymentRevertMismatch"
+	LowStockEvent                   EventType = "LowStock"
+	PaymentPartiallyRefundedEvent   EventType = "PaymentPartiallyRefunded"
+	OrderApprovedEvent              EventType = "OrderApproved"
+	OrderRejectedEvent              EventType = "OrderRejected"
+)
+
+// Reason codes attached to failed payments so that clients can tell a business rule from a decline.
+const (
+	ReasonLimitExceeded   = "LIMIT_EXCEEDED"
+	ReasonGatewayDeclined = "GATEWAY_DECLINED"
+	ReasonInjectedFailure = "INJECTED_FAILURE"
 )
 
 // EventPayload is an interface to all event payloads, making their nature explicit.
@@ -19,10 +37,14 @@ type EventPayload interface{}
 
 // BaseEvent provides fields common to all SAGA events.
 type BaseEvent struct {
+	// EventID identifies the event, so that a redelivered copy can be recognized and skipped.
+	EventID   string    `json:"event_id,omitempty"`
 	OrderID   string    `json:"order_id"`
 	Timestamp time.Time `json:"timestamp"`
 	Type      EventType `json:"type"`
 	Details   string    `json:"details,omitempty"`
+	// CorrelationID ties the events of a saga to the request that started it.
+	CorrelationID string `json:"correlation_id,omitempty"`
 }
 
 // OrderItem represents an item within an order
@@ -40,6 +62,15 @@ type Order struct {
 	Total      float64     `json:"total,omitempty"`
 	Status     string      `json:"status"` // Pending, approved, rejected
 	Reason     string      `json:"reason,omitempty"`
+	ReasonCode string      `json:"reason_code,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	// Shortages explains an INSUFFICIENT_STOCK rejection item by item.
+	Shortages []StockShortage `json:"shortages,omitempty"`
+	// Tags are markers set while processing the order, e.g. "precheck_skipped".
+	Tags []string `json:"tags,omitempty"`
+	// Address is where the order is shipped; ShippingCost is included in Total.
+	Address      string  `json:"address,omitempty"`
+	ShippingCost float64 `json:"shipping_cost,omitempty"`
 }
 
 // Product defines the structure of a product.
@@ -50,6 +81,8 @@ type Product struct {
 	Price       float64 `json:"price"`
 	Available   int     `json:"available"`
 	ImageURL    string  `json:"image_url,omitempty"`
+	// Warehouses is the stock by warehouse; Available is its sum.
+	Warehouses map[string]int `json:"warehouses,omitempty"`
 }
 
 // --- Payload of Events ---
@@ -71,6 +104,30 @@ type InventoryRequestPayload struct {
 	CustomerID string      `json:"customer_id,omitempty"`
 }
 
+// ShippingQuoteRequest asks the shipping service the cost of shipping an order.
+type ShippingQuoteRequest struct {
+	OrderID string      `json:"order_id"`
+	Address string      `json:"address"`
+	Items   []OrderItem `json:"items"`
+}
+
+// ShippingQuote is the cost of shipping an order to the zone of its address.
+type ShippingQuote struct {
+	OrderID string  `json:"order_id"`
+	Zone    string  `json:"zone"`
+	Cost    float64 `json:"cost"`
+}
+
+// PricesRequest asks the inventory service the prices of several products at once.
+type PricesRequest struct {
+	ProductIDs []string `json:"product_ids"`
+}
+
+// PricesResponse is the price of each requested product, by product id.
+type PricesResponse struct {
+	Prices map[string]float64 `json:"prices"`
+}
+
 // PaymentPayload common data for PaymentProcessed and PaymentFailed
 type PaymentPayload struct {
 	OrderID    string  `json:"order_id"`
@@ -81,10 +138,72 @@ type PaymentPayload struct {
 
 // OrderStatusUpdatePayload Data for order status update events.
 type OrderStatusUpdatePayload struct {
+	OrderID      string          `json:"order_id"`
+	Total        float64         `json:"total,omitempty"`
+	ShippingCost float64         `json:"shipping_cost,omitempty"`
+	Status       string          `json:"status"`
+	Reason       string          `json:"reason,omitempty"`
+	ReasonCode   string          `json:"reason_code,omitempty"`
+	Shortages    []StockShortage `json:"shortages,omitempty"`
+}
+
+// SagaCompletedPayload summarises the final outcome of a saga, emitted exactly once per order.
+type SagaCompletedPayload struct {
+	OrderID           string   `json:"order_id"`
+	Flow              string   `json:"flow"` // orchestrated, choreographed
+	Status            string   `json:"status"`
+	Total             float64  `json:"total"`
+	DurationMs        int64    `json:"duration_ms"`
+	StepsExecuted     []string `json:"steps_executed"`
+	CompensationsRun  []string `json:"compensations_run,omitempty"`
+	FailureReasonCode string   `json:"failure_reason_code,omitempty"`
+	// CompensationLatencyMs is how long the saga stayed inconsistent: from the failure of a step
+	// to the end of the compensation it triggered.
+	CompensationLatencyMs int64 `json:"compensation_latency_ms,omitempty"`
+}
+
+// OrderOutcomePayload announces the final status of an order to consumers outside the saga,
+// such as a notification service.
+type OrderOutcomePayload struct {
+	OrderID    string  `json:"order_id"`
+	CustomerID string  `json:"customer_id"`
+	Total      float64 `json:"total"`
+	Reason     string  `json:"reason,omitempty"`
+	ReasonCode string  `json:"reason_code,omitempty"`
+}
+
+// PaymentRevertAuditPayload reports a payment revert where the local record and the gateway disagree,
+// so that operators can reconcile the charge.
+type PaymentRevertAuditPayload struct {
+	OrderID       string `json:"order_id"`
+	LocalStatus   string `json:"local_status"`   // empty when the service has no record
+	GatewayStatus string `json:"gateway_status"` // empty when the gateway has no transaction
+	Action        string `json:"action"`         // reverted, revert_failed, skipped
+	Reason        string `json:"reason,omitempty"`
+}
+
+// LowStockPayload announces a product whose available stock dropped below the low-stock threshold.
+type LowStockPayload struct {
+	ProductID string `json:"product_id"`
+	Available int    `json:"available"`
+	Threshold int    `json:"threshold"`
+}
+
+// RefundRequest asks a payment service to give back part of the amount paid for an order.
+type RefundRequest struct {
 	OrderID string  `json:"order_id"`
-	Total   float64 `json:"total,omitempty"`
-	Status  string  `json:"status"`
-	Reason  string  `json:"reason,omitempty"`
+	Amount  float64 `json:"amount"`
+	Reason  string  `json:"reason"`
+}
+
+// PaymentRefundPayload reports a partial refund: the amount given back, the total refunded
+// for the order so far and what is left of the payment.
+type PaymentRefundPayload struct {
+	OrderID   string  `json:"order_id"`
+	Amount    float64 `json:"amount"`
+	Refunded  float64 `json:"refunded"`
+	Remaining float64 `json:"remaining"`
+	Reason    string  `json:"reason,omitempty"`
 }
 
 // GenericEvent wrapper for all event payloads
@@ -93,10 +212,11 @@ type GenericEvent struct {
 	Payload EventPayload `json:"payload"`
 }
 
-// NewGenericEvent creates a new generic event with the base data and the specific payload.
+// NewGenericEvent creates a new generic event with a new EventID, the base data and the specific payload.
 func NewGenericEvent(eventType EventType, orderID, details string, payload EventPayload) GenericEvent {
 	return GenericEvent{
 		BaseEvent: BaseEvent{
+			EventID:   uuid.NewString(),
 			OrderID:   orderID,
 			Timestamp: time.Now(),
 			Type:      eventType,
@@ -0,0 +1,51 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// A struct payload is published as a JSON object and decodes back into the same struct on the
+// subscriber's side, which only sees it as a generic map.
+func TestPayloadRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		payload EventPayload
+		decoded interface{}
+	}{
+		{PaymentPayload{OrderID: "cho-1", CustomerID: "customer-1", Amount: 49.5}, &PaymentPayload{}},
+		{InventoryRequestPayload{OrderID: "cho-1", Items: []OrderItem{{ProductID: "mouse-wireless", Quantity: 2}}, Amount: 99}, &InventoryRequestPayload{}},
+		{OrderStatusUpdatePayload{OrderID: "cho-1", Status: "rejected", ReasonCode: ReasonInsufficientQty,
+			Shortages: []StockShortage{{ProductID: "mouse-wireless", Requested: 5, Available: 2}}}, &OrderStatusUpdatePayload{}},
+	} {
+		sent := NewGenericEvent(PaymentProcessedEvent, "cho-1", "test", tc.payload)
+		body, err := json.Marshal(sent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var envelope struct {
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil || len(envelope.Payload) == 0 || envelope.Payload[0] != '{' {
+			t.Fatalf("%T published as %s, want a JSON object payload (%v)", tc.payload, body, err)
+		}
+
+		var received GenericEvent
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Fatal(err)
+		}
+		if received.EventID != sent.EventID || received.OrderID != sent.OrderID || received.Type != sent.Type {
+			t.Errorf("envelope %+v, want %+v", received.BaseEvent, sent.BaseEvent)
+		}
+		raw, err := json.Marshal(received.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(raw, tc.decoded); err != nil {
+			t.Fatalf("%T payload does not decode: %v", tc.payload, err)
+		}
+		if got := reflect.ValueOf(tc.decoded).Elem().Interface(); !reflect.DeepEqual(got, tc.payload) {
+			t.Errorf("payload decoded as %+v, want %+v", got, tc.payload)
+		}
+	}
+}
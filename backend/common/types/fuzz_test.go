@@ -0,0 +1,37 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Whatever a consumer receives, decoding the envelope and then its payload into any payload type
+// fails cleanly or succeeds, and a decoded event encodes again.
+func FuzzGenericEvent(f *testing.F) {
+	for _, seed := range []string{
+		`{"event_id":"e1","order_id":"cho-1","type":"OrderCreated","payload":{"order_id":"cho-1","items":[{"product_id":"a","quantity":1}]}}`,
+		`{"payload":null}`, `{"payload":[]}`, `{"payload":"x"}`, `{"timestamp":"yesterday"}`, `null`, `{"payload":{"items":[null]}}`,
+		`{"payload":{"amount":1e400}}`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var e GenericEvent
+		if json.Unmarshal(body, &e) != nil {
+			return
+		}
+		if _, err := json.Marshal(e); err != nil {
+			t.Fatalf("%q decoded but does not encode again: %v", body, err)
+		}
+		raw, err := json.Marshal(e.Payload)
+		if err != nil {
+			t.Fatalf("payload of %q does not encode again: %v", body, err)
+		}
+		for _, payload := range []interface{}{
+			&OrderCreatedPayload{}, &InventoryRequestPayload{}, &PaymentPayload{}, &OrderStatusUpdatePayload{},
+			&SagaCompletedPayload{}, &PaymentRevertAuditPayload{},
+		} {
+			_ = json.Unmarshal(raw, payload)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package events
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var snakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// Every payload the gateway and the services exchange spells its fields in snake_case, so a
+// request accepted by one flow decodes the same way in the other.
+func TestJSONFieldsSnakeCase(t *testing.T) {
+	for _, v := range []interface{}{
+		Order{}, OrderItem{}, Product{}, AuthRequest{}, AuthResponse{}, ErrorResponse{}, StockShortage{},
+		OrderCreatedPayload{}, InventoryRequestPayload{}, ShippingQuoteRequest{}, ShippingQuote{},
+		PricesRequest{}, PricesResponse{}, PaymentPayload{}, OrderStatusUpdatePayload{},
+		SagaCompletedPayload{}, OrderOutcomePayload{}, PaymentRevertAuditPayload{}, LowStockPayload{},
+		RefundRequest{}, PaymentRefundPayload{}, GenericEvent{},
+	} {
+		typ := reflect.TypeOf(v)
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || (name == "" && field.Anonymous) || !field.IsExported() {
+				continue
+			}
+			if !snakeCase.MatchString(name) {
+				t.Errorf("%s.%s is named %q in JSON, want snake_case", typ.Name(), field.Name, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package events
+
+import "time"
+
+// Transaction is the local record a payment service keeps of the payment of an order.
+type Transaction struct {
+	OrderID    string     `json:"order_id"`
+	CustomerID string     `json:"customer_id,omitempty"`
+	Amount     float64    `json:"amount"`
+	Refunded   float64    `json:"refunded,omitempty"`
+	Status     string     `json:"status"` // "pending", "processed", "failed" or "reverted"
+	Attempts   int        `json:"attempts"`
+	ReasonCode string     `json:"reason_code,omitempty"` // of the last failure
+	Reason     string     `json:"reason,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	RevertedAt *time.Time `json:"reverted_at,omitempty"`
+}
@@ -0,0 +1,113 @@
+package warehouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/StitchMl/saga-demo/common/responses"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// DefaultWarehouse receives the stock of a product when a request names no warehouse.
+const DefaultWarehouse = "wh-north"
+
+// ProductRequest is the body of POST /admin/products, creating or updating a product.
+// Available is the stock of WarehouseID (DefaultWarehouse when empty); other warehouses are kept.
+type ProductRequest struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Available   int     `json:"available"`
+	ImageURL    string  `json:"image_url"`
+	WarehouseID string  `json:"warehouse_id"`
+}
+
+// DecodeProductRequest reads and validates a ProductRequest, writing a 400 when it is invalid.
+func DecodeProductRequest(w http.ResponseWriter, r *http.Request) (ProductRequest, bool) {
+	var req ProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request body")
+		return req, false
+	}
+	if req.WarehouseID == "" {
+		req.WarehouseID = DefaultWarehouse
+	}
+	var problems []string
+	if req.ID == "" || strings.Contains(req.ID, "/") {
+		problems = append(problems, "id is required and cannot contain '/'")
+	}
+	if req.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	if req.Price <= 0 {
+		problems = append(problems, "price must be positive")
+	}
+	if req.Available < 0 || req.Available > MaxStock {
+		problems = append(problems, fmt.Sprintf("available must be between 0 and %d", MaxStock))
+	}
+	if len(problems) > 0 {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, strings.Join(problems, "; "))
+		return req, false
+	}
+	return req, true
+}
+
+// Upsert applies a ProductRequest to the product it names, creating the product if needed.
+// It reports whether the product was created.
+func Upsert(products map[string]events.Product, req ProductRequest) (events.Product, bool) {
+	product, exists := products[req.ID]
+	product.ID = req.ID
+	product.Name = req.Name
+	product.Description = req.Description
+	product.Price = req.Price
+	product.ImageURL = req.ImageURL
+	product = SetStock(product, req.WarehouseID, req.Available)
+	products[req.ID] = product
+	return product, !exists
+}
+
+// AdjustRequest is the body of POST /admin/products/{id}/adjust_stock: a signed change of the
+// stock of a warehouse (the first one of the product, by id, when empty).
+type AdjustRequest struct {
+	Delta       int    `json:"delta"`
+	WarehouseID string `json:"warehouse_id"`
+}
+
+// DecodeAdjustRequest reads and validates an AdjustRequest, writing a 400 when it is invalid.
+func DecodeAdjustRequest(w http.ResponseWriter, r *http.Request) (AdjustRequest, bool) {
+	var req AdjustRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Delta == 0 {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "delta is required and cannot be zero")
+		return req, false
+	}
+	return req, true
+}
+
+// Adjust changes the stock of a product by req.Delta, with the bounds of Take and Restore:
+// nothing changes when a warehouse would drop below zero or exceed MaxStock.
+func Adjust(products map[string]events.Product, productID string, req AdjustRequest) (events.Product, error) {
+	wh := req.WarehouseID
+	if wh == "" {
+		wh = DefaultWarehouse
+		if ids := warehouseIDs(products[productID]); len(ids) > 0 {
+			wh = ids[0]
+		}
+	}
+	var err error
+	if req.Delta < 0 {
+		err = Take(products, Allocation{productID: {wh: -req.Delta}})
+	} else {
+		err = Restore(products, Allocation{productID: {wh: req.Delta}})
+	}
+	return products[productID], err
+}
+
+// ProductPath splits /admin/products/{id}[/action] into the product id and the action.
+func ProductPath(path string) (id, action string) {
+	rest := strings.TrimPrefix(path, "/admin/products/")
+	id, action, _ = strings.Cut(rest, "/")
+	return id, action
+}
@@ -0,0 +1,226 @@
+package warehouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/responses"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Allocation strategies, selected through INVENTORY_ALLOCATION_STRATEGY.
+const (
+	// StrategySingleFirst ships from one warehouse when a single one holds every item, and splits otherwise.
+	StrategySingleFirst = "single_first"
+	// StrategySplit always takes each item from the warehouses in order, splitting freely.
+	StrategySplit = "split"
+)
+
+// Strategy is the allocation strategy in use.
+var Strategy = StrategySingleFirst
+
+// MaxStock is the most units a product may have in a warehouse (INVENTORY_MAX_STOCK, default 1000000).
+var MaxStock = 1000000
+
+func init() {
+	switch s := os.Getenv("INVENTORY_ALLOCATION_STRATEGY"); s {
+	case "":
+	case StrategySingleFirst, StrategySplit:
+		Strategy = s
+	default:
+		log.Fatalf("Invalid INVENTORY_ALLOCATION_STRATEGY %q: must be single_first or split", s)
+	}
+	if v := os.Getenv("INVENTORY_MAX_STOCK"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid INVENTORY_MAX_STOCK: %q", v)
+		}
+		MaxStock = n
+	}
+	config.Set("INVENTORY_ALLOCATION_STRATEGY", Strategy)
+	config.Set("INVENTORY_MAX_STOCK", MaxStock)
+}
+
+// Allocation is the stock taken for a reservation: quantity by warehouse, by product.
+type Allocation map[string]map[string]int
+
+// Allocate picks the warehouses the items are taken from, following Strategy. ok is false when
+// the overall stock is not enough; callers check the shortages item by item before.
+func Allocate(products map[string]events.Product, items []events.OrderItem) (alloc Allocation, ok bool) {
+	wanted := make(map[string]int, len(items))
+	for _, item := range items {
+		wanted[item.ProductID] += item.Quantity
+	}
+
+	if Strategy == StrategySingleFirst {
+		if wh, found := singleWarehouse(products, wanted); found {
+			alloc = make(Allocation, len(wanted))
+			for id, qty := range wanted {
+				alloc[id] = map[string]int{wh: qty}
+			}
+			return alloc, true
+		}
+	}
+
+	alloc = make(Allocation, len(wanted))
+	for id, qty := range wanted {
+		product := products[id]
+		taken := make(map[string]int)
+		for _, wh := range warehouseIDs(product) {
+			if qty == 0 {
+				break
+			}
+			n := min(qty, product.Warehouses[wh])
+			if n > 0 {
+				taken[wh] = n
+				qty -= n
+			}
+		}
+		if qty > 0 {
+			return nil, false
+		}
+		alloc[id] = taken
+	}
+	return alloc, true
+}
+
+// singleWarehouse returns the first warehouse, by id, holding every wanted quantity.
+func singleWarehouse(products map[string]events.Product, wanted map[string]int) (string, bool) {
+	candidates := make(map[string]bool)
+	for id := range wanted {
+		for wh := range products[id].Warehouses {
+			candidates[wh] = true
+		}
+	}
+	ids := make([]string, 0, len(candidates))
+	for wh := range candidates {
+		ids = append(ids, wh)
+	}
+	sort.Strings(ids)
+	for _, wh := range ids {
+		enough := true
+		for id, qty := range wanted {
+			if products[id].Warehouses[wh] < qty {
+				enough = false
+				break
+			}
+		}
+		if enough {
+			return wh, true
+		}
+	}
+	return "", false
+}
+
+// Take removes an allocation from the stock of the products.
+func Take(products map[string]events.Product, alloc Allocation) error {
+	return apply(products, alloc, -1)
+}
+
+// Restore gives an allocation back to the warehouses it was taken from.
+func Restore(products map[string]events.Product, alloc Allocation) error {
+	return apply(products, alloc, 1)
+}
+
+// apply changes the stock by the allocation, or returns an error without changing anything
+// when a quantity is not positive or a warehouse would go below zero or above MaxStock.
+func apply(products map[string]events.Product, alloc Allocation, sign int) error {
+	for id, byWarehouse := range alloc {
+		product, ok := products[id]
+		if !ok {
+			continue
+		}
+		for wh, qty := range byWarehouse {
+			if qty <= 0 {
+				return fmt.Errorf("invalid quantity %d of %s in %s", qty, id, wh)
+			}
+			if n := product.Warehouses[wh] + sign*qty; n < 0 || n > MaxStock {
+				return fmt.Errorf("stock of %s in %s would be %d, outside 0..%d", id, wh, n, MaxStock)
+			}
+		}
+	}
+	for id, byWarehouse := range alloc {
+		product, ok := products[id]
+		if !ok {
+			continue
+		}
+		stock := make(map[string]int, len(product.Warehouses))
+		for wh, n := range product.Warehouses {
+			stock[wh] = n
+		}
+		for wh, qty := range byWarehouse {
+			stock[wh] += sign * qty
+		}
+		product.Warehouses = stock
+		product.Available = total(stock)
+		products[id] = product
+	}
+	return nil
+}
+
+// SetStock sets the stock of a product in a warehouse, creating the warehouse if needed.
+func SetStock(product events.Product, warehouseID string, available int) events.Product {
+	stock := make(map[string]int, len(product.Warehouses)+1)
+	for wh, n := range product.Warehouses {
+		stock[wh] = n
+	}
+	stock[warehouseID] = available
+	product.Warehouses = stock
+	product.Available = total(stock)
+	return product
+}
+
+// Catalog returns the products for /catalog, keeping the per-warehouse stock only
+// when withWarehouses is set (?warehouses=true).
+func Catalog(products map[string]events.Product, withWarehouses bool) []events.Product {
+	list := make([]events.Product, 0, len(products))
+	for _, p := range products {
+		if !withWarehouses {
+			p.Warehouses = nil
+		}
+		list = append(list, p)
+	}
+	return list
+}
+
+// StockRequest is the body of the admin endpoint adjusting the stock of a warehouse.
+type StockRequest struct {
+	ProductID   string `json:"product_id"`
+	WarehouseID string `json:"warehouse_id"`
+	Available   int    `json:"available"`
+}
+
+// DecodeStockRequest reads and validates a StockRequest, writing a 400 when it is invalid.
+func DecodeStockRequest(w http.ResponseWriter, r *http.Request) (StockRequest, bool) {
+	var req StockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductID == "" || req.WarehouseID == "" ||
+		req.Available < 0 || req.Available > MaxStock {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest,
+			fmt.Sprintf("product_id and warehouse_id are required and available must be between 0 and %d", MaxStock))
+		return req, false
+	}
+	return req, true
+}
+
+func warehouseIDs(product events.Product) []string {
+	ids := make([]string, 0, len(product.Warehouses))
+	for wh := range product.Warehouses {
+		ids = append(ids, wh)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func total(stock map[string]int) int {
+	n := 0
+	for _, qty := range stock {
+		n += qty
+	}
+	return n
+}
@@ -0,0 +1,135 @@
+package warehouse
+
+import (
+	"maps"
+	"reflect"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func testProducts() map[string]events.Product {
+	return map[string]events.Product{
+		"mouse":  {ID: "mouse", Available: 50, Warehouses: map[string]int{"wh-north": 20, "wh-south": 30}},
+		"laptop": {ID: "laptop", Available: 5, Warehouses: map[string]int{"wh-north": 5}},
+	}
+}
+
+func withStrategy(t *testing.T, s string) {
+	t.Helper()
+	prev := Strategy
+	Strategy = s
+	t.Cleanup(func() { Strategy = prev })
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		items    []events.OrderItem
+		want     Allocation
+		ok       bool
+	}{
+		{name: "one warehouse holds everything", strategy: StrategySingleFirst,
+			items: []events.OrderItem{{ProductID: "mouse", Quantity: 25}},
+			want:  Allocation{"mouse": {"wh-south": 25}}, ok: true},
+		{name: "repeated lines add up", strategy: StrategySingleFirst,
+			items: []events.OrderItem{{ProductID: "mouse", Quantity: 10}, {ProductID: "mouse", Quantity: 15}},
+			want:  Allocation{"mouse": {"wh-south": 25}}, ok: true},
+		{name: "the first warehouse holding every item", strategy: StrategySingleFirst,
+			items: []events.OrderItem{{ProductID: "mouse", Quantity: 5}, {ProductID: "laptop", Quantity: 1}},
+			want:  Allocation{"mouse": {"wh-north": 5}, "laptop": {"wh-north": 1}}, ok: true},
+		{name: "split when no warehouse is enough", strategy: StrategySingleFirst,
+			items: []events.OrderItem{{ProductID: "mouse", Quantity: 35}},
+			want:  Allocation{"mouse": {"wh-north": 20, "wh-south": 15}}, ok: true},
+		{name: "split strategy drains warehouses in order", strategy: StrategySplit,
+			items: []events.OrderItem{{ProductID: "mouse", Quantity: 25}},
+			want:  Allocation{"mouse": {"wh-north": 20, "wh-south": 5}}, ok: true},
+		{name: "not enough overall", strategy: StrategySingleFirst,
+			items: []events.OrderItem{{ProductID: "mouse", Quantity: 51}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			withStrategy(t, tc.strategy)
+			got, ok := Allocate(testProducts(), tc.items)
+			if ok != tc.ok || (tc.ok && !reflect.DeepEqual(got, tc.want)) {
+				t.Errorf("Allocate = %v, %t; want %v, %t", got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+// Restoring an allocation gives every unit back to the warehouse it came from.
+func TestTakeRestore(t *testing.T) {
+	products := testProducts()
+	alloc := Allocation{"mouse": {"wh-north": 20, "wh-south": 15}}
+	if err := Take(products, alloc); err != nil {
+		t.Fatal(err)
+	}
+	if got := products["mouse"]; got.Available != 15 || got.Warehouses["wh-north"] != 0 || got.Warehouses["wh-south"] != 15 {
+		t.Fatalf("after Take: %+v", got)
+	}
+	if err := Restore(products, alloc); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := products["mouse"], testProducts()["mouse"]; got.Available != want.Available || !maps.Equal(got.Warehouses, want.Warehouses) {
+		t.Errorf("after Restore: %+v, want %+v", got, want)
+	}
+}
+
+// An allocation that would take a warehouse below zero changes nothing.
+func TestTakeRejectedAtomically(t *testing.T) {
+	products := testProducts()
+	err := Take(products, Allocation{"laptop": {"wh-north": 1}, "mouse": {"wh-north": 21}})
+	if err == nil {
+		t.Fatal("took more than the warehouse holds")
+	}
+	if !reflect.DeepEqual(products, testProducts()) {
+		t.Errorf("stock changed by a rejected allocation: %+v", products)
+	}
+}
+
+func TestCatalogWarehouses(t *testing.T) {
+	for _, with := range []bool{false, true} {
+		for _, p := range Catalog(testProducts(), with) {
+			if (p.Warehouses != nil) != with {
+				t.Errorf("warehouses=%t: %s lists %v", with, p.ID, p.Warehouses)
+			}
+		}
+	}
+	if p := SetStock(testProducts()["laptop"], "wh-east", 7); p.Available != 12 || p.Warehouses["wh-east"] != 7 {
+		t.Errorf("SetStock = %+v", p)
+	}
+}
+
+// A quantity that is not positive, or a warehouse pushed past MaxStock, rejects the whole
+// change whichever way it goes.
+func TestStockBounds(t *testing.T) {
+	prev := MaxStock
+	MaxStock = 40
+	defer func() { MaxStock = prev }()
+
+	for _, tc := range []struct {
+		name  string
+		apply func(map[string]events.Product, Allocation) error
+		alloc Allocation
+	}{
+		{"negative take", Take, Allocation{"laptop": {"wh-north": 1}, "mouse": {"wh-north": -5}}},
+		{"zero take", Take, Allocation{"mouse": {"wh-south": 0}}},
+		{"negative restore", Restore, Allocation{"mouse": {"wh-north": -30}}},
+		{"restore above the ceiling", Restore, Allocation{"laptop": {"wh-north": 1}, "mouse": {"wh-south": 11}}},
+	} {
+		products := testProducts()
+		if err := tc.apply(products, tc.alloc); err == nil {
+			t.Errorf("%s: accepted", tc.name)
+		}
+		if !reflect.DeepEqual(products, testProducts()) {
+			t.Errorf("%s: stock changed to %+v", tc.name, products)
+		}
+	}
+
+	products := testProducts()
+	if err := Restore(products, Allocation{"mouse": {"wh-south": 10}}); err != nil || products["mouse"].Warehouses["wh-south"] != 40 {
+		t.Errorf("restoring up to the ceiling: %v, stock %+v", err, products["mouse"])
+	}
+}
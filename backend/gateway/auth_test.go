@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/sessions"
+)
+
+// withAuthService points both flows at an auth service issuing tokens with sessions and
+// accepting user1 as a legacy customer id.
+func withAuthService(t *testing.T) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/validate_token":
+			sessions.ValidateTokenHandler(w, r)
+		case validateURL:
+			var body struct {
+				CustomerID string `json:"customer_id"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			_ = json.NewEncoder(w).Encode(map[string]bool{"valid": body.CustomerID == "user1"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	prevCh, prevOr, prevLegacy := chAuth, orAuth, legacyCustomerAuth
+	chAuth, orAuth = srv.URL, srv.URL
+	t.Cleanup(func() { chAuth, orAuth, legacyCustomerAuth = prevCh, prevOr, prevLegacy })
+}
+
+// authCall runs a request through authenticate and returns the status and the customer the
+// handler behind it saw, if it ran.
+func authCall(target string, header map[string]string) (int, string) {
+	var seen string
+	handler := authenticate(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get("X-Customer-ID")
+	})
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec.Code, seen
+}
+
+func TestAuthenticateBearerToken(t *testing.T) {
+	withAuthService(t)
+	legacyCustomerAuth = false
+	token, _ := sessions.Issue("customer-7")
+	bearer := map[string]string{"Authorization": "Bearer " + token}
+
+	if code, seen := authCall("/orders", bearer); code != http.StatusOK || seen != "customer-7" {
+		t.Errorf("valid token answered %d as %q, want 200 as customer-7", code, seen)
+	}
+	if code, seen := authCall("/orders?flow=orchestrated", map[string]string{"Authorization": "Bearer " + token, "X-Customer-ID": "user1"}); code != http.StatusOK || seen != "customer-7" {
+		t.Errorf("token with a forged X-Customer-ID answered %d as %q, want the customer of the token", code, seen)
+	}
+	if code, _ := authCall("/orders?customer_id=user1", bearer); code != http.StatusForbidden {
+		t.Errorf("token used for another customer answered %d, want 403", code)
+	}
+	if code, _ := authCall("/orders", map[string]string{"Authorization": "Bearer not-a-token"}); code != http.StatusUnauthorized {
+		t.Errorf("unknown token answered %d, want 401", code)
+	}
+
+	prevTTL := sessions.TTL
+	sessions.TTL = 10 * time.Millisecond
+	expired, _ := sessions.Issue("customer-7")
+	sessions.TTL = prevTTL
+	time.Sleep(20 * time.Millisecond)
+	if code, seen := authCall("/orders", map[string]string{"Authorization": "Bearer " + expired}); code != http.StatusUnauthorized || seen != "" {
+		t.Errorf("expired token answered %d as %q, want 401", code, seen)
+	}
+}
+
+// The bare X-Customer-ID is checked with /validate while the legacy path is on, and refused
+// without a token once it is off.
+func TestAuthenticateLegacyCustomerID(t *testing.T) {
+	withAuthService(t)
+
+	legacyCustomerAuth = true
+	if code, seen := authCall("/orders", map[string]string{"X-Customer-ID": "user1"}); code != http.StatusOK || seen != "user1" {
+		t.Errorf("legacy customer id answered %d as %q, want 200 as user1", code, seen)
+	}
+	if code, _ := authCall("/orders", map[string]string{"X-Customer-ID": "intruder"}); code != http.StatusUnauthorized {
+		t.Errorf("unknown legacy customer answered %d, want 401", code)
+	}
+	if code, _ := authCall("/orders", nil); code != http.StatusUnauthorized {
+		t.Errorf("request without credentials answered %d, want 401", code)
+	}
+
+	legacyCustomerAuth = false
+	if code, seen := authCall("/orders", map[string]string{"X-Customer-ID": "user1"}); code != http.StatusUnauthorized || seen != "" {
+		t.Errorf("legacy customer id with the legacy path off answered %d, want 401", code)
+	}
+}
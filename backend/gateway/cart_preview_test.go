@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// inventoryCatalog serves products on /catalog and counts the requests, or fails them all when
+// products is nil.
+func inventoryCatalog(t *testing.T, products []events.Product) (string, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if products == nil {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(products)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &hits
+}
+
+// withCatalogs points the two flows at their own inventory stub, with an empty price cache and
+// a payment limit of 500.
+func withCatalogs(t *testing.T, choreographed, orchestrated []events.Product) (chHits, orHits *atomic.Int32) {
+	t.Helper()
+	prevCh, prevOr, prevLimit := chInv, orInv, paymentAmountLimit
+	chInv, chHits = inventoryCatalog(t, choreographed)
+	orInv, orHits = inventoryCatalog(t, orchestrated)
+	paymentAmountLimit = 500
+	priceCache.Lock()
+	priceCache.Entries = make(map[string]cachedCatalog)
+	priceCache.Unlock()
+	t.Cleanup(func() { chInv, orInv, paymentAmountLimit = prevCh, prevOr, prevLimit })
+	return chHits, orHits
+}
+
+type cartPreview struct {
+	Flow       string                 `json:"flow"`
+	Lines      []cartLine             `json:"lines"`
+	Total      float64                `json:"total"`
+	Valid      bool                   `json:"valid"`
+	Violations []events.ErrorResponse `json:"violations"`
+}
+
+func previewCart(t *testing.T, flow, items string) (int, cartPreview) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	cartPreviewHandler(rec, httptest.NewRequest(http.MethodPost, "/cart/preview?flow="+flow, strings.NewReader(`{"items":[`+items+`]}`)))
+	var preview cartPreview
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&preview); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, preview
+}
+
+func TestCartPreview(t *testing.T) {
+	withCatalogs(t,
+		[]events.Product{{ID: "mouse-wireless", Name: "Mouse", Price: 49.5}},
+		[]events.Product{{ID: "mouse-wireless", Name: "Mouse", Price: 60}},
+	)
+
+	tests := []struct {
+		name       string
+		flow       string
+		items      string
+		total      float64
+		violations []string
+	}{
+		{name: "choreographed prices", flow: "choreographed", items: `{"product_id":"mouse-wireless","quantity":2}`, total: 99},
+		{name: "orchestrated prices", flow: "orchestrated", items: `{"product_id":"mouse-wireless","quantity":2}`, total: 120},
+		{name: "repeated lines merged", flow: "orchestrated", items: `{"product_id":"mouse-wireless","quantity":1},{"product_id":"mouse-wireless","quantity":1}`, total: 120},
+		{name: "unknown product", flow: "choreographed", items: `{"product_id":"mouse-wireless","quantity":1},{"product_id":"no-such-product","quantity":1}`,
+			total: 49.5, violations: []string{events.ReasonUnknownProduct}},
+		{name: "over the payment limit", flow: "orchestrated", items: `{"product_id":"mouse-wireless","quantity":9}`,
+			total: 540, violations: []string{events.ReasonLimitExceeded}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			code, preview := previewCart(t, tc.flow, tc.items)
+			if code != http.StatusOK {
+				t.Fatalf("answered %d", code)
+			}
+			if preview.Flow != tc.flow || preview.Total != tc.total {
+				t.Errorf("%s total %.2f, want %s total %.2f", preview.Flow, preview.Total, tc.flow, tc.total)
+			}
+			var reasons []string
+			for _, v := range preview.Violations {
+				reasons = append(reasons, v.ReasonCode)
+			}
+			if preview.Valid != (len(tc.violations) == 0) || strings.Join(reasons, ",") != strings.Join(tc.violations, ",") {
+				t.Errorf("valid %t, violations %v, want %v", preview.Valid, reasons, tc.violations)
+			}
+			if len(preview.Lines) == 0 || preview.Lines[0].LineTotal != preview.Lines[0].UnitPrice*float64(preview.Lines[0].Quantity) {
+				t.Errorf("lines = %+v", preview.Lines)
+			}
+		})
+	}
+}
+
+// Previews reuse the prices of their flow for a while; an inventory service that cannot be
+// reached fails the preview of its flow only.
+func TestCartPreviewCatalogs(t *testing.T) {
+	chHits, orHits := withCatalogs(t, []events.Product{{ID: "mouse-wireless", Price: 49.5}}, nil)
+
+	for i := 0; i < 2; i++ {
+		if code, _ := previewCart(t, "choreographed", `{"product_id":"mouse-wireless","quantity":1}`); code != http.StatusOK {
+			t.Fatalf("answered %d", code)
+		}
+	}
+	if n := chHits.Load(); n != 1 {
+		t.Errorf("choreographed catalog fetched %d times, want once", n)
+	}
+	if code, _ := previewCart(t, "orchestrated", `{"product_id":"mouse-wireless","quantity":1}`); code != http.StatusBadGateway {
+		t.Errorf("orchestrated preview answered %d with its inventory down, want 502", code)
+	}
+	if n := orHits.Load(); n != 1 {
+		t.Errorf("orchestrated catalog fetched %d times, want once", n)
+	}
+}
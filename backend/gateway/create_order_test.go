@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Repeated product ids are merged before the caps are checked, so splitting a quantity over
+// several lines neither passes the cap nor reaches the order service.
+func TestCreateOrderItemCaps(t *testing.T) {
+	var forwarded []events.Order
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var order events.Order
+		_ = json.NewDecoder(r.Body).Decode(&order)
+		forwarded = append(forwarded, order)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer upstream.Close()
+	prev := chOrder
+	chOrder = upstream.URL
+	defer func() { chOrder = prev }()
+
+	tests := []struct {
+		name   string
+		items  string
+		code   int
+		reason string
+		want   []events.OrderItem
+	}{
+		{name: "duplicates merged", items: `{"product_id":"a","quantity":2},{"product_id":"b","quantity":1},{"product_id":"a","quantity":3}`,
+			code: http.StatusAccepted, want: []events.OrderItem{{ProductID: "a", Quantity: 5}, {ProductID: "b", Quantity: 1}}},
+		{name: "merged up to the cap", items: `{"product_id":"a","quantity":60},{"product_id":"a","quantity":40}`,
+			code: http.StatusAccepted, want: []events.OrderItem{{ProductID: "a", Quantity: 100}}},
+		{name: "merged over the cap", items: `{"product_id":"a","quantity":60},{"product_id":"a","quantity":41}`,
+			code: http.StatusUnprocessableEntity, reason: events.ReasonQuantityExceeded},
+		{name: "zero quantity", items: `{"product_id":"a","quantity":0}`,
+			code: http.StatusUnprocessableEntity, reason: events.ReasonInvalidQuantity},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			forwarded = nil
+			req := httptest.NewRequest(http.MethodPost, "/create_order", strings.NewReader(`{"items":[`+tc.items+`]}`))
+			req.Header.Set("X-Customer-ID", "user1")
+			rec := httptest.NewRecorder()
+			createOrderHandler(rec, req)
+			if rec.Code != tc.code {
+				t.Fatalf("answered %d, want %d: %s", rec.Code, tc.code, rec.Body)
+			}
+			if tc.reason != "" {
+				var resp events.ErrorResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.ReasonCode != tc.reason {
+					t.Errorf("error = %+v (%v), want %s", resp, err, tc.reason)
+				}
+				if len(forwarded) != 0 {
+					t.Error("rejected order forwarded to the order service")
+				}
+				return
+			}
+			if len(forwarded) != 1 {
+				t.Fatalf("forwarded %d orders, want 1", len(forwarded))
+			}
+			got := forwarded[0]
+			if got.CustomerID != "user1" || len(got.Items) != len(tc.want) {
+				t.Fatalf("forwarded %+v, want items %v", got, tc.want)
+			}
+			for i := range tc.want {
+				if got.Items[i] != tc.want[i] {
+					t.Errorf("item %d = %+v, want %+v", i, got.Items[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
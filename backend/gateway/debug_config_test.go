@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/config"
+)
+
+// /debug/config lists the resolved upstream URLs and limits of the gateway, and never the admin token.
+func TestDebugConfig(t *testing.T) {
+	urls := map[string]string{
+		"CHOREOGRAPHER_INVENTORY_BASE_URL": "http://ch-inventory:8081", "ORCHESTRATOR_INVENTORY_BASE_URL": "http://or-inventory:8081",
+		"CHOREOGRAPHER_AUTH_BASE_URL": "http://ch-auth:8083", "ORCHESTRATOR_AUTH_BASE_URL": "http://or-auth:8083",
+		"CHOREOGRAPHER_ORDER_BASE_URL": "http://ch-order:8080", "ORCHESTRATOR_ORDER_BASE_URL": "http://or-order:8080",
+		"ORCHESTRATOR_SERVICE_URL": "http://orchestrator:8080",
+	}
+	for k, v := range urls {
+		t.Setenv(k, v)
+	}
+	defer func(ci, oi, ca, oa, co, oo, o string) {
+		chInv, orInv, chAuth, orAuth, chOrder, orOrder, orchestrator = ci, oi, ca, oa, co, oo, o
+	}(chInv, orInv, chAuth, orAuth, chOrder, orOrder, orchestrator)
+	loadServiceURLs()
+	registerConfig("8000")
+	defer adminauth.SetTokens("")
+	adminauth.SetTokens("admin-secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/config", nil)
+	req.Header.Set(adminauth.Header, "admin-secret")
+	rec := httptest.NewRecorder()
+	adminauth.Require(config.Handler)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "admin-secret") {
+		t.Fatalf("admin token in the output: %s", rec.Body)
+	}
+	var body struct {
+		Config map[string]string `json:"config"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range urls {
+		if body.Config[k] != v {
+			t.Errorf("%s = %q, want %q", k, body.Config[k], v)
+		}
+	}
+	for _, k := range []string{"GATEWAY_PORT", "PAYMENT_AMOUNT_LIMIT", "RATE_LIMIT_RPS", "IMAGE_PROXY_MAX_BYTES"} {
+		if _, ok := body.Config[k]; !ok {
+			t.Errorf("%s missing", k)
+		}
+	}
+	if body.Config["ADMIN_TOKEN"] != "***" {
+		t.Errorf("ADMIN_TOKEN = %q, want it redacted", body.Config["ADMIN_TOKEN"])
+	}
+
+	rec = httptest.NewRecorder()
+	adminauth.Require(config.Handler)(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("answered %d without the admin token, want 401", rec.Code)
+	}
+}
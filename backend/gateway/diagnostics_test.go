@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The order proxy cannot be steered to the diagnostic endpoints of the order services.
+func TestOrderProxyDoesNotReachDiagnostics(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.EscapedPath())
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+	prev := chOrder
+	chOrder = upstream.URL
+	defer func() { chOrder = prev }()
+
+	for _, path := range []string{"/orders/..%2Fdebug%2Fvars", "/orders/%2E%2E%2Fdebug%2Fpprof%2F", "/orders/x/../../debug/vars"} {
+		rec := httptest.NewRecorder()
+		orderStatusProxy(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s answered %d, want 400", path, rec.Code)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, p := range paths {
+		if strings.Contains(p, "debug") {
+			t.Errorf("upstream asked for %s", p)
+		}
+	}
+}
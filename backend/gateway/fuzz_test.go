@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/order_policy"
+)
+
+// Any body either is refused with a reason or yields an order with items that all name a product.
+func FuzzDecodeOrderBody(f *testing.F) {
+	for _, seed := range []string{
+		`{"items":[{"product_id":"mouse-wireless","quantity":1}]}`,
+		`null`, `[]`, `""`, `{}`, `{"items":null}`, `{"items":[null]}`, `{"items":[{"quantity":-1}]}`,
+		`{"items":[{"product_id":"a","quantity":1e99}]}`, `{"items":"x"}`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		data, order, problem := decodeOrderBody(body)
+		if problem != "" {
+			return
+		}
+		if data == nil || len(order.Items) == 0 {
+			t.Fatalf("%q accepted as %v, %+v", body, data, order)
+		}
+		for _, item := range order.Items {
+			if item.ProductID == "" {
+				t.Fatalf("%q accepted with an item without product", body)
+			}
+		}
+		order_policy.ValidateItems(order_policy.DedupeItems(order.Items))
+	})
+}
+
+// Any path under /orders/ is refused, or reaches the order service as a single /orders/{id}.
+func FuzzOrderStatusPath(f *testing.F) {
+	for _, seed := range []string{"order-1", "", "/", "a/b", "..", "%2e%2e", "x/full", "/full", "a b", "?wait=1"} {
+		f.Add(seed)
+	}
+	upstreamPath := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath <- r.URL.Path
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+	prev := chOrder
+	chOrder = upstream.URL
+	defer func() { chOrder = prev }()
+
+	f.Fuzz(func(t *testing.T, id string) {
+		if strings.HasSuffix(id, "/full") {
+			return // the aggregated view calls several services
+		}
+		req := httptest.NewRequest(http.MethodGet, "/orders/x", nil)
+		req.URL.Path = "/orders/" + id
+		rec := httptest.NewRecorder()
+		orderStatusProxy(rec, req)
+		select {
+		case got := <-upstreamPath:
+			if got != "/orders/"+id || id == "" || strings.Contains(id, "/") {
+				t.Fatalf("id %q reached the order service as %q", id, got)
+			}
+		default:
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("id %q answered %d without calling the order service", id, rec.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/buildinfo"
+)
+
+// /health/full shows the build each component reports on /version, and marks down the ones
+// that cannot be reached or answer something else.
+func TestFullHealthCollectsVersions(t *testing.T) {
+	up := httptest.NewServer(buildinfo.Handler("stub"))
+	defer up.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	prev := []string{chOrder, chInv, chAuth, orchestrator, orOrder, orInv, orAuth}
+	defer func() {
+		chOrder, chInv, chAuth, orchestrator, orOrder, orInv, orAuth = prev[0], prev[1], prev[2], prev[3], prev[4], prev[5], prev[6]
+	}()
+	chOrder, chInv, chAuth, orchestrator, orOrder = up.URL, up.URL, up.URL, up.URL, up.URL
+	orInv, orAuth = broken.URL, closed.URL
+
+	rec := httptest.NewRecorder()
+	fullHealthHandler(rec, httptest.NewRequest(http.MethodGet, "/health/full", nil))
+	var health struct {
+		Gateway    buildinfo.Info             `json:"gateway"`
+		Components map[string]componentStatus `json:"components"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	if health.Gateway != buildinfo.Get("gateway") {
+		t.Errorf("gateway build = %+v", health.Gateway)
+	}
+	if len(health.Components) != 7 {
+		t.Fatalf("%d components, want 7", len(health.Components))
+	}
+	for name, status := range health.Components {
+		switch name {
+		case "orchestrator-inventory-service", "orchestrator-auth-service":
+			if status.Status != "down" || status.Build != nil || status.Error == "" {
+				t.Errorf("%s = %+v, want down with an error", name, status)
+			}
+		default:
+			if status.Status != "up" || status.Build == nil || *status.Build != buildinfo.Get("stub") {
+				t.Errorf("%s = %+v, want up with the stub build", name, status)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// imageFixture serves a PNG at /img/<name> and a catalog whose products point at it, and makes
+// it the inventory of both flows. Only 127.0.0.1 is an allowed image host.
+type imageFixture struct {
+	images       *httptest.Server
+	catalogCalls atomic.Int32
+}
+
+func newImageFixture(t *testing.T, productIDs ...string) *imageFixture {
+	t.Helper()
+	f := &imageFixture{}
+	f.images = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ctHdr, "image/png")
+		_, _ = w.Write([]byte("png:" + r.URL.Path))
+	}))
+	t.Cleanup(f.images.Close)
+	inventory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.catalogCalls.Add(1)
+		var products []events.Product
+		for _, id := range productIDs {
+			products = append(products, events.Product{ID: id, ImageURL: f.images.URL + "/img/" + id})
+		}
+		_ = json.NewEncoder(w).Encode(products)
+	}))
+	t.Cleanup(inventory.Close)
+
+	prevCh, prevOr, prevHosts, prevMax := chInv, orInv, imageAllowedHosts, imageCacheMax
+	chInv, orInv, imageAllowedHosts = inventory.URL, inventory.URL, []string{"127.0.0.1"}
+	imageCache.Lock()
+	imageCache.Data = make(map[string]cachedImage)
+	imageCache.Unlock()
+	t.Cleanup(func() { chInv, orInv, imageAllowedHosts, imageCacheMax = prevCh, prevOr, prevHosts, prevMax })
+	return f
+}
+
+func getImage(query string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	imageProxy(rec, httptest.NewRequest(http.MethodGet, "/catalog/image?"+query, nil))
+	return rec
+}
+
+func imageCacheLen() int {
+	imageCache.RLock()
+	defer imageCache.RUnlock()
+	return len(imageCache.Data)
+}
+
+// Unknown flows share the cache entry of the choreographed flow instead of adding their own.
+func TestImageProxyNormalisesFlow(t *testing.T) {
+	f := newImageFixture(t, "mouse")
+	for _, flow := range []string{"", "choreographed", "bogus-1", "bogus-2"} {
+		rec := getImage("product_id=mouse&flow=" + flow)
+		if rec.Code != http.StatusOK || rec.Body.String() != "png:/img/mouse" {
+			t.Fatalf("flow %q: %d %q", flow, rec.Code, rec.Body.String())
+		}
+	}
+	if n := f.catalogCalls.Load(); n != 1 {
+		t.Errorf("catalog fetched %d times, want 1", n)
+	}
+	if n := imageCacheLen(); n != 1 {
+		t.Errorf("cache holds %d entries, want 1", n)
+	}
+}
+
+func TestImageCacheCapped(t *testing.T) {
+	newImageFixture(t, "a", "b", "c")
+	imageCacheMax = 2
+	for _, id := range []string{"a", "b", "c"} {
+		if rec := getImage("product_id=" + id); rec.Code != http.StatusOK {
+			t.Fatalf("image %s: %d", id, rec.Code)
+		}
+	}
+	if n := imageCacheLen(); n != 2 {
+		t.Fatalf("cache holds %d entries, want 2", n)
+	}
+	imageCache.RLock()
+	_, first := imageCache.Data["choreographed|a"]
+	imageCache.RUnlock()
+	if first {
+		t.Error("the entry closest to expiry was kept instead of being evicted")
+	}
+}
+
+// Expired entries are evicted before live ones.
+func TestCacheImageDropsExpiredFirst(t *testing.T) {
+	newImageFixture(t)
+	imageCacheMax = 2
+	cacheImage("expired", cachedImage{expires: time.Now().Add(-time.Minute)})
+	cacheImage("live", cachedImage{expires: time.Now().Add(time.Minute)})
+	cacheImage("new", cachedImage{expires: time.Now().Add(2 * time.Minute)})
+	imageCache.RLock()
+	defer imageCache.RUnlock()
+	if _, ok := imageCache.Data["live"]; !ok {
+		t.Error("live entry evicted while an expired one was there")
+	}
+	if _, ok := imageCache.Data["expired"]; ok {
+		t.Error("expired entry kept")
+	}
+}
+
+func TestFetchImageRedirects(t *testing.T) {
+	newImageFixture(t)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ctHdr, "image/png")
+		_, _ = w.Write([]byte("redirected"))
+	}))
+	defer target.Close()
+	port := target.URL[strings.LastIndex(target.URL, ":")+1:]
+
+	tests := []struct {
+		name     string
+		location string
+		wantErr  bool
+	}{
+		{name: "to an allowed host", location: target.URL + "/img"},
+		{name: "to a disallowed host", location: "http://localhost:" + port + "/img", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			origin := httptest.NewServer(http.RedirectHandler(tc.location, http.StatusFound))
+			defer origin.Close()
+			img, _, err := fetchImage(origin.URL + "/img")
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("redirect followed, got %q", img.data)
+				}
+				return
+			}
+			if err != nil || string(img.data) != "redirected" {
+				t.Fatalf("fetchImage = %q, %v", img.data, err)
+			}
+		})
+	}
+}
+
+func TestFetchImageRedirectLoop(t *testing.T) {
+	newImageFixture(t)
+	var loop *httptest.Server
+	loop = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, loop.URL+"/again", http.StatusFound)
+	}))
+	defer loop.Close()
+	if _, _, err := fetchImage(loop.URL); err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("fetchImage = %v, want the redirect limit", err)
+	}
+}
@@ -2,15 +2,38 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/bodylimit"
+	"github.com/StitchMl/saga-demo/common/buildinfo"
+	"github.com/StitchMl/saga-demo/common/chaos"
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/correlation"
+	"github.com/StitchMl/saga-demo/common/diagnostics"
+	"github.com/StitchMl/saga-demo/common/graceful"
+	"github.com/StitchMl/saga-demo/common/maintenance"
+	"github.com/StitchMl/saga-demo/common/metrics"
+	"github.com/StitchMl/saga-demo/common/order_policy"
+	"github.com/StitchMl/saga-demo/common/responses"
+	"github.com/StitchMl/saga-demo/common/sessions"
+	"github.com/StitchMl/saga-demo/common/tlsconfig"
+	events "github.com/StitchMl/saga-demo/common/types"
 	"github.com/google/uuid"
 )
 
@@ -24,6 +47,53 @@ const (
 
 var gatewayNS = uuid.New()
 
+// envOr retrieves an environment variable, falling back to def when it is not set.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt retrieves an integer environment variable, falling back to def when it is not set.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Fatalf("invalid env %s: %q", key, v)
+	}
+	return n
+}
+
+// envFloat retrieves a non-negative decimal environment variable, falling back to def when it is not set.
+func envFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		log.Fatalf("invalid env %s: %q", key, v)
+	}
+	return f
+}
+
+// envBool retrieves a boolean environment variable, falling back to def when it is not set.
+func envBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("invalid env %s: %q", key, v)
+	}
+	return b
+}
+
 // mustGet retrieves an environment variable and panics if it is not set.
 func mustGet(key string) string {
 	v := os.Getenv(key)
@@ -33,7 +103,17 @@ func mustGet(key string) string {
 	return v
 }
 
+// Base URLs of the backend services, required, read by loadServiceURLs
 var (
+	chInv, orInv     string
+	chAuth, orAuth   string
+	chOrder, orOrder string
+	orchestrator     string
+)
+
+// loadServiceURLs reads the required service URLs, exiting when one is missing. It runs from
+// main rather than at package initialisation, so that tests can set the URLs themselves.
+func loadServiceURLs() {
 	chInv = mustGet("CHOREOGRAPHER_INVENTORY_BASE_URL")
 	orInv = mustGet("ORCHESTRATOR_INVENTORY_BASE_URL")
 
@@ -44,13 +124,78 @@ var (
 	orOrder = mustGet("ORCHESTRATOR_ORDER_BASE_URL")
 
 	orchestrator = mustGet("ORCHESTRATOR_SERVICE_URL")
+}
+
+var (
+	// Optional: used by the demo scenarios to arm payment failures and by /orders/{id}/full
+	orPayment = envOr("ORCHESTRATOR_PAYMENT_BASE_URL", "")
+	// Optional: only used by /orders/{id}/full
+	chPayment = envOr("CHOREOGRAPHER_PAYMENT_BASE_URL", "")
+
+	imageAllowedHosts = strings.Split(envOr("IMAGE_PROXY_ALLOWED_HOSTS", "m.media-amazon.com"), ",")
+	imageMaxBytes     = int64(envInt("IMAGE_PROXY_MAX_BYTES", 2<<20))
+	imageCacheTTL     = time.Duration(envInt("IMAGE_PROXY_CACHE_TTL_SECONDS", 600)) * time.Second
+	imageCacheMax     = envInt("IMAGE_PROXY_CACHE_MAX_ENTRIES", 256)
+
+	// serviceClient calls the backend services without a timeout of its own, like http.DefaultClient,
+	// with the TLS settings of common/tlsconfig.
+	serviceClient = tlsconfig.Client(0)
+
+	priceCacheTTL = time.Duration(envInt("CART_PRICE_CACHE_TTL_SECONDS", 30)) * time.Second
+	// paymentAmountLimit mirrors the payment services' limit so the preview can flag over-limit totals; 0 disables the check.
+	paymentAmountLimit = envFloat("PAYMENT_AMOUNT_LIMIT", 0)
+
+	// legacyCustomerAuth accepts a bare X-Customer-ID as the credential when no bearer token is sent.
+	legacyCustomerAuth = envBool("GATEWAY_LEGACY_CUSTOMER_AUTH", true)
+
+	// rateLimitRPS is the sustained request rate allowed per customer, or per client IP on the
+	// public routes; 0 disables rate limiting. rateLimitBurst is the size of each bucket.
+	rateLimitRPS   = envFloat("RATE_LIMIT_RPS", 0)
+	rateLimitBurst = envInt("RATE_LIMIT_BURST", 10)
 )
 
+// registerConfig records the effective gateway configuration for /debug/config.
+func registerConfig(port string) {
+	for name, raw := range map[string]string{
+		"CHOREOGRAPHER_INVENTORY_BASE_URL": chInv, "ORCHESTRATOR_INVENTORY_BASE_URL": orInv,
+		"CHOREOGRAPHER_AUTH_BASE_URL": chAuth, "ORCHESTRATOR_AUTH_BASE_URL": orAuth,
+		"CHOREOGRAPHER_ORDER_BASE_URL": chOrder, "ORCHESTRATOR_ORDER_BASE_URL": orOrder,
+		"ORCHESTRATOR_SERVICE_URL": orchestrator,
+	} {
+		tlsconfig.CheckURL(name, raw)
+	}
+	if orPayment != "" {
+		tlsconfig.CheckURL("ORCHESTRATOR_PAYMENT_BASE_URL", orPayment)
+	}
+	if chPayment != "" {
+		tlsconfig.CheckURL("CHOREOGRAPHER_PAYMENT_BASE_URL", chPayment)
+	}
+	config.Set("GATEWAY_PORT", port)
+	config.Set("CHOREOGRAPHER_INVENTORY_BASE_URL", chInv)
+	config.Set("ORCHESTRATOR_INVENTORY_BASE_URL", orInv)
+	config.Set("CHOREOGRAPHER_AUTH_BASE_URL", chAuth)
+	config.Set("ORCHESTRATOR_AUTH_BASE_URL", orAuth)
+	config.Set("CHOREOGRAPHER_ORDER_BASE_URL", chOrder)
+	config.Set("ORCHESTRATOR_ORDER_BASE_URL", orOrder)
+	config.Set("ORCHESTRATOR_SERVICE_URL", orchestrator)
+	config.Set("ORCHESTRATOR_PAYMENT_BASE_URL", orPayment)
+	config.Set("CHOREOGRAPHER_PAYMENT_BASE_URL", chPayment)
+	config.Set("IMAGE_PROXY_ALLOWED_HOSTS", strings.Join(imageAllowedHosts, ","))
+	config.Set("IMAGE_PROXY_MAX_BYTES", imageMaxBytes)
+	config.Set("IMAGE_PROXY_CACHE_TTL_SECONDS", imageCacheTTL)
+	config.Set("IMAGE_PROXY_CACHE_MAX_ENTRIES", imageCacheMax)
+	config.Set("CART_PRICE_CACHE_TTL_SECONDS", priceCacheTTL)
+	config.Set("PAYMENT_AMOUNT_LIMIT", paymentAmountLimit)
+	config.Set("GATEWAY_LEGACY_CUSTOMER_AUTH", legacyCustomerAuth)
+	config.Set("RATE_LIMIT_RPS", rateLimitRPS)
+	config.Set("RATE_LIMIT_BURST", rateLimitBurst)
+}
+
 // withCORS adds CORS headers to the response and handles preflight requests.
 func withCORS(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,X-Customer-ID,X-Auth-NS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Customer-ID,X-Auth-NS,Idempotency-Key,X-Correlation-ID")
 		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -60,6 +205,296 @@ func withCORS(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// accessRecord collects, while a request is served, the upstream hosts its handler called.
+type accessRecord struct {
+	mu        sync.Mutex
+	upstreams []string
+}
+
+type accessKey struct{}
+
+// setUpstream records the host of an upstream call made for r, for the access log and /metrics.
+func setUpstream(r *http.Request, target string) {
+	rec, _ := r.Context().Value(accessKey{}).(*accessRecord)
+	u, err := url.Parse(target)
+	if rec == nil || err != nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, h := range rec.upstreams {
+		if h == u.Host {
+			return
+		}
+	}
+	rec.upstreams = append(rec.upstreams, u.Host)
+}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// routeStats are the counters of one route in /metrics.
+type routeStats struct {
+	Requests int64
+	Errors   int64 // 5xx responses
+	ByStatus map[string]int64
+}
+
+// Request counters by route and by upstream host
+var gatewayMetrics = struct {
+	sync.Mutex
+	Total     int64
+	Routes    map[string]*routeStats
+	Upstreams map[string]int64
+}{Routes: make(map[string]*routeStats), Upstreams: make(map[string]int64)}
+
+// routeLatency is the histogram of the request durations, by route.
+var routeLatency = metrics.NewHistogram(metrics.LatencyBucketsMs...)
+
+// withAccessLog wraps the mux: every request is logged as one JSON line with its route (the
+// matched mux pattern), upstream hosts, status and duration, and counted in /metrics.
+func withAccessLog(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		rec := &accessRecord{}
+		sw := &statusRecorder{ResponseWriter: w}
+		mux.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), accessKey{}, rec)))
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		elapsed := time.Since(start)
+
+		rec.mu.Lock()
+		upstreams := append([]string(nil), rec.upstreams...)
+		rec.mu.Unlock()
+
+		gatewayMetrics.Lock()
+		gatewayMetrics.Total++
+		stats, ok := gatewayMetrics.Routes[route]
+		if !ok {
+			stats = &routeStats{ByStatus: make(map[string]int64)}
+			gatewayMetrics.Routes[route] = stats
+		}
+		stats.Requests++
+		stats.ByStatus[strconv.Itoa(sw.status)]++
+		if sw.status >= 500 {
+			stats.Errors++
+		}
+		for _, u := range upstreams {
+			gatewayMetrics.Upstreams[u]++
+		}
+		gatewayMetrics.Unlock()
+		routeLatency.Observe(route, float64(elapsed.Milliseconds()))
+
+		line, _ := json.Marshal(map[string]interface{}{
+			"method":         r.Method,
+			"path":           r.URL.Path,
+			"route":          route,
+			"upstream":       strings.Join(upstreams, ","),
+			"status":         sw.status,
+			"duration_ms":    float64(elapsed.Microseconds()) / 1000,
+			"correlation_id": w.Header().Get(correlation.Header),
+		})
+		log.Printf("[Gateway] access %s", line)
+	})
+}
+
+// metricsHandler serves GET /metrics with the request counters and latency histograms by route.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, methodNotAllowed, http.StatusMethodNotAllowed)
+		return
+	}
+	latency := routeLatency.Snapshot()
+	routes := make(map[string]interface{})
+	gatewayMetrics.Lock()
+	for name, s := range gatewayMetrics.Routes {
+		byStatus := make(map[string]int64, len(s.ByStatus))
+		for code, n := range s.ByStatus {
+			byStatus[code] = n
+		}
+		routes[name] = map[string]interface{}{
+			"requests":   s.Requests,
+			"errors":     s.Errors,
+			"by_status":  byStatus,
+			"latency_ms": latency[name],
+		}
+	}
+	upstreams := make(map[string]int64, len(gatewayMetrics.Upstreams))
+	for u, n := range gatewayMetrics.Upstreams {
+		upstreams[u] = n
+	}
+	total := gatewayMetrics.Total
+	gatewayMetrics.Unlock()
+
+	responses.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"total_requests": total,
+		"routes":         routes,
+		"upstreams":      upstreams,
+	})
+}
+
+// hopHeaders only apply to one connection and are not copied from an upstream response.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// copyResponse streams an upstream response to the client with its status and headers, except
+// the hop-by-hop ones and the CORS ones, which the gateway sets itself.
+func copyResponse(w http.ResponseWriter, resp *http.Response) {
+	skip := make(map[string]bool, len(hopHeaders))
+	for _, h := range hopHeaders {
+		skip[h] = true
+	}
+	for _, v := range resp.Header.Values("Connection") {
+		for _, h := range strings.Split(v, ",") {
+			skip[http.CanonicalHeaderKey(strings.TrimSpace(h))] = true
+		}
+	}
+	for key, values := range resp.Header {
+		if skip[key] || strings.HasPrefix(key, "Access-Control-") {
+			continue
+		}
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// bucket is the token bucket of one customer or client IP.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Token buckets by "customer:<id>" or "ip:<address>"
+var rateBuckets = struct {
+	sync.Mutex
+	Data map[string]*bucket
+}{Data: make(map[string]*bucket)}
+
+// takeToken takes a token from the bucket of key, refilled at rateLimitRPS up to rateLimitBurst.
+// When the bucket is empty it returns false and how long until the next token.
+func takeToken(key string, now time.Time) (bool, time.Duration) {
+	rateBuckets.Lock()
+	defer rateBuckets.Unlock()
+	b, ok := rateBuckets.Data[key]
+	if !ok {
+		b = &bucket{tokens: float64(rateLimitBurst), last: now}
+		rateBuckets.Data[key] = b
+	}
+	b.tokens = min(float64(rateLimitBurst), b.tokens+now.Sub(b.last).Seconds()*rateLimitRPS)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rateLimitRPS * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// startBucketJanitor drops, every minute, the buckets that have refilled completely: they are
+// equivalent to a new bucket, so the map only holds the recently active clients.
+func startBucketJanitor() {
+	full := time.Duration(float64(rateLimitBurst) / rateLimitRPS * float64(time.Second))
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			rateBuckets.Lock()
+			for key, b := range rateBuckets.Data {
+				if now.Sub(b.last) >= full {
+					delete(rateBuckets.Data, key)
+				}
+			}
+			rateBuckets.Unlock()
+		}
+	}()
+}
+
+// customerKey is the rate-limit key of an authenticated request.
+func customerKey(r *http.Request) string {
+	return "customer:" + customerIDFrom(r)
+}
+
+// ipKey is the rate-limit key of a public request: the remote IP.
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimit answers 429 with a Retry-After once the client identified by keyOf exceeds
+// RATE_LIMIT_RPS: ipKey on every route but the probes, customerKey behind authenticate.
+func rateLimit(keyOf func(*http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rateLimitRPS <= 0 {
+			next(w, r)
+			return
+		}
+		if ok, wait := takeToken(keyOf(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			responses.WriteError(w, http.StatusTooManyRequests, events.ReasonRateLimited, "rate limit exceeded")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// registerRoutes registers the gateway routes on mux. The /orders routes are limited by client
+// IP before authenticate, so that a flood never reaches the auth service, then by customer. The
+// health and metrics routes are not limited, so that probes keep working under load.
+func registerRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/orders", withCORS(rateLimit(ipKey, authenticate(rateLimit(customerKey, correlation.Middleware(ordersHandler)))))) // Use the new dispatcher
+	mux.HandleFunc("/orders/", withCORS(rateLimit(ipKey, authenticate(rateLimit(customerKey, orderStatusProxy)))))
+	mux.HandleFunc("/orders/all", withCORS(rateLimit(ipKey, authenticate(rateLimit(customerKey, allOrdersHandler)))))
+
+	mux.HandleFunc("/catalog", withCORS(rateLimit(ipKey, catalogProxy)))
+	mux.HandleFunc("/catalog/image", withCORS(rateLimit(ipKey, imageProxy)))
+	mux.HandleFunc("/cart/preview", withCORS(rateLimit(ipKey, cartPreviewHandler)))
+
+	mux.HandleFunc("/register", withCORS(rateLimit(ipKey, authProxy)))
+	mux.HandleFunc("/login", withCORS(rateLimit(ipKey, authProxy)))
+	mux.HandleFunc(validateURL, withCORS(rateLimit(ipKey, authProxy)))
+	mux.HandleFunc("/logout", withCORS(rateLimit(ipKey, authProxy)))
+
+	mux.HandleFunc("/debug/config", adminauth.Require(config.Handler))
+	mux.HandleFunc("/version", buildinfo.Handler("gateway"))
+	mux.HandleFunc("/maintenance", withCORS(maintenance.StatusHandler))
+	mux.HandleFunc("/admin/maintenance", adminauth.Require(maintenance.AdminHandler))
+	mux.HandleFunc("/admin/scenario", adminauth.Require(scenarioHandler))
+
+	mux.HandleFunc("/health/full", withCORS(fullHealthHandler))
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Gateway OK"))
+	})
+}
+
 // Helper: gets customer id from header or query
 func customerIDFrom(r *http.Request) string {
 	if v := r.Header.Get("X-Customer-ID"); v != "" {
@@ -69,11 +504,11 @@ func customerIDFrom(r *http.Request) string {
 }
 
 // Helper: chooses auth URL based on flow
-func authURLForFlow(flow string) string {
+func authURLForFlow(flow, path string) string {
 	if flow == "orchestrated" {
-		return orAuth + validateURL
+		return orAuth + path
 	}
-	return chAuth + validateURL
+	return chAuth + path
 }
 
 // Helper: returns ns from the header/query or gateway fallback
@@ -87,16 +522,26 @@ func nsFrom(r *http.Request) string {
 	return gatewayNS.String()
 }
 
-// authenticate checks for the X-Customer-ID header and validates it against the auth service.
+// authenticate accepts an "Authorization: Bearer <token>" issued by /login, checked with the auth
+// service of the flow, and passes its customer on as X-Customer-ID. Without a token, the bare
+// X-Customer-ID header is validated instead, as long as legacyCustomerAuth is on.
 func authenticate(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if token := sessions.BearerToken(r); token != "" {
+			authenticateToken(w, r, token, next)
+			return
+		}
+		if !legacyCustomerAuth {
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
 		cid := customerIDFrom(r)
 		if cid == "" {
 			http.Error(w, "missing X-Customer-ID", http.StatusUnauthorized)
 			return
 		}
 
-		authURL := authURLForFlow(r.URL.Query().Get("flow"))
+		authURL := authURLForFlow(r.URL.Query().Get("flow"), validateURL)
 		ns := nsFrom(r)
 
 		body, _ := json.Marshal(map[string]string{
@@ -104,7 +549,8 @@ func authenticate(next http.HandlerFunc) http.HandlerFunc {
 			"ns":          ns,
 		})
 
-		resp, err := http.Post(authURL, ctJSON, bytes.NewReader(body))
+		setUpstream(r, authURL)
+		resp, err := serviceClient.Post(authURL, ctJSON, bytes.NewReader(body))
 		if err != nil {
 			http.Error(w, "auth service unreachable", http.StatusBadGateway)
 			return
@@ -130,6 +576,63 @@ func authenticate(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// authenticateToken checks a bearer token with /validate_token and runs next as its customer.
+// A customer_id in the query must be the one of the token.
+func authenticateToken(w http.ResponseWriter, r *http.Request, token string, next http.HandlerFunc) {
+	req, _ := http.NewRequest(http.MethodPost, authURLForFlow(r.URL.Query().Get("flow"), "/validate_token"), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	setUpstream(r, req.URL.String())
+	resp, err := serviceClient.Do(req)
+	if err != nil {
+		http.Error(w, "auth service unreachable", http.StatusBadGateway)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var session sessions.Session
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&session) != nil || session.CustomerID == "" {
+		http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+	if cid := r.URL.Query().Get("customer_id"); cid != "" && cid != session.CustomerID {
+		http.Error(w, "customer_id does not match the token", http.StatusForbidden)
+		return
+	}
+	r.Header.Set("X-Customer-ID", session.CustomerID)
+	next(w, r)
+}
+
+// decodeOrderBody reads an order request both as a map, forwarded with its unknown fields, and as
+// an events.Order for the checks. problem names what is wrong with the body, if anything.
+func decodeOrderBody(body []byte) (map[string]interface{}, events.Order, string) {
+	var orderData map[string]interface{}
+	var order events.Order
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, order, "request body is empty"
+	}
+	if err := json.Unmarshal(body, &orderData); err != nil || orderData == nil {
+		return nil, order, "request body must be a JSON object"
+	}
+	if err := json.Unmarshal(body, &order); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return nil, order, fmt.Sprintf("field %s must be %s, not %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return nil, order, "invalid request body: " + err.Error()
+	}
+	if len(order.Items) == 0 {
+		return nil, order, "field items is required"
+	}
+	for _, item := range order.Items {
+		if item.ProductID == "" {
+			return nil, order, "field items.product_id is required"
+		}
+	}
+	return orderData, order, ""
+}
+
 // createOrderHandler handles order creation requests and proxies them to the appropriate service.
 func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -143,20 +646,46 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 		baseURL = orchestrator
 	}
 
-	client := &http.Client{Timeout: 15 * time.Second}
+	client := tlsconfig.Client(15 * time.Second)
 	url := baseURL + "/create_order"
 	// The customer ID is in the header, not the body.
-	bodyBytes, _ := io.ReadAll(r.Body)
+	bodyBytes, err := io.ReadAll(r.Body)
 	_ = r.Body.Close() // Close the original body
+	if bodylimit.TooLarge(err) {
+		bodylimit.WriteTooLarge(w)
+		return
+	}
 
-	var orderData map[string]interface{}
-	_ = json.Unmarshal(bodyBytes, &orderData)
+	orderData, order, problem := decodeOrderBody(bodyBytes)
+	if problem != "" {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, problem)
+		return
+	}
+
+	// Repeated product ids are merged before the limits are checked.
+	order.Items = order_policy.DedupeItems(order.Items)
+	if v := order_policy.ValidateItems(order.Items); v != nil {
+		order_policy.WriteViolation(w, v)
+		return
+	}
+	orderData["items"] = order.Items
 	orderData["customer_id"] = r.Header.Get("X-Customer-ID")
 	newBody, _ := json.Marshal(orderData)
 
+	reqID := r.Header.Get(adminauth.RequestIDHeader)
+	if reqID == "" {
+		reqID = uuid.NewString()
+	}
 	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(newBody))
 	req.Header.Set(ctHdr, ctJSON)
+	req.Header.Set(adminauth.RequestIDHeader, reqID)
+	correlation.Inject(r.Context(), req)
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
 
+	correlation.Printf(r.Context(), "[Gateway] Forwarding order of customer %s to %s (request %s)", orderData["customer_id"], url, reqID)
+	setUpstream(r, url)
 	resp, err := client.Do(req)
 	if err != nil {
 		http.Error(w, orderServiceUnreachable, http.StatusBadGateway)
@@ -166,9 +695,82 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 		_ = resp.Body.Close()
 	}()
 
+	w.Header().Set(adminauth.RequestIDHeader, reqID)
+	if flow == "orchestrated" && resp.StatusCode == http.StatusConflict {
+		writeSagaFailure(w, resp, correlation.FromContext(r.Context()))
+		return
+	}
+	copyResponse(w, resp)
+}
+
+// Outcomes of a failed orchestrated saga, as shown to the client.
+const (
+	outcomeRejectedCompensated = "rejected_compensated"
+	outcomeNeedsAttention      = "failed_needs_attention"
+)
+
+// writeSagaFailure maps a failed orchestrated saga to the response shape of its outcome: either
+// everything was undone, or a compensation failed, was skipped or deferred, or the order could not
+// be confirmed after the payment, and support must step in. The support reference is the
+// correlation ID of the saga, falling back to cid, the one the gateway sent.
+func writeSagaFailure(w http.ResponseWriter, resp *http.Response, cid string) {
+	var result struct {
+		OrderID              string                 `json:"order_id"`
+		Status               string                 `json:"status"`
+		Reason               string                 `json:"reason"`
+		ReasonCode           string                 `json:"reason_code"`
+		CompensationFailed   bool                   `json:"compensation_failed"`
+		SkippedCompensations []string               `json:"skipped_compensations"`
+		CorrelationID        string                 `json:"correlation_id"`
+		Shortages            []events.StockShortage `json:"shortages"`
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &result)
+	}
+	if err != nil {
+		log.Printf("[Gateway] Undecodable saga failure (correlation %s): %v", cid, err)
+		http.Error(w, "order failed", http.StatusBadGateway)
+		return
+	}
+	// A repeated Idempotency-Key whose first saga still runs: nothing is known of the outcome yet.
+	if result.ReasonCode == events.ReasonInProgress {
+		w.Header().Set(ctHdr, ctJSON)
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write(body)
+		return
+	}
+
+	out := map[string]interface{}{
+		"order_id":    result.OrderID,
+		"status":      result.Status,
+		"reason":      result.Reason,
+		"reason_code": result.ReasonCode,
+	}
+	if len(result.Shortages) > 0 {
+		out["shortages"] = result.Shortages
+	}
+	if result.CompensationFailed || len(result.SkippedCompensations) > 0 ||
+		result.Status == "needs_review" || result.Status == "failed_confirmation" {
+		ref := result.CorrelationID
+		if ref == "" {
+			ref = resp.Header.Get(correlation.Header)
+		}
+		if ref == "" {
+			ref = cid
+		}
+		log.Printf("[Gateway] Order %s needs attention (support reference %s): %s", result.OrderID, ref, result.Reason)
+		out["outcome"] = outcomeNeedsAttention
+		out["support_reference"] = ref
+		out["message"] = "Your order could not be completed and is being checked by our team. " +
+			"Please contact support quoting the reference " + ref + "."
+	} else {
+		out["outcome"] = outcomeRejectedCompensated
+		out["message"] = "Your order was not placed. Nothing was charged and no items are held, so you can try again."
+	}
 	w.Header().Set(ctHdr, ctJSON)
-	w.WriteHeader(resp.StatusCode)
-	_, _ = io.Copy(w, resp.Body)
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(out)
 }
 
 // ordersHandler dispatches requests to /orders based on the HTTP method.
@@ -177,29 +779,334 @@ func ordersHandler(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		ordersListProxy(w, r)
 	case http.MethodPost:
-		createOrderHandler(w, r)
+		maintenance.Guard(createOrderHandler)(w, r)
 	default:
 		http.Error(w, methodNotAllowed, http.StatusMethodNotAllowed)
 	}
 }
 
+// inventoryBase returns the inventory service base URL of the requested flow.
+func inventoryBase(flow string) string {
+	if flow == "orchestrated" {
+		return orInv
+	}
+	return chInv
+}
+
+// fetchCatalog retrieves the product catalog of a flow from its inventory service.
+func fetchCatalog(flow string) ([]events.Product, error) {
+	resp, err := serviceClient.Get(inventoryBase(flow) + "/catalog")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var products []events.Product
+	if err := json.NewDecoder(resp.Body).Decode(&products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// Catalog prices per flow, cached briefly for the cart preview
+var priceCache = struct {
+	sync.Mutex
+	Entries map[string]cachedCatalog
+}{Entries: make(map[string]cachedCatalog)}
+
+type cachedCatalog struct {
+	Products map[string]events.Product
+	Expires  time.Time
+}
+
+// catalogPrices returns the products of a flow keyed by ID, from the cache when fresh.
+func catalogPrices(flow string) (map[string]events.Product, error) {
+	priceCache.Lock()
+	entry, ok := priceCache.Entries[flow]
+	priceCache.Unlock()
+	if ok && time.Now().Before(entry.Expires) {
+		return entry.Products, nil
+	}
+
+	products, err := fetchCatalog(flow)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]events.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	priceCache.Lock()
+	priceCache.Entries[flow] = cachedCatalog{Products: byID, Expires: time.Now().Add(priceCacheTTL)}
+	priceCache.Unlock()
+	return byID, nil
+}
+
+// cartLine is a priced line of the cart preview.
+type cartLine struct {
+	ProductID string  `json:"product_id"`
+	Name      string  `json:"name,omitempty"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	LineTotal float64 `json:"line_total"`
+}
+
+// cartPreviewHandler prices a cart with the inventory prices of the selected flow and reports
+// every order policy violation, without creating anything.
+func cartPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, methodNotAllowed, http.StatusMethodNotAllowed)
+		return
+	}
+	var cart struct {
+		Items []events.OrderItem `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&cart); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	flow := r.URL.Query().Get("flow")
+	if flow != "orchestrated" {
+		flow = "choreographed"
+	}
+
+	items := order_policy.DedupeItems(cart.Items)
+	violations := []events.ErrorResponse{}
+	if v := order_policy.ValidateItems(items); v != nil {
+		violations = append(violations, events.ErrorResponse{ReasonCode: v.ReasonCode, Message: v.Message})
+	}
+
+	products, err := catalogPrices(flow)
+	if err != nil {
+		log.Printf("[Gateway] cart preview: catalog of %s flow unavailable: %v", flow, err)
+		http.Error(w, "inventory service unreachable", http.StatusBadGateway)
+		return
+	}
+
+	lines := make([]cartLine, 0, len(items))
+	var total float64
+	for _, item := range items {
+		p, ok := products[item.ProductID]
+		if !ok {
+			violations = append(violations, events.ErrorResponse{
+				ReasonCode: events.ReasonUnknownProduct,
+				Message:    "Product price not found for " + item.ProductID,
+			})
+			continue
+		}
+		if v := order_policy.CheckPrice(p.ID, p.Price); v != nil {
+			violations = append(violations, events.ErrorResponse{ReasonCode: v.ReasonCode, Message: v.Message})
+		}
+		line := cartLine{ProductID: p.ID, Name: p.Name, Quantity: item.Quantity, UnitPrice: p.Price, LineTotal: p.Price * float64(item.Quantity)}
+		lines = append(lines, line)
+		total += line.LineTotal
+	}
+	if paymentAmountLimit > 0 && total > paymentAmountLimit {
+		violations = append(violations, events.ErrorResponse{
+			ReasonCode: events.ReasonLimitExceeded,
+			Message:    fmt.Sprintf("The amount %.2f exceeds the limit of %.2f", total, paymentAmountLimit),
+		})
+	}
+
+	w.Header().Set(ctHdr, ctJSON)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"flow":       flow,
+		"lines":      lines,
+		"total":      total,
+		"valid":      len(violations) == 0,
+		"violations": violations,
+	})
+}
+
 // catalogProxy retrieves the catalog from the appropriate inventory service based on the flow type.
+// Image URLs are rewritten to the gateway image proxy so that clients never reach third-party hosts.
 func catalogProxy(w http.ResponseWriter, r *http.Request) {
-	base := chInv
-	if r.URL.Query().Get("flow") == "orchestrated" {
-		base = orInv
-	}
-	resp, err := http.Get(base + "/catalog")
-	if err != nil || resp.StatusCode != http.StatusOK {
+	flow := r.URL.Query().Get("flow")
+	setUpstream(r, inventoryBase(flow))
+	products, err := fetchCatalog(flow)
+	if err != nil {
 		http.Error(w, "inventory unreachable", http.StatusBadGateway)
 		return
 	}
+
+	scheme := "http"
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		scheme = p
+	}
+	for i := range products {
+		if products[i].ImageURL == "" {
+			continue
+		}
+		q := url.Values{"product_id": {products[i].ID}}
+		if flow != "" {
+			q.Set("flow", flow)
+		}
+		products[i].ImageURL = fmt.Sprintf("%s://%s/catalog/image?%s", scheme, r.Host, q.Encode())
+	}
+
+	w.Header().Set(ctHdr, ctJSON)
+	_ = json.NewEncoder(w).Encode(products)
+}
+
+// cachedImage is an upstream product image kept by the image proxy.
+type cachedImage struct {
+	data        []byte
+	contentType string
+	expires     time.Time
+}
+
+// In-memory cache of proxied images, keyed by flow and product ID, holding at most imageCacheMax
+var imageCache = struct {
+	sync.RWMutex
+	Data map[string]cachedImage
+}{Data: make(map[string]cachedImage)}
+
+// cacheImage stores an image, first dropping the expired ones and then, while the cache is
+// full, the one closest to expiry.
+func cacheImage(key string, img cachedImage) {
+	imageCache.Lock()
+	defer imageCache.Unlock()
+	if _, ok := imageCache.Data[key]; !ok && len(imageCache.Data) >= imageCacheMax {
+		now := time.Now()
+		for k, cached := range imageCache.Data {
+			if now.After(cached.expires) {
+				delete(imageCache.Data, k)
+			}
+		}
+		for len(imageCache.Data) >= imageCacheMax {
+			var oldest string
+			for k, cached := range imageCache.Data {
+				if oldest == "" || cached.expires.Before(imageCache.Data[oldest].expires) {
+					oldest = k
+				}
+			}
+			delete(imageCache.Data, oldest)
+		}
+	}
+	imageCache.Data[key] = img
+}
+
+// maxImageRedirects bounds the redirects followed when fetching an image.
+const maxImageRedirects = 5
+
+// checkImageRedirect lets the image fetch follow a redirect only to an allowed host, so that an
+// allowed host cannot bounce the gateway to an internal address.
+func checkImageRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxImageRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxImageRedirects)
+	}
+	if !allowedImageURL(req.URL.String()) {
+		return fmt.Errorf("redirect to disallowed host %s", req.URL.Host)
+	}
+	return nil
+}
+
+// allowedImageURL checks that the upstream image URL uses http(s) and a whitelisted host.
+func allowedImageURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+	for _, h := range imageAllowedHosts {
+		if strings.EqualFold(u.Hostname(), strings.TrimSpace(h)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchImage downloads an upstream image, refusing anything larger than imageMaxBytes.
+func fetchImage(raw string) (cachedImage, int, error) {
+	client := &http.Client{Timeout: 10 * time.Second, CheckRedirect: checkImageRedirect}
+	resp, err := client.Get(raw)
+	if err != nil {
+		return cachedImage{}, http.StatusBadGateway, err
+	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
+	if resp.StatusCode != http.StatusOK {
+		return cachedImage{}, http.StatusBadGateway, fmt.Errorf("upstream status %d", resp.StatusCode)
+	}
+	ct := resp.Header.Get(ctHdr)
+	if !strings.HasPrefix(ct, "image/") {
+		return cachedImage{}, http.StatusBadGateway, fmt.Errorf("upstream content type %q is not an image", ct)
+	}
+	if resp.ContentLength > imageMaxBytes {
+		return cachedImage{}, http.StatusBadGateway, fmt.Errorf("image of %d bytes exceeds the limit", resp.ContentLength)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, imageMaxBytes+1))
+	if err != nil {
+		return cachedImage{}, http.StatusBadGateway, err
+	}
+	if int64(len(data)) > imageMaxBytes {
+		return cachedImage{}, http.StatusBadGateway, fmt.Errorf("image exceeds the limit of %d bytes", imageMaxBytes)
+	}
+	return cachedImage{data: data, contentType: ct, expires: time.Now().Add(imageCacheTTL)}, http.StatusOK, nil
+}
 
-	w.Header().Set(ctHdr, ctJSON)
-	_, _ = io.Copy(w, resp.Body)
+// imageProxy serves GET /catalog/image?product_id=, fetching the product image server-side with caching.
+func imageProxy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, methodNotAllowed, http.StatusMethodNotAllowed)
+		return
+	}
+	productID := r.URL.Query().Get("product_id")
+	if productID == "" {
+		http.Error(w, "product_id required", http.StatusBadRequest)
+		return
+	}
+	// Any flow but the orchestrated one reads the choreographed catalog, so it shares its cache
+	// entries: a client cannot grow the cache by varying the parameter.
+	flow := r.URL.Query().Get("flow")
+	if flow != "orchestrated" {
+		flow = "choreographed"
+	}
+	key := flow + "|" + productID
+
+	imageCache.RLock()
+	img, ok := imageCache.Data[key]
+	imageCache.RUnlock()
+
+	if !ok || time.Now().After(img.expires) {
+		products, err := fetchCatalog(flow)
+		if err != nil {
+			http.Error(w, "inventory unreachable", http.StatusBadGateway)
+			return
+		}
+		var imageURL string
+		for _, p := range products {
+			if p.ID == productID {
+				imageURL = p.ImageURL
+				break
+			}
+		}
+		if imageURL == "" {
+			responses.WriteNotFound(w, "image", productID)
+			return
+		}
+		if !allowedImageURL(imageURL) {
+			log.Printf("[Gateway] Refusing to proxy image of %s from disallowed host: %s", productID, imageURL)
+			http.Error(w, "image host not allowed", http.StatusForbidden)
+			return
+		}
+		var status int
+		img, status, err = fetchImage(imageURL)
+		if err != nil {
+			log.Printf("[Gateway] Image proxy failed for %s: %v", productID, err)
+			http.Error(w, "image unavailable", status)
+			return
+		}
+		cacheImage(key, img)
+	}
+
+	w.Header().Set(ctHdr, img.contentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(imageCacheTTL.Seconds())))
+	_, _ = w.Write(img.data)
 }
 
 // ordersListProxy retrieves the list of orders for a customer from the appropriate order service.
@@ -214,28 +1121,167 @@ func ordersListProxy(w http.ResponseWriter, r *http.Request) {
 		base = orOrder
 	}
 	url := fmt.Sprintf("%s/orders?customer_id=%s", base, cid)
-	resp, err := http.Get(url)
-	if err != nil || resp.StatusCode != http.StatusOK {
+	setUpstream(r, url)
+	resp, err := serviceClient.Get(url)
+	if err != nil {
 		http.Error(w, orderServiceUnreachable, http.StatusBadGateway)
 		return
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
+	copyResponse(w, resp)
+}
+
+// flowOrder is an order tagged with the saga flow that produced it.
+type flowOrder struct {
+	events.Order
+	Flow string `json:"flow"`
+}
+
+// fetchFlowOrders retrieves the orders of a customer from the order service of one flow.
+func fetchFlowOrders(client *http.Client, flow, base, cid string) ([]flowOrder, error) {
+	resp, err := client.Get(fmt.Sprintf("%s/orders?customer_id=%s", base, cid))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
 
+	var orders []events.Order
+	if err := json.NewDecoder(resp.Body).Decode(&orders); err != nil {
+		return nil, err
+	}
+	out := make([]flowOrder, 0, len(orders))
+	for _, o := range orders {
+		out = append(out, flowOrder{Order: o, Flow: flow})
+	}
+	return out, nil
+}
+
+// allOrdersHandler merges the order histories of both flows, newest first, and paginates them.
+// If one order service is down, the orders of the other flow are returned with a warning.
+func allOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, methodNotAllowed, http.StatusMethodNotAllowed)
+		return
+	}
+	cid := customerIDFrom(r)
+	if cid == "" {
+		http.Error(w, "customer_id required", http.StatusBadRequest)
+		return
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if err != nil || pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	sources := map[string]string{"choreographed": chOrder, "orchestrated": orOrder}
+	client := tlsconfig.Client(5 * time.Second)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		merged   []flowOrder
+		warnings []string
+	)
+	for flow, base := range sources {
+		wg.Add(1)
+		go func(flow, base string) {
+			defer wg.Done()
+			orders, err := fetchFlowOrders(client, flow, base, cid)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("[Gateway] %s order service unavailable for order history: %v", flow, err)
+				warnings = append(warnings, flow+" orders unavailable: "+orderServiceUnreachable)
+				return
+			}
+			merged = append(merged, orders...)
+		}(flow, base)
+	}
+	wg.Wait()
+
+	if len(warnings) == len(sources) {
+		http.Error(w, orderServiceUnreachable, http.StatusBadGateway)
+		return
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		if !merged[i].CreatedAt.Equal(merged[j].CreatedAt) {
+			return merged[i].CreatedAt.After(merged[j].CreatedAt)
+		}
+		return merged[i].OrderID < merged[j].OrderID
+	})
+	sort.Strings(warnings)
+
+	start := (page - 1) * pageSize
+	if start > len(merged) {
+		start = len(merged)
+	}
+	end := start + pageSize
+	if end > len(merged) {
+		end = len(merged)
+	}
+
+	out := map[string]interface{}{
+		"orders":    merged[start:end],
+		"total":     len(merged),
+		"page":      page,
+		"page_size": pageSize,
+	}
+	if len(warnings) > 0 {
+		out["warnings"] = warnings
+	}
 	w.Header().Set(ctHdr, ctJSON)
-	_, _ = io.Copy(w, resp.Body)
+	_ = json.NewEncoder(w).Encode(out)
 }
 
 // orderStatusProxy retrieves the status of a specific order by ID from the appropriate order service.
 func orderStatusProxy(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	id := strings.TrimPrefix(r.URL.Path, "/orders/")
+	if id, ok := strings.CutSuffix(id, "/full"); ok && id != "" && !strings.Contains(id, "/") {
+		orderFullHandler(w, r, id)
+		return
+	}
+	if id == "" || strings.Contains(id, "/") {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "expected /orders/{id}")
+		return
+	}
 	flow := r.URL.Query().Get("flow")
 	base := chOrder
 	if flow == "orchestrated" {
 		base = orOrder
 	}
-	resp, err := http.Get(base + "/orders/" + id)
+	// Long-poll parameters are forwarded, and the request context ends the wait if the client leaves.
+	q := url.Values{}
+	for _, key := range []string{"wait", "since_status"} {
+		if v := r.URL.Query().Get(key); v != "" {
+			q.Set(key, v)
+		}
+	}
+	target := base + "/orders/" + url.PathEscape(id)
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target, nil)
+	if err != nil {
+		http.Error(w, orderServiceUnreachable, http.StatusBadGateway)
+		return
+	}
+	setUpstream(r, target)
+	resp, err := serviceClient.Do(req)
 	if err != nil {
 		http.Error(w, orderServiceUnreachable, http.StatusBadGateway)
 		return
@@ -244,9 +1290,107 @@ func orderStatusProxy(w http.ResponseWriter, r *http.Request) {
 		_ = resp.Body.Close()
 	}()
 
-	w.Header().Set(ctHdr, ctJSON)
-	w.WriteHeader(resp.StatusCode)
-	_, _ = io.Copy(w, resp.Body)
+	copyResponse(w, resp)
+}
+
+// orderViewTimeout bounds all the upstream calls of /orders/{id}/full together.
+const orderViewTimeout = 5 * time.Second
+
+// fetchSection gets a JSON document for one section of /orders/{id}/full. The error is the
+// message shown in place of the section.
+func fetchSection(ctx context.Context, name, target string) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, errors.New(name + " unreachable")
+	}
+	correlation.Inject(ctx, req)
+	resp, err := serviceClient.Do(req)
+	if err != nil {
+		log.Printf("[Gateway] %s unreachable for %s: %v", name, target, err)
+		return nil, errors.New(name + " unreachable")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errors.New(name + " not found")
+	}
+	var doc json.RawMessage
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&doc) != nil {
+		log.Printf("[Gateway] %s answered %d for %s", name, resp.StatusCode, target)
+		return nil, errors.New(name + " unreachable")
+	}
+	return doc, nil
+}
+
+// orderFullHandler serves GET /orders/{id}/full: the order, its payment transaction and its
+// shipping, fetched concurrently. A section that cannot be fetched is replaced by
+// {"error": "..."} and the others are still returned with 200.
+func orderFullHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, methodNotAllowed, http.StatusMethodNotAllowed)
+		return
+	}
+	flow := r.URL.Query().Get("flow")
+	if flow != "orchestrated" {
+		flow = "choreographed"
+	}
+	orderBase, paymentBase := chOrder, chPayment
+	if flow == "orchestrated" {
+		orderBase, paymentBase = orOrder, orPayment
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), orderViewTimeout)
+	defer cancel()
+
+	var (
+		wg               sync.WaitGroup
+		order, payment   json.RawMessage
+		orderErr, payErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		target := orderBase + "/orders/" + url.PathEscape(id)
+		setUpstream(r, target)
+		order, orderErr = fetchSection(ctx, "order service", target)
+	}()
+	go func() {
+		defer wg.Done()
+		if paymentBase == "" {
+			payErr = errors.New("payment service not configured")
+			return
+		}
+		target := paymentBase + "/transactions/" + url.PathEscape(id)
+		setUpstream(r, target)
+		payment, payErr = fetchSection(ctx, "payment service", target)
+	}()
+	wg.Wait()
+
+	section := func(doc json.RawMessage, err error) interface{} {
+		if err != nil {
+			return map[string]string{"error": err.Error()}
+		}
+		return doc
+	}
+	// Shipping has no service of its own to ask: the orchestrated order record carries the
+	// address and the quoted cost, and the choreographed flow does not ship.
+	var shipping interface{} = map[string]string{"status": "not_applicable"}
+	if flow == "orchestrated" {
+		var o events.Order
+		if orderErr != nil {
+			shipping = section(nil, orderErr)
+		} else if err := json.Unmarshal(order, &o); err == nil {
+			shipping = map[string]interface{}{"address": o.Address, "shipping_cost": o.ShippingCost}
+		}
+	}
+
+	responses.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"order_id": id,
+		"flow":     flow,
+		"order":    section(order, orderErr),
+		"payment":  section(payment, payErr),
+		"shipping": shipping,
+	})
 }
 
 // authProxy handles authentication requests and proxies them to the appropriate auth service.
@@ -261,7 +1405,16 @@ func authProxy(w http.ResponseWriter, r *http.Request) {
 	// Read the original body
 	var payload map[string]interface{}
 	if r.Body != nil {
-		_ = json.NewDecoder(r.Body).Decode(&payload)
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if bodylimit.TooLarge(err) {
+			bodylimit.WriteTooLarge(w)
+			return
+		}
+		// An empty body is forwarded as {"ns": ...}; anything else must be a JSON object.
+		if err != nil && !errors.Is(err, io.EOF) {
+			responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "request body must be a JSON object")
+			return
+		}
 	}
 	if payload == nil {
 		payload = map[string]interface{}{}
@@ -280,8 +1433,12 @@ func authProxy(w http.ResponseWriter, r *http.Request) {
 	buf, _ := json.Marshal(payload)
 
 	req, _ := http.NewRequest(r.Method, url, bytes.NewReader(buf))
+	setUpstream(r, url)
 	req.Header.Set(ctHdr, ctJSON)
-	resp, err := http.DefaultClient.Do(req)
+	if v := r.Header.Get("Authorization"); v != "" {
+		req.Header.Set("Authorization", v)
+	}
+	resp, err := serviceClient.Do(req)
 	if err != nil {
 		http.Error(w, "auth unreachable", http.StatusBadGateway)
 		return
@@ -289,29 +1446,194 @@ func authProxy(w http.ResponseWriter, r *http.Request) {
 	defer func() {
 		_ = resp.Body.Close()
 	}()
+	copyResponse(w, resp)
+}
+
+// componentStatus is the health and build of a downstream component as seen by /health/full.
+type componentStatus struct {
+	Status string          `json:"status"`
+	Build  *buildinfo.Info `json:"build,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// fullHealthHandler reports the gateway build and read-only state, and the reachability and build
+// of each component, read from their /version endpoints.
+func fullHealthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, methodNotAllowed, http.StatusMethodNotAllowed)
+		return
+	}
+	components := map[string]string{
+		"choreographer-order-service":     chOrder,
+		"choreographer-inventory-service": chInv,
+		"choreographer-auth-service":      chAuth,
+		"orchestrator":                    orchestrator,
+		"orchestrator-order-service":      orOrder,
+		"orchestrator-inventory-service":  orInv,
+		"orchestrator-auth-service":       orAuth,
+	}
+	client := tlsconfig.Client(3 * time.Second)
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		out = make(map[string]componentStatus, len(components))
+	)
+	for name, base := range components {
+		wg.Add(1)
+		go func(name, base string) {
+			defer wg.Done()
+			status := componentStatus{Status: "down"}
+			resp, err := client.Get(base + "/version")
+			if err == nil {
+				var info buildinfo.Info
+				if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&info) == nil {
+					status = componentStatus{Status: "up", Build: &info}
+				} else {
+					status.Error = fmt.Sprintf("unexpected response: %d", resp.StatusCode)
+				}
+				_ = resp.Body.Close()
+			} else {
+				status.Error = err.Error()
+			}
+			mu.Lock()
+			out[name] = status
+			mu.Unlock()
+		}(name, base)
+	}
+	wg.Wait()
 
 	w.Header().Set(ctHdr, ctJSON)
-	w.WriteHeader(resp.StatusCode)
-	_, _ = io.Copy(w, resp.Body)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"gateway":     buildinfo.Get("gateway"),
+		"maintenance": maintenance.Current(),
+		"components":  out,
+	})
 }
 
-func main() {
-	port := mustGet("GATEWAY_PORT")
+// scenario is a demo setup: the faults armed on the orchestrated services for the next order.
+type scenario struct {
+	Description string                    `json:"description"`
+	Faults      map[string]map[string]int `json:"-"` // service base URL -> fault -> failures
+}
 
-	http.HandleFunc("/orders", withCORS(authenticate(ordersHandler))) // Use the new dispatcher
-	http.HandleFunc("/orders/", withCORS(authenticate(orderStatusProxy)))
+// scenarios returns the built-in demo scenarios of /admin/scenario, by name.
+func scenarios() map[string]scenario {
+	return map[string]scenario{
+		"payment-declined": {
+			Description: "The payment is declined; the reservation is cancelled and the order rejected.",
+			Faults:      map[string]map[string]int{orPayment: {chaos.FaultPayment: 1}},
+		},
+		"out-of-stock": {
+			Description: "The inventory refuses the reservation; the order is rejected before any payment.",
+			Faults:      map[string]map[string]int{orInv: {chaos.FaultReservation: 1}},
+		},
+		"confirmation-fails": {
+			Description: "Stock and payment succeed but the order cannot be approved; it ends in failed_confirmation.",
+			Faults:      map[string]map[string]int{orOrder: {chaos.FaultConfirmation: 1}},
+		},
+	}
+}
 
-	http.HandleFunc("/catalog", withCORS(catalogProxy))
+// scenarioHandler serves /admin/scenario: GET lists the scenarios, POST {"name": "..."} clears the
+// faults of the orchestrated services and arms those of the scenario, DELETE clears them.
+func scenarioHandler(w http.ResponseWriter, r *http.Request) {
+	all := scenarios()
+	switch r.Method {
+	case http.MethodGet:
+		responses.WriteJSON(w, http.StatusOK, all)
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request body")
+			return
+		}
+		sc, ok := all[req.Name]
+		if !ok {
+			responses.WriteNotFound(w, "scenario", req.Name)
+			return
+		}
+		failures := clearScenario(r)
+		for base, faults := range sc.Faults {
+			if err := callChaos(r, http.MethodPost, base, faults); err != nil {
+				failures[base] = err.Error()
+			}
+		}
+		if len(failures) > 0 {
+			responses.WriteJSON(w, http.StatusBadGateway, map[string]interface{}{"scenario": req.Name, "errors": failures})
+			return
+		}
+		log.Printf("[Gateway] Demo scenario %s armed", req.Name)
+		responses.WriteJSON(w, http.StatusOK, map[string]string{"scenario": req.Name, "description": sc.Description})
+	case http.MethodDelete:
+		if failures := clearScenario(r); len(failures) > 0 {
+			responses.WriteJSON(w, http.StatusBadGateway, map[string]interface{}{"errors": failures})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, methodNotAllowed, http.StatusMethodNotAllowed)
+	}
+}
 
-	http.HandleFunc("/register", withCORS(authProxy))
-	http.HandleFunc("/login", withCORS(authProxy))
-	http.HandleFunc(validateURL, withCORS(authProxy))
+// clearScenario disarms the faults of every orchestrated service and returns the errors by service.
+func clearScenario(r *http.Request) map[string]string {
+	failures := make(map[string]string)
+	for _, base := range []string{orOrder, orInv, orPayment} {
+		if err := callChaos(r, http.MethodDelete, base, nil); err != nil {
+			failures[base] = err.Error()
+		}
+	}
+	return failures
+}
 
-	http.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("Gateway OK"))
-	})
+// callChaos calls /admin/chaos on a service, forwarding the admin token of the request.
+func callChaos(r *http.Request, method, base string, faults map[string]int) error {
+	if base == "" {
+		if method == http.MethodDelete {
+			return nil
+		}
+		return fmt.Errorf("service URL not configured")
+	}
+	var body io.Reader
+	if faults != nil {
+		b, err := json.Marshal(faults)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), method, base+"/admin/chaos", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(adminauth.Header, r.Header.Get(adminauth.Header))
+	req.Header.Set(ctHdr, ctJSON)
+	client := tlsconfig.Client(3 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func main() {
+	loadServiceURLs()
+	port := mustGet("GATEWAY_PORT")
+	registerConfig(port)
+	if rateLimitRPS > 0 {
+		startBucketJanitor()
+	}
+	registerRoutes(http.DefaultServeMux)
 
 	log.Printf("[Gateway] listening on :%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	if err := graceful.ListenAndServe(":"+port, diagnostics.Handler(bodylimit.Handler(withAccessLog(http.DefaultServeMux)))); err != nil {
+		log.Fatal(err)
+	}
 }
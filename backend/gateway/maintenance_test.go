@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/maintenance"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// While read-only the gateway refuses new orders without forwarding them, keeps serving the
+// order list, and reports the mode in /health/full.
+func TestReadOnlyOrders(t *testing.T) {
+	var creates, lists int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			creates++
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		lists++
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer upstream.Close()
+	prev := chOrder
+	chOrder = upstream.URL
+	defer func() { chOrder = prev }()
+	maintenance.Set(true, 45, "demo reset")
+	defer maintenance.Set(false, 0, "")
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"items":[{"product_id":"a","quantity":1}]}`))
+		req.Header.Set("X-Customer-ID", "user1")
+		rec := httptest.NewRecorder()
+		ordersHandler(rec, req)
+		return rec
+	}
+
+	rec := post()
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "45" {
+		t.Fatalf("POST /orders answered %d (Retry-After %q), want 503", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	var envelope events.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil || envelope.ReasonCode != maintenance.ReasonMaintenance || envelope.Message != "demo reset" {
+		t.Errorf("envelope = %+v (%v)", envelope, err)
+	}
+	if creates != 0 {
+		t.Errorf("%d orders forwarded while read-only", creates)
+	}
+
+	rec = httptest.NewRecorder()
+	ordersHandler(rec, httptest.NewRequest(http.MethodGet, "/orders?customer_id=user1", nil))
+	if rec.Code != http.StatusOK || lists != 1 {
+		t.Errorf("GET /orders answered %d with %d upstream reads, want it proxied", rec.Code, lists)
+	}
+
+	rec = httptest.NewRecorder()
+	fullHealthHandler(rec, httptest.NewRequest(http.MethodGet, "/health/full", nil))
+	var health struct {
+		Maintenance maintenance.Status `json:"maintenance"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil || !health.Maintenance.ReadOnly || health.Maintenance.RetryAfter != 45 {
+		t.Errorf("/health/full maintenance = %+v (%v), want read-only", health.Maintenance, err)
+	}
+
+	maintenance.Set(false, 0, "")
+	if rec := post(); rec.Code != http.StatusAccepted || creates != 1 {
+		t.Errorf("POST /orders answered %d once read-only was disabled, want it forwarded", rec.Code)
+	}
+}
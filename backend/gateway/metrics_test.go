@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type metricsSnapshot struct {
+	Total  int64 `json:"total_requests"`
+	Routes map[string]struct {
+		Requests int64            `json:"requests"`
+		Errors   int64            `json:"errors"`
+		ByStatus map[string]int64 `json:"by_status"`
+	} `json:"routes"`
+	Upstreams map[string]int64 `json:"upstreams"`
+}
+
+func readMetrics(t *testing.T) metricsSnapshot {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metricsHandler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var m metricsSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+		t.Fatalf("/metrics answered %d %s: %v", rec.Code, rec.Body, err)
+	}
+	return m
+}
+
+// Parallel requests through the access log are all counted: by route, by status, as errors
+// for the 5xx, and by the upstream their handler called.
+func TestMetricsUnderParallelLoad(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics-test/ok", func(w http.ResponseWriter, r *http.Request) {
+		setUpstream(r, "http://inventory.test:8080/catalog")
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/metrics-test/fail", func(w http.ResponseWriter, r *http.Request) {
+		setUpstream(r, "http://orders.test:8080/create_order")
+		http.Error(w, "upstream down", http.StatusBadGateway)
+	})
+	srv := httptest.NewServer(withAccessLog(mux))
+	defer srv.Close()
+
+	before := readMetrics(t)
+	const perRoute = 50
+	var wg sync.WaitGroup
+	for i := 0; i < perRoute; i++ {
+		for _, path := range []string{"/metrics-test/ok", "/metrics-test/fail", "/metrics-test/missing"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := http.Get(srv.URL + path)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_ = resp.Body.Close()
+			}()
+		}
+	}
+	wg.Wait()
+	after := readMetrics(t)
+
+	if got := after.Total - before.Total; got != 3*perRoute {
+		t.Errorf("total grew by %d, want %d", got, 3*perRoute)
+	}
+	ok, fail, unmatched := after.Routes["/metrics-test/ok"], after.Routes["/metrics-test/fail"], after.Routes["unmatched"]
+	prevOK, prevFail, prevUnmatched := before.Routes["/metrics-test/ok"], before.Routes["/metrics-test/fail"], before.Routes["unmatched"]
+	if ok.Requests-prevOK.Requests != perRoute || ok.ByStatus["200"]-prevOK.ByStatus["200"] != perRoute || ok.Errors != prevOK.Errors {
+		t.Errorf("ok route counted %+v, was %+v, want %d more 200s", ok, prevOK, perRoute)
+	}
+	if fail.Requests-prevFail.Requests != perRoute || fail.Errors-prevFail.Errors != perRoute || fail.ByStatus["502"]-prevFail.ByStatus["502"] != perRoute {
+		t.Errorf("failing route counted %+v, was %+v, want %d more 502 errors", fail, prevFail, perRoute)
+	}
+	if unmatched.ByStatus["404"]-prevUnmatched.ByStatus["404"] != perRoute {
+		t.Errorf("unmatched route counted %+v, was %+v, want %d more 404s", unmatched, prevUnmatched, perRoute)
+	}
+	for host, want := range map[string]int64{"inventory.test:8080": perRoute, "orders.test:8080": perRoute} {
+		if got := after.Upstreams[host] - before.Upstreams[host]; got != want {
+			t.Errorf("upstream %s counted %d more calls, want %d", host, got, want)
+		}
+	}
+}
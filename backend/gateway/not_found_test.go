@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// The 404 body of an order service reaches the client unchanged, for either flow.
+func TestOrderNotFoundPassedThrough(t *testing.T) {
+	const upstreamBody = `{"code":"not_found","resource":"order","id":"bogus-id"}`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(upstreamBody))
+	}))
+	defer upstream.Close()
+	prevCh, prevOr := chOrder, orOrder
+	chOrder, orOrder = upstream.URL, upstream.URL
+	defer func() { chOrder, orOrder = prevCh, prevOr }()
+
+	for _, flow := range []string{"choreographed", "orchestrated"} {
+		rec := httptest.NewRecorder()
+		orderStatusProxy(rec, httptest.NewRequest(http.MethodGet, "/orders/bogus-id?flow="+flow, nil))
+		if rec.Code != http.StatusNotFound || rec.Body.String() != upstreamBody {
+			t.Errorf("%s: answered %d %q, want the upstream 404 unchanged", flow, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestUnknownImageNotFound(t *testing.T) {
+	withCatalogs(t, []events.Product{{ID: "mouse-wireless", Price: 49.5}}, nil)
+	rec := httptest.NewRecorder()
+	imageProxy(rec, httptest.NewRequest(http.MethodGet, "/catalog/image?product_id=bogus-id", nil))
+	var body events.NotFoundResponse
+	if rec.Code != http.StatusNotFound || json.NewDecoder(rec.Body).Decode(&body) != nil {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	if body != (events.NotFoundResponse{Code: events.CodeNotFound, Resource: "image", ID: "bogus-id"}) {
+		t.Errorf("body = %+v", body)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Malformed order bodies are refused with a 400 naming the problem, without reaching the order
+// service; a valid one is forwarded with its other fields and the authenticated customer.
+func TestCreateOrderBody(t *testing.T) {
+	var forwarded []map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		forwarded = append(forwarded, body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer upstream.Close()
+	prev := chOrder
+	chOrder = upstream.URL
+	defer func() { chOrder = prev }()
+
+	for _, tc := range []struct {
+		name, body, problem string
+	}{
+		{"empty body", ``, "request body is empty"},
+		{"invalid JSON", `{"items":[`, "request body must be a JSON object"},
+		{"JSON array", `[]`, "request body must be a JSON object"},
+		{"items of the wrong type", `{"items":"mouse"}`, "field items must be"},
+		{"no items", `{"note":"gift"}`, "field items is required"},
+		{"item without a product", `{"items":[{"quantity":1}]}`, "field items.product_id is required"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			forwarded = nil
+			req := httptest.NewRequest(http.MethodPost, "/create_order", strings.NewReader(tc.body))
+			req.Header.Set("X-Customer-ID", "user1")
+			rec := httptest.NewRecorder()
+			createOrderHandler(rec, req)
+			var resp events.ErrorResponse
+			_ = json.NewDecoder(rec.Body).Decode(&resp)
+			if rec.Code != http.StatusBadRequest || resp.ReasonCode != events.ReasonInvalidRequest || !strings.Contains(resp.Message, tc.problem) {
+				t.Errorf("answered %d %+v, want 400 %s mentioning %q", rec.Code, resp, events.ReasonInvalidRequest, tc.problem)
+			}
+			if len(forwarded) != 0 {
+				t.Error("malformed order forwarded to the order service")
+			}
+		})
+	}
+
+	forwarded = nil
+	req := httptest.NewRequest(http.MethodPost, "/create_order",
+		strings.NewReader(`{"customer_id":"someone-else","note":"gift","items":[{"product_id":"mouse-wireless","quantity":2}]}`))
+	req.Header.Set("X-Customer-ID", "user1")
+	rec := httptest.NewRecorder()
+	createOrderHandler(rec, req)
+	if rec.Code != http.StatusAccepted || len(forwarded) != 1 {
+		t.Fatalf("valid order answered %d, forwarded %d times", rec.Code, len(forwarded))
+	}
+	if got := forwarded[0]; got["customer_id"] != "user1" || got["note"] != "gift" {
+		t.Errorf("forwarded %v, want the note kept and the authenticated customer user1", got)
+	}
+}
+
+// The auth routes forward the body with the namespace added, an empty body included, and
+// refuse a body that is not a JSON object.
+func TestAuthProxyBody(t *testing.T) {
+	var forwarded []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = append(forwarded, string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	prev := chAuth
+	chAuth = upstream.URL
+	defer func() { chAuth = prev }()
+
+	for body, want := range map[string]int{
+		``:                     http.StatusOK,
+		`null`:                 http.StatusOK,
+		`{"username":"user1"}`: http.StatusOK,
+		`{"username":`:         http.StatusBadRequest,
+		`"user1"`:              http.StatusBadRequest,
+	} {
+		forwarded = nil
+		req := httptest.NewRequest(http.MethodPost, "/login?ns=demo", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		authProxy(rec, req)
+		if rec.Code != want {
+			t.Errorf("body %q answered %d, want %d", body, rec.Code, want)
+			continue
+		}
+		if want != http.StatusOK {
+			if len(forwarded) != 0 {
+				t.Errorf("body %q forwarded to the auth service", body)
+			}
+			continue
+		}
+		var sent map[string]interface{}
+		if len(forwarded) != 1 || json.Unmarshal([]byte(forwarded[0]), &sent) != nil || sent["ns"] != "demo" {
+			t.Errorf("body %q forwarded as %q, want a JSON object with ns demo", body, forwarded)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// /orders/{id}/full merges the order, its payment and its shipping into one document, answering
+// 200 with an error in place of each section whose service failed.
+func TestOrderFullView(t *testing.T) {
+	serve := func(status int, body string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, body+"\n")
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	order := serve(http.StatusOK, `{"order_id":"orc-1","status":"approved","address":"Via Roma 1","shipping_cost":7.5}`)
+	payment := serve(http.StatusOK, `{"order_id":"cho-1","status":"completed","amount":42}`)
+	failing := serve(http.StatusInternalServerError, `{"error":"boom"}`)
+	missing := serve(http.StatusNotFound, `{"error":"no such order"}`)
+
+	prevChO, prevOrO, prevChP, prevOrP := chOrder, orOrder, chPayment, orPayment
+	defer func() { chOrder, orOrder, chPayment, orPayment = prevChO, prevOrO, prevChP, prevOrP }()
+
+	for _, tc := range []struct {
+		name                 string
+		target               string
+		chOrder, chPayment   string
+		orOrder, orPayment   string
+		flow                 string
+		order, pay, shipping interface{}
+	}{
+		{
+			name: "orchestrated payment down", target: "/orders/orc-1/full?flow=orchestrated",
+			orOrder: order.URL, orPayment: failing.URL, flow: "orchestrated",
+			order:    map[string]interface{}{"order_id": "orc-1", "status": "approved", "address": "Via Roma 1", "shipping_cost": 7.5},
+			pay:      map[string]interface{}{"error": "payment service unreachable"},
+			shipping: map[string]interface{}{"address": "Via Roma 1", "shipping_cost": 7.5},
+		},
+		{
+			name: "choreographed order down", target: "/orders/cho-1/full",
+			chOrder: failing.URL, chPayment: payment.URL, flow: "choreographed",
+			order:    map[string]interface{}{"error": "order service unreachable"},
+			pay:      map[string]interface{}{"order_id": "cho-1", "status": "completed", "amount": 42.0},
+			shipping: map[string]interface{}{"status": "not_applicable"},
+		},
+		{
+			name: "orchestrated order missing, payment not configured", target: "/orders/orc-1/full?flow=orchestrated",
+			orOrder: missing.URL, flow: "orchestrated",
+			order:    map[string]interface{}{"error": "order service not found"},
+			pay:      map[string]interface{}{"error": "payment service not configured"},
+			shipping: map[string]interface{}{"error": "order service not found"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chOrder, chPayment, orOrder, orPayment = tc.chOrder, tc.chPayment, tc.orOrder, tc.orPayment
+			rec := httptest.NewRecorder()
+			orderStatusProxy(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("answered %d %s, want 200", rec.Code, rec.Body)
+			}
+			var view map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &view); err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range map[string]interface{}{
+				"flow":     tc.flow,
+				"order":    tc.order,
+				"payment":  tc.pay,
+				"shipping": tc.shipping,
+			} {
+				if !reflect.DeepEqual(view[key], want) {
+					t.Errorf("%s = %v, want %v", key, view[key], want)
+				}
+			}
+		})
+	}
+}
+
+// Only GET is served on the merged view.
+func TestOrderFullViewMethod(t *testing.T) {
+	rec := httptest.NewRecorder()
+	orderStatusProxy(rec, httptest.NewRequest(http.MethodPost, "/orders/cho-1/full", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST answered %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// orderService serves the given orders on /orders, or fails every request when orders is nil.
+func orderService(t *testing.T, orders []events.Order) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if orders == nil {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(orders)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+type historyPage struct {
+	Orders   []flowOrder `json:"orders"`
+	Total    int         `json:"total"`
+	Warnings []string    `json:"warnings"`
+}
+
+func getHistory(t *testing.T, query string) (int, historyPage) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	allOrdersHandler(rec, httptest.NewRequest(http.MethodGet, "/orders/all?customer_id=user1&"+query, nil))
+	var page historyPage
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, page
+}
+
+func withOrderServices(t *testing.T, choreographed, orchestrated []events.Order) {
+	t.Helper()
+	prevCh, prevOr := chOrder, orOrder
+	chOrder, orOrder = orderService(t, choreographed), orderService(t, orchestrated)
+	t.Cleanup(func() { chOrder, orOrder = prevCh, prevOr })
+}
+
+// Orders of both flows are merged newest first; orders created at the same instant are ordered
+// by id, so pages never overlap.
+func TestOrderHistoryMerge(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	withOrderServices(t,
+		[]events.Order{{OrderID: "ch-1", CreatedAt: t0}, {OrderID: "ch-2", CreatedAt: t0.Add(time.Minute)}},
+		[]events.Order{{OrderID: "or-1", CreatedAt: t0}, {OrderID: "or-2", CreatedAt: t0.Add(2 * time.Minute)}},
+	)
+
+	want := []struct{ id, flow string }{
+		{"or-2", "orchestrated"}, {"ch-2", "choreographed"}, {"ch-1", "choreographed"}, {"or-1", "orchestrated"},
+	}
+	var got []flowOrder
+	for _, query := range []string{"page=1&page_size=3", "page=2&page_size=3"} {
+		code, page := getHistory(t, query)
+		if code != http.StatusOK {
+			t.Fatalf("%s answered %d", query, code)
+		}
+		if page.Total != 4 || len(page.Warnings) != 0 {
+			t.Fatalf("%s: total %d, warnings %v", query, page.Total, page.Warnings)
+		}
+		got = append(got, page.Orders...)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d orders over both pages, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].OrderID != w.id || got[i].Flow != w.flow {
+			t.Errorf("order %d = %s (%s), want %s (%s)", i, got[i].OrderID, got[i].Flow, w.id, w.flow)
+		}
+	}
+}
+
+func TestOrderHistoryUpstreamDown(t *testing.T) {
+	t.Run("one flow down", func(t *testing.T) {
+		withOrderServices(t, nil, []events.Order{{OrderID: "or-1", CreatedAt: time.Now()}})
+		code, page := getHistory(t, "")
+		if code != http.StatusOK {
+			t.Fatalf("answered %d, want the partial history", code)
+		}
+		if len(page.Orders) != 1 || page.Orders[0].Flow != "orchestrated" {
+			t.Errorf("orders = %+v, want the orchestrated one", page.Orders)
+		}
+		if len(page.Warnings) != 1 {
+			t.Errorf("warnings = %v, want one for the choreographed flow", page.Warnings)
+		}
+	})
+	t.Run("both flows down", func(t *testing.T) {
+		withOrderServices(t, nil, nil)
+		if code, _ := getHistory(t, ""); code != http.StatusBadGateway {
+			t.Errorf("answered %d, want 502", code)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The order routes pass the upstream status and headers through, except the hop-by-hop and
+// CORS ones, and keep sending each flow to its own service.
+func TestProxyHeaderPassthrough(t *testing.T) {
+	upstream := func(flow string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Content-Type", "text/plain; charset=utf-8")
+			h.Set("Location", "/orders/"+flow+"-1")
+			h.Set("Cache-Control", "no-store")
+			h.Set("Connection", "X-Internal")
+			h.Set("X-Internal", "hop")
+			h.Set("Keep-Alive", "timeout=5")
+			h.Set("Access-Control-Allow-Origin", "*")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, flow)
+		}))
+	}
+	cho, orc := upstream("choreographed"), upstream("orchestrated")
+	defer cho.Close()
+	defer orc.Close()
+	prevCh, prevOrc, prevOr := chOrder, orchestrator, orOrder
+	chOrder, orchestrator, orOrder = cho.URL, orc.URL, orc.URL
+	defer func() { chOrder, orchestrator, orOrder = prevCh, prevOrc, prevOr }()
+
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		flow    string
+	}{
+		{"create choreographed", createOrderHandler, http.MethodPost, "/create_order", "choreographed"},
+		{"create orchestrated", createOrderHandler, http.MethodPost, "/create_order?flow=orchestrated", "orchestrated"},
+		{"list", ordersListProxy, http.MethodGet, "/orders?customer_id=user1&flow=orchestrated", "orchestrated"},
+		{"status", orderStatusProxy, http.MethodGet, "/orders/o-1", "choreographed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(`{"items":[{"product_id":"mouse-wireless","quantity":1}]}`))
+			req.Header.Set("X-Customer-ID", "user1")
+			rec := httptest.NewRecorder()
+			tc.handler(rec, req)
+			h := rec.Header()
+			if rec.Code != http.StatusCreated || rec.Body.String() != tc.flow {
+				t.Errorf("answered %d %q, want 201 from the %s service", rec.Code, rec.Body, tc.flow)
+			}
+			for key, want := range map[string]string{
+				"Content-Type":  "text/plain; charset=utf-8",
+				"Location":      "/orders/" + tc.flow + "-1",
+				"Cache-Control": "no-store",
+			} {
+				if got := h.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+			for _, key := range []string{"Connection", "X-Internal", "Keep-Alive", "Access-Control-Allow-Origin"} {
+				if got := h.Get(key); got != "" {
+					t.Errorf("%s = %q copied from the upstream", key, got)
+				}
+			}
+		})
+	}
+}
+
+// A large upstream body reaches the client while the upstream is still writing it.
+func TestProxyStreamsBody(t *testing.T) {
+	const half = 512 << 10
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write([]byte(strings.Repeat("a", half)))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte(strings.Repeat("b", half)))
+	}))
+	defer upstream.Close()
+	defer close(release)
+	prev := chOrder
+	chOrder = upstream.URL
+	defer func() { chOrder = prev }()
+	gateway := httptest.NewServer(http.HandlerFunc(ordersListProxy))
+	defer gateway.Close()
+
+	resp, err := http.Get(gateway.URL + "/orders?customer_id=user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	firstHalf := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(resp.Body, make([]byte, half))
+		firstHalf <- err
+	}()
+	select {
+	case err := <-firstHalf:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first half of the body was held back until the upstream finished")
+	}
+
+	release <- struct{}{}
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil || len(rest) != half || rest[0] != 'b' {
+		t.Errorf("read %d more bytes (%v), want the second half", len(rest), err)
+	}
+}
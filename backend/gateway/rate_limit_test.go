@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// withRateLimit sets the rate limit for one test and empties the buckets.
+func withRateLimit(t *testing.T, rps float64, burst int) {
+	t.Helper()
+	prevRPS, prevBurst := rateLimitRPS, rateLimitBurst
+	rateLimitRPS, rateLimitBurst = rps, burst
+	resetBuckets := func() {
+		rateBuckets.Lock()
+		rateBuckets.Data = make(map[string]*bucket)
+		rateBuckets.Unlock()
+	}
+	resetBuckets()
+	t.Cleanup(func() {
+		rateLimitRPS, rateLimitBurst = prevRPS, prevBurst
+		resetBuckets()
+	})
+}
+
+func serve(mux *http.ServeMux, method, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.RemoteAddr = "192.0.2.1:4000"
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTakeToken(t *testing.T) {
+	withRateLimit(t, 2, 2)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := takeToken("ip:a", now); !ok {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+	ok, wait := takeToken("ip:a", now)
+	if ok {
+		t.Fatal("request past the burst allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("wait = %s, want 500ms at 2 rps", wait)
+	}
+	if ok, _ := takeToken("ip:b", now); !ok {
+		t.Error("another client shares the bucket")
+	}
+	if ok, _ := takeToken("ip:a", now.Add(wait)); !ok {
+		t.Error("bucket not refilled after the wait")
+	}
+}
+
+// The probes are never limited, so that a client over the limit cannot make the gateway look down.
+func TestHealthNotRateLimited(t *testing.T) {
+	withRateLimit(t, 1, 1)
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+
+	_ = serve(mux, http.MethodGet, "/catalog/image", nil) // spends the IP's only token
+	for i := 0; i < 5; i++ {
+		if rec := serve(mux, http.MethodGet, "/health", nil); rec.Code != http.StatusOK {
+			t.Fatalf("/health call %d answered %d", i+1, rec.Code)
+		}
+	}
+	if rec := serve(mux, http.MethodGet, "/catalog/image", nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("limited route answered %d, want 429", rec.Code)
+	}
+}
+
+// Past the limit, requests to the /orders routes are refused before authenticate calls the
+// auth service.
+func TestRateLimitBeforeAuthenticate(t *testing.T) {
+	withRateLimit(t, 1, 2)
+	var authCalls atomic.Int32
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authCalls.Add(1)
+		http.Error(w, "unknown customer", http.StatusUnauthorized)
+	}))
+	defer auth.Close()
+	prevCh, prevOr := chAuth, orAuth
+	chAuth, orAuth = auth.URL, auth.URL
+	defer func() { chAuth, orAuth = prevCh, prevOr }()
+
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	// Every request claims another customer, so only the IP limit can stop them.
+	for i, customer := range []string{"c1", "c2", "c3", "c4"} {
+		rec := serve(mux, http.MethodGet, "/orders/all", map[string]string{"X-Customer-ID": customer})
+		want := http.StatusUnauthorized
+		if i >= 2 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Errorf("request %d answered %d, want %d", i+1, rec.Code, want)
+		}
+	}
+	if n := authCalls.Load(); n != 2 {
+		t.Errorf("auth service called %d times, want 2: the limited requests must not reach it", n)
+	}
+}
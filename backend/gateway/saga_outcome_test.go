@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// withOrchestrator points the orchestrated flow at a stub answering every saga with status and body.
+func withOrchestrator(t *testing.T, status int, body string) {
+	t.Helper()
+	withOrchestratorHeader(t, status, body, "")
+}
+
+// withOrchestratorHeader is withOrchestrator with the stub also answering cid as X-Correlation-ID.
+func withOrchestratorHeader(t *testing.T, status int, body, cid string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if cid != "" {
+			w.Header().Set(correlation.Header, cid)
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	prev := orchestrator
+	orchestrator = srv.URL
+	t.Cleanup(func() { orchestrator = prev })
+}
+
+func postOrchestratedOrder(t *testing.T, requestID string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/orders?flow=orchestrated", strings.NewReader(`{"items":[{"product_id":"mouse-wireless","quantity":1}]}`))
+	req.Header.Set("X-Customer-ID", "user1")
+	if requestID != "" {
+		req.Header.Set(adminauth.RequestIDHeader, requestID)
+	}
+	rec := httptest.NewRecorder()
+	createOrderHandler(rec, req)
+	var body map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec, body
+}
+
+// A failed saga reaches the client as one of two outcomes: rejected with everything undone, or
+// needing attention with the correlation ID of the saga as support reference.
+func TestSagaFailureOutcomes(t *testing.T) {
+	tests := []struct {
+		name      string
+		saga      string
+		header    string // X-Correlation-ID of the orchestrator response
+		outcome   string
+		reference string
+	}{
+		{name: "compensated cleanly", outcome: outcomeRejectedCompensated,
+			saga: `{"order_id":"orc-1","status":"rejected","reason":"payment declined","reason_code":"GATEWAY_DECLINED","compensations":["CANCEL_RESERVATION"],"correlation_id":"cid-42"}`},
+		{name: "compensation failed", outcome: outcomeNeedsAttention, reference: "cid-42",
+			saga: `{"order_id":"orc-1","status":"rejected","reason":"payment declined","reason_code":"GATEWAY_DECLINED","compensation_failed":true,"correlation_id":"cid-42"}`},
+		{name: "parked for manual review", outcome: outcomeNeedsAttention, reference: "cid-42",
+			saga: `{"order_id":"orc-1","status":"needs_review","reason":"shipping failed","skipped_compensations":["REVERT_PAYMENT","CANCEL_RESERVATION"],"correlation_id":"cid-42"}`},
+		{name: "confirmation failed after the payment", outcome: outcomeNeedsAttention, reference: "cid-42",
+			saga: `{"order_id":"orc-1","status":"failed_confirmation","reason":"Order confirmation failed, requires manual intervention.","correlation_id":"cid-42"}`},
+		{name: "refund skipped by cancel_only", outcome: outcomeNeedsAttention, reference: "cid-42",
+			saga: `{"order_id":"orc-1","status":"rejected","reason":"shipping failed","compensations":["CANCEL_RESERVATION"],"skipped_compensations":["REVERT_PAYMENT"],"correlation_id":"cid-42"}`},
+		{name: "reference from the response header", outcome: outcomeNeedsAttention, reference: "cid-header", header: "cid-header",
+			saga: `{"order_id":"orc-1","status":"rejected","reason":"payment declined","compensation_failed":true}`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			withOrchestratorHeader(t, http.StatusConflict, tc.saga, tc.header)
+			rec, body := postOrchestratedOrder(t, "req-42")
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("answered %d, want 409", rec.Code)
+			}
+			if body["outcome"] != tc.outcome || body["order_id"] != "orc-1" || body["message"] == "" {
+				t.Errorf("body = %v, want outcome %s for orc-1 with a message", body, tc.outcome)
+			}
+			ref, hasRef := body["support_reference"]
+			if hasRef != (tc.reference != "") || (hasRef && (ref != tc.reference || !strings.Contains(body["message"].(string), tc.reference))) {
+				t.Errorf("support reference %v in %v, want %q only when attention is needed", ref, body, tc.reference)
+			}
+			if tc.outcome == outcomeNeedsAttention && strings.Contains(body["message"].(string), "Nothing was charged") {
+				t.Errorf("message %q tells the client nothing was charged", body["message"])
+			}
+			if got := rec.Header().Get(adminauth.RequestIDHeader); got != "req-42" {
+				t.Errorf("request id header %q", got)
+			}
+		})
+	}
+}
+
+func TestSagaOutcomePassThrough(t *testing.T) {
+	t.Run("approved order relayed as is", func(t *testing.T) {
+		withOrchestrator(t, http.StatusOK, `{"order_id":"orc-2","status":"approved"}`)
+		rec, body := postOrchestratedOrder(t, "")
+		if rec.Code != http.StatusOK || body["status"] != "approved" || body["outcome"] != nil {
+			t.Errorf("answered %d %v, want the approved order unchanged", rec.Code, body)
+		}
+		if rec.Header().Get(adminauth.RequestIDHeader) == "" {
+			t.Error("no request id generated for the support reference")
+		}
+	})
+	t.Run("undecodable failure", func(t *testing.T) {
+		withOrchestrator(t, http.StatusConflict, `not json`)
+		if rec, _ := postOrchestratedOrder(t, ""); rec.Code != http.StatusBadGateway {
+			t.Errorf("answered %d, want 502", rec.Code)
+		}
+	})
+	t.Run("choreographed conflicts are not mapped", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"reason_code":"X","message":"y"}`))
+		}))
+		defer upstream.Close()
+		prev := chOrder
+		chOrder = upstream.URL
+		defer func() { chOrder = prev }()
+
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"items":[{"product_id":"mouse-wireless","quantity":1}]}`))
+		req.Header.Set("X-Customer-ID", "user1")
+		rec := httptest.NewRecorder()
+		createOrderHandler(rec, req)
+		if rec.Code != http.StatusConflict || strings.Contains(rec.Body.String(), "outcome") {
+			t.Errorf("answered %d %s, want the upstream conflict unchanged", rec.Code, rec.Body)
+		}
+	})
+}
+
+// The shortages of a saga rejected for lack of stock reach the client, so it can retry with less.
+func TestSagaFailureShortages(t *testing.T) {
+	withOrchestrator(t, http.StatusConflict, `{"order_id":"orc-3","status":"rejected","reason":"Insufficient quantity for mouse-wireless","reason_code":"INSUFFICIENT_STOCK",`+
+		`"shortages":[{"product_id":"mouse-wireless","requested":5,"available":2,"suggested_quantity":2}]}`)
+	rec, _ := postOrchestratedOrder(t, "")
+	var body struct {
+		ReasonCode string                 `json:"reason_code"`
+		Shortages  []events.StockShortage `json:"shortages"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	want := events.StockShortage{ProductID: "mouse-wireless", Requested: 5, Available: 2, SuggestedQuantity: 2}
+	if body.ReasonCode != events.ReasonInsufficientQty || len(body.Shortages) != 1 || body.Shortages[0] != want {
+		t.Errorf("answered %d %+v, want the shortage", rec.Code, body)
+	}
+}
+
+// A duplicate sent while the first saga of its Idempotency-Key still runs is relayed as in
+// progress, not as a finished saga: the first one may still charge the customer.
+func TestSagaDuplicateInFlight(t *testing.T) {
+	inFlight := `{"reason_code":"REQUEST_IN_PROGRESS","message":"A request with this Idempotency-Key is still in progress","order_id":"orc-5"}`
+	withOrchestrator(t, http.StatusConflict, inFlight)
+	rec, body := postOrchestratedOrder(t, "")
+	if rec.Code != http.StatusConflict || strings.TrimSpace(rec.Body.String()) != inFlight {
+		t.Errorf("answered %d %s, want the in-progress conflict unchanged", rec.Code, rec.Body)
+	}
+	if body["outcome"] != nil {
+		t.Errorf("in-progress duplicate reported with outcome %v", body["outcome"])
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/chaos"
+	"github.com/StitchMl/saga-demo/common/payment_gateway"
+)
+
+// withChaosServices points the orchestrated order, inventory and payment URLs at services
+// serving the real /admin/chaos, and returns the calls each one received.
+func withChaosServices(t *testing.T) func() map[string][]string {
+	t.Helper()
+	adminauth.SetTokens("admin-secret")
+	t.Cleanup(func() { adminauth.SetTokens("") })
+	chaos.Clear()
+	t.Cleanup(chaos.Clear)
+
+	var mu sync.Mutex
+	calls := make(map[string][]string)
+	service := func(name string) string {
+		guarded := adminauth.Require(chaos.AdminHandler)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			calls[name] = append(calls[name], r.Method+" "+r.URL.Path)
+			mu.Unlock()
+			guarded(w, r)
+		}))
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+	prevOrder, prevInv, prevPayment := orOrder, orInv, orPayment
+	orOrder, orInv, orPayment = service("order"), service("inventory"), service("payment")
+	t.Cleanup(func() { orOrder, orInv, orPayment = prevOrder, prevInv, prevPayment })
+	return func() map[string][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		out := calls
+		calls = make(map[string][]string)
+		return out
+	}
+}
+
+func callScenario(method, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/admin/scenario", strings.NewReader(body))
+	req.Header.Set(adminauth.Header, "admin-secret")
+	rec := httptest.NewRecorder()
+	adminauth.Require(scenarioHandler)(rec, req)
+	return rec
+}
+
+// The payment-declined scenario clears every service and arms the payment service only: the
+// next payment is declined, and nothing stays armed after it.
+func TestScenarioPaymentDeclined(t *testing.T) {
+	calls := withChaosServices(t)
+	chaos.Arm(chaos.FaultReservation, 3) // left over from an earlier demo
+
+	if rec := callScenario(http.MethodPost, `{"name":"payment-declined"}`); rec.Code != http.StatusOK {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	got := calls()
+	for _, name := range []string{"order", "inventory"} {
+		if strings.Join(got[name], ",") != "DELETE /admin/chaos" {
+			t.Errorf("%s service received %v, want its faults cleared only", name, got[name])
+		}
+	}
+	if strings.Join(got["payment"], ",") != "DELETE /admin/chaos,POST /admin/chaos" {
+		t.Errorf("payment service received %v, want cleared then armed", got["payment"])
+	}
+	if armed := chaos.Armed(); len(armed) != 1 || armed[chaos.FaultPayment] != 1 {
+		t.Fatalf("armed = %v, want one payment failure", armed)
+	}
+
+	err := payment_gateway.ProcessPayment("scenario-declined", "customer-1", 10)
+	if !errors.Is(err, payment_gateway.ErrInjectedFailure) {
+		t.Errorf("first payment: %v, want the injected failure", err)
+	}
+	if chaos.Take(chaos.FaultPayment) || chaos.Take(chaos.FaultReservation) {
+		t.Error("faults still armed after the scenario's payment")
+	}
+}
+
+func TestScenarioErrors(t *testing.T) {
+	calls := withChaosServices(t)
+
+	rec := callScenario(http.MethodPost, `{"name":"no-such-scenario"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown scenario answered %d, want 404", rec.Code)
+	}
+	if got := calls(); len(got) != 0 {
+		t.Errorf("unknown scenario called %v", got)
+	}
+
+	var listed map[string]scenario
+	if rec := callScenario(http.MethodGet, ""); rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&listed) != nil || len(listed) != 3 {
+		t.Errorf("GET answered %d with %v, want the three built-in scenarios", rec.Code, listed)
+	}
+
+	orPayment = "http://127.0.0.1:1"
+	if rec := callScenario(http.MethodPost, `{"name":"payment-declined"}`); rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), orPayment) {
+		t.Errorf("scenario with the payment service down answered %d: %s", rec.Code, rec.Body)
+	}
+
+	chaos.Arm(chaos.FaultConfirmation, 1)
+	orPayment = ""
+	if rec := callScenario(http.MethodDelete, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE answered %d: %s", rec.Code, rec.Body)
+	}
+	if armed := chaos.Armed(); len(armed) != 0 {
+		t.Errorf("armed = %v after DELETE", armed)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// logCapture collects the output of the standard logger.
+type logCapture struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func captureLog(t *testing.T) *logCapture {
+	t.Helper()
+	c := &logCapture{}
+	prev := log.Writer()
+	log.SetOutput(c)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	return c
+}
+
+func (c *logCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Write(p)
+}
+
+func (c *logCapture) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.String()
+}
+
+// pausedAfterPayment stands in for the services like fakeServices, but holds the commit of the
+// reservation, the step right after a successful payment, until resume is closed. It sends the
+// order id on paid once the payment went through.
+func pausedAfterPayment(t *testing.T, services *fakeServices) (paid chan string, resume chan struct{}) {
+	t.Helper()
+	paid, resume = make(chan string, 1), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/commit_reservation" {
+			var req events.InventoryRequestPayload
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			paid <- req.OrderID
+			<-resume
+		}
+		services.serve(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	appConfig.OrderServiceURL, appConfig.InventoryServiceURL, appConfig.PaymentServiceURL, appConfig.AuthServiceURL = srv.URL, srv.URL, srv.URL, srv.URL
+	return paid, resume
+}
+
+func waitSagaState(t *testing.T, orderID string) SagaState {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sagaStates.RLock()
+		state, ok := sagaStates.Data[orderID]
+		var snapshot SagaState
+		if ok {
+			snapshot = *state
+		}
+		sagaStates.RUnlock()
+		if ok && !snapshot.Running {
+			return snapshot
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("saga %s still running", orderID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// A client that goes away right after the payment succeeded leaves the saga running: it
+// approves the order in the background, records the outcome in the saga state store, and logs
+// that the client never saw it. A request deadline is told apart from a disconnect.
+func TestAbandonedSagaCompletes(t *testing.T) {
+	tests := []struct {
+		name  string
+		cause error
+		log   string
+	}{
+		{name: "client disconnected", cause: context.Canceled, log: "the saga ended with status approved (payment completed: true)"},
+		{name: "request deadline", cause: context.DeadlineExceeded, log: "saga completed anyway with status approved"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			services := newFakeServices(t)
+			paid, resume := pausedAfterPayment(t, services)
+			logs := captureLog(t)
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/create_order",
+				strings.NewReader(`{"customer_id":"user1","items":[{"product_id":"mouse-wireless","quantity":1}]}`)).WithContext(ctx)
+			returned := make(chan struct{})
+			go func() {
+				createOrderHandler(rec, req)
+				close(returned)
+			}()
+
+			var orderID string
+			select {
+			case orderID = <-paid:
+			case <-time.After(2 * time.Second):
+				t.Fatal("the saga never got past the payment")
+			}
+			cancel(tc.cause)
+			select {
+			case <-returned:
+			case <-time.After(2 * time.Second):
+				t.Fatal("the handler kept waiting for the abandoned saga")
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("the abandoned request got a response: %s", rec.Body)
+			}
+
+			close(resume)
+			state := waitSagaState(t, orderID)
+			if state.OrderStatus != "approved" || len(state.Compensations) != 0 {
+				t.Errorf("saga state = %+v, want the order approved without compensations", state)
+			}
+			deadline := time.Now().Add(2 * time.Second)
+			for !strings.Contains(logs.String(), tc.log) {
+				if time.Now().After(deadline) {
+					t.Fatalf("no %q in the log:\n%s", tc.log, logs)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func postBatchStatus(t *testing.T, ids ...string) (*httptest.ResponseRecorder, map[string]BatchStatus) {
+	t.Helper()
+	body, _ := json.Marshal(map[string][]string{"order_ids": ids})
+	rec := httptest.NewRecorder()
+	batchStatusHandler(rec, httptest.NewRequest(http.MethodPost, "/saga/status/batch", strings.NewReader(string(body))))
+	var out map[string]BatchStatus
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec, out
+}
+
+// Known sagas come back with their state from the store, unknown ids with not_found, and no
+// downstream service is called.
+func TestBatchStatusMixedIDs(t *testing.T) {
+	services := newFakeServices(t)
+	appConfig.StatusBatchMax = 10
+	updated := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	sagaStates.Lock()
+	sagaStates.Data["batch-running"] = &SagaState{OrderID: "batch-running", Step: "PROCESS_PAYMENT", Running: true, UpdatedAt: updated}
+	sagaStates.Data["batch-approved"] = &SagaState{OrderID: "batch-approved", Step: "CONFIRM_ORDER", OrderStatus: "approved", UpdatedAt: updated}
+	sagaStates.Unlock()
+	t.Cleanup(func() {
+		sagaStates.Lock()
+		delete(sagaStates.Data, "batch-running")
+		delete(sagaStates.Data, "batch-approved")
+		sagaStates.Unlock()
+	})
+
+	rec, out := postBatchStatus(t, "batch-running", "batch-unknown", "batch-approved")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	if len(out) != 3 {
+		t.Fatalf("%d entries, want 3: %+v", len(out), out)
+	}
+	if s := out["batch-running"]; s.State != "running" || s.LastStep != "PROCESS_PAYMENT" || s.UpdatedAt == nil || !s.UpdatedAt.Equal(updated) || s.NotFound {
+		t.Errorf("running saga = %+v", s)
+	}
+	if s := out["batch-approved"]; s.State != "approved" || s.LastStep != "CONFIRM_ORDER" || s.NotFound {
+		t.Errorf("finished saga = %+v", s)
+	}
+	if s := out["batch-unknown"]; s != (BatchStatus{NotFound: true}) {
+		t.Errorf("unknown id = %+v, want only not_found", s)
+	}
+	if calls := services.Calls(); len(calls) != 0 {
+		t.Errorf("downstream calls %v", calls)
+	}
+}
+
+func TestBatchStatusCap(t *testing.T) {
+	newFakeServices(t)
+	appConfig.StatusBatchMax = 2
+
+	if rec, out := postBatchStatus(t, "a", "b"); rec.Code != http.StatusOK || len(out) != 2 {
+		t.Errorf("a batch at the cap answered %d with %d entries", rec.Code, len(out))
+	}
+	rec, _ := postBatchStatus(t, "a", "b", "c")
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("answered %d over the cap, want 413", rec.Code)
+	}
+	var resp events.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.ReasonCode != events.ReasonTooManyItems {
+		t.Errorf("error = %+v (%v)", resp, err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// A call retried after two 503s is recorded once, with every attempt, the final status, the
+// time spent in the downstream service and the waits between the attempts.
+func TestCallLogThroughRetries(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	appConfig.MaxCallsPerSaga = 10
+
+	ctx, collector := withCallCollector(context.Background())
+	policy := StepPolicy{MaxAttempts: 3, Timeout: time.Second, Backoff: 10 * time.Millisecond}
+	if err := makeServiceCall(ctx, policy, srv.URL+"/process", map[string]string{"order_id": "order-1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	calls, dropped := collector.snapshot()
+	if len(calls) != 1 || dropped != 0 {
+		t.Fatalf("recorded %d calls (%d dropped), want the retried call once", len(calls), dropped)
+	}
+	call := calls[0]
+	if call.URL != srv.URL+"/process" || call.Attempts != 3 || call.StatusCode != http.StatusOK || call.Error != "" {
+		t.Errorf("call = %+v, want 3 attempts ending in 200", call)
+	}
+	// Backoffs of 10ms then 20ms, on top of 3 answers taking 20ms each.
+	if call.RetryWaitMs != 30 {
+		t.Errorf("retry wait = %dms, want 30ms", call.RetryWaitMs)
+	}
+	if call.DurationMs < 90 {
+		t.Errorf("duration = %dms, want at least the 60ms of answers and the 30ms of waits", call.DurationMs)
+	}
+}
+
+// The call log of a saga is capped; the calls over the cap are counted, and both are served
+// by /saga/{id}.
+func TestCallLogCap(t *testing.T) {
+	newFakeServices(t)
+	appConfig.MaxCallsPerSaga = 2
+
+	order := newSagaOrder(events.Order{CustomerID: "user1", Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 1}}})
+	result, _ := executeOrderSaga(correlation.NewID(), order)
+	if result.Order.Status != "approved" {
+		t.Fatalf("saga ended %q", result.Order.Status)
+	}
+	if len(result.Calls) != 2 {
+		t.Fatalf("saga result lists %d calls, want the cap of 2", len(result.Calls))
+	}
+
+	rec := httptest.NewRecorder()
+	sagaHandler(rec, httptest.NewRequest(http.MethodGet, "/saga/"+order.OrderID, nil))
+	var status struct {
+		Calls        []CallRecord `json:"calls"`
+		CallsDropped int          `json:"calls_dropped"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("decoding /saga/%s (%d): %v", order.OrderID, rec.Code, err)
+	}
+	if len(status.Calls) != 2 || status.CallsDropped == 0 {
+		t.Errorf("/saga/%s lists %d calls, %d dropped; want 2 and the rest dropped", order.OrderID, len(status.Calls), status.CallsDropped)
+	}
+	if status.Calls[0].URL != result.Calls[0].URL {
+		t.Errorf("first call %s, result says %s", status.Calls[0].URL, result.Calls[0].URL)
+	}
+}
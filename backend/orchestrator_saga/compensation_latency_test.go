@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/correlation"
+	"github.com/StitchMl/saga-demo/common/metrics"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func TestCompensationWindow(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	tests := []struct {
+		name   string
+		events []SagaEvent
+		step   string
+		window time.Duration
+		ok     bool
+	}{
+		{name: "approved", events: []SagaEvent{
+			{Step: "PROCESS_PAYMENT", Status: "completed", Timestamp: at(0)},
+		}},
+		{name: "compensated", ok: true, step: "PROCESS_PAYMENT", window: 1200 * time.Millisecond, events: []SagaEvent{
+			{Step: "RESERVE_INVENTORY", Status: "completed", Timestamp: at(0)},
+			{Step: "PROCESS_PAYMENT", Status: "failed", Timestamp: at(300)},
+			{Step: "SAGA_COMPENSATION", Status: "started", Timestamp: at(400)},
+			{Step: "CANCEL_RESERVATION", Status: "failed", Timestamp: at(900)},
+			{Step: "CONFIRM_ORDER", Status: "failed", Timestamp: at(1000)},
+			{Step: "SAGA_COMPENSATION", Status: "completed", Timestamp: at(1500)},
+		}},
+		{name: "compensation not finished", events: []SagaEvent{
+			{Step: "PROCESS_PAYMENT", Status: "failed", Timestamp: at(0)},
+			{Step: "SAGA_COMPENSATION", Status: "started", Timestamp: at(10)},
+		}},
+		{name: "parked", events: []SagaEvent{
+			{Step: "PROCESS_PAYMENT", Status: "failed", Timestamp: at(0)},
+			{Step: "SAGA_COMPENSATION", Status: "parked", Timestamp: at(10)},
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			step, window, ok := compensationWindow(tc.events)
+			if step != tc.step || window != tc.window || ok != tc.ok {
+				t.Errorf("window = %s, %s, %t, want %s, %s, %t", step, window, ok, tc.step, tc.window, tc.ok)
+			}
+		})
+	}
+}
+
+// The window runs from the payment failure to the end of the compensation, on the saga clock,
+// and lands in the saga result, the histogram and /saga/stats.
+func TestCompensationLatencyMeasured(t *testing.T) {
+	services := newFakeServices(t)
+	services.Fail["/process"] = http.StatusBadRequest
+	fake := withFakeSagaClock(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cancel_reservation" {
+			fake.Advance(750 * time.Millisecond)
+		}
+		services.serve(w, r)
+	}))
+	defer srv.Close()
+	appConfig.InventoryServiceURL = srv.URL
+	before := compensationLatency.Snapshot()["PROCESS_PAYMENT"]
+
+	result, err := executeOrderSaga(correlation.NewID(), newSagaOrder(events.Order{
+		CustomerID: "user1",
+		Items:      []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 1}},
+	}))
+	if err == nil {
+		t.Fatal("the saga succeeded with the payment failing")
+	}
+	if result.FailedStep != "PROCESS_PAYMENT" || result.CompensationLatencyMs != 750 {
+		t.Errorf("failed step %s, compensation latency %dms, want PROCESS_PAYMENT and 750ms", result.FailedStep, result.CompensationLatencyMs)
+	}
+
+	rec := httptest.NewRecorder()
+	sagaStatsHandler(rec, httptest.NewRequest(http.MethodGet, "/saga/stats", nil))
+	var stats struct {
+		Latency map[string]metrics.Snapshot `json:"compensation_latency_ms"`
+	}
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&stats) != nil {
+		t.Fatalf("/saga/stats answered %d: %s", rec.Code, rec.Body)
+	}
+	after := stats.Latency["PROCESS_PAYMENT"]
+	if after.Count != before.Count+1 || after.Sum != before.Sum+750 {
+		t.Errorf("histogram went from %d observations summing %.0f to %d summing %.0f, want one more of 750",
+			before.Count, before.Sum, after.Count, after.Sum)
+	}
+}
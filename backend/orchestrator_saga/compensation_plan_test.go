@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+type compensationPlan struct {
+	OrderID  string                `json:"order_id"`
+	Strategy string                `json:"strategy"`
+	Actions  []PlannedCompensation `json:"actions"`
+}
+
+func getCompensationPlan(t *testing.T, orderID string) (int, compensationPlan) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	sagaHandler(rec, httptest.NewRequest(http.MethodGet, "/saga/"+orderID+"/compensation_plan", nil))
+	var plan compensationPlan
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&plan); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, plan
+}
+
+// stoppedSaga records a saga whose completed steps went through and which stopped while running
+// the stuck one, as a saga interrupted there would leave it.
+func stoppedSaga(completed []string, stuck string) events.Order {
+	order := events.Order{
+		OrderID: "plan-" + correlation.NewID(),
+		Status:  "pending",
+		Items:   []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 2}},
+		Total:   99,
+	}
+	saveSagaOrder(order)
+	for _, step := range completed {
+		logSagaEvent(order.OrderID, step, "started", "")
+		logSagaEvent(order.OrderID, step, "completed", "")
+	}
+	logSagaEvent(order.OrderID, stuck, "started", "")
+	return order
+}
+
+// For a saga stopped at each step, the plan lists the compensations of the steps completed so
+// far, most recent first, and calls none of them.
+func TestCompensationPlanAtEachStep(t *testing.T) {
+	tests := []struct {
+		name      string
+		completed []string
+		stuck     string
+		actions   []string
+	}{
+		{name: "creating the order", stuck: "CREATE_ORDER"},
+		{name: "checking the order", completed: []string{"CREATE_ORDER"}, stuck: "VALIDATE_CUSTOMER", actions: []string{"REJECT_ORDER"}},
+		{name: "reserving", completed: []string{"CREATE_ORDER", "VALIDATE_CUSTOMER", "GET_PRICES", "GET_SHIPPING_QUOTE"},
+			stuck: "RESERVE_INVENTORY", actions: []string{"REJECT_ORDER"}},
+		{name: "paying", completed: []string{"CREATE_ORDER", "VALIDATE_CUSTOMER", "GET_PRICES", "GET_SHIPPING_QUOTE", "RESERVE_INVENTORY"},
+			stuck: "PROCESS_PAYMENT", actions: []string{"CANCEL_RESERVATION", "REJECT_ORDER"}},
+		{name: "committing", completed: []string{"CREATE_ORDER", "VALIDATE_CUSTOMER", "GET_PRICES", "GET_SHIPPING_QUOTE", "RESERVE_INVENTORY", "PROCESS_PAYMENT"},
+			stuck: "COMMIT_RESERVATION", actions: []string{"REVERT_PAYMENT", "CANCEL_RESERVATION", "REJECT_ORDER"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			services := newFakeServices(t)
+			appConfig.CompensationStrategy = strategyFull
+			order := stoppedSaga(tc.completed, tc.stuck)
+
+			code, plan := getCompensationPlan(t, order.OrderID)
+			if code != http.StatusOK {
+				t.Fatalf("answered %d", code)
+			}
+			var steps []string
+			for _, action := range plan.Actions {
+				steps = append(steps, action.Step)
+				if action.AlreadyRan || action.SkippedByStrategy {
+					t.Errorf("%s flagged as already run or skipped", action.Step)
+				}
+			}
+			if !slices.Equal(steps, tc.actions) {
+				t.Errorf("plan %v, want %v", steps, tc.actions)
+			}
+			if calls := services.Calls(); len(calls) != 0 {
+				t.Errorf("the dry run called %v", calls)
+			}
+		})
+	}
+}
+
+func TestCompensationPlanDetails(t *testing.T) {
+	services := newFakeServices(t)
+	appConfig.CompensationStrategy = strategyRefundOnly
+	order := stoppedSaga([]string{"CREATE_ORDER", "RESERVE_INVENTORY", "PROCESS_PAYMENT"}, "COMMIT_RESERVATION")
+
+	_, plan := getCompensationPlan(t, order.OrderID)
+	if plan.OrderID != order.OrderID || plan.Strategy != strategyRefundOnly || len(plan.Actions) != 3 {
+		t.Fatalf("plan = %+v", plan)
+	}
+	wantURLs := []string{appConfig.PaymentServiceURL + "/revert", appConfig.InventoryServiceURL + "/cancel_reservation", appConfig.OrderServiceURL + "/update_status"}
+	for i, action := range plan.Actions {
+		if action.TargetURL != wantURLs[i] {
+			t.Errorf("%s targets %s, want %s", action.Step, action.TargetURL, wantURLs[i])
+		}
+		if action.SkippedByStrategy != (action.Step == "CANCEL_RESERVATION") {
+			t.Errorf("%s skipped by refund_only = %t", action.Step, action.SkippedByStrategy)
+		}
+	}
+	payload, _ := json.Marshal(plan.Actions[1].Payload)
+	var cancel events.InventoryRequestPayload
+	if err := json.Unmarshal(payload, &cancel); err != nil || cancel.OrderID != order.OrderID || !slices.Equal(cancel.Items, order.Items) {
+		t.Errorf("cancellation payload %s, want the order and its items", payload)
+	}
+
+	appConfig.CompensationStrategy = strategyManual
+	if _, plan := getCompensationPlan(t, order.OrderID); len(plan.Actions) != 0 {
+		t.Errorf("manual strategy plans %+v, want nothing", plan.Actions)
+	}
+	if code, _ := getCompensationPlan(t, "plan-unknown"); code != http.StatusNotFound {
+		t.Errorf("unknown saga answered %d, want 404", code)
+	}
+	if calls := services.Calls(); len(calls) != 0 {
+		t.Errorf("the dry run called %v", calls)
+	}
+}
+
+// After a saga compensated itself, the plan flags every compensation as already run.
+func TestCompensationPlanAfterCompensation(t *testing.T) {
+	services := newFakeServices(t)
+	appConfig.CompensationStrategy = strategyFull
+	services.Fail["/process"] = http.StatusBadRequest
+
+	result, err := executeOrderSaga(correlation.NewID(), newSagaOrder(events.Order{
+		CustomerID: "user1",
+		Items:      []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 1}},
+	}))
+	if err == nil {
+		t.Fatal("the saga succeeded with the payment failing")
+	}
+	callsAfterSaga := len(services.Calls())
+
+	_, plan := getCompensationPlan(t, result.OrderID)
+	var steps []string
+	for _, action := range plan.Actions {
+		steps = append(steps, action.Step)
+		if !action.AlreadyRan {
+			t.Errorf("%s not flagged as already run", action.Step)
+		}
+	}
+	if !slices.Equal(steps, []string{"CANCEL_RESERVATION", "REJECT_ORDER"}) {
+		t.Errorf("plan %v, want the reservation and order compensations", steps)
+	}
+	if n := len(services.Calls()); n != callsAfterSaga {
+		t.Errorf("the dry run made %d calls", n-callsAfterSaga)
+	}
+}
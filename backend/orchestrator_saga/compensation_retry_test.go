@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// failingFirst fails the first call of each path in fail with 502, then lets it through.
+func failingFirst(t *testing.T, services *fakeServices, fail ...string) {
+	failed := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		services.mu.Lock()
+		first := slices.Contains(fail, r.URL.Path) && !failed[r.URL.Path]
+		failed[r.URL.Path] = true
+		if first {
+			services.Fail[r.URL.Path] = http.StatusBadGateway
+		} else {
+			delete(services.Fail, r.URL.Path)
+		}
+		services.mu.Unlock()
+		services.serve(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	appConfig.OrderServiceURL = srv.URL
+	appConfig.InventoryServiceURL = srv.URL
+	appConfig.PaymentServiceURL = srv.URL
+}
+
+// paidSaga logs a saga that got past the payment, so compensateSaga has every step to undo.
+func paidSaga() events.Order {
+	order := events.Order{OrderID: newOrderID(), CustomerID: "user1", Total: 20,
+		Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 2}}}
+	for _, step := range []string{"CREATE_ORDER", "RESERVE_INVENTORY", "PROCESS_PAYMENT"} {
+		logSagaEvent(order.OrderID, step, "completed", step+" done")
+	}
+	return order
+}
+
+func retryDeadLetters(t *testing.T, orderID string) (int, map[string]string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	retryDeadLetterHandler(rec, httptest.NewRequest(http.MethodPost, "/saga/dead-letters/"+orderID+"/retry", nil))
+	var body struct {
+		Results []struct {
+			Compensation string `json:"compensation"`
+			Status       string `json:"status"`
+		} `json:"retried"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	statuses := make(map[string]string)
+	for _, res := range body.Results {
+		statuses[res.Compensation] = res.Status
+	}
+	return rec.Code, statuses
+}
+
+// A refund failing during the compensation is kept as a dead letter while the other
+// compensations go on; the retry runs only the refund, which the payment service accepts the
+// second time, and a later retry has nothing left to run.
+func TestRetryFailedRefund(t *testing.T) {
+	services := newFakeServices(t)
+	appConfig.CompensationStrategy = strategyFull
+	failingFirst(t, services, "/revert")
+	order := paidSaga()
+
+	if status := compensateSaga(context.Background(), order.OrderID, order, "test failure"); status != "rejected" {
+		t.Fatalf("compensation left the order %q, want rejected", status)
+	}
+	if calls, want := services.Calls(), []string{"/revert", "/cancel_reservation", "/update_status rejected"}; !slices.Equal(calls, want) {
+		t.Fatalf("compensation calls = %v, want %v", calls, want)
+	}
+	deadLetters.Lock()
+	_, parked := deadLetters.Entries[order.OrderID+"/REVERT_PAYMENT"]
+	deadLetters.Unlock()
+	if !parked {
+		t.Fatal("the failed refund is not a dead letter")
+	}
+
+	code, statuses := retryDeadLetters(t, order.OrderID)
+	if code != http.StatusOK || statuses["REVERT_PAYMENT"] != "compensated" || len(statuses) != 1 {
+		t.Errorf("retry answered %d %v, want only REVERT_PAYMENT compensated", code, statuses)
+	}
+	if n := countCalls(services.Calls(), "/revert"); n != 2 {
+		t.Errorf("refund called %d times, want 2", n)
+	}
+	if code, _ := retryDeadLetters(t, order.OrderID); code != http.StatusNotFound {
+		t.Errorf("second retry answered %d, want 404 with nothing left", code)
+	}
+
+	// A dead letter left behind for a refund the saga log shows as done is dropped unrun.
+	addDeadLetter(order, "REVERT_PAYMENT", "test failure", context.DeadlineExceeded)
+	if _, statuses := retryDeadLetters(t, order.OrderID); statuses["REVERT_PAYMENT"] != "already_compensated" {
+		t.Errorf("stale dead letter retried as %v, want already_compensated", statuses)
+	}
+	if n := countCalls(services.Calls(), "/revert"); n != 2 {
+		t.Errorf("refund called %d times after the stale dead letter, want still 2", n)
+	}
+}
+
+// The retry runs the failed compensations in the reverse order of the saga steps, as the
+// compensation itself did.
+func TestRetryDeadLettersInSagaOrder(t *testing.T) {
+	services := newFakeServices(t)
+	appConfig.CompensationStrategy = strategyFull
+	failingFirst(t, services, "/revert", "/cancel_reservation", "/update_status")
+	order := paidSaga()
+	compensateSaga(context.Background(), order.OrderID, order, "test failure")
+	before := len(services.Calls())
+
+	code, statuses := retryDeadLetters(t, order.OrderID)
+	if code != http.StatusOK || len(statuses) != 3 {
+		t.Fatalf("retry answered %d %v, want the three compensations", code, statuses)
+	}
+	want := []string{"/revert", "/cancel_reservation", "/update_status rejected"}
+	if calls := services.Calls()[before:]; !slices.Equal(calls, want) {
+		t.Errorf("retry calls = %v, want %v", calls, want)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Each strategy runs its own compensations against a saga that failed after the payment, and
+// leaves the order in the state the README documents.
+func TestCompensationStrategies(t *testing.T) {
+	tests := []struct {
+		strategy string
+		calls    []string
+		status   string
+		skipped  []string
+	}{
+		{strategy: strategyFull, calls: []string{"/revert", "/cancel_reservation", "/update_status rejected"}, status: "rejected"},
+		{strategy: strategyRefundOnly, calls: []string{"/revert", "/update_status rejected"}, status: "rejected",
+			skipped: []string{"CANCEL_RESERVATION"}},
+		{strategy: strategyCancelOnly, calls: []string{"/cancel_reservation", "/update_status rejected"}, status: "rejected",
+			skipped: []string{"REVERT_PAYMENT"}},
+		{strategy: strategyManual, calls: []string{"/update_status needs_review"}, status: "needs_review",
+			skipped: []string{"REVERT_PAYMENT", "CANCEL_RESERVATION", "REJECT_ORDER"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.strategy, func(t *testing.T) {
+			services := newFakeServices(t)
+			appConfig.CompensationStrategy = tc.strategy
+			orderID := "compensate-" + tc.strategy + "-" + correlation.NewID()
+			for _, step := range []string{"CREATE_ORDER", "RESERVE_INVENTORY", "PROCESS_PAYMENT"} {
+				logSagaEvent(orderID, step, "completed", "done")
+			}
+			order := events.Order{OrderID: orderID, Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 1}}}
+
+			status := compensateSaga(context.Background(), orderID, order, "shipping failed")
+			if status != tc.status {
+				t.Errorf("order left %q, want %q", status, tc.status)
+			}
+			result := SagaResult{Order: events.Order{OrderID: orderID, Status: status}}
+			summarizeSaga(&result)
+			if !slices.Equal(result.SkippedCompensations, tc.skipped) {
+				t.Errorf("skipped compensations %v, want %v", result.SkippedCompensations, tc.skipped)
+			}
+			if got := services.Calls(); !slices.Equal(got, tc.calls) {
+				t.Errorf("service calls %v, want %v", got, tc.calls)
+			}
+
+			reviewQueue.RLock()
+			entry, parked := reviewQueue.Entries[orderID]
+			reviewQueue.RUnlock()
+			if parked != (tc.strategy == strategyManual) {
+				t.Fatalf("parked for review = %t with strategy %s", parked, tc.strategy)
+			}
+			if parked && len(entry.CompletedSteps) != 3 {
+				t.Errorf("review entry lists %v, want the 3 completed steps", entry.CompletedSteps)
+			}
+			deadLetters.Lock()
+			for key := range deadLetters.Entries {
+				if strings.HasPrefix(key, orderID+"/") {
+					t.Errorf("dead letter %s after successful compensations", key)
+				}
+			}
+			deadLetters.Unlock()
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// A retry logs saga events, which prune the saga tables once the prune interval has passed; the
+// prune reads the dead letters, so the retry must not hold their lock meanwhile.
+func TestRetryDeadLetterAfterPruneInterval(t *testing.T) {
+	payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer payment.Close()
+	appConfig = Config{
+		PaymentServiceURL: payment.URL,
+		SagaLogRetention:  time.Hour,
+		StepPolicies:      map[string]StepPolicy{policyCompensation: {MaxAttempts: 1, Timeout: time.Second}},
+	}
+
+	// A saga finished long ago, so that the prune has something to drop. The IDs are new on
+	// every run, as the saga log remembers the compensations of the previous ones.
+	orderID, expiredID := newOrderID(), newOrderID()
+	finished := time.Now().Add(-2 * time.Hour)
+	sagaStates.Lock()
+	sagaStates.Data[expiredID] = &SagaState{OrderID: expiredID, FinishedAt: &finished}
+	sagaStates.Unlock()
+	sagaLog.Lock()
+	sagaLog.LastPrune = time.Now().Add(-2 * sagaPruneInterval)
+	sagaLog.Unlock()
+	addDeadLetter(events.Order{OrderID: orderID}, "REVERT_PAYMENT", "payment declined", errors.New("payment service down"))
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		retryDeadLetterHandler(rec, httptest.NewRequest(http.MethodPost, "/saga/dead-letters/"+orderID+"/retry", nil))
+		done <- rec
+	}()
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusOK {
+			t.Fatalf("retry answered %d: %s", rec.Code, rec.Body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry of the dead letter did not return: deadlocked with the saga prune")
+	}
+
+	deadLetters.Lock()
+	_, left := deadLetters.Entries[orderID+"/REVERT_PAYMENT"]
+	deadLetters.Unlock()
+	if left {
+		t.Error("dead letter still present after a successful retry")
+	}
+	// The prune runs in the background: wait for it to drop the expired saga.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sagaStates.RLock()
+		_, kept := sagaStates.Data[expiredID]
+		sagaStates.RUnlock()
+		if !kept {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired saga not pruned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// A second retry of the same order while the first one runs is refused rather than run twice.
+func TestRetryDeadLetterConcurrentRetryConflicts(t *testing.T) {
+	release := make(chan struct{})
+	calls := make(chan struct{}, 2)
+	payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer payment.Close()
+	appConfig = Config{
+		PaymentServiceURL: payment.URL,
+		SagaLogRetention:  time.Hour,
+		StepPolicies:      map[string]StepPolicy{policyCompensation: {MaxAttempts: 1, Timeout: 5 * time.Second}},
+	}
+	orderID := newOrderID()
+	addDeadLetter(events.Order{OrderID: orderID}, "REVERT_PAYMENT", "payment declined", errors.New("payment service down"))
+
+	done := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		retryDeadLetterHandler(rec, httptest.NewRequest(http.MethodPost, "/saga/dead-letters/"+orderID+"/retry", nil))
+		done <- rec.Code
+	}()
+	<-calls
+
+	rec := httptest.NewRecorder()
+	retryDeadLetterHandler(rec, httptest.NewRequest(http.MethodPost, "/saga/dead-letters/"+orderID+"/retry", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("concurrent retry answered %d, want %d", rec.Code, http.StatusConflict)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("first retry answered %d, want %d", code, http.StatusOK)
+	}
+	if len(calls) != 0 {
+		t.Error("compensation ran twice")
+	}
+}
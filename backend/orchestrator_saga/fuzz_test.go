@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Any order request is answered: malformed bodies with 400, the others by validation or the saga.
+func FuzzCreateOrderBody(f *testing.F) {
+	for _, seed := range []string{
+		`{"customer_id":"user1","items":[{"product_id":"mouse-wireless","quantity":1}]}`,
+		`null`, `[]`, `{}`, `{"items":null}`, `{"items":[null]}`, `{"items":[{"product_id":"","quantity":-5}]}`,
+		`{"customer_id":"user1","items":[{"product_id":"a","quantity":2147483647},{"product_id":"a","quantity":2147483647}]}`,
+		`{"items":"x"}`, `{"created_at":"never"}`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, body string) {
+		newFakeServices(t)
+		rec := httptest.NewRecorder()
+		createOrderHandler(rec, httptest.NewRequest(http.MethodPost, "/create_order", strings.NewReader(body)))
+		var order events.Order
+		if json.NewDecoder(strings.NewReader(body)).Decode(&order) != nil && rec.Code != http.StatusBadRequest {
+			t.Fatalf("malformed body %q answered %d", body, rec.Code)
+		}
+		if rec.Code >= 500 && rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("body %q answered %d: %s", body, rec.Code, rec.Body)
+		}
+	})
+}
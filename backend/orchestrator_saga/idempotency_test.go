@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+const (
+	mouseOrder    = `{"customer_id":"user1","items":[{"product_id":"mouse-wireless","quantity":1}]}`
+	keyboardOrder = `{"customer_id":"user1","items":[{"product_id":"keyboard-mech","quantity":1}]}`
+)
+
+func postOrder(body, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(idempotencyHeader, key)
+	rec := httptest.NewRecorder()
+	createOrderHandler(rec, req)
+	return rec
+}
+
+// claimFirst forgets every key, then claims key for customer as if a first request with body
+// were still running.
+func claimFirst(t *testing.T, customer, key, body string) {
+	t.Helper()
+	idempotencyKeys.Lock()
+	idempotencyKeys.Entries = make(map[string]*idempotencyEntry)
+	idempotencyKeys.Unlock()
+	var order events.Order
+	if err := json.Unmarshal([]byte(body), &order); err != nil {
+		t.Fatal(err)
+	}
+	scoped := strings.Join([]string{customer, http.MethodPost, "/orders", key}, "|")
+	if _, found := claimIdempotencyKey(scoped, requestFingerprint(order), "order-first"); found {
+		t.Fatalf("key %s already claimed", key)
+	}
+}
+
+func TestIdempotencyKeyReuse(t *testing.T) {
+	claimFirst(t, "user1", "key-1", mouseOrder)
+
+	tests := []struct {
+		name   string
+		body   string
+		code   int
+		reason string
+	}{
+		{name: "same request", body: mouseOrder, code: http.StatusConflict, reason: events.ReasonInProgress},
+		{name: "same request reformatted", body: strings.ReplaceAll(mouseOrder, ",", ", "), code: http.StatusConflict, reason: events.ReasonInProgress},
+		{name: "another order", body: keyboardOrder, code: http.StatusUnprocessableEntity, reason: events.ReasonIdempotencyReuse},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := postOrder(tc.body, "key-1")
+			if rec.Code != tc.code {
+				t.Fatalf("answered %d, want %d: %s", rec.Code, tc.code, rec.Body)
+			}
+			var resp events.ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.ReasonCode != tc.reason {
+				t.Errorf("reason code %q, want %q", resp.ReasonCode, tc.reason)
+			}
+		})
+	}
+}
+
+// Another customer sending the same key starts its own saga instead of getting the first one.
+func TestIdempotencyKeyScopedToCustomer(t *testing.T) {
+	services := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+	}))
+	defer services.Close()
+	appConfig = Config{
+		OrderServiceURL:     services.URL,
+		InventoryServiceURL: services.URL,
+		PaymentServiceURL:   services.URL,
+		AuthServiceURL:      services.URL,
+		ServiceCallTimeout:  time.Second,
+		SagaTimeout:         5 * time.Second,
+		IdempotencyKeyTTL:   time.Hour,
+	}
+	claimFirst(t, "user2", "key-2", strings.Replace(mouseOrder, "user1", "user2", 1))
+
+	rec := postOrder(mouseOrder, "key-2")
+	var resp struct {
+		OrderID    string `json:"order_id"`
+		ReasonCode string `json:"reason_code"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.OrderID == "order-first" || resp.ReasonCode == events.ReasonIdempotencyReuse ||
+		rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("answered %d with the saga of another customer: %+v", rec.Code, resp)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Orders with an invalid quantity are refused before any saga runs, so no service is needed.
+const invalidImport = `[{"customer_id":"user1","items":[{"product_id":"mouse-wireless","quantity":0}]},
+	{"customer_id":"user1","items":[{"product_id":"mouse-wireless","quantity":0}]}]`
+
+func TestImportOrdersParameters(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{query: "", want: http.StatusOK},
+		{query: "concurrency=2&rate=1000", want: http.StatusOK},
+		{query: "rate=1000000001", want: http.StatusBadRequest}, // a zero ticker period would panic
+		{query: "rate=1001", want: http.StatusBadRequest},
+		{query: "rate=0", want: http.StatusBadRequest},
+		{query: "rate=-5", want: http.StatusBadRequest},
+		{query: "rate=fast", want: http.StatusBadRequest},
+		{query: "concurrency=1000000000", want: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/admin/orders/import?"+tc.query, strings.NewReader(invalidImport))
+			importOrdersHandler(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("answered %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+			if tc.want != http.StatusOK {
+				return
+			}
+			var body struct {
+				Results []ImportResult `json:"results"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Results) != 2 {
+				t.Fatalf("got %d results, want 2", len(body.Results))
+			}
+			for _, res := range body.Results {
+				if res.Status != "invalid" || res.ReasonCode != events.ReasonInvalidQuantity {
+					t.Errorf("result %d = %+v, want invalid with %s", res.Index, res, events.ReasonInvalidQuantity)
+				}
+			}
+		})
+	}
+}
@@ -2,17 +2,40 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/alerting"
+	"github.com/StitchMl/saga-demo/common/analytics"
+	"github.com/StitchMl/saga-demo/common/bodylimit"
+	"github.com/StitchMl/saga-demo/common/buildinfo"
+	"github.com/StitchMl/saga-demo/common/clock"
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/correlation"
+	"github.com/StitchMl/saga-demo/common/diagnostics"
+	"github.com/StitchMl/saga-demo/common/graceful"
+	"github.com/StitchMl/saga-demo/common/idgen"
+	"github.com/StitchMl/saga-demo/common/maintenance"
+	"github.com/StitchMl/saga-demo/common/metrics"
+	"github.com/StitchMl/saga-demo/common/order_policy"
+	"github.com/StitchMl/saga-demo/common/responses"
+	"github.com/StitchMl/saga-demo/common/tlsconfig"
 	events "github.com/StitchMl/saga-demo/common/types"
 )
 
@@ -24,9 +47,11 @@ const (
 
 // ServiceError defines a custom error for service call failures.
 type ServiceError struct {
-	URL     string
-	Status  int
-	Message string
+	URL        string
+	Status     int
+	ReasonCode string
+	Message    string
+	Shortages  []events.StockShortage
 }
 
 func (e *ServiceError) Error() string {
@@ -39,12 +64,90 @@ type Config struct {
 	InventoryServiceURL string `json:"inventory_service_url"`
 	PaymentServiceURL   string `json:"payment_service_url"`
 	AuthServiceURL      string `json:"auth_service_url"`
-	ServerPort          string `json:"server_port"`
-	ServiceCallTimeout  time.Duration
+	// ShippingServiceURL quotes the shipping cost; when empty GET_SHIPPING_QUOTE charges ShippingFlatRate.
+	ShippingServiceURL   string  `json:"shipping_service_url"`
+	ShippingFlatRate     float64 `json:"shipping_flat_rate"`
+	ServerPort           string  `json:"server_port"`
+	ServiceCallTimeout   time.Duration
+	SagaTimeout          time.Duration
+	IdempotencyKeyTTL    time.Duration
+	DeadLetterFile       string `json:"dead_letter_file"`
+	CompensationStrategy string `json:"compensation_strategy"`
+	MaxCallsPerSaga      int    `json:"max_calls_per_saga"`
+	MaxCallAttempts      int    `json:"max_call_attempts"`
+	StatusBatchMax       int    `json:"status_batch_max"`
+	// SagaLogRetention is how long a finished saga stays in the saga log.
+	SagaLogRetention time.Duration `json:"saga_log_retention"`
+	// VerifyOrderBeforePayment reads the order back from the order service before charging for it.
+	VerifyOrderBeforePayment bool `json:"verify_order_before_payment"`
+	StepPolicies             map[string]StepPolicy
 }
 
+// StepPolicy is the retry and timeout policy of the service calls of a saga step.
+type StepPolicy struct {
+	MaxAttempts int           // attempts per call when the service answers 429 or 503
+	Timeout     time.Duration // timeout of each attempt
+	Backoff     time.Duration // first wait between attempts, doubled each time up to maxRetryBackoff
+}
+
+// Step policies, configured through <NAME>_STEP_MAX_ATTEMPTS, <NAME>_STEP_TIMEOUT_MS and <NAME>_STEP_BACKOFF_MS.
+const (
+	policyOrder        = "order"
+	policyAuth         = "auth"
+	policyInventory    = "inventory"
+	policyPayment      = "payment"
+	policyShipping     = "shipping"
+	policyCompensation = "compensation" // every compensating call, critical so retried harder by default
+)
+
+// policy returns the configured policy of a step.
+func policy(name string) StepPolicy {
+	return appConfig.StepPolicies[name]
+}
+
+// loadStepPolicies reads the policy of every step, defaulting to the global call settings.
+func loadStepPolicies() {
+	appConfig.StepPolicies = make(map[string]StepPolicy)
+	for _, name := range []string{policyOrder, policyAuth, policyInventory, policyPayment, policyShipping, policyCompensation} {
+		p := StepPolicy{MaxAttempts: appConfig.MaxCallAttempts, Timeout: appConfig.ServiceCallTimeout, Backoff: retryBaseDelay}
+		if name == policyCompensation {
+			p.MaxAttempts *= 2
+		}
+		prefix := strings.ToUpper(name) + "_STEP_"
+		p.MaxAttempts = envPositive(prefix+"MAX_ATTEMPTS", p.MaxAttempts)
+		p.Timeout = time.Duration(envPositive(prefix+"TIMEOUT_MS", int(p.Timeout.Milliseconds()))) * time.Millisecond
+		p.Backoff = time.Duration(envPositive(prefix+"BACKOFF_MS", int(p.Backoff.Milliseconds()))) * time.Millisecond
+		appConfig.StepPolicies[name] = p
+		config.Set(prefix+"POLICY", fmt.Sprintf("attempts=%d timeout=%s backoff=%s", p.MaxAttempts, p.Timeout, p.Backoff))
+	}
+}
+
+// envPositive reads a positive integer from the environment, exiting on invalid values.
+func envPositive(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Fatalf("Invalid %s: %q, must be a positive integer", key, v)
+	}
+	return n
+}
+
+// Compensation strategies selectable through COMPENSATION_STRATEGY.
+const (
+	strategyFull       = "full"        // refund the payment, release the inventory and reject the order
+	strategyRefundOnly = "refund_only" // refund the payment and reject the order, the inventory stays reserved
+	strategyCancelOnly = "cancel_only" // release the inventory and reject the order, the payment is not refunded
+	strategyManual     = "manual"      // undo nothing and park the order for manual review
+)
+
 var appConfig Config
 
+// sagaClock paces the retry waits of the service calls and timestamps the saga log.
+var sagaClock clock.Clock = clock.Real{}
+
 type SagaEvent struct {
 	OrderID   string    `json:"order_id"`
 	Step      string    `json:"step"`
@@ -53,275 +156,1989 @@ type SagaEvent struct {
 	Details   string    `json:"details,omitempty"`
 }
 
+// SagaState is the progress of a saga, updated at every step transition.
+type SagaState struct {
+	OrderID       string     `json:"order_id"`
+	Running       bool       `json:"running"`
+	OrderStatus   string     `json:"order_status,omitempty"`
+	Step          string     `json:"step"`
+	StepStatus    string     `json:"step_status"`
+	Compensations []string   `json:"compensations_applied"`
+	StartedAt     time.Time  `json:"started_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// In-memory progress of every saga, kept after it ends for post-mortem queries
+var sagaStates = struct {
+	sync.RWMutex
+	Data map[string]*SagaState
+}{Data: make(map[string]*SagaState)}
+
+// trackSagaState records a step transition in the saga state table.
+func trackSagaState(event SagaEvent) {
+	sagaStates.Lock()
+	defer sagaStates.Unlock()
+	state, ok := sagaStates.Data[event.OrderID]
+	if !ok {
+		state = &SagaState{OrderID: event.OrderID, Running: true, Compensations: []string{}, StartedAt: event.Timestamp}
+		sagaStates.Data[event.OrderID] = state
+	}
+	state.Step, state.StepStatus, state.UpdatedAt = event.Step, event.Status, event.Timestamp
+	if event.Status == "compensated" {
+		state.Compensations = append(state.Compensations, event.Step)
+	}
+}
+
+// finishSagaState marks the saga of the order as ended with the final order status.
+func finishSagaState(order events.Order) {
+	sagaStates.Lock()
+	defer sagaStates.Unlock()
+	if state, ok := sagaStates.Data[order.OrderID]; ok {
+		now := time.Now()
+		state.Running, state.OrderStatus, state.FinishedAt = false, order.Status, &now
+	}
+}
+
 // In-memory logging of SAGA events to track transaction status
 var sagaLog = struct {
 	sync.RWMutex
-	Events map[string][]SagaEvent // Map OrderID to a list of events
+	Events    map[string][]SagaEvent // Map OrderID to a list of events
+	LastPrune time.Time
 }{Events: make(map[string][]SagaEvent)}
 
+// sagaPruneInterval is how often logSagaEvent drops the expired sagas.
+const sagaPruneInterval = time.Minute
+
+// pruneSagas drops from the saga log, state and call tables the sagas finished more than
+// SagaLogRetention ago, except those still waiting for a review or a dead-letter retry.
+func pruneSagas(now time.Time) {
+	var expired []string
+	sagaStates.RLock()
+	for id, state := range sagaStates.Data {
+		if state.FinishedAt != nil && now.Sub(*state.FinishedAt) > appConfig.SagaLogRetention {
+			expired = append(expired, id)
+		}
+	}
+	sagaStates.RUnlock()
+	if len(expired) == 0 {
+		return
+	}
+
+	pending := make(map[string]bool)
+	reviewQueue.RLock()
+	for id := range reviewQueue.Entries {
+		pending[id] = true
+	}
+	reviewQueue.RUnlock()
+	deadLetters.Lock()
+	for _, e := range deadLetters.Entries {
+		pending[e.OrderID] = true
+	}
+	deadLetters.Unlock()
+
+	var dropped []string
+	for _, id := range expired {
+		if !pending[id] {
+			dropped = append(dropped, id)
+		}
+	}
+	sagaLog.Lock()
+	for _, id := range dropped {
+		delete(sagaLog.Events, id)
+	}
+	sagaLog.Unlock()
+	sagaStates.Lock()
+	for _, id := range dropped {
+		delete(sagaStates.Data, id)
+	}
+	sagaStates.Unlock()
+	sagaCalls.Lock()
+	for _, id := range dropped {
+		delete(sagaCalls.Calls, id)
+		delete(sagaCalls.Dropped, id)
+	}
+	sagaCalls.Unlock()
+	if len(dropped) > 0 {
+		log.Printf("Pruned %d sagas finished more than %s ago", len(dropped), appConfig.SagaLogRetention)
+	}
+}
+
+// ReviewEntry is a failed saga parked for manual review by the "manual" compensation strategy.
+type ReviewEntry struct {
+	OrderID        string       `json:"order_id"`
+	Reason         string       `json:"reason"`
+	CompletedSteps []string     `json:"completed_steps"`
+	Order          events.Order `json:"order"`
+	Timestamp      time.Time    `json:"timestamp"`
+}
+
+// States of the entries listed by the dead-letter endpoint.
+const (
+	deadLetterFailed      = "failed"       // the compensation ran and failed, POST .../retry runs it again
+	deadLetterNeedsReview = "needs_review" // the manual strategy left the compensation to an operator
+)
+
+// DeadLetter is a compensation that failed and was left for a retry through the dead-letter endpoint,
+// or, as listed by that endpoint, one that the manual strategy left pending.
+type DeadLetter struct {
+	OrderID           string       `json:"order_id"`
+	Compensation      string       `json:"compensation"`
+	State             string       `json:"state,omitempty"`
+	OriginalError     string       `json:"original_error"`
+	CompensationError string       `json:"compensation_error"`
+	Attempts          int          `json:"attempts"`
+	Timestamp         time.Time    `json:"timestamp"`
+	Order             events.Order `json:"order"`
+}
+
+// CallRecord is a downstream HTTP call made while running a saga.
+type CallRecord struct {
+	URL         string    `json:"url"`
+	Attempts    int       `json:"attempts"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	RetryWaitMs int64     `json:"retry_wait_ms,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// callCollector gathers the calls of a single saga; it travels in the saga context.
+type callCollector struct {
+	sync.Mutex
+	Calls   []CallRecord
+	Dropped int
+}
+
+type callCollectorKey struct{}
+
+// withCallCollector returns a context carrying a new call collector.
+func withCallCollector(ctx context.Context) (context.Context, *callCollector) {
+	c := &callCollector{}
+	return context.WithValue(ctx, callCollectorKey{}, c), c
+}
+
+// recordCall appends the call to the collector in ctx, if any, up to MaxCallsPerSaga.
+func recordCall(ctx context.Context, rec CallRecord) {
+	c, ok := ctx.Value(callCollectorKey{}).(*callCollector)
+	if !ok {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if len(c.Calls) >= appConfig.MaxCallsPerSaga {
+		c.Dropped++
+		return
+	}
+	c.Calls = append(c.Calls, rec)
+}
+
+// snapshot returns a copy of the collected calls and the number of calls dropped by the cap.
+func (c *callCollector) snapshot() ([]CallRecord, int) {
+	c.Lock()
+	defer c.Unlock()
+	return append([]CallRecord{}, c.Calls...), c.Dropped
+}
+
+// Downstream call log of every saga, keyed by OrderID
+var sagaCalls = struct {
+	sync.RWMutex
+	Calls   map[string][]CallRecord
+	Dropped map[string]int
+}{Calls: make(map[string][]CallRecord), Dropped: make(map[string]int)}
+
+// Order of every saga as last known by the orchestrator, keyed by OrderID
+var sagaOrders = struct {
+	sync.RWMutex
+	Data map[string]events.Order
+}{Data: make(map[string]events.Order)}
+
+// saveSagaOrder records the latest known state of the order of a saga.
+func saveSagaOrder(order events.Order) {
+	sagaOrders.Lock()
+	sagaOrders.Data[order.OrderID] = order
+	sagaOrders.Unlock()
+}
+
+// SagaResult is the response of /create_order: the final order and the calls the saga made.
+type SagaResult struct {
+	events.Order
+	Calls []CallRecord `json:"calls"`
+	// FailedStep is the forward step that failed, if any.
+	FailedStep string `json:"failed_step,omitempty"`
+	// Compensations are the compensation steps applied, in order.
+	Compensations []string `json:"compensations,omitempty"`
+	// CompensationFailed reports that a compensation could not be applied, leaving payment or stock held.
+	CompensationFailed bool `json:"compensation_failed,omitempty"`
+	// SkippedCompensations are the compensations left undone on purpose: skipped by the
+	// compensation strategy, or deferred to a manual review.
+	SkippedCompensations []string `json:"skipped_compensations,omitempty"`
+	// CorrelationID identifies the saga in the logs of every service it called.
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// CompensationLatencyMs is the time from the failure of FailedStep to the end of its compensation.
+	CompensationLatencyMs int64 `json:"compensation_latency_ms,omitempty"`
+}
+
+// compensationLatency is the histogram of the compensation windows, by failing step.
+var compensationLatency = metrics.NewHistogram(metrics.LatencyBucketsMs...)
+
+// Sagas waiting for manual compensation, keyed by OrderID
+var reviewQueue = struct {
+	sync.RWMutex
+	Entries map[string]ReviewEntry
+}{Entries: make(map[string]ReviewEntry)}
+
+// Failed compensations, keyed by OrderID and compensation name.
+// Retrying marks the orders whose dead letters are being retried, so concurrent retries of the
+// same order run once; the compensations themselves run without the lock.
+var deadLetters = struct {
+	sync.Mutex
+	Entries  map[string]DeadLetter
+	Retrying map[string]bool
+}{Entries: make(map[string]DeadLetter), Retrying: make(map[string]bool)}
+
+// Readiness probes of the downstream services: each check is reused for readinessCacheTTL
+// so frequent probes do not hit the services on every request.
+const (
+	readinessCacheTTL     = 5 * time.Second
+	readinessProbeTimeout = 2 * time.Second
+)
+
+var readiness = struct {
+	sync.Mutex
+	Checked   time.Time
+	Unhealthy map[string]string // dependency name to the failure
+}{}
+
 func main() {
 	// Load configuration
 	loadConfigFromEnv()
+	loadDeadLetters()
+
+	// Endpoint to start a new order SAGA
+	http.HandleFunc("/create_order", maintenance.Guard(correlation.Middleware(createOrderHandler)))
+	// Compensations that failed or were parked by the manual strategy, and the retry of the failed ones;
+	// /saga/needs_review lists the parked ones only
+	http.HandleFunc("/saga/needs_review", adminauth.Require(needsReviewHandler))
+	http.HandleFunc("/saga/dead-letters", adminauth.Require(deadLettersHandler))
+	http.HandleFunc("/saga/dead-letters/", adminauth.Require(correlation.Middleware(retryDeadLetterHandler)))
+	// Saga log and downstream calls of a single saga, and the list of recent sagas
+	http.HandleFunc("/saga/", sagaHandler)
+	http.HandleFunc("/saga", sagaListHandler)
+	// Status of several sagas at once, for the admin dashboard
+	http.HandleFunc("/saga/status/batch", adminauth.Require(batchStatusHandler))
+	http.HandleFunc("/saga/stats", sagaStatsHandler)
+	http.HandleFunc("/saga/definition", sagaDefinitionHandler)
+	diagnostics.Publish("compensation_latency_ms", func() interface{} { return compensationLatency.Snapshot() })
+	// Bulk order import for demo seeding
+	http.HandleFunc("/admin/orders/import", adminauth.Require(maintenance.Guard(importOrdersHandler)))
+	// Read-only mode for planned maintenance
+	http.HandleFunc("/maintenance", maintenance.StatusHandler)
+	http.HandleFunc("/admin/maintenance", adminauth.Require(maintenance.AdminHandler))
+	// Effective configuration, secrets redacted
+	http.HandleFunc("/debug/config", adminauth.Require(config.Handler))
+	http.HandleFunc("/version", buildinfo.Handler("orchestrator"))
+	// Liveness only; readiness checks the downstream services
+	http.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "Orchestrator is healthy!")
+	})
+	http.HandleFunc("/ready", readyHandler)
+
+	log.Printf("Orchestrator started on port %s", appConfig.ServerPort)
+	// On SIGTERM the running sagas, including asynchronous ones, get the grace period to finish or compensate
+	if err := graceful.ListenAndServe(":"+appConfig.ServerPort, diagnostics.Handler(bodylimit.Handler(http.DefaultServeMux))); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Load configuration from a JSON file
+func loadConfigFromEnv() {
+	appConfig.OrderServiceURL = os.Getenv("OrderServiceURL")
+	if appConfig.OrderServiceURL == "" {
+		log.Fatal("Environment variable OrderServiceURL not set.")
+	}
+	appConfig.InventoryServiceURL = os.Getenv("InventoryServiceURL")
+	if appConfig.InventoryServiceURL == "" {
+		log.Fatal("Environment variable InventoryServiceURL not set.")
+	}
+	appConfig.PaymentServiceURL = os.Getenv("PaymentServiceURL")
+	if appConfig.PaymentServiceURL == "" {
+		log.Fatal("Environment variable PaymentServiceURL not set.")
+	}
+	appConfig.AuthServiceURL = os.Getenv("AuthServiceURL")
+	if appConfig.AuthServiceURL == "" {
+		log.Fatal("Environment variable AuthServiceURL not set.")
+	}
+	appConfig.ServerPort = os.Getenv("ServerPort")
+	if appConfig.ServerPort == "" {
+		log.Fatal("ServerPort environment variable not set! Must be set to run the server.")
+	}
+	timeoutStr := os.Getenv("SERVICE_CALL_TIMEOUT_SECONDS")
+	if timeoutStr == "" {
+		timeoutStr = "10" // Default timeout
+	}
+	timeout, err := time.ParseDuration(timeoutStr + "s")
+	if err != nil {
+		log.Fatalf("Invalid SERVICE_CALL_TIMEOUT_SECONDS: %v", err)
+	}
+	appConfig.ServiceCallTimeout = timeout
+
+	appConfig.SagaTimeout = 60 * time.Second
+	if v := os.Getenv("SAGA_TIMEOUT_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid SAGA_TIMEOUT_SECONDS: %q", v)
+		}
+		appConfig.SagaTimeout = time.Duration(n) * time.Second
+	}
+
+	appConfig.CompensationStrategy = os.Getenv("COMPENSATION_STRATEGY")
+	switch appConfig.CompensationStrategy {
+	case "":
+		appConfig.CompensationStrategy = strategyFull
+	case strategyFull, strategyRefundOnly, strategyCancelOnly, strategyManual:
+	default:
+		log.Fatalf("Invalid COMPENSATION_STRATEGY %q: must be one of full, refund_only, cancel_only, manual", appConfig.CompensationStrategy)
+	}
+
+	appConfig.MaxCallsPerSaga = 50
+	if v := os.Getenv("MAX_CALLS_PER_SAGA"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid MAX_CALLS_PER_SAGA: %q", v)
+		}
+		appConfig.MaxCallsPerSaga = n
+	}
+
+	appConfig.MaxCallAttempts = 3
+	if v := os.Getenv("SERVICE_CALL_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid SERVICE_CALL_MAX_ATTEMPTS: %q", v)
+		}
+		appConfig.MaxCallAttempts = n
+	}
+	loadStepPolicies()
+
+	appConfig.IdempotencyKeyTTL = time.Duration(envPositive("IDEMPOTENCY_KEY_TTL_SECONDS", 3600)) * time.Second
+	appConfig.DeadLetterFile = os.Getenv("DEAD_LETTER_FILE")
+	appConfig.StatusBatchMax = envPositive("SAGA_STATUS_BATCH_MAX", 100)
+	appConfig.SagaLogRetention = time.Duration(envPositive("SAGA_LOG_RETENTION_SECONDS", 86400)) * time.Second
+	if v := os.Getenv("VERIFY_ORDER_BEFORE_PAYMENT"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid VERIFY_ORDER_BEFORE_PAYMENT: %q", v)
+		}
+		appConfig.VerifyOrderBeforePayment = b
+	}
+
+	tlsconfig.CheckURL("OrderServiceURL", appConfig.OrderServiceURL)
+	tlsconfig.CheckURL("InventoryServiceURL", appConfig.InventoryServiceURL)
+	tlsconfig.CheckURL("PaymentServiceURL", appConfig.PaymentServiceURL)
+	tlsconfig.CheckURL("AuthServiceURL", appConfig.AuthServiceURL)
+	appConfig.ShippingServiceURL = os.Getenv("ShippingServiceURL")
+	if appConfig.ShippingServiceURL != "" {
+		tlsconfig.CheckURL("ShippingServiceURL", appConfig.ShippingServiceURL)
+	}
+	appConfig.ShippingFlatRate = 9.90
+	if v := os.Getenv("SHIPPING_FLAT_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 {
+			log.Fatalf("Invalid SHIPPING_FLAT_RATE: %q", v)
+		}
+		appConfig.ShippingFlatRate = rate
+	}
+
+	config.Set("OrderServiceURL", appConfig.OrderServiceURL)
+	config.Set("InventoryServiceURL", appConfig.InventoryServiceURL)
+	config.Set("PaymentServiceURL", appConfig.PaymentServiceURL)
+	config.Set("AuthServiceURL", appConfig.AuthServiceURL)
+	config.Set("ShippingServiceURL", appConfig.ShippingServiceURL)
+	config.Set("SHIPPING_FLAT_RATE", appConfig.ShippingFlatRate)
+	config.Set("ServerPort", appConfig.ServerPort)
+	config.Set("SERVICE_CALL_TIMEOUT_SECONDS", appConfig.ServiceCallTimeout)
+	config.Set("SAGA_TIMEOUT_SECONDS", appConfig.SagaTimeout)
+	config.Set("IDEMPOTENCY_KEY_TTL_SECONDS", appConfig.IdempotencyKeyTTL)
+	config.Set("DEAD_LETTER_FILE", appConfig.DeadLetterFile)
+	config.Set("SAGA_STATUS_BATCH_MAX", appConfig.StatusBatchMax)
+	config.Set("SAGA_LOG_RETENTION_SECONDS", appConfig.SagaLogRetention)
+	config.Set("VERIFY_ORDER_BEFORE_PAYMENT", appConfig.VerifyOrderBeforePayment)
+	config.Set("COMPENSATION_STRATEGY", appConfig.CompensationStrategy)
+	config.Set("MAX_CALLS_PER_SAGA", appConfig.MaxCallsPerSaga)
+	config.Set("SERVICE_CALL_MAX_ATTEMPTS", appConfig.MaxCallAttempts)
+
+	log.Printf("Configuration loaded: %+v", appConfig)
+}
+
+// Order creation manager (starts SAGA)
+func createOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Use events.Order for the incoming request
+	var order events.Order
+	err := json.NewDecoder(r.Body).Decode(&order)
+	if bodylimit.TooLarge(err) {
+		bodylimit.WriteTooLarge(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if v := order_policy.ValidateItems(order.Items); v != nil {
+		order_policy.WriteViolation(w, v)
+		return
+	}
+
+	fingerprint := requestFingerprint(order)
+	order = newSagaOrder(order)
+
+	// A repeated Idempotency-Key gets the outcome of the first request instead of a second saga.
+	// Keys are scoped to the customer and the endpoint, so two clients never share one.
+	var key string
+	if k := r.Header.Get(idempotencyHeader); k != "" {
+		key = strings.Join([]string{order.CustomerID, r.Method, r.URL.Path, k}, "|")
+		if prev, found := claimIdempotencyKey(key, fingerprint, order.OrderID); found {
+			if prev.Fingerprint != fingerprint {
+				log.Printf("Idempotency-Key %s reused with a different request, refused", k)
+				responses.WriteError(w, http.StatusUnprocessableEntity, events.ReasonIdempotencyReuse,
+					"This Idempotency-Key was already used for a different request")
+				return
+			}
+			replayIdempotent(w, key, prev)
+			return
+		}
+	}
+	cid := correlation.FromContext(r.Context())
+	execute := func() (SagaResult, error) {
+		result, err := executeOrderSaga(cid, order)
+		if key != "" {
+			completeIdempotencyKey(key, result, err)
+		}
+		return result, err
+	}
+
+	// With ?async=true the saga is only accepted here; its progress is read from /saga/{id}/status.
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		logSagaEvent(order.OrderID, "SAGA_ACCEPTED", "started", "Saga accepted for asynchronous execution.")
+		// Tracked before it starts, so a shutdown right after the 202 still waits for it
+		release := graceful.Track()
+		go func() {
+			defer release()
+			_, _ = execute()
+		}()
+		w.Header().Set(contentType, contentTypeJSON)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"order_id":   order.OrderID,
+			"status":     order.Status,
+			"status_url": "/saga/" + order.OrderID + "/status",
+		})
+		return
+	}
+
+	// The saga runs in its own goroutine so that a client disconnect is noticed without interrupting it.
+	// It is tracked before it starts, so a shutdown still waits for it once the client is gone.
+	done := make(chan sagaOutcome, 1)
+	release := graceful.Track()
+	go func() {
+		defer release()
+		result, err := execute()
+		done <- sagaOutcome{result, err}
+	}()
+	var outcome sagaOutcome
+	select {
+	case outcome = <-done:
+	case <-r.Context().Done():
+		cause := context.Cause(r.Context())
+		go logAbandonedSaga(done, cause)
+		return
+	}
+
+	log.Printf("Responding for order %s with status %s", outcome.Result.OrderID, outcome.Result.Status)
+	writeSagaResult(w, outcome.Result, outcome.Err != nil)
+}
+
+// writeSagaResult writes the final order of a saga, with 409 when the saga failed.
+func writeSagaResult(w http.ResponseWriter, result SagaResult, failed bool) {
+	w.Header().Set(contentType, contentTypeJSON)
+	if failed {
+		// SAGA failed, respond with an error status, and the final order states.
+		w.WriteHeader(http.StatusConflict) // 409 Conflict is a good code for a business rule failure.
+	} else {
+		w.WriteHeader(http.StatusOK) // 200 OK for success
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error in the encoding of the JSON response: %v", err)
+	}
+}
+
+// idempotencyHeader carries the client key making a /create_order request safe to repeat.
+const idempotencyHeader = "Idempotency-Key"
+
+// idempotencyEntry is the saga started for an idempotency key.
+type idempotencyEntry struct {
+	OrderID     string
+	Fingerprint string // of the request that claimed the key, see requestFingerprint
+	Done        bool
+	Failed      bool
+	Result      SagaResult
+	Expires     time.Time
+}
+
+// Sagas started with an Idempotency-Key, kept for IDEMPOTENCY_KEY_TTL_SECONDS
+var idempotencyKeys = struct {
+	sync.Mutex
+	Entries map[string]*idempotencyEntry
+}{Entries: make(map[string]*idempotencyEntry)}
+
+// requestFingerprint identifies the content of an order request, whatever its JSON formatting,
+// so that a key reused for another order can be told from a retry.
+func requestFingerprint(order events.Order) string {
+	data, _ := json.Marshal(order)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// claimIdempotencyKey registers key for the saga of orderID. When the key is already known,
+// it returns a copy of its entry and found is true.
+func claimIdempotencyKey(key, fingerprint, orderID string) (entry idempotencyEntry, found bool) {
+	idempotencyKeys.Lock()
+	defer idempotencyKeys.Unlock()
+	now := time.Now()
+	for k, e := range idempotencyKeys.Entries {
+		if e.Done && now.After(e.Expires) {
+			delete(idempotencyKeys.Entries, k)
+		}
+	}
+	if e, ok := idempotencyKeys.Entries[key]; ok {
+		return *e, true
+	}
+	idempotencyKeys.Entries[key] = &idempotencyEntry{OrderID: orderID, Fingerprint: fingerprint}
+	return idempotencyEntry{}, false
+}
+
+// completeIdempotencyKey stores the outcome of the saga started for key.
+func completeIdempotencyKey(key string, result SagaResult, err error) {
+	idempotencyKeys.Lock()
+	defer idempotencyKeys.Unlock()
+	if e, ok := idempotencyKeys.Entries[key]; ok {
+		e.Done, e.Failed, e.Result = true, err != nil, result
+		e.Expires = time.Now().Add(appConfig.IdempotencyKeyTTL)
+	}
+}
+
+// replayIdempotent answers a repeated request: 409 while the first saga runs, its outcome afterwards.
+func replayIdempotent(w http.ResponseWriter, key string, prev idempotencyEntry) {
+	if !prev.Done {
+		log.Printf("Idempotency-Key %s: saga for order %s still in progress", key, prev.OrderID)
+		responses.WriteJSON(w, http.StatusConflict, events.ErrorResponse{
+			ReasonCode: events.ReasonInProgress,
+			Message:    "A request with this Idempotency-Key is still in progress",
+			OrderID:    prev.OrderID,
+		})
+		return
+	}
+	log.Printf("Idempotency-Key %s: replaying the outcome of order %s", key, prev.OrderID)
+	w.Header().Set("Idempotent-Replayed", "true")
+	writeSagaResult(w, prev.Result, prev.Failed)
+}
+
+// sagaOutcome is what runOrderSaga returned.
+type sagaOutcome struct {
+	Result SagaResult
+	Err    error
+}
+
+// logAbandonedSaga waits for a saga whose client went away and logs the outcome the client never saw.
+// The final order stays available through GET /saga/{id}.
+func logAbandonedSaga(done <-chan sagaOutcome, cause error) {
+	outcome := <-done
+	order := outcome.Result.Order
+	if errors.Is(cause, context.DeadlineExceeded) {
+		log.Printf("[Saga] Request deadline expired for order %s; saga completed anyway with status %s", order.OrderID, order.Status)
+		return
+	}
+	paid := false
+	sagaLog.RLock()
+	for _, e := range sagaLog.Events[order.OrderID] {
+		if e.Step == "PROCESS_PAYMENT" && e.Status == "completed" {
+			paid = true
+		}
+	}
+	sagaLog.RUnlock()
+	log.Printf("[Saga] Client disconnected (%v) before the outcome of order %s: the client saw no response, the saga ended with status %s (payment completed: %t)",
+		cause, order.OrderID, order.Status, paid)
+}
+
+// newOrderID returns a new "orc-<uuid>" ID not used by any saga yet.
+func newOrderID() string {
+	sagaOrders.RLock()
+	defer sagaOrders.RUnlock()
+	return idgen.NewUnique(idgen.FlowOrchestrated, func(id string) bool {
+		_, ok := sagaOrders.Data[id]
+		return ok
+	})
+}
+
+// newSagaOrder assigns an ID to a validated order and sets its initial status.
+func newSagaOrder(order events.Order) events.Order {
+	order.OrderID = newOrderID()
+	order.Status = "pending"
+	order.CreatedAt = time.Now()
+
+	// Initial log, adapted for the new items format
+	log.Printf("Request received: Order creation %s for Customer %s, Items: %+v", order.OrderID, order.CustomerID, order.Items)
+	return order
+}
+
+// runOrderSaga assigns an ID to a validated order, runs its saga synchronously and stores its call log.
+func runOrderSaga(order events.Order) (SagaResult, error) {
+	return executeOrderSaga(correlation.NewID(), newSagaOrder(order))
+}
+
+// executeOrderSaga runs the saga of an order that already has an ID and stores its call log.
+// cid is the correlation ID sent to the downstream services.
+func executeOrderSaga(cid string, order events.Order) (SagaResult, error) {
+	// The saga runs detached from the request context so a client disconnect cannot interrupt it,
+	// bounded by SAGA_TIMEOUT_SECONDS instead.
+	ctx, cancel := context.WithTimeout(correlation.WithID(context.Background(), cid), appConfig.SagaTimeout)
+	defer cancel()
+	correlation.Logf(cid, "Starting saga for order %s", order.OrderID)
+	ctx, collector := withCallCollector(ctx)
+	started := time.Now()
+	saveSagaOrder(order)
+	finalOrder, err := startSaga(ctx, order)
+	saveSagaOrder(finalOrder)
+	finishSagaState(finalOrder)
+	emitSagaCompleted(finalOrder, started)
+
+	calls, dropped := collector.snapshot()
+	sagaCalls.Lock()
+	sagaCalls.Calls[order.OrderID] = calls
+	sagaCalls.Dropped[order.OrderID] = dropped
+	sagaCalls.Unlock()
+	result := SagaResult{Order: finalOrder, Calls: calls, CorrelationID: cid}
+	summarizeSaga(&result)
+	return result, err
+}
+
+// summarizeSaga fills the failed step and the compensations of a result from the saga log.
+func summarizeSaga(result *SagaResult) {
+	sagaLog.RLock()
+	defer sagaLog.RUnlock()
+	for _, e := range sagaLog.Events[result.OrderID] {
+		isCompensation := e.Step == "REVERT_PAYMENT" || e.Step == "CANCEL_RESERVATION"
+		switch {
+		case isCompensation && e.Status == "compensated":
+			result.Compensations = append(result.Compensations, e.Step)
+		case isCompensation && e.Status == "failed":
+			result.CompensationFailed = true
+		case isCompensation && e.Status == "skipped":
+			result.SkippedCompensations = append(result.SkippedCompensations, e.Step)
+		case e.Status == "failed" && result.FailedStep == "":
+			result.FailedStep = e.Step
+		}
+	}
+	if result.Status == "needs_review" {
+		result.SkippedCompensations = append(result.SkippedCompensations, pendingCompensations(sagaLog.Events[result.OrderID])...)
+	}
+	if _, window, ok := compensationWindow(sagaLog.Events[result.OrderID]); ok {
+		result.CompensationLatencyMs = window.Milliseconds()
+	}
+}
+
+// compensationWindow returns the forward step whose failure triggered the compensation and the time
+// from that failure to the end of the compensation; ok is false when the saga was not compensated.
+func compensationWindow(eventsLogged []SagaEvent) (step string, window time.Duration, ok bool) {
+	var failedAt time.Time
+	for _, e := range eventsLogged {
+		switch {
+		case forwardSteps[e.Step] && e.Status == "failed" && step == "":
+			step, failedAt = e.Step, e.Timestamp
+		case e.Step == "SAGA_COMPENSATION" && e.Status == "completed" && step != "":
+			return step, e.Timestamp.Sub(failedAt), true
+		}
+	}
+	return "", 0, false
+}
+
+// PolicyDefinition is a step policy as reported by GET /saga/definition.
+type PolicyDefinition struct {
+	Name        string `json:"name"`
+	MaxAttempts int    `json:"max_attempts"`
+	TimeoutMs   int64  `json:"timeout_ms"`
+	BackoffMs   int64  `json:"backoff_ms"`
+}
+
+// CompensationDefinition is the compensation of a forward step.
+type CompensationDefinition struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	SkippedBy string `json:"skipped_by,omitempty"`
+}
+
+// StepDefinition is a forward step of the saga, with its policy and compensation.
+type StepDefinition struct {
+	Name            string                  `json:"name"`
+	Policy          PolicyDefinition        `json:"policy"`
+	PointOfNoReturn bool                    `json:"point_of_no_return,omitempty"`
+	Parallel        bool                    `json:"parallel,omitempty"`
+	Compensation    *CompensationDefinition `json:"compensation,omitempty"`
+}
+
+// policyDefinition returns the configured policy of a step for the saga definition.
+func policyDefinition(name string) PolicyDefinition {
+	p := policy(name)
+	return PolicyDefinition{Name: name, MaxAttempts: p.MaxAttempts, TimeoutMs: p.Timeout.Milliseconds(), BackoffMs: p.Backoff.Milliseconds()}
+}
+
+// sagaDefinitionHandler serves GET /saga/definition: the forward steps in execution order, each
+// with its compensation, and the policies and timeouts in use, built from orderSagaSteps and
+// compensationTable so it always matches the code.
+func sagaDefinitionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	steps := make([]StepDefinition, 0, len(orderSagaSteps))
+	for _, step := range orderSagaSteps {
+		def := StepDefinition{Name: step.Name, Policy: policyDefinition(step.Policy), PointOfNoReturn: step.PointOfNoReturn, Parallel: step.Parallel}
+		if comp, ok := compensationTable[step.Name]; ok {
+			def.Compensation = &CompensationDefinition{Name: comp.Name, URL: comp.URL(), SkippedBy: comp.SkippedBy}
+		}
+		steps = append(steps, def)
+	}
+	responses.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"steps":                 steps,
+		"compensation_strategy": appConfig.CompensationStrategy,
+		"compensation_policy":   policyDefinition(policyCompensation),
+		"saga_timeout_ms":       appConfig.SagaTimeout.Milliseconds(),
+	})
+}
+
+// sagaStatsHandler serves GET /saga/stats with the compensation latency histogram, by failing step.
+func sagaStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"compensation_latency_ms": compensationLatency.Snapshot(),
+	})
+}
+
+// ImportSpec is an order of a bulk import; OutcomeHint is the outcome the caller expects, if any.
+type ImportSpec struct {
+	CustomerID  string             `json:"customer_id"`
+	Items       []events.OrderItem `json:"items"`
+	OutcomeHint string             `json:"outcome_hint,omitempty"`
+}
+
+// ImportResult is the outcome of one order of a bulk import.
+type ImportResult struct {
+	Index       int    `json:"index"`
+	OrderID     string `json:"order_id,omitempty"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	ReasonCode  string `json:"reason_code,omitempty"`
+	OutcomeHint string `json:"outcome_hint,omitempty"`
+	HintMatched *bool  `json:"hint_matched,omitempty"`
+}
+
+// maxImportBatch bounds the number of orders accepted by a single import request.
+const maxImportBatch = 500
+
+// Upper bounds of the concurrency and rate parameters of an import: more sagas in flight than
+// orders is pointless, and a rate past maxImportRate would need ticks shorter than a millisecond.
+const (
+	maxImportConcurrency = maxImportBatch
+	maxImportRate        = 1000
+)
+
+// importOrdersHandler serves POST /admin/orders/import: it runs every order through the normal saga
+// with at most `concurrency` sagas in flight (default 4) and, when `rate` is set, at most `rate` sagas started per second.
+func importOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var specs []ImportSpec
+	if err := json.NewDecoder(r.Body).Decode(&specs); err != nil {
+		http.Error(w, "Invalid request body: expected an array of orders", http.StatusBadRequest)
+		return
+	}
+	if len(specs) == 0 || len(specs) > maxImportBatch {
+		http.Error(w, fmt.Sprintf("An import must contain between 1 and %d orders", maxImportBatch), http.StatusBadRequest)
+		return
+	}
+	concurrency, err := queryInt(r, "concurrency", 4, maxImportConcurrency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rate, err := queryInt(r, "rate", 0, maxImportRate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ticker *time.Ticker
+	if rate > 0 {
+		ticker = time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+	}
+
+	results := make([]ImportResult, len(specs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		if ticker != nil && i > 0 {
+			<-ticker.C
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, spec ImportSpec) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = importOrder(i, spec)
+		}(i, spec)
+	}
+	wg.Wait()
+
+	log.Printf("Bulk import of %d orders completed", len(specs))
+	w.Header().Set(contentType, contentTypeJSON)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+// importOrder validates and runs a single imported order.
+func importOrder(index int, spec ImportSpec) ImportResult {
+	result := ImportResult{Index: index, OutcomeHint: spec.OutcomeHint}
+	if v := order_policy.ValidateItems(spec.Items); v != nil {
+		result.Status = "invalid"
+		result.Reason = v.Message
+		result.ReasonCode = v.ReasonCode
+		return result
+	}
+	saga, _ := runOrderSaga(events.Order{CustomerID: spec.CustomerID, Items: spec.Items})
+	result.OrderID = saga.OrderID
+	result.Status = saga.Status
+	result.Reason = saga.Reason
+	result.ReasonCode = saga.ReasonCode
+	if spec.OutcomeHint != "" {
+		matched := spec.OutcomeHint == saga.Status
+		result.HintMatched = &matched
+	}
+	return result
+}
+
+// queryInt reads an integer query parameter between 1 and max, falling back to def when absent.
+func queryInt(r *http.Request, key string, def, max int) (int, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > max {
+		return 0, fmt.Errorf("invalid %s: must be an integer between 1 and %d", key, max)
+	}
+	return n, nil
+}
+
+// SagaStep is a forward step of the order saga.
+type SagaStep struct {
+	Name      string
+	Started   string // saga log details when the step starts
+	Completed string // saga log details when the step completes
+	// Execute runs the step, updating the order with what it learns.
+	Execute func(ctx context.Context, order *events.Order) error
+	// Failed returns the saga log details of a failure.
+	Failed func(err error) string
+	// Abort settles the order after a failure and returns the error of the saga.
+	Abort func(ctx context.Context, order *events.Order, err error) error
+	// PointOfNoReturn marks the step after which the saga must reach an outcome, timeout or not.
+	PointOfNoReturn bool
+	// Policy is the step policy of the service calls of Execute, reported by /saga/definition.
+	Policy string
+	// Parallel runs the step concurrently with the Parallel steps next to it; the group ends when
+	// all of them have. Steps of a group share the order, so each may only write its own fields.
+	Parallel bool
+}
+
+// fixedDetails returns a Failed func ignoring the error.
+func fixedDetails(details string) func(error) string {
+	return func(error) string { return details }
+}
+
+// compensateOn returns an Abort func running compensateSaga and reporting the failure.
+func compensateOn(reason, fallback string) func(context.Context, *events.Order, error) error {
+	return func(ctx context.Context, order *events.Order, err error) error {
+		order.Status = compensateSaga(ctx, order.OrderID, *order, reason)
+		order.Reason = getCleanErrorMessage(err, fallback)
+		var v *order_policy.Violation
+		var serviceErr *ServiceError
+		switch {
+		case errors.As(err, &v):
+			order.ReasonCode = v.ReasonCode
+		case errors.As(err, &serviceErr):
+			order.ReasonCode = serviceErr.ReasonCode
+			order.Shortages = serviceErr.Shortages
+		}
+		return err
+	}
+}
+
+// rejectCustomer is the Abort of VALIDATE_CUSTOMER: nothing to compensate yet but the order record.
+func rejectCustomer(ctx context.Context, order *events.Order, err error) error {
+	updateOrderStatus(ctx, policy(policyOrder), order, "rejected", errorInvalidCustomer)
+	order.Status = "rejected"
+	order.Reason = getCleanErrorMessage(err, "Customer validation failed")
+	if errors.Is(err, errCustomerNotValid) {
+		order.Reason = errorInvalidCustomer
+	}
+	return err
+}
+
+// errCustomerNotValid is returned when the auth service answers that the customer is not valid.
+var errCustomerNotValid = errors.New("customer validation returned false")
+
+// orderSagaSteps are the forward steps of the order saga, in execution order.
+// Compensations of completed steps are declared in compensationTable.
+var orderSagaSteps = []SagaStep{
+	{
+		// Step 1: Create Order in Order Service with “pending” status
+		Name:      "CREATE_ORDER",
+		Policy:    policyOrder,
+		Started:   "Creating order in order service.",
+		Completed: "Order created successfully in order service.",
+		Execute: func(ctx context.Context, order *events.Order) error {
+			if err := makeServiceCall(ctx, policy(policyOrder), appConfig.OrderServiceURL+"/create_order", *order, nil); err != nil {
+				log.Printf("Failed to create order %s in order service: %v", order.OrderID, err)
+				return err
+			}
+			return nil
+		},
+		Failed: fixedDetails("Failed to create order."),
+		Abort: func(_ context.Context, order *events.Order, err error) error {
+			var svcErr *ServiceError
+			if errors.As(err, &svcErr) && svcErr.ReasonCode == events.ReasonUnknownProduct {
+				order.Status = "rejected"
+				order.Reason = svcErr.Message
+				order.ReasonCode = svcErr.ReasonCode
+				return fmt.Errorf("order rejected: %s", svcErr.Message)
+			}
+			order.Status = "failed"
+			order.Reason = "Failed to create order record"
+			return fmt.Errorf("failed to create order")
+		},
+	},
+	{
+		// Step 2: Validate Customer, at the same time as step 3
+		Name:      "VALIDATE_CUSTOMER",
+		Policy:    policyAuth,
+		Parallel:  true, // only reads CustomerID
+		Started:   "Validating customer.",
+		Completed: "Customer validated successfully.",
+		Execute: func(ctx context.Context, order *events.Order) error {
+			authReq := map[string]interface{}{"customer_id": order.CustomerID}
+			var authResp struct {
+				Valid bool `json:"valid"`
+			}
+			if err := makeServiceCall(ctx, policy(policyAuth), appConfig.AuthServiceURL+"/validate", authReq, &authResp); err != nil {
+				log.Printf("Customer validation failed for order %s: %v", order.OrderID, err)
+				return err
+			}
+			if !authResp.Valid {
+				log.Printf("Customer validation returned not valid for order %s", order.OrderID)
+				return errCustomerNotValid
+			}
+			return nil
+		},
+		Failed: func(err error) string {
+			if errors.Is(err, errCustomerNotValid) {
+				return "Customer validation returned false."
+			}
+			return "Customer validation failed."
+		},
+		Abort: rejectCustomer,
+	},
+	{
+		// Step 3: Get product prices and calculate the total amount
+		Name:      "GET_PRICES",
+		Policy:    policyInventory,
+		Parallel:  true, // only writes the item prices and Total
+		Started:   "Getting product prices from inventory service.",
+		Completed: "Prices obtained and total calculated.",
+		Execute: func(ctx context.Context, order *events.Order) error {
+			totalAmount, err := getPricesAndCalculateTotal(ctx, order.Items)
+			if err != nil {
+				log.Printf("Failed to get prices for order %s: %v", order.OrderID, err)
+				return err
+			}
+			order.Total = totalAmount
+			log.Printf("Calculated total amount for Order %s: %.2f", order.OrderID, totalAmount)
+			return nil
+		},
+		Failed: func(err error) string { return fmt.Sprintf("Failed to get prices: %v", err) },
+		Abort:  compensateOn("get_prices_failure", "Failed to get prices"),
+	},
+	{
+		// Step 4: Quote the shipping and add it to the total, falling back to the flat rate
+		Name:      "GET_SHIPPING_QUOTE",
+		Policy:    policyShipping,
+		Started:   "Getting shipping quote from shipping service.",
+		Completed: "Shipping cost added to the total.",
+		Execute: func(ctx context.Context, order *events.Order) error {
+			order.ShippingCost = quoteShipping(ctx, order)
+			order.Total = math.Round((order.Total+order.ShippingCost)*100) / 100
+			log.Printf("Shipping cost for order %s: %.2f, total %.2f", order.OrderID, order.ShippingCost, order.Total)
+			return nil
+		},
+		// Never fails: a quote that cannot be obtained is replaced by the flat rate.
+	},
+	{
+		// Step 5: Reserve Products in the Inventory
+		Name:      "RESERVE_INVENTORY",
+		Policy:    policyInventory,
+		Started:   "Attempting to reserve inventory.",
+		Completed: "Inventory reserved successfully.",
+		Execute: func(ctx context.Context, order *events.Order) error {
+			// Pass the entire list of items for the reserve
+			reserveReq := events.InventoryRequestPayload{OrderID: order.OrderID, Items: order.Items}
+			if err := makeServiceCall(ctx, policy(policyInventory), appConfig.InventoryServiceURL+"/reserve", reserveReq, nil); err != nil {
+				log.Printf("Inventory reserve failure for order %s: %v", order.OrderID, err)
+				return err
+			}
+			log.Printf("Successfully reserved inventory for order %s", order.OrderID)
+			return nil
+		},
+		Failed: func(err error) string { return fmt.Sprintf("Inventory reservation failed: %v", err) },
+		Abort:  compensateOn("inventory_failure", "Inventory reservation failed"),
+	},
+	{
+		// Step 6: Process Payment
+		Name:      "PROCESS_PAYMENT",
+		Policy:    policyPayment,
+		Started:   "Attempting to process payment.",
+		Completed: "Payment processed successfully.",
+		Execute: func(ctx context.Context, order *events.Order) error {
+			if appConfig.VerifyOrderBeforePayment {
+				if err := verifyOrder(ctx, order.OrderID); err != nil {
+					return err
+				}
+			}
+			paymentReq := events.PaymentPayload{OrderID: order.OrderID, CustomerID: order.CustomerID, Amount: order.Total}
+			if err := makeServiceCall(ctx, policy(policyPayment), appConfig.PaymentServiceURL+"/process", paymentReq, nil); err != nil {
+				log.Printf("Failure to process payment for order %s: %v", order.OrderID, err)
+				return err
+			}
+			log.Printf("Payment successfully processed for order %s", order.OrderID)
+			return nil
+		},
+		Failed:          func(err error) string { return fmt.Sprintf("Payment processing failed: %v", err) },
+		Abort:           compensateOn("payment_failure", "Payment processing failed"),
+		PointOfNoReturn: true,
+	},
+	{
+		// Step 7: Commit the reservation, so the inventory no longer releases it when its TTL expires
+		Name:      "COMMIT_RESERVATION",
+		Policy:    policyInventory,
+		Started:   "Committing inventory reservation.",
+		Completed: "Inventory reservation committed.",
+		Execute: func(ctx context.Context, order *events.Order) error {
+			commitReservation(ctx, order.OrderID)
+			return nil
+		},
+		// Never fails: the payment is taken, a commit that cannot be done is logged for an operator.
+	},
+	{
+		// Step 8: Order Confirmation
+		Name:    "CONFIRM_ORDER",
+		Policy:  policyOrder,
+		Started: "Attempting to confirm order.",
+		Execute: func(ctx context.Context, order *events.Order) error {
+			if !updateOrderStatus(ctx, policy(policyOrder), order, "approved", "Saga completed successfully") {
+				log.Printf("Order confirmation failure for order %s", order.OrderID)
+				return fmt.Errorf("order confirmation failed")
+			}
+			return nil
+		},
+		Failed: fixedDetails("Order confirmation failed, requires manual intervention."),
+		Abort: func(_ context.Context, order *events.Order, err error) error {
+			order.Status = "failed_confirmation"
+			order.Reason = "Order confirmation failed, requires manual intervention."
+			return err
+		},
+	},
+}
+
+// Start the SAGA logic
+func startSaga(ctx context.Context, order events.Order) (events.Order, error) {
+	logSagaEvent(order.OrderID, "SAGA_START", "started", "Saga started for order.")
+
+	for steps := orderSagaSteps; len(steps) > 0; {
+		group := stepGroup(steps)
+		steps = steps[len(group):]
+		if failed, err := runSteps(ctx, &order, group); failed != nil {
+			return order, failed.Abort(ctx, &order, err)
+		}
+		if group[len(group)-1].PointOfNoReturn {
+			// Once past this step, the saga must reach an outcome: the saga timeout no longer applies.
+			ctx = context.WithoutCancel(ctx)
+		}
+	}
+
+	log.Printf("Order %s successfully completed!", order.OrderID)
+	logSagaEvent(order.OrderID, "SAGA_COMPLETE", "completed", "Order saga completed successfully.")
+	order.Status = "approved"
+	order.Reason = "Saga completed successfully"
+	return order, nil
+}
+
+// stepGroup returns the steps to run next: the first step alone, or all the Parallel steps
+// at the start of steps.
+func stepGroup(steps []SagaStep) []SagaStep {
+	n := 1
+	for steps[0].Parallel && n < len(steps) && steps[n].Parallel {
+		n++
+	}
+	return steps[:n]
+}
+
+// runSteps runs a group of steps, concurrently when there are several. Every step runs to its end
+// even if another fails. The failures are logged once the group is over, in saga order, and the
+// first of them is returned: two steps failing together always abort the saga the same way, and
+// the saga log names the same failed step.
+func runSteps(ctx context.Context, order *events.Order, group []SagaStep) (*SagaStep, error) {
+	errs := make([]error, len(group))
+	run := func(i int) {
+		step := group[i]
+		if errs[i] = step.Execute(ctx, order); errs[i] == nil && step.Completed != "" {
+			logSagaEvent(order.OrderID, step.Name, "completed", step.Completed)
+		}
+	}
+
+	for _, step := range group {
+		logSagaEvent(order.OrderID, step.Name, "started", step.Started)
+	}
+	if len(group) == 1 {
+		run(0)
+	} else {
+		var wg sync.WaitGroup
+		for i := range group {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	var failed *SagaStep
+	var failure error
+	for i, err := range errs {
+		if err != nil {
+			logSagaEvent(order.OrderID, group[i].Name, "failed", group[i].Failed(err))
+			if failed == nil {
+				failed, failure = &group[i], err
+			}
+		}
+	}
+	return failed, failure
+}
+
+// compensateSaga undoes the completed steps according to the configured strategy
+// and returns the status the order is left in.
+func compensateSaga(ctx context.Context, orderID string, order events.Order, reason string) string {
+	// Compensation must run to the end even if the saga timed out; each call keeps its own timeout.
+	ctx = context.WithoutCancel(ctx)
+	strategy := appConfig.CompensationStrategy
+	log.Printf("Start of compensation for order %s due to: %s (strategy %s)", orderID, reason, strategy)
+	logSagaEvent(orderID, "SAGA_COMPENSATION", "started", fmt.Sprintf("Compensation initiated due to %s, strategy %s", reason, strategy))
+
+	sagaLog.RLock()
+	eventsLogged := sagaLog.Events[orderID]
+	sagaLog.RUnlock()
+
+	if strategy == strategyManual {
+		parkForReview(ctx, orderID, order, reason, eventsLogged)
+		return "needs_review"
+	}
+
+	// Iterate events in reverse order to compensate
+	for i := len(eventsLogged) - 1; i >= 0; i-- {
+		event := eventsLogged[i]
+		step, ok := compensationTable[event.Step]
+		if !ok || event.Status != "completed" {
+			continue
+		}
+		if step.SkippedBy == strategy {
+			logSagaEvent(orderID, step.Name, "skipped", step.Skipped)
+			continue
+		}
+		if err := step.Run(ctx, order, reason); err != nil {
+			addDeadLetter(order, step.Name, reason, err)
+			alerting.RetriesExhausted(alerting.Alert{
+				Operation:     "compensation " + step.Name,
+				Attempts:      policy(policyCompensation).MaxAttempts,
+				LastError:     err.Error(),
+				CorrelationID: correlation.FromContext(ctx),
+				OrderID:       orderID,
+			})
+		}
+	}
+	log.Printf("SAGA compensation for order %s completed.", orderID)
+	logSagaEvent(orderID, "SAGA_COMPENSATION", "completed", "Saga compensation completed.")
+	return "rejected"
+}
+
+// compensationOrder returns the compensations in the order compensateSaga runs them: the
+// reverse of the forward steps.
+func compensationOrder() []compensationStep {
+	var out []compensationStep
+	for i := len(orderSagaSteps) - 1; i >= 0; i-- {
+		if step, ok := compensationTable[orderSagaSteps[i].Name]; ok {
+			out = append(out, step)
+		}
+	}
+	return out
+}
+
+// pendingCompensations returns, in the order compensateSaga would run them, the compensations of
+// the completed forward steps that the saga log does not record as done.
+func pendingCompensations(eventsLogged []SagaEvent) []string {
+	completed := make(map[string]bool)
+	for _, e := range eventsLogged {
+		if e.Status == "completed" {
+			completed[e.Step] = true
+		}
+	}
+	var pending []string
+	for i := len(orderSagaSteps) - 1; i >= 0; i-- {
+		step, ok := compensationTable[orderSagaSteps[i].Name]
+		if ok && completed[orderSagaSteps[i].Name] && !compensationRan(step, eventsLogged) {
+			pending = append(pending, step.Name)
+		}
+	}
+	return pending
+}
+
+// compensationRan reports whether the saga log already records the compensation as done.
+func compensationRan(step compensationStep, eventsLogged []SagaEvent) bool {
+	for _, e := range eventsLogged {
+		if step.Ran(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// parkForReview leaves the completed steps untouched and records the saga for manual review.
+func parkForReview(ctx context.Context, orderID string, order events.Order, reason string, eventsLogged []SagaEvent) {
+	var completed []string
+	for _, event := range eventsLogged {
+		if event.Status == "completed" {
+			completed = append(completed, event.Step)
+		}
+	}
+	updateOrderStatus(ctx, policy(policyCompensation), &order, "needs_review", reason)
+
+	reviewQueue.Lock()
+	reviewQueue.Entries[orderID] = ReviewEntry{
+		OrderID:        orderID,
+		Reason:         reason,
+		CompletedSteps: completed,
+		Order:          order,
+		Timestamp:      time.Now(),
+	}
+	reviewQueue.Unlock()
+
+	log.Printf("Order %s parked for manual review, completed steps: %v", orderID, completed)
+	logSagaEvent(orderID, "SAGA_COMPENSATION", "parked", "Saga parked for manual review, no compensation executed.")
+}
+
+// needsReviewHandler serves GET /saga/needs_review: the dead-letter list restricted to the
+// compensations parked by the manual strategy.
+func needsReviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, listDeadLetters(deadLetterNeedsReview))
+}
+
+// addDeadLetter records a failed compensation so it can be retried later.
+func addDeadLetter(order events.Order, compensation, reason string, err error) {
+	deadLetters.Lock()
+	defer deadLetters.Unlock()
+	key := order.OrderID + "/" + compensation
+	entry, ok := deadLetters.Entries[key]
+	if !ok {
+		entry = DeadLetter{OrderID: order.OrderID, Compensation: compensation, OriginalError: reason, Order: order}
+	}
+	entry.CompensationError = err.Error()
+	entry.Attempts++
+	entry.Timestamp = time.Now()
+	deadLetters.Entries[key] = entry
+	saveDeadLetters()
+	log.Printf("Compensation %s for order %s moved to the dead letters: %v", compensation, order.OrderID, err)
+}
+
+// loadDeadLetters restores the dead letters from DEAD_LETTER_FILE, if set.
+func loadDeadLetters() {
+	if appConfig.DeadLetterFile == "" {
+		return
+	}
+	data, err := os.ReadFile(appConfig.DeadLetterFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to read DEAD_LETTER_FILE: %v", err)
+	}
+	var entries []DeadLetter
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Fatalf("Invalid DEAD_LETTER_FILE %s: %v", appConfig.DeadLetterFile, err)
+	}
+	deadLetters.Lock()
+	for _, e := range entries {
+		deadLetters.Entries[e.OrderID+"/"+e.Compensation] = e
+	}
+	deadLetters.Unlock()
+	log.Printf("Loaded %d dead letters from %s", len(entries), appConfig.DeadLetterFile)
+}
+
+// saveDeadLetters writes the dead letters to DEAD_LETTER_FILE, if set. Callers hold the lock.
+func saveDeadLetters() {
+	if appConfig.DeadLetterFile == "" {
+		return
+	}
+	entries := make([]DeadLetter, 0, len(deadLetters.Entries))
+	for _, e := range deadLetters.Entries {
+		entries = append(entries, e)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err == nil {
+		err = os.WriteFile(appConfig.DeadLetterFile, data, 0o644)
+	}
+	if err != nil {
+		log.Printf("Failed to save dead letters to %s: %v", appConfig.DeadLetterFile, err)
+	}
+}
 
-	// Endpoint to start a new order SAGA
-	http.HandleFunc("/create_order", createOrderHandler)
+// deadLettersHandler lists the failed compensations and those parked by the manual strategy;
+// ?state=failed or ?state=needs_review keeps one kind.
+func deadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	state := r.URL.Query().Get("state")
+	if state != "" && state != deadLetterFailed && state != deadLetterNeedsReview {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "state must be failed or needs_review")
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, listDeadLetters(state))
+}
 
-	log.Printf("Orchestrator started on port %s", appConfig.ServerPort)
-	log.Fatal(http.ListenAndServe(":"+appConfig.ServerPort, nil))
+// listDeadLetters returns the failed compensations and one entry per compensation pending on a
+// saga parked for review, sorted by order; state, when set, keeps the entries in that state.
+func listDeadLetters(state string) []DeadLetter {
+	out := make([]DeadLetter, 0)
+	if state != deadLetterNeedsReview {
+		deadLetters.Lock()
+		for _, e := range deadLetters.Entries {
+			e.State = deadLetterFailed
+			out = append(out, e)
+		}
+		deadLetters.Unlock()
+	}
+	if state != deadLetterFailed {
+		reviewQueue.RLock()
+		parked := make([]ReviewEntry, 0, len(reviewQueue.Entries))
+		for _, e := range reviewQueue.Entries {
+			parked = append(parked, e)
+		}
+		reviewQueue.RUnlock()
+		// The saga log of a parked saga is kept by pruneSagas, so its pending compensations can be read there.
+		for _, e := range parked {
+			sagaLog.RLock()
+			pending := pendingCompensations(sagaLog.Events[e.OrderID])
+			sagaLog.RUnlock()
+			for _, name := range pending {
+				out = append(out, DeadLetter{
+					OrderID:       e.OrderID,
+					Compensation:  name,
+					State:         deadLetterNeedsReview,
+					OriginalError: e.Reason,
+					Timestamp:     e.Timestamp,
+					Order:         e.Order,
+				})
+			}
+		}
+	}
+	rank := make(map[string]int)
+	for i, step := range compensationOrder() {
+		rank[step.Name] = i
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].OrderID != out[j].OrderID {
+			return out[i].OrderID < out[j].OrderID
+		}
+		return rank[out[i].Compensation] < rank[out[j].Compensation]
+	})
+	return out
 }
 
-// Load configuration from a JSON file
-func loadConfigFromEnv() {
-	appConfig.OrderServiceURL = os.Getenv("OrderServiceURL")
-	if appConfig.OrderServiceURL == "" {
-		log.Fatal("Environment variable OrderServiceURL not set.")
+// retryDeadLetterHandler serves POST /saga/dead-letters/{orderId}/retry, re-running the failed
+// compensations of the order. An entry is removed only when its compensation succeeds.
+func retryDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
-	appConfig.InventoryServiceURL = os.Getenv("InventoryServiceURL")
-	if appConfig.InventoryServiceURL == "" {
-		log.Fatal("Environment variable InventoryServiceURL not set.")
+	rest := strings.TrimPrefix(r.URL.Path, "/saga/dead-letters/")
+	orderID, sub, _ := strings.Cut(rest, "/")
+	if orderID == "" || sub != "retry" {
+		responses.WriteNotFound(w, "dead_letters", rest)
+		return
 	}
-	appConfig.PaymentServiceURL = os.Getenv("PaymentServiceURL")
-	if appConfig.PaymentServiceURL == "" {
-		log.Fatal("Environment variable PaymentServiceURL not set.")
+
+	type retryResult struct {
+		Compensation string `json:"compensation"`
+		Status       string `json:"status"`
+		Error        string `json:"error,omitempty"`
 	}
-	appConfig.AuthServiceURL = os.Getenv("AuthServiceURL")
-	if appConfig.AuthServiceURL == "" {
-		log.Fatal("Environment variable AuthServiceURL not set.")
+	var results []retryResult
+
+	sagaLog.RLock()
+	eventsLogged := sagaLog.Events[orderID]
+	sagaLog.RUnlock()
+
+	deadLetters.Lock()
+	if deadLetters.Retrying[orderID] {
+		deadLetters.Unlock()
+		responses.WriteError(w, http.StatusConflict, events.ReasonInProgress, "The dead letters of this order are already being retried")
+		return
 	}
-	appConfig.ServerPort = os.Getenv("ServerPort")
-	if appConfig.ServerPort == "" {
-		log.Fatal("ServerPort environment variable not set! Must be set to run the server.")
+	var pending []DeadLetter
+	for _, step := range compensationOrder() {
+		if entry, ok := deadLetters.Entries[orderID+"/"+step.Name]; ok {
+			pending = append(pending, entry)
+		}
 	}
-	timeoutStr := os.Getenv("SERVICE_CALL_TIMEOUT_SECONDS")
-	if timeoutStr == "" {
-		timeoutStr = "10" // Default timeout
+	if len(pending) > 0 {
+		deadLetters.Retrying[orderID] = true
 	}
-	timeout, err := time.ParseDuration(timeoutStr + "s")
-	if err != nil {
-		log.Fatalf("Invalid SERVICE_CALL_TIMEOUT_SECONDS: %v", err)
+	deadLetters.Unlock()
+	defer func() {
+		deadLetters.Lock()
+		delete(deadLetters.Retrying, orderID)
+		deadLetters.Unlock()
+	}()
+
+	// Same order as compensateSaga, so e.g. the payment is refunded before the order is rejected.
+	// The compensations run without the lock: they log saga events, which may prune the saga tables.
+	steps := make(map[string]compensationStep)
+	for _, step := range compensationOrder() {
+		steps[step.Name] = step
 	}
-	appConfig.ServiceCallTimeout = timeout
+	for _, entry := range pending {
+		step, key := steps[entry.Compensation], orderID+"/"+entry.Compensation
+		// A compensation that succeeded since, e.g. through another retry, is not run twice.
+		if compensationRan(step, eventsLogged) {
+			deadLetters.Lock()
+			delete(deadLetters.Entries, key)
+			deadLetters.Unlock()
+			results = append(results, retryResult{Compensation: entry.Compensation, Status: "already_compensated"})
+			continue
+		}
+		err := step.Run(context.WithoutCancel(r.Context()), entry.Order, entry.OriginalError)
+		deadLetters.Lock()
+		if err != nil {
+			entry.CompensationError = err.Error()
+			entry.Attempts++
+			entry.Timestamp = time.Now()
+			deadLetters.Entries[key] = entry
+			results = append(results, retryResult{Compensation: entry.Compensation, Status: "failed", Error: err.Error()})
+		} else {
+			delete(deadLetters.Entries, key)
+			results = append(results, retryResult{Compensation: entry.Compensation, Status: "compensated"})
+		}
+		deadLetters.Unlock()
+	}
+	if len(results) == 0 {
+		responses.WriteNotFound(w, "dead_letters", orderID)
+		return
+	}
+	deadLetters.Lock()
+	saveDeadLetters()
+	deadLetters.Unlock()
 
-	log.Printf("Configuration loaded: %+v", appConfig)
+	remaining := 0
+	for _, res := range results {
+		if res.Status == "failed" {
+			remaining++
+		}
+	}
+	log.Printf("Dead letters of order %s retried, %d remaining", orderID, remaining)
+	responses.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"order_id":  orderID,
+		"retried":   results,
+		"remaining": remaining,
+	})
 }
 
-// Order creation manager (starts SAGA)
-func createOrderHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// readyHandler reports 503, with the failing dependencies, while any downstream service does not answer its /health.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Use events.Order for the incoming request
-	var order events.Order
-	err := json.NewDecoder(r.Body).Decode(&order)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	readiness.Lock()
+	if time.Since(readiness.Checked) > readinessCacheTTL {
+		readiness.Unhealthy = checkDependencies()
+		readiness.Checked = time.Now()
+	}
+	unhealthy := readiness.Unhealthy
+	readiness.Unlock()
+
+	if len(unhealthy) > 0 {
+		responses.WriteJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":    "not_ready",
+			"unhealthy": unhealthy,
+		})
 		return
 	}
+	responses.WriteJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
 
-	// Assigns an ID to the order and sets the initial status.
-	order.OrderID = fmt.Sprintf("order-%d", time.Now().UnixNano())
-	order.Status = "pending"
+// checkDependencies calls GET /health on every downstream service and returns the ones that failed.
+func checkDependencies() map[string]string {
+	dependencies := map[string]string{
+		"order-service":     appConfig.OrderServiceURL,
+		"inventory-service": appConfig.InventoryServiceURL,
+		"payment-service":   appConfig.PaymentServiceURL,
+		"auth-service":      appConfig.AuthServiceURL,
+	}
+	client := tlsconfig.Client(readinessProbeTimeout)
 
-	// Initial log, adapted for the new items format
-	log.Printf("Request received: Order creation %s for Customer %s, Items: %+v", order.OrderID, order.CustomerID, order.Items)
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		unhealthy = make(map[string]string)
+	)
+	for name, base := range dependencies {
+		wg.Add(1)
+		go func(name, base string) {
+			defer wg.Done()
+			resp, err := client.Get(base + "/health")
+			if err == nil {
+				_ = resp.Body.Close()
+				if resp.StatusCode == http.StatusOK {
+					return
+				}
+				err = fmt.Errorf("health check returned %d", resp.StatusCode)
+			}
+			log.Printf("Readiness: %s is unhealthy: %v", name, err)
+			mu.Lock()
+			unhealthy[name] = err.Error()
+			mu.Unlock()
+		}(name, base)
+	}
+	wg.Wait()
+	return unhealthy
+}
 
-	// It starts the SAGA synchronously to provide immediate feedback.
-	finalOrder, err := startSaga(order)
-	if err != nil {
-		// SAGA failed, respond with an error status, and the final order states.
-		w.Header().Set(contentType, contentTypeJSON)
-		w.WriteHeader(http.StatusConflict) // 409 Conflict is a good code for a business rule failure.
-		if err := json.NewEncoder(w).Encode(finalOrder); err != nil {
-			log.Printf("Error in the encoding of the JSON response: %v", err)
+// forwardSteps are the saga steps reported as executed in the saga summary.
+var forwardSteps = map[string]bool{
+	"CREATE_ORDER": true, "VALIDATE_CUSTOMER": true, "GET_PRICES": true, "GET_SHIPPING_QUOTE": true,
+	"RESERVE_INVENTORY": true, "PROCESS_PAYMENT": true, "CONFIRM_ORDER": true,
+}
+
+// emitSagaCompleted sends the end-of-saga summary, built from the saga log, to the analytics webhook.
+func emitSagaCompleted(order events.Order, started time.Time) {
+	sagaLog.RLock()
+	eventsLogged := sagaLog.Events[order.OrderID]
+	sagaLog.RUnlock()
+
+	summary := events.SagaCompletedPayload{
+		OrderID:       order.OrderID,
+		Flow:          "orchestrated",
+		Status:        order.Status,
+		Total:         order.Total,
+		DurationMs:    time.Since(started).Milliseconds(),
+		StepsExecuted: []string{},
+	}
+	for _, event := range eventsLogged {
+		switch {
+		case forwardSteps[event.Step] && event.Status == "started":
+			summary.StepsExecuted = append(summary.StepsExecuted, event.Step)
+		case forwardSteps[event.Step] && event.Status == "failed":
+			summary.FailureReasonCode = event.Step + "_FAILED"
+		case event.Status == "compensated":
+			summary.CompensationsRun = append(summary.CompensationsRun, event.Step)
 		}
+	}
+	if order.ReasonCode != "" {
+		summary.FailureReasonCode = order.ReasonCode
+	}
+	if step, window, ok := compensationWindow(eventsLogged); ok {
+		summary.CompensationLatencyMs = window.Milliseconds()
+		compensationLatency.Observe(step, float64(summary.CompensationLatencyMs))
+	}
+	analytics.PostSagaCompleted(summary)
+}
+
+// sagaHandler serves GET /saga/{id} with the saga log and the downstream calls of a saga.
+func sagaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/saga/")
+	orderID, sub, _ := strings.Cut(rest, "/")
+	if orderID == "" {
+		responses.WriteNotFound(w, "saga", rest)
+		return
+	}
+	switch sub {
+	case "":
+	case "compensation_plan":
+		compensationPlanHandler(w, r, orderID)
+		return
+	case "status":
+		sagaStatusHandler(w, orderID)
+		return
+	default:
+		responses.WriteNotFound(w, "saga", rest)
+		return
+	}
+
+	sagaLog.RLock()
+	eventsLogged, ok := sagaLog.Events[orderID]
+	sagaLog.RUnlock()
+	if !ok {
+		responses.WriteNotFound(w, "saga", orderID)
 		return
 	}
+	sagaCalls.RLock()
+	calls, dropped := sagaCalls.Calls[orderID], sagaCalls.Dropped[orderID]
+	sagaCalls.RUnlock()
 
-	// SAGA succeeded
 	w.Header().Set(contentType, contentTypeJSON)
-	w.WriteHeader(http.StatusOK) // 200 OK for success
-	if err := json.NewEncoder(w).Encode(finalOrder); err != nil {
-		log.Printf("Error in the encoding of the JSON response: %v", err)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"order_id":      orderID,
+		"events":        eventsLogged,
+		"calls":         calls,
+		"calls_dropped": dropped,
+	})
+}
+
+// sagaListHandler serves GET /saga with the most recent sagas first, filtered by ?status= (the
+// final order status, or "running") and at most ?limit= of them (default 50).
+func sagaListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	sagaStates.RLock()
+	list := make([]SagaState, 0, len(sagaStates.Data))
+	for _, state := range sagaStates.Data {
+		if status == "" || (status == "running" && state.Running) || (!state.Running && state.OrderStatus == status) {
+			snapshot := *state
+			snapshot.Compensations = append([]string{}, state.Compensations...)
+			list = append(list, snapshot)
+		}
 	}
+	sagaStates.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.After(list[j].StartedAt) })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	responses.WriteJSON(w, http.StatusOK, list)
 }
 
-// Start the SAGA logic
-func startSaga(order events.Order) (events.Order, error) {
-	logSagaEvent(order.OrderID, "SAGA_START", "started", "Saga started for order.")
+// sagaStatusHandler serves GET /saga/{id}/status with the current or final progress of the saga.
+func sagaStatusHandler(w http.ResponseWriter, orderID string) {
+	sagaStates.RLock()
+	state, ok := sagaStates.Data[orderID]
+	var snapshot SagaState
+	if ok {
+		snapshot = *state
+		snapshot.Compensations = append([]string{}, state.Compensations...)
+	}
+	sagaStates.RUnlock()
+	if !ok {
+		responses.WriteNotFound(w, "saga", orderID)
+		return
+	}
+	w.Header().Set(contentType, contentTypeJSON)
+	_ = json.NewEncoder(w).Encode(snapshot)
+}
 
-	// Step 1: Create Order in Order Service with “pending” status
-	logSagaEvent(order.OrderID, "CREATE_ORDER", "started", "Creating order in order service.")
-	resp, err := makeServiceCall(appConfig.OrderServiceURL+"/create_order", order)
-	if err != nil || resp["status"] != "success" {
-		log.Printf("Failed to create order %s in order service: %v, response: %+v", order.OrderID, err, resp)
-		logSagaEvent(order.OrderID, "CREATE_ORDER", "failed", "Failed to create order.")
-		order.Status = "failed"
-		order.Reason = "Failed to create order record"
-		return order, fmt.Errorf("failed to create order")
-	}
-	logSagaEvent(order.OrderID, "CREATE_ORDER", "completed", "Order created successfully in order service.")
-
-	// Step 2: Validate Customer
-	logSagaEvent(order.OrderID, "VALIDATE_CUSTOMER", "started", "Validating customer.")
-	authReq := map[string]interface{}{"customer_id": order.CustomerID}
-	authResp, err := makeServiceCall(appConfig.AuthServiceURL+"/validate", authReq)
-	if err != nil {
-		log.Printf("Customer validation failed for order %s: %v", order.OrderID, err)
-		logSagaEvent(order.OrderID, "VALIDATE_CUSTOMER", "failed", "Customer validation failed.")
-		updateOrderStatus(order.OrderID, "rejected", errorInvalidCustomer, &order.Total)
-		order.Status = "rejected"
-		order.Reason = getCleanErrorMessage(err, "Customer validation failed")
-		return order, err
-	}
-	if valid, ok := authResp["valid"].(bool); !ok || !valid {
-		log.Printf("Customer validation returned not valid for order %s: response: %+v", order.OrderID, authResp)
-		logSagaEvent(order.OrderID, "VALIDATE_CUSTOMER", "failed", "Customer validation returned false.")
-		updateOrderStatus(order.OrderID, "rejected", errorInvalidCustomer, &order.Total)
-		order.Status = "rejected"
-		order.Reason = errorInvalidCustomer
-		return order, fmt.Errorf("customer validation returned false")
+// BatchStatus is the state of one saga in the /saga/status/batch response.
+// Unknown ids only have NotFound set.
+type BatchStatus struct {
+	State     string     `json:"state,omitempty"`
+	LastStep  string     `json:"last_step,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	NotFound  bool       `json:"not_found,omitempty"`
+}
+
+// batchStatusHandler serves POST /saga/status/batch with a body like {"order_ids": ["order-1", ...]}.
+// It reads the saga state store only, and rejects more than SAGA_STATUS_BATCH_MAX ids with 413.
+func batchStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		OrderIDs []string `json:"order_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request body")
+		return
+	}
+	if len(req.OrderIDs) > appConfig.StatusBatchMax {
+		responses.WriteError(w, http.StatusRequestEntityTooLarge, events.ReasonTooManyItems,
+			fmt.Sprintf("The batch has %d order ids, the maximum is %d", len(req.OrderIDs), appConfig.StatusBatchMax))
+		return
 	}
-	logSagaEvent(order.OrderID, "VALIDATE_CUSTOMER", "completed", "Customer validated successfully.")
 
-	// Step 3: Get product prices and calculate the total amount
-	logSagaEvent(order.OrderID, "GET_PRICES", "started", "Getting product prices from inventory service.")
-	totalAmount, err := getPricesAndCalculateTotal(order.Items)
-	if err != nil {
-		log.Printf("Failed to get prices for order %s: %v", order.OrderID, err)
-		logSagaEvent(order.OrderID, "GET_PRICES", "failed", fmt.Sprintf("Failed to get prices: %v", err))
-		compensateSaga(order.OrderID, order, "get_prices_failure")
-		order.Status = "rejected"
-		order.Reason = getCleanErrorMessage(err, "Failed to get prices")
-		return order, err
-	}
-	order.Total = totalAmount
-	log.Printf("Calculated total amount for Order %s: %.2f", order.OrderID, totalAmount)
-	logSagaEvent(order.OrderID, "GET_PRICES", "completed", "Prices obtained and total calculated.")
-
-	// Step 4: Reserve Products in the Inventory
-	logSagaEvent(order.OrderID, "RESERVE_INVENTORY", "started", "Attempting to reserve inventory.")
-	// Pass the entire list of items for the reserve
-	reserveReq := events.InventoryRequestPayload{
-		OrderID: order.OrderID,
-		Items:   order.Items,
-	}
-	resp, err = makeServiceCall(appConfig.InventoryServiceURL+"/reserve", reserveReq)
-	if err != nil || resp["status"] != "success" {
-		log.Printf("Inventory reserve failure for order %s: %v, response: %+v", order.OrderID, err, resp)
-		logSagaEvent(order.OrderID, "RESERVE_INVENTORY", "failed", fmt.Sprintf("Inventory reservation failed: %v", err))
-		compensateSaga(order.OrderID, order, "inventory_failure")
-		order.Status = "rejected"
-		order.Reason = getCleanErrorMessage(err, "Inventory reservation failed")
-		return order, err
-	}
-	log.Printf("Successfully reserved inventory for order %s", order.OrderID)
-	logSagaEvent(order.OrderID, "RESERVE_INVENTORY", "completed", "Inventory reserved successfully.")
-
-	// Step 5: Process Payment
-	logSagaEvent(order.OrderID, "PROCESS_PAYMENT", "started", "Attempting to process payment.")
-	paymentReq := events.PaymentPayload{
-		OrderID:    order.OrderID,
-		CustomerID: order.CustomerID,
-		Amount:     totalAmount,
-	}
-	resp, err = makeServiceCall(appConfig.PaymentServiceURL+"/process", paymentReq)
-	if err != nil || resp["status"] != "success" {
-		log.Printf("Failure to process payment for order %s: %v, response: %+v", order.OrderID, err, resp)
-		logSagaEvent(order.OrderID, "PROCESS_PAYMENT", "failed", fmt.Sprintf("Payment processing failed: %v", err))
-		compensateSaga(order.OrderID, order, "payment_failure")
-		order.Status = "rejected"
-		order.Reason = getCleanErrorMessage(err, "Payment processing failed")
-		return order, err
-	}
-	log.Printf("Payment successfully processed for order %s", order.OrderID)
-	logSagaEvent(order.OrderID, "PROCESS_PAYMENT", "completed", "Payment processed successfully.")
-
-	// Step 6: Order Confirmation
-	logSagaEvent(order.OrderID, "CONFIRM_ORDER", "started", "Attempting to confirm order.")
-	if !updateOrderStatus(order.OrderID, "approved", "Saga completed successfully", &order.Total) {
-		log.Printf("Order confirmation failure for order %s", order.OrderID)
-		logSagaEvent(order.OrderID, "CONFIRM_ORDER", "failed", "Order confirmation failed, requires manual intervention.")
-		order.Status = "failed_confirmation"
-		order.Reason = "Order confirmation failed, requires manual intervention."
-		return order, fmt.Errorf("order confirmation failed")
+	out := make(map[string]BatchStatus, len(req.OrderIDs))
+	sagaStates.RLock()
+	for _, id := range req.OrderIDs {
+		state, ok := sagaStates.Data[id]
+		if !ok {
+			out[id] = BatchStatus{NotFound: true}
+			continue
+		}
+		status := state.OrderStatus
+		if state.Running {
+			status = "running"
+		}
+		updated := state.UpdatedAt
+		out[id] = BatchStatus{State: status, LastStep: state.Step, UpdatedAt: &updated}
 	}
-	log.Printf("Order %s successfully completed!", order.OrderID)
-	logSagaEvent(order.OrderID, "SAGA_COMPLETE", "completed", "Order saga completed successfully.")
-	order.Status = "approved"
-	order.Reason = "Saga completed successfully"
-	return order, nil
+	sagaStates.RUnlock()
+
+	responses.WriteJSON(w, http.StatusOK, out)
+}
+
+// compensationStep describes how compensateSaga undoes a completed forward step.
+type compensationStep struct {
+	Name      string
+	URL       func() string
+	Payload   func(order events.Order) interface{}
+	SkippedBy string // strategy that leaves the step in place
+	Skipped   string // saga log details when the strategy skips it
+	// Run applies the compensation.
+	Run func(ctx context.Context, order events.Order, reason string) error
+	// Ran reports whether the compensation is already in the saga log.
+	Ran func(event SagaEvent) bool
+}
+
+// compensationTable holds the compensations run by compensateSaga and previewed by the compensation plan, keyed by forward step.
+var compensationTable = map[string]compensationStep{
+	"PROCESS_PAYMENT": {
+		Name: "REVERT_PAYMENT",
+		URL:  func() string { return appConfig.PaymentServiceURL + "/revert" },
+		Payload: func(order events.Order) interface{} {
+			return map[string]interface{}{"order_id": order.OrderID, "reason": "<failure reason>"}
+		},
+		SkippedBy: strategyCancelOnly,
+		Skipped:   "Payment left captured by the cancel_only strategy.",
+		Run: func(ctx context.Context, order events.Order, reason string) error {
+			return revertPayment(ctx, order.OrderID, reason)
+		},
+		Ran: func(e SagaEvent) bool {
+			return e.Step == "REVERT_PAYMENT" && (e.Status == "compensated" || e.Status == "skipped")
+		},
+	},
+	"RESERVE_INVENTORY": {
+		Name: "CANCEL_RESERVATION",
+		URL:  func() string { return appConfig.InventoryServiceURL + "/cancel_reservation" },
+		Payload: func(order events.Order) interface{} {
+			return events.InventoryRequestPayload{OrderID: order.OrderID, Items: order.Items, Reason: "<failure reason>"}
+		},
+		SkippedBy: strategyRefundOnly,
+		Skipped:   "Reservation kept by the refund_only strategy.",
+		Run: func(ctx context.Context, order events.Order, reason string) error {
+			// Pass the entire list of items to inventory clearing
+			return cancelInventoryReservation(ctx, order.OrderID, order.Items, reason)
+		},
+		Ran: func(e SagaEvent) bool {
+			return e.Step == "CANCEL_RESERVATION" && (e.Status == "compensated" || e.Status == "skipped")
+		},
+	},
+	"CREATE_ORDER": {
+		Name: "REJECT_ORDER",
+		URL:  func() string { return appConfig.OrderServiceURL + "/update_status" },
+		Payload: func(order events.Order) interface{} {
+			return events.OrderStatusUpdatePayload{OrderID: order.OrderID, Status: "rejected", Reason: "<failure reason>", Total: order.Total, ShippingCost: order.ShippingCost}
+		},
+		Run: func(ctx context.Context, order events.Order, reason string) error {
+			if !updateOrderStatus(ctx, policy(policyCompensation), &order, "rejected", reason) {
+				return fmt.Errorf("order %s could not be marked as rejected", order.OrderID)
+			}
+			return nil
+		},
+		Ran: func(e SagaEvent) bool {
+			return e.Step == "UPDATE_ORDER_STATUS" && e.Status == "completed" && e.Details == "Order status updated to rejected"
+		},
+	},
 }
 
-// The compensateSaga function now receives the full order object
-func compensateSaga(orderID string, order events.Order, reason string) {
-	log.Printf("Start of compensation for order %s due to: %s", orderID, reason)
-	logSagaEvent(orderID, "SAGA_COMPENSATION", "started", fmt.Sprintf("Compensation initiated due to %s", reason))
+// PlannedCompensation is an action compensateSaga would run for a saga.
+type PlannedCompensation struct {
+	Step              string      `json:"step"`
+	Compensates       string      `json:"compensates"`
+	TargetURL         string      `json:"target_url"`
+	Payload           interface{} `json:"payload"`
+	AlreadyRan        bool        `json:"already_ran"`
+	SkippedByStrategy bool        `json:"skipped_by_strategy"`
+}
 
+// compensationPlanHandler serves GET /saga/{id}/compensation_plan: the compensations that would run,
+// in order, for the completed steps of the saga. Nothing is executed.
+func compensationPlanHandler(w http.ResponseWriter, _ *http.Request, orderID string) {
 	sagaLog.RLock()
-	eventsLogged := sagaLog.Events[orderID]
+	eventsLogged, ok := sagaLog.Events[orderID]
 	sagaLog.RUnlock()
+	sagaOrders.RLock()
+	order, known := sagaOrders.Data[orderID]
+	sagaOrders.RUnlock()
+	if !ok || !known {
+		responses.WriteNotFound(w, "saga", orderID)
+		return
+	}
 
-	// Iterate events in reverse order to compensate
-	for i := len(eventsLogged) - 1; i >= 0; i-- {
-		event := eventsLogged[i]
-		if event.Status == "completed" {
-			switch event.Step {
-			case "PROCESS_PAYMENT":
-				revertPayment(orderID, reason)
-			case "RESERVE_INVENTORY":
-				// Pass the entire list of items to inventory clearing
-				cancelInventoryReservation(orderID, order.Items, reason)
-			case "CREATE_ORDER":
-				updateOrderStatus(orderID, "rejected", reason, &order.Total)
+	strategy := appConfig.CompensationStrategy
+	plan := []PlannedCompensation{}
+	if strategy != strategyManual {
+		// Same order as compensateSaga: the completed steps, most recent first.
+		for i := len(eventsLogged) - 1; i >= 0; i-- {
+			event := eventsLogged[i]
+			step, ok := compensationTable[event.Step]
+			if !ok || event.Status != "completed" {
+				continue
 			}
+			action := PlannedCompensation{
+				Step:              step.Name,
+				Compensates:       event.Step,
+				TargetURL:         step.URL(),
+				Payload:           step.Payload(order),
+				SkippedByStrategy: step.SkippedBy == strategy,
+				AlreadyRan:        compensationRan(step, eventsLogged),
+			}
+			plan = append(plan, action)
 		}
 	}
-	log.Printf("SAGA compensation for order %s completed.", orderID)
-	logSagaEvent(orderID, "SAGA_COMPENSATION", "completed", "Saga compensation completed.")
+
+	w.Header().Set(contentType, contentTypeJSON)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"order_id": orderID,
+		"status":   order.Status,
+		"strategy": strategy,
+		"actions":  plan,
+	})
 }
 
 // getPricesAndCalculateTotal fetches prices from the inventory service and calculates the total.
-func getPricesAndCalculateTotal(items []events.OrderItem) (float64, error) {
+func getPricesAndCalculateTotal(ctx context.Context, items []events.OrderItem) (float64, error) {
+	prices, err := getPrices(ctx, items)
+	if err != nil {
+		return 0, err
+	}
 	var totalAmount float64
 	for i, item := range items {
-		priceReq := map[string]string{"product_id": item.ProductID}
-		resp, err := makeServiceCall(appConfig.InventoryServiceURL+"/get_price", priceReq)
-		if err != nil {
-			return 0, fmt.Errorf("could not get price for product %s: %w", item.ProductID, err)
-		}
-		priceStr, ok := resp["price"].(string)
+		price, ok := prices[item.ProductID]
 		if !ok {
-			return 0, fmt.Errorf("price for product %s is not a string: %+v", item.ProductID, resp)
+			return 0, fmt.Errorf("no price returned for product %s", item.ProductID)
 		}
-		price, err := strconv.ParseFloat(priceStr, 64)
-		if err != nil {
-			return 0, fmt.Errorf("could not parse price for product %s from response: %+v", item.ProductID, resp)
+		if v := order_policy.CheckPrice(item.ProductID, price); v != nil {
+			return 0, v
 		}
 		items[i].Price = price
-		if items[i].Price <= 0 {
-			return 0, fmt.Errorf("product %s has an invalid price: %.2f", item.ProductID, items[i].Price)
-		}
 		totalAmount += items[i].Price * float64(item.Quantity)
 	}
 	return totalAmount, nil
 }
 
+// getPrices asks /get_prices for the prices of all the items in one call. An inventory service
+// answering 404 without a reason code predates the endpoint and is asked item by item instead.
+func getPrices(ctx context.Context, items []events.OrderItem) (map[string]float64, error) {
+	req := events.PricesRequest{ProductIDs: make([]string, 0, len(items))}
+	for _, item := range items {
+		if !slices.Contains(req.ProductIDs, item.ProductID) {
+			req.ProductIDs = append(req.ProductIDs, item.ProductID)
+		}
+	}
+	var resp events.PricesResponse
+	err := makeServiceCall(ctx, policy(policyInventory), appConfig.InventoryServiceURL+"/get_prices", req, &resp)
+	var serviceErr *ServiceError
+	if errors.As(err, &serviceErr) && serviceErr.Status == http.StatusNotFound && serviceErr.ReasonCode == "" {
+		correlation.Printf(ctx, "Inventory service has no /get_prices, getting the prices one by one")
+		return getPricesOneByOne(ctx, req.ProductIDs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get prices: %w", err)
+	}
+	return resp.Prices, nil
+}
+
+// getPricesOneByOne calls /get_price for each product, for inventory services without /get_prices.
+func getPricesOneByOne(ctx context.Context, productIDs []string) (map[string]float64, error) {
+	prices := make(map[string]float64, len(productIDs))
+	for _, id := range productIDs {
+		priceReq := map[string]string{"product_id": id}
+		var priceResp struct {
+			Price string `json:"price"`
+		}
+		if err := makeServiceCall(ctx, policy(policyInventory), appConfig.InventoryServiceURL+"/get_price", priceReq, &priceResp); err != nil {
+			return nil, fmt.Errorf("could not get price for product %s: %w", id, err)
+		}
+		price, err := strconv.ParseFloat(priceResp.Price, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse price for product %s from response: %q", id, priceResp.Price)
+		}
+		prices[id] = price
+	}
+	return prices, nil
+}
+
 // Helper function to update order status
-func updateOrderStatus(orderID, status, reason string, total *float64) bool {
+func updateOrderStatus(ctx context.Context, p StepPolicy, order *events.Order, status, reason string) bool {
+	orderID := order.OrderID
 	logSagaEvent(orderID, "UPDATE_ORDER_STATUS", "started", fmt.Sprintf("Updating order status to %s", status))
 	updateReq := events.OrderStatusUpdatePayload{
-		OrderID: orderID,
-		Status:  status,
-		Reason:  reason,
-	}
-	if total != nil {
-		updateReq.Total = *total
+		OrderID:      orderID,
+		Status:       status,
+		Reason:       reason,
+		Total:        order.Total,
+		ShippingCost: order.ShippingCost,
 	}
-	resp, err := makeServiceCall(appConfig.OrderServiceURL+"/update_status", updateReq)
-	if err != nil || resp["status"] != "success" {
-		log.Printf("Error updating order status for %s: %v, response: %+v", orderID, err, resp)
+	if err := makeServiceCall(ctx, p, appConfig.OrderServiceURL+"/update_status", updateReq, nil); err != nil {
+		log.Printf("Error updating order status for %s: %v", orderID, err)
 		logSagaEvent(orderID, "UPDATE_ORDER_STATUS", "failed", fmt.Sprintf("Failed to update order status: %v", err))
 		return false
 	}
@@ -330,93 +2147,226 @@ func updateOrderStatus(orderID, status, reason string, total *float64) bool {
 	return true
 }
 
+// quoteShipping asks the shipping service the cost of shipping the order, with the retries of
+// the shipping policy. Without a shipping service, or once the quote fails, it returns the flat rate
+// so that a shipping outage does not fail the saga.
+func quoteShipping(ctx context.Context, order *events.Order) float64 {
+	if appConfig.ShippingServiceURL == "" {
+		return appConfig.ShippingFlatRate
+	}
+	quoteReq := events.ShippingQuoteRequest{OrderID: order.OrderID, Address: order.Address, Items: order.Items}
+	var quote events.ShippingQuote
+	if err := makeServiceCall(ctx, policy(policyShipping), appConfig.ShippingServiceURL+"/quote", quoteReq, &quote); err != nil {
+		log.Printf("Shipping quote failed for order %s, using the flat rate %.2f: %v", order.OrderID, appConfig.ShippingFlatRate, err)
+		logSagaEvent(order.OrderID, "GET_SHIPPING_QUOTE", "fallback", fmt.Sprintf("Quote failed, flat rate %.2f applied: %v", appConfig.ShippingFlatRate, err))
+		return appConfig.ShippingFlatRate
+	}
+	return quote.Cost
+}
+
+// commitReservation tells the inventory service the reservation is paid for. A failure is logged
+// as a "warning" saga event: the stock stays reserved until its TTL and may then be released.
+func commitReservation(ctx context.Context, orderID string) {
+	commitReq := events.InventoryRequestPayload{OrderID: orderID}
+	if err := makeServiceCall(ctx, policy(policyInventory), appConfig.InventoryServiceURL+"/commit_reservation", commitReq, nil); err != nil {
+		log.Printf("Reservation commit failed for order %s: %v", orderID, err)
+		logSagaEvent(orderID, "COMMIT_RESERVATION", "warning", fmt.Sprintf("Reservation not committed: %v", err))
+	}
+}
+
+// verifyOrder reads the order back from the order service and checks it is still pending,
+// so that no payment is taken for an order that was not stored or was already closed.
+func verifyOrder(ctx context.Context, orderID string) error {
+	url := appConfig.OrderServiceURL + "/orders/" + orderID
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error when creating HTTP request: %w", err)
+	}
+	correlation.Inject(ctx, req)
+	client := tlsconfig.Client(policy(policyOrder).Timeout)
+	resp, err := client.Do(req)
+	if err != nil {
+		logSagaEvent(orderID, "VERIFY_ORDER", "failed", fmt.Sprintf("Order service unreachable: %v", err))
+		return fmt.Errorf("error in request to service %s: %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var order events.Order
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		logSagaEvent(orderID, "VERIFY_ORDER", "failed", "Order not found in the order service.")
+		return &ServiceError{URL: url, Status: resp.StatusCode, ReasonCode: events.ReasonOrderNotFound, Message: "Order not found before payment"}
+	case resp.StatusCode != http.StatusOK:
+		logSagaEvent(orderID, "VERIFY_ORDER", "failed", fmt.Sprintf("Order service responded with status %d", resp.StatusCode))
+		return &ServiceError{URL: url, Status: resp.StatusCode, Message: "Order could not be verified before payment"}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+		return fmt.Errorf("error in parsing the JSON response: %w", err)
+	}
+	if order.Status != "pending" {
+		logSagaEvent(orderID, "VERIFY_ORDER", "failed", fmt.Sprintf("Order is %s, not pending.", order.Status))
+		return &ServiceError{URL: url, Status: resp.StatusCode, ReasonCode: events.ReasonInvalidRequest, Message: "Order is " + order.Status + ", not pending"}
+	}
+	logSagaEvent(orderID, "VERIFY_ORDER", "completed", "Order verified before payment.")
+	return nil
+}
+
 // Helper function to offset payment
-func revertPayment(orderID string, reason string) {
+func revertPayment(ctx context.Context, orderID string, reason string) error {
 	logSagaEvent(orderID, "REVERT_PAYMENT", "compensating", "Attempting to revert payment.")
 	revertReq := map[string]interface{}{
 		"order_id": orderID,
 		"reason":   reason,
 	}
-	resp, err := makeServiceCall(appConfig.PaymentServiceURL+"/revert", revertReq)
-	if err != nil || resp["status"] != "success" {
-		log.Printf("Failure to offset payment for order %s: %v, response: %+v", orderID, err, resp)
+	if err := makeServiceCall(ctx, policy(policyCompensation), appConfig.PaymentServiceURL+"/revert", revertReq, nil); err != nil {
+		log.Printf("Failure to offset payment for order %s: %v", orderID, err)
 		logSagaEvent(orderID, "REVERT_PAYMENT", "failed", "Payment reversion failed, manual intervention might be needed.")
-	} else {
-		log.Printf("Payment for order %s successfully compensated.", orderID)
-		logSagaEvent(orderID, "REVERT_PAYMENT", "compensated", "Payment reverted successfully.")
+		return err
 	}
+	log.Printf("Payment for order %s successfully compensated.", orderID)
+	logSagaEvent(orderID, "REVERT_PAYMENT", "compensated", "Payment reverted successfully.")
+	return nil
 }
 
 // Helper function to cancel inventory reservation
-func cancelInventoryReservation(orderID string, items []events.OrderItem, reason string) {
+func cancelInventoryReservation(ctx context.Context, orderID string, items []events.OrderItem, reason string) error {
 	logSagaEvent(orderID, "CANCEL_RESERVATION", "compensating", "Attempting to cancel inventory reservation.")
 	cancelReq := events.InventoryRequestPayload{
 		OrderID: orderID,
 		Items:   items,
 		Reason:  reason,
 	}
-	resp, err := makeServiceCall(appConfig.InventoryServiceURL+"/cancel_reservation", cancelReq)
-	if err != nil || resp["status"] != "success" {
-		log.Printf("Inventory compensation failure for order %s: %v, response: %+v", orderID, err, resp)
+	if err := makeServiceCall(ctx, policy(policyCompensation), appConfig.InventoryServiceURL+"/cancel_reservation", cancelReq, nil); err != nil {
+		log.Printf("Inventory compensation failure for order %s: %v", orderID, err)
 		logSagaEvent(orderID, "CANCEL_RESERVATION", "failed", "Inventory reservation cancellation failed, manual intervention might be needed.")
-	} else {
-		log.Printf("Inventory reserve for order %s successfully compensated.", orderID)
-		logSagaEvent(orderID, "CANCEL_RESERVATION", "compensated", "Inventory reservation cancelled successfully.")
+		return err
 	}
+	log.Printf("Inventory reserve for order %s successfully compensated.", orderID)
+	logSagaEvent(orderID, "CANCEL_RESERVATION", "compensated", "Inventory reservation cancelled successfully.")
+	return nil
 }
 
-// Function for making HTTP calls to services
-func makeServiceCall(url string, payload interface{}) (map[string]interface{}, error) {
+// makeServiceCall POSTs payload to a service as JSON.
+// Success is signalled by any 2xx status; out, when not nil, receives the decoded body.
+// Failures come back as a *ServiceError carrying the reason code of the error envelope.
+func makeServiceCall(ctx context.Context, policy StepPolicy, url string, payload, out interface{}) error {
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		return nil, fmt.Errorf("payload marshalling error: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return nil, fmt.Errorf("error when creating HTTP request: %w", err)
+		return fmt.Errorf("payload marshalling error: %w", err)
 	}
-	req.Header.Set(contentType, contentTypeJSON)
 
-	client := &http.Client{Timeout: appConfig.ServiceCallTimeout}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error in request to service %s: %w", url, err)
-	}
+	record := CallRecord{URL: url, StartedAt: time.Now()}
 	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Warning: Error closing HTTP response body from %s: %v", url, err)
-		}
+		record.DurationMs = time.Since(record.StartedAt).Milliseconds()
+		recordCall(ctx, record)
 	}()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error in reading the answer: %w", err)
+	client := tlsconfig.Client(policy.Timeout)
+	var resp *http.Response
+	var body []byte
+	for attempt := 1; ; attempt++ {
+		record.Attempts = attempt
+		// A new request per attempt, since the body of the previous one has been consumed.
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonPayload))
+		if err != nil {
+			return fmt.Errorf("error when creating HTTP request: %w", err)
+		}
+		req.Header.Set(contentType, contentTypeJSON)
+		correlation.Inject(ctx, req)
+
+		resp, err = client.Do(req)
+		if err != nil {
+			record.Error = err.Error()
+			return fmt.Errorf("error in request to service %s: %w", url, err)
+		}
+		record.StatusCode = resp.StatusCode
+		body, err = io.ReadAll(resp.Body)
+		if cerr := resp.Body.Close(); cerr != nil {
+			correlation.Printf(ctx, "Warning: Error closing HTTP response body from %s: %v", url, cerr)
+		}
+		if err != nil {
+			return fmt.Errorf("error in reading the answer: %w", err)
+		}
+
+		if !retryableStatus(resp.StatusCode) || attempt >= policy.MaxAttempts {
+			break
+		}
+		retryAfter := resp.Header.Get("Retry-After")
+		delay, ok := retryDelay(ctx, policy.Backoff, retryAfter, attempt)
+		if !ok {
+			correlation.Printf(ctx, "Not retrying %s: waiting for Retry-After %q would exceed the saga deadline", url, retryAfter)
+			break
+		}
+		correlation.Printf(ctx, "Service %s answered %d (attempt %d/%d), retrying in %s (Retry-After %q)",
+			url, resp.StatusCode, attempt, policy.MaxAttempts, delay, retryAfter)
+		record.RetryWaitMs += delay.Milliseconds()
+		select {
+		case <-sagaClock.After(delay):
+		case <-ctx.Done():
+			record.Error = ctx.Err().Error()
+			return fmt.Errorf("retry of %s interrupted: %w", url, ctx.Err())
+		}
 	}
 
-	if resp.StatusCode >= 400 {
-		var errorResult map[string]interface{}
-		_ = json.Unmarshal(body, &errorResult)
-		errorMessage, _ := errorResult["message"].(string)
-		if errorMessage == "" {
-			errorMessage = string(body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var envelope events.ErrorResponse
+		_ = json.Unmarshal(body, &envelope)
+		if envelope.Message == "" {
+			envelope.Message = strings.TrimSpace(string(body))
 		}
-		return nil, &ServiceError{URL: url, Status: resp.StatusCode, Message: errorMessage}
+		return &ServiceError{URL: url, Status: resp.StatusCode, ReasonCode: envelope.ReasonCode, Message: envelope.Message, Shortages: envelope.Shortages}
 	}
 
-	var result map[string]interface{}
-	err = json.Unmarshal(body, &result)
-	if err != nil {
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
 		// Log the raw body if JSON unmarshalling fails to aid debugging
-		log.Printf("Error unmarshalling JSON response from %s. Raw body: %s. Error: %v", url, string(body), err)
-		return nil, fmt.Errorf("error in parsing the JSON response: %w", err)
+		correlation.Printf(ctx, "Error unmarshalling JSON response from %s. Raw body: %s. Error: %v", url, string(body), err)
+		return fmt.Errorf("error in parsing the JSON response: %w", err)
 	}
+	return nil
+}
+
+// retryableStatus reports whether the downstream service asked the caller to come back later.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// retryBaseDelay is the default first backoff; it doubles on every attempt.
+const retryBaseDelay = 200 * time.Millisecond
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
-		return result, fmt.Errorf("the service %s answered with status %d: %s", url, resp.StatusCode, body)
+// maxRetryBackoff caps the computed backoff; a longer Retry-After is still honored.
+const maxRetryBackoff = 5 * time.Second
+
+// retryDelay returns max(Retry-After, computed backoff) as the wait before the next attempt.
+// ok is false when the wait would go past the deadline of ctx.
+func retryDelay(ctx context.Context, backoff time.Duration, retryAfter string, attempt int) (delay time.Duration, ok bool) {
+	delay = backoff << (attempt - 1)
+	if delay > maxRetryBackoff || delay <= 0 {
+		delay = maxRetryBackoff
+	}
+	if header := parseRetryAfter(retryAfter); header > delay {
+		delay = header
 	}
+	if deadline, set := ctx.Deadline(); set && time.Now().Add(delay).After(deadline) {
+		return 0, false
+	}
+	return delay, true
+}
 
-	return result, nil
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
 }
 
 // Log an event in the SAGA log
@@ -425,17 +2375,37 @@ func logSagaEvent(orderID, step, status, details string) {
 		OrderID:   orderID,
 		Step:      step,
 		Status:    status,
-		Timestamp: time.Now(),
+		Timestamp: sagaClock.Now(),
 		Details:   details,
 	}
 
+	now := time.Now()
 	sagaLog.Lock()
 	sagaLog.Events[orderID] = append(sagaLog.Events[orderID], event)
+	prune := now.Sub(sagaLog.LastPrune) >= sagaPruneInterval
+	if prune {
+		sagaLog.LastPrune = now
+	}
 	sagaLog.Unlock()
+	trackSagaState(event)
+	// In the background, as the caller may hold locks that pruneSagas takes, e.g. deadLetters
+	// while a dead letter is retried.
+	if prune {
+		go pruneSagas(now)
+	}
 
 	log.Printf("[SAGA Event] Order: %s, Step: %s, Status: %s, Details: %s", orderID, step, status, details)
 }
 
+// serviceReasonCode returns the reason code reported by a failed service call, if any.
+func serviceReasonCode(err error) string {
+	var serviceErr *ServiceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.ReasonCode
+	}
+	return ""
+}
+
 // getCleanErrorMessage extracts a user-friendly message from a ServiceError.
 func getCleanErrorMessage(err error, defaultMessage string) string {
 	var serviceErr *ServiceError
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/maintenance"
+)
+
+// A saga already running when read-only mode is enabled goes on to approve its order, while
+// the orders arriving afterwards are refused before any downstream call.
+func TestReadOnlySparesInFlightSagas(t *testing.T) {
+	services := newFakeServices(t)
+	paying, release := make(chan struct{}), make(chan struct{})
+	payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(paying)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer payment.Close()
+	appConfig.PaymentServiceURL = payment.URL
+	t.Cleanup(func() { maintenance.Set(false, 0, "") })
+
+	create := maintenance.Guard(createOrderHandler)
+	post := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		create(rec, httptest.NewRequest(http.MethodPost, "/create_order",
+			strings.NewReader(`{"customer_id":"user1","items":[{"product_id":"mouse-wireless","quantity":1}]}`)))
+		return rec
+	}
+
+	inFlight := make(chan *httptest.ResponseRecorder, 1)
+	go func() { inFlight <- post() }()
+	select {
+	case <-paying:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the saga never reached the payment")
+	}
+	maintenance.Set(true, 30, "")
+	callsBefore := len(services.Calls())
+
+	if rec := post(); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "30" {
+		t.Errorf("new order answered %d (Retry-After %q) while read-only, want 503", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if n := len(services.Calls()); n != callsBefore {
+		t.Errorf("the refused order made %d downstream calls", n-callsBefore)
+	}
+
+	close(release)
+	select {
+	case rec := <-inFlight:
+		if rec.Code != http.StatusOK {
+			t.Errorf("in-flight saga answered %d, want 200: %s", rec.Code, rec.Body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the in-flight saga never completed")
+	}
+	if calls := services.Calls(); !slices.Contains(calls, "/update_status approved") {
+		t.Errorf("in-flight saga made the calls %v, want its order approved", calls)
+	}
+}
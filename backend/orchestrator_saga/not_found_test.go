@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// The saga endpoints answer an unknown order id, or a path naming nothing, with the shared 404 body.
+func TestUnknownSagaNotFound(t *testing.T) {
+	for _, tc := range []struct {
+		handler  http.HandlerFunc
+		method   string
+		path     string
+		resource string
+		id       string
+	}{
+		{sagaHandler, http.MethodGet, "/saga/bogus-id", "saga", "bogus-id"},
+		{sagaHandler, http.MethodGet, "/saga/bogus-id/status", "saga", "bogus-id"},
+		{sagaHandler, http.MethodGet, "/saga/bogus-id/compensation_plan", "saga", "bogus-id"},
+		{sagaHandler, http.MethodGet, "/saga/", "saga", ""},
+		{sagaHandler, http.MethodGet, "/saga/bogus-id/bogus", "saga", "bogus-id/bogus"},
+		{retryDeadLetterHandler, http.MethodPost, "/saga/dead-letters/bogus-id/retry", "dead_letters", "bogus-id"},
+		{retryDeadLetterHandler, http.MethodPost, "/saga/dead-letters/bogus-id/bogus", "dead_letters", "bogus-id/bogus"},
+	} {
+		rec := httptest.NewRecorder()
+		tc.handler(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		var body events.NotFoundResponse
+		if rec.Code != http.StatusNotFound || json.NewDecoder(rec.Body).Decode(&body) != nil {
+			t.Errorf("%s answered %d: %s", tc.path, rec.Code, rec.Body)
+			continue
+		}
+		if body != (events.NotFoundResponse{Code: events.CodeNotFound, Resource: tc.resource, ID: tc.id}) {
+			t.Errorf("%s body = %+v", tc.path, body)
+		}
+	}
+}
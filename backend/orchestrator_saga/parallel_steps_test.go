@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// slowServices delays the answers of the paths in slow by delay.
+func slowServices(t testing.TB, services *fakeServices, delay time.Duration, slow ...string) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(slow, r.URL.Path) {
+			time.Sleep(delay)
+		}
+		services.serve(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	appConfig.OrderServiceURL = srv.URL
+	appConfig.InventoryServiceURL = srv.URL
+	appConfig.PaymentServiceURL = srv.URL
+	appConfig.AuthServiceURL = srv.URL
+}
+
+func parallelOrder() events.Order {
+	return newSagaOrder(events.Order{CustomerID: "user1", Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 1}}})
+}
+
+// With the auth and price services both slow, the saga waits for them once, not twice.
+func TestValidationAndPricesRunTogether(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	services := newFakeServices(t)
+	slowServices(t, services, delay, "/validate", "/get_prices")
+
+	start := time.Now()
+	result, err := executeOrderSaga(correlation.NewID(), parallelOrder())
+	elapsed := time.Since(start)
+	if err != nil || result.Status != "approved" {
+		t.Fatalf("saga ended %q: %v", result.Status, err)
+	}
+	if elapsed >= 2*delay {
+		t.Errorf("saga took %s, want less than the %s of two sequential slow calls", elapsed, 2*delay)
+	}
+}
+
+// When both parallel steps fail, both failures are logged in step order and the saga always
+// aborts on the first step.
+func TestParallelStepsFailTogether(t *testing.T) {
+	services := newFakeServices(t)
+	services.Fail["/validate"] = http.StatusInternalServerError
+	services.Fail["/get_prices"] = http.StatusInternalServerError
+
+	for i := 0; i < 10; i++ {
+		result, err := executeOrderSaga(correlation.NewID(), parallelOrder())
+		if err == nil {
+			t.Fatal("saga succeeded with the auth and price services failing")
+		}
+		if result.FailedStep != "VALIDATE_CUSTOMER" {
+			t.Fatalf("saga aborted on %q, want VALIDATE_CUSTOMER", result.FailedStep)
+		}
+
+		sagaLog.RLock()
+		logged := slices.Clone(sagaLog.Events[result.OrderID])
+		sagaLog.RUnlock()
+		var steps []string
+		for _, e := range logged {
+			if e.Step == "VALIDATE_CUSTOMER" || e.Step == "GET_PRICES" {
+				steps = append(steps, e.Step+" "+e.Status)
+			}
+		}
+		want := []string{"VALIDATE_CUSTOMER started", "GET_PRICES started", "VALIDATE_CUSTOMER failed", "GET_PRICES failed"}
+		if !slices.Equal(steps, want) {
+			t.Fatalf("saga log = %v, want %v", steps, want)
+		}
+		if n := countCalls(services.Calls(), "/reserve"); n != 0 {
+			t.Fatalf("inventory reserved %d times after the parallel steps failed", n)
+		}
+	}
+}
+
+func BenchmarkSagaSlowAuthAndPrices(b *testing.B) {
+	services := newFakeServices(b)
+	slowServices(b, services, 20*time.Millisecond, "/validate", "/get_prices")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := executeOrderSaga(correlation.NewID(), parallelOrder()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
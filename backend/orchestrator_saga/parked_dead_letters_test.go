@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// listedFor returns the compensations and states listed by handler at target for orderID.
+func listedFor(t *testing.T, handler http.HandlerFunc, target, orderID string) []string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	var entries []DeadLetter
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&entries) != nil {
+		t.Fatalf("%s answered %d: %s", target, rec.Code, rec.Body)
+	}
+	var out []string
+	for _, e := range entries {
+		if e.OrderID == orderID {
+			out = append(out, e.Compensation+" "+e.State)
+		}
+	}
+	return out
+}
+
+// A saga parked by the manual strategy shows on the dead-letter list with the compensations it
+// left pending, next to the failed ones, and /saga/needs_review keeps only the parked ones.
+func TestParkedSagaListedWithDeadLetters(t *testing.T) {
+	newFakeServices(t)
+	appConfig.CompensationStrategy = strategyManual
+	parked, failed := newOrderID(), newOrderID()
+	for _, step := range []string{"CREATE_ORDER", "RESERVE_INVENTORY", "PROCESS_PAYMENT"} {
+		logSagaEvent(parked, step, "completed", "done")
+	}
+	order := events.Order{OrderID: parked, Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 1}}}
+	if status := compensateSaga(context.Background(), parked, order, "shipping failed"); status != "needs_review" {
+		t.Fatalf("order left %q, want needs_review", status)
+	}
+	addDeadLetter(events.Order{OrderID: failed}, "REVERT_PAYMENT", "shipping failed", errors.New("payment service down"))
+	t.Cleanup(func() {
+		reviewQueue.Lock()
+		delete(reviewQueue.Entries, parked)
+		reviewQueue.Unlock()
+		deadLetters.Lock()
+		delete(deadLetters.Entries, failed+"/REVERT_PAYMENT")
+		deadLetters.Unlock()
+	})
+
+	pending := []string{"REVERT_PAYMENT needs_review", "CANCEL_RESERVATION needs_review", "REJECT_ORDER needs_review"}
+	for _, tc := range []struct {
+		handler http.HandlerFunc
+		target  string
+		parked  []string
+		failed  []string
+	}{
+		{deadLettersHandler, "/saga/dead-letters", pending, []string{"REVERT_PAYMENT failed"}},
+		{deadLettersHandler, "/saga/dead-letters?state=needs_review", pending, nil},
+		{deadLettersHandler, "/saga/dead-letters?state=failed", nil, []string{"REVERT_PAYMENT failed"}},
+		{needsReviewHandler, "/saga/needs_review", pending, nil},
+	} {
+		if got := listedFor(t, tc.handler, tc.target, parked); !slices.Equal(got, tc.parked) {
+			t.Errorf("%s lists %v for the parked saga, want %v", tc.target, got, tc.parked)
+		}
+		if got := listedFor(t, tc.handler, tc.target, failed); !slices.Equal(got, tc.failed) {
+			t.Errorf("%s lists %v for the failed compensation, want %v", tc.target, got, tc.failed)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	deadLettersHandler(rec, httptest.NewRequest(http.MethodGet, "/saga/dead-letters?state=bogus", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown state answered %d, want 400", rec.Code)
+	}
+}
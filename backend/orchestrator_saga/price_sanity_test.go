@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// A product priced out of the sanity bounds fails the saga before anything is reserved or charged.
+func TestSagaRejectsInsanePrices(t *testing.T) {
+	for _, price := range []float64{0, -5, 1e9} {
+		t.Run(fmt.Sprint(price), func(t *testing.T) {
+			services := newFakeServices(t)
+			services.Prices["mouse-wireless"] = price
+
+			order := newSagaOrder(events.Order{CustomerID: "user1", Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 1}}})
+			result, err := executeOrderSaga(correlation.NewID(), order)
+			if err == nil || result.Order.Status != "rejected" {
+				t.Fatalf("saga ended %q (%v), want rejected", result.Order.Status, err)
+			}
+			if result.Order.ReasonCode != events.ReasonPriceSanity {
+				t.Errorf("reason code %q, want %s", result.Order.ReasonCode, events.ReasonPriceSanity)
+			}
+			calls := services.Calls()
+			if slices.Contains(calls, "/reserve") || slices.Contains(calls, "/process") {
+				t.Errorf("service calls %v: reserved or charged at a price of %.2f", calls, price)
+			}
+		})
+	}
+}
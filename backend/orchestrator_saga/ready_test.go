@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// healthStub answers /health with status and counts the probes.
+func healthStub(t *testing.T, status int, probes *atomic.Int32) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			probes.Add(1)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func getReady(t *testing.T) (int, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	readyHandler(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, body
+}
+
+// One downstream service down makes the orchestrator not ready, naming only that service, and
+// the probes are not repeated while the result is cached.
+func TestReadyWithServiceDown(t *testing.T) {
+	var probes atomic.Int32
+	appConfig = Config{
+		OrderServiceURL:     healthStub(t, http.StatusOK, &probes),
+		InventoryServiceURL: healthStub(t, http.StatusOK, &probes),
+		PaymentServiceURL:   healthStub(t, http.StatusServiceUnavailable, &probes),
+		AuthServiceURL:      healthStub(t, http.StatusOK, &probes),
+	}
+	readiness.Lock()
+	readiness.Checked = time.Time{}
+	readiness.Unlock()
+
+	code, body := getReady(t)
+	if code != http.StatusServiceUnavailable || body["status"] != "not_ready" {
+		t.Fatalf("answered %d %v, want 503 not_ready", code, body)
+	}
+	unhealthy, _ := body["unhealthy"].(map[string]interface{})
+	if len(unhealthy) != 1 || unhealthy["payment-service"] == nil {
+		t.Errorf("unhealthy = %v, want the payment service only", unhealthy)
+	}
+	if n := probes.Load(); n != 4 {
+		t.Errorf("%d probes, want one per service", n)
+	}
+
+	if code, _ := getReady(t); code != http.StatusServiceUnavailable {
+		t.Errorf("cached answer %d, want 503", code)
+	}
+	if n := probes.Load(); n != 4 {
+		t.Errorf("%d probes after a second request, want the cached result used", n)
+	}
+
+	// Past the cache, the recovered service makes the orchestrator ready again.
+	appConfig.PaymentServiceURL = healthStub(t, http.StatusOK, &probes)
+	readiness.Lock()
+	readiness.Checked = time.Now().Add(-readinessCacheTTL - time.Second)
+	readiness.Unlock()
+	if code, body := getReady(t); code != http.StatusOK || body["status"] != "ready" {
+		t.Errorf("answered %d %v, want 200 ready", code, body)
+	}
+}
+
+// A service that cannot be reached counts as down.
+func TestReadyWithServiceUnreachable(t *testing.T) {
+	var probes atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+	appConfig = Config{
+		OrderServiceURL:     down.URL,
+		InventoryServiceURL: healthStub(t, http.StatusOK, &probes),
+		PaymentServiceURL:   healthStub(t, http.StatusOK, &probes),
+		AuthServiceURL:      healthStub(t, http.StatusOK, &probes),
+	}
+	readiness.Lock()
+	readiness.Checked = time.Time{}
+	readiness.Unlock()
+
+	code, body := getReady(t)
+	unhealthy, _ := body["unhealthy"].(map[string]interface{})
+	if code != http.StatusServiceUnavailable || len(unhealthy) != 1 || unhealthy["order-service"] == nil {
+		t.Errorf("answered %d %v, want the order service unhealthy", code, body)
+	}
+}
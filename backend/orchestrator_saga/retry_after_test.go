@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/clock"
+)
+
+// throttled answers 429 with the given Retry-After to the first request and 200 afterwards.
+func throttled(t *testing.T, retryAfter string) (string, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &hits
+}
+
+func withFakeSagaClock(t *testing.T) *clock.Fake {
+	t.Helper()
+	fake := clock.NewFake(time.Now())
+	prev := sagaClock
+	sagaClock = fake
+	t.Cleanup(func() { sagaClock = prev })
+	return fake
+}
+
+// The retry waits for the longer of Retry-After and the computed backoff, and not a moment less.
+func TestRetryAfterHonored(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		backoff    time.Duration
+		wait       time.Duration
+	}{
+		{name: "Retry-After longer than the backoff", retryAfter: "3", backoff: 100 * time.Millisecond, wait: 3 * time.Second},
+		{name: "backoff longer than Retry-After", retryAfter: "1", backoff: 2 * time.Second, wait: 2 * time.Second},
+		{name: "unparsable Retry-After", retryAfter: "soon", backoff: 100 * time.Millisecond, wait: 100 * time.Millisecond},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := withFakeSagaClock(t)
+			url, hits := throttled(t, tc.retryAfter)
+			appConfig.MaxCallsPerSaga = 10
+			ctx, collector := withCallCollector(context.Background())
+
+			done := make(chan error, 1)
+			go func() {
+				done <- makeServiceCall(ctx, StepPolicy{MaxAttempts: 3, Timeout: time.Second, Backoff: tc.backoff}, url+"/process", struct{}{}, nil)
+			}()
+			deadline := time.Now().Add(2 * time.Second)
+			for fake.Waiters() == 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("the call never waited to retry")
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			fake.Advance(tc.wait - time.Millisecond)
+			select {
+			case err := <-done:
+				t.Fatalf("retried before the wait was over: %v", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+			fake.Advance(time.Millisecond)
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("no retry once the wait was over")
+			}
+
+			if n := hits.Load(); n != 2 {
+				t.Errorf("service called %d times, want 2", n)
+			}
+			calls, _ := collector.snapshot()
+			if len(calls) != 1 || calls[0].Attempts != 2 || calls[0].RetryWaitMs != tc.wait.Milliseconds() {
+				t.Errorf("call log = %+v, want 2 attempts and a %s wait", calls, tc.wait)
+			}
+		})
+	}
+}
+
+// A Retry-After reaching past the saga deadline ends the call at once with the 429.
+func TestRetryAfterPastDeadline(t *testing.T) {
+	withFakeSagaClock(t)
+	url, hits := throttled(t, "10")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := makeServiceCall(ctx, StepPolicy{MaxAttempts: 3, Timeout: time.Second, Backoff: 100 * time.Millisecond}, url+"/process", struct{}{}, nil)
+	var serr *ServiceError
+	if !errors.As(err, &serr) || serr.Status != http.StatusTooManyRequests {
+		t.Fatalf("err = %v, want the 429", err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("service called %d times, want once", n)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("7"); got != 7*time.Second {
+		t.Errorf("seconds: %s", got)
+	}
+	if got := parseRetryAfter(time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)); got < 28*time.Second || got > 30*time.Second {
+		t.Errorf("HTTP date 30s ahead: %s", got)
+	}
+	for _, v := range []string{"", "0", "-5", "soon", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)} {
+		if got := parseRetryAfter(v); got > 0 {
+			t.Errorf("parseRetryAfter(%q) = %s, want no wait", v, got)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// A retried POST sends the whole JSON body again, not the drained body of the first attempt.
+func TestRetrySendsFullBody(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		first := len(bodies) == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	appConfig.MaxCallsPerSaga = 10
+
+	payment := events.PaymentPayload{OrderID: "retry-body", CustomerID: "user1", Amount: 99.5}
+	err := makeServiceCall(context.Background(), StepPolicy{MaxAttempts: 2, Timeout: time.Second, Backoff: time.Millisecond}, srv.URL+"/process", payment, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 {
+		t.Fatalf("%d attempts, want 2", len(bodies))
+	}
+	want, _ := json.Marshal(payment)
+	for i, body := range bodies {
+		var got events.PaymentPayload
+		if err := json.Unmarshal([]byte(body), &got); err != nil || got != payment {
+			t.Errorf("attempt %d sent %q, want %s", i+1, body, want)
+		}
+	}
+}
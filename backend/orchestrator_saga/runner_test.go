@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// fakeSteps builds saga steps that record their execution and fail with the error set for
+// their name. The Abort of every step records the step and the error it received.
+type fakeSteps struct {
+	mu       sync.Mutex
+	executed []string
+	aborted  []string
+	fail     map[string]error
+	abortErr error
+}
+
+func (f *fakeSteps) step(name string, parallel bool) SagaStep {
+	return SagaStep{
+		Name:      name,
+		Started:   name + " started",
+		Completed: name + " completed",
+		Parallel:  parallel,
+		Execute: func(context.Context, *events.Order) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.executed = append(f.executed, name)
+			return f.fail[name]
+		},
+		Failed: func(err error) string { return name + " failed: " + err.Error() },
+		Abort: func(_ context.Context, order *events.Order, err error) error {
+			f.aborted = append(f.aborted, name)
+			f.abortErr = err
+			order.Status = "rejected"
+			return err
+		},
+	}
+}
+
+func withSagaSteps(t *testing.T, steps ...SagaStep) {
+	t.Helper()
+	prev := orderSagaSteps
+	orderSagaSteps = steps
+	t.Cleanup(func() { orderSagaSteps = prev })
+}
+
+// stepEvents returns the "STEP status" entries of the saga log of an order.
+func stepEvents(orderID string) []string {
+	sagaLog.RLock()
+	defer sagaLog.RUnlock()
+	var out []string
+	for _, e := range sagaLog.Events[orderID] {
+		out = append(out, e.Step+" "+e.Status)
+	}
+	return out
+}
+
+func TestRunnerOrder(t *testing.T) {
+	f := &fakeSteps{fail: map[string]error{}}
+	withSagaSteps(t, f.step("A", false), f.step("B", true), f.step("C", true), f.step("D", false))
+	order := events.Order{OrderID: "runner-" + correlation.NewID()}
+
+	final, err := startSaga(context.Background(), order)
+	if err != nil || final.Status != "approved" {
+		t.Fatalf("saga ended %q: %v", final.Status, err)
+	}
+	if len(f.executed) != 4 || f.executed[0] != "A" || f.executed[3] != "D" {
+		t.Errorf("executed %v, want A, then B and C in any order, then D", f.executed)
+	}
+	want := []string{"SAGA_START started", "A started", "A completed", "B started", "C started"}
+	if got := stepEvents(order.OrderID); !slices.Equal(got[:5], want) || got[len(got)-1] != "SAGA_COMPLETE completed" {
+		t.Errorf("saga log %v", got)
+	}
+	if len(f.aborted) != 0 {
+		t.Errorf("aborted %v on success", f.aborted)
+	}
+}
+
+func TestRunnerStopsAtFailure(t *testing.T) {
+	boom := errors.New("boom")
+	f := &fakeSteps{fail: map[string]error{"B": boom}}
+	withSagaSteps(t, f.step("A", false), f.step("B", false), f.step("C", false))
+	order := events.Order{OrderID: "runner-" + correlation.NewID()}
+
+	final, err := startSaga(context.Background(), order)
+	if !errors.Is(err, boom) || final.Status != "rejected" {
+		t.Fatalf("saga ended %q: %v, want rejected with the error of B", final.Status, err)
+	}
+	if !slices.Equal(f.executed, []string{"A", "B"}) || !slices.Equal(f.aborted, []string{"B"}) {
+		t.Errorf("executed %v and aborted %v, want C never run and B aborted", f.executed, f.aborted)
+	}
+	want := []string{"SAGA_START started", "A started", "A completed", "B started", "B failed"}
+	if got := stepEvents(order.OrderID); !slices.Equal(got, want) {
+		t.Errorf("saga log %v, want %v", got, want)
+	}
+}
+
+// Parallel steps all run to their end; when several fail, the first in saga order aborts the
+// saga and every failure is logged, in saga order.
+func TestRunnerAggregatesParallelFailures(t *testing.T) {
+	errB, errC := errors.New("b failed"), errors.New("c failed")
+	f := &fakeSteps{fail: map[string]error{"B": errB, "C": errC}}
+	withSagaSteps(t, f.step("A", false), f.step("B", true), f.step("C", true), f.step("D", true), f.step("E", false))
+	order := events.Order{OrderID: "runner-" + correlation.NewID()}
+
+	_, err := startSaga(context.Background(), order)
+	if !errors.Is(err, errB) || !errors.Is(f.abortErr, errB) || !slices.Equal(f.aborted, []string{"B"}) {
+		t.Fatalf("saga error %v, aborted %v, want the error of B", err, f.aborted)
+	}
+	if len(f.executed) != 4 || slices.Contains(f.executed, "E") {
+		t.Errorf("executed %v, want the whole parallel group and not E", f.executed)
+	}
+	got := stepEvents(order.OrderID)
+	want := []string{"B failed", "C failed"}
+	var failures []string
+	for _, e := range got {
+		if e == "B failed" || e == "C failed" || e == "D failed" {
+			failures = append(failures, e)
+		}
+	}
+	if !slices.Equal(failures, want) || !slices.Contains(got, "D completed") {
+		t.Errorf("saga log %v, want B then C failed and D completed", got)
+	}
+}
+
+// A failure after the payment compensates the completed steps in reverse: refund, then release
+// the stock, then reject the order.
+func TestRunnerCompensatesInReverse(t *testing.T) {
+	services := newFakeServices(t)
+	appConfig.CompensationStrategy = strategyFull
+	f := &fakeSteps{fail: map[string]error{"SHIP_ORDER": errors.New("no courier")}}
+	ship := f.step("SHIP_ORDER", false)
+	ship.Abort = compensateOn("shipping_failure", "Shipping failed")
+	withSagaSteps(t, f.step("CREATE_ORDER", false), f.step("RESERVE_INVENTORY", false), f.step("PROCESS_PAYMENT", false), ship)
+	order := events.Order{OrderID: "runner-" + correlation.NewID(), Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 1}}}
+
+	final, err := startSaga(context.Background(), order)
+	if err == nil || final.Status != "rejected" {
+		t.Fatalf("saga ended %q: %v", final.Status, err)
+	}
+	if got, want := services.Calls(), []string{"/revert", "/cancel_reservation", "/update_status rejected"}; !slices.Equal(got, want) {
+		t.Errorf("compensation calls %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// The saga definition is compared with testdata/saga_definition.golden, so a change to the
+// steps, their compensations or their policies shows up in the diff; run the test with -update
+// to accept it.
+func TestSagaDefinitionGolden(t *testing.T) {
+	newFakeServices(t)
+	appConfig.OrderServiceURL = "http://order-service:8081"
+	appConfig.InventoryServiceURL = "http://inventory-service:8082"
+	appConfig.PaymentServiceURL = "http://payment-service:8083"
+	appConfig.ShippingServiceURL = "http://shipping-service:8084"
+	appConfig.CompensationStrategy = strategyFull
+	appConfig.SagaTimeout = 30 * time.Second
+	appConfig.StepPolicies[policyPayment] = StepPolicy{MaxAttempts: 3, Timeout: 5 * time.Second, Backoff: 200 * time.Millisecond}
+
+	rec := httptest.NewRecorder()
+	sagaDefinitionHandler(rec, httptest.NewRequest(http.MethodGet, "/saga/definition", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	var got bytes.Buffer
+	if err := json.Indent(&got, rec.Body.Bytes(), "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	got.WriteByte('\n')
+
+	golden := filepath.Join("testdata", "saga_definition.golden")
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("saga definition drifted from %s (run with -update to accept):\n%s", golden, got.String())
+	}
+
+	rec = httptest.NewRecorder()
+	sagaDefinitionHandler(rec, httptest.NewRequest(http.MethodPost, "/saga/definition", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST answered %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// withSagaStates replaces the saga state table for the test.
+func withSagaStates(t *testing.T, states ...*SagaState) {
+	t.Helper()
+	sagaStates.Lock()
+	prev := sagaStates.Data
+	sagaStates.Data = make(map[string]*SagaState)
+	for _, s := range states {
+		if s.Compensations == nil {
+			s.Compensations = []string{}
+		}
+		sagaStates.Data[s.OrderID] = s
+	}
+	sagaStates.Unlock()
+	t.Cleanup(func() {
+		sagaStates.Lock()
+		sagaStates.Data = prev
+		sagaStates.Unlock()
+	})
+}
+
+func TestSagaList(t *testing.T) {
+	t0 := time.Now().Add(-time.Hour)
+	withSagaStates(t,
+		&SagaState{OrderID: "approved-old", OrderStatus: "approved", StartedAt: t0},
+		&SagaState{OrderID: "rejected", OrderStatus: "rejected", StartedAt: t0.Add(time.Minute)},
+		&SagaState{OrderID: "approved-new", OrderStatus: "approved", StartedAt: t0.Add(2 * time.Minute)},
+		&SagaState{OrderID: "running", Running: true, StartedAt: t0.Add(3 * time.Minute)},
+	)
+
+	for query, want := range map[string][]string{
+		"":                 {"running", "approved-new", "rejected", "approved-old"},
+		"?status=approved": {"approved-new", "approved-old"},
+		"?status=running":  {"running"},
+		"?status=pending":  {},
+		"?limit=2":         {"running", "approved-new"},
+	} {
+		rec := httptest.NewRecorder()
+		sagaListHandler(rec, httptest.NewRequest(http.MethodGet, "/saga"+query, nil))
+		var list []SagaState
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("%q answered %d (%v)", query, rec.Code, err)
+		}
+		got := []string{}
+		for _, s := range list {
+			got = append(got, s.OrderID)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("GET /saga%s = %v, want %v", query, got, want)
+		}
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=x"} {
+		rec := httptest.NewRecorder()
+		sagaListHandler(rec, httptest.NewRequest(http.MethodGet, "/saga"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s answered %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+// Sagas finished past the retention leave every saga table, except those still waiting for a
+// review or a dead-letter retry; running and recent sagas stay.
+func TestPruneSagas(t *testing.T) {
+	appConfig = Config{SagaLogRetention: time.Hour}
+	now := time.Now()
+	old, recent := now.Add(-2*time.Hour), now.Add(-time.Minute)
+	expired, review, dead := newOrderID(), newOrderID(), newOrderID()
+	withSagaStates(t,
+		&SagaState{OrderID: expired, FinishedAt: &old},
+		&SagaState{OrderID: review, FinishedAt: &old},
+		&SagaState{OrderID: dead, FinishedAt: &old},
+		&SagaState{OrderID: "recent", FinishedAt: &recent},
+		&SagaState{OrderID: "running", Running: true, StartedAt: old},
+	)
+	sagaLog.Lock()
+	sagaLog.Events[expired] = []SagaEvent{{OrderID: expired, Step: "CREATE_ORDER"}}
+	sagaLog.Unlock()
+	sagaCalls.Lock()
+	sagaCalls.Calls[expired] = []CallRecord{{URL: "/create_order"}}
+	sagaCalls.Dropped[expired] = 1
+	sagaCalls.Unlock()
+	reviewQueue.Lock()
+	reviewQueue.Entries[review] = ReviewEntry{OrderID: review}
+	reviewQueue.Unlock()
+	deadLetters.Lock()
+	deadLetters.Entries[dead+"/REVERT_PAYMENT"] = DeadLetter{OrderID: dead, Compensation: "REVERT_PAYMENT"}
+	deadLetters.Unlock()
+	t.Cleanup(func() {
+		reviewQueue.Lock()
+		delete(reviewQueue.Entries, review)
+		reviewQueue.Unlock()
+		deadLetters.Lock()
+		delete(deadLetters.Entries, dead+"/REVERT_PAYMENT")
+		deadLetters.Unlock()
+	})
+
+	pruneSagas(now)
+
+	sagaStates.RLock()
+	var kept []string
+	for id := range sagaStates.Data {
+		kept = append(kept, id)
+	}
+	sagaStates.RUnlock()
+	slices.Sort(kept)
+	want := []string{review, dead, "recent", "running"}
+	slices.Sort(want)
+	if !slices.Equal(kept, want) {
+		t.Errorf("kept %v, want %v", kept, want)
+	}
+	sagaLog.RLock()
+	_, logged := sagaLog.Events[expired]
+	sagaLog.RUnlock()
+	sagaCalls.RLock()
+	_, called := sagaCalls.Calls[expired]
+	_, dropped := sagaCalls.Dropped[expired]
+	sagaCalls.RUnlock()
+	if logged || called || dropped {
+		t.Errorf("expired saga left in the log (%t) or the calls (%t, %t)", logged, called, dropped)
+	}
+}
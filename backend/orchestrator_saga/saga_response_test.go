@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// createdOrderIDs wraps services so that the ids of the orders sent to the order service are
+// recorded, and returns them.
+func createdOrderIDs(t *testing.T, services *fakeServices) func() []string {
+	t.Helper()
+	var ids []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/create_order" {
+			body, _ := io.ReadAll(r.Body)
+			var order events.Order
+			_ = json.Unmarshal(body, &order)
+			ids = append(ids, order.OrderID)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		services.serve(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	appConfig.OrderServiceURL = srv.URL
+	return func() []string { return ids }
+}
+
+// The response of /create_order carries the id of the order actually created downstream, with
+// the failed step and the compensations applied when the saga fails.
+func TestSagaResponse(t *testing.T) {
+	tests := []struct {
+		name               string
+		fail               []string
+		code               int
+		status             string
+		failedStep         string
+		compensations      []string
+		compensationFailed bool
+	}{
+		{name: "approved", code: http.StatusOK, status: "approved"},
+		{name: "payment declined", fail: []string{"/process"}, code: http.StatusConflict, status: "rejected",
+			failedStep: "PROCESS_PAYMENT", compensations: []string{"CANCEL_RESERVATION"}},
+		{name: "payment declined, reservation stuck", fail: []string{"/process", "/cancel_reservation"}, code: http.StatusConflict, status: "rejected",
+			failedStep: "PROCESS_PAYMENT", compensationFailed: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			services := newFakeServices(t)
+			appConfig.CompensationStrategy = strategyFull
+			for _, path := range tc.fail {
+				services.Fail[path] = http.StatusBadRequest
+			}
+			created := createdOrderIDs(t, services)
+
+			rec := httptest.NewRecorder()
+			createOrderHandler(rec, httptest.NewRequest(http.MethodPost, "/create_order",
+				strings.NewReader(`{"customer_id":"user1","items":[{"product_id":"mouse-wireless","quantity":1}]}`)))
+			if rec.Code != tc.code {
+				t.Fatalf("answered %d, want %d: %s", rec.Code, tc.code, rec.Body)
+			}
+			var result SagaResult
+			if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			if ids := created(); len(ids) != 1 || result.OrderID != ids[0] || !strings.HasPrefix(result.OrderID, "orc-") {
+				t.Errorf("response order id %q, order service got %v", result.OrderID, ids)
+			}
+			if result.Status != tc.status || result.FailedStep != tc.failedStep || result.CompensationFailed != tc.compensationFailed {
+				t.Errorf("result %s failed at %q (compensation failed %t), want %s at %q (%t)",
+					result.Status, result.FailedStep, result.CompensationFailed, tc.status, tc.failedStep, tc.compensationFailed)
+			}
+			if !slices.Equal(result.Compensations, tc.compensations) {
+				t.Errorf("compensations %v, want %v", result.Compensations, tc.compensations)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// The orchestrator tells a valid customer from an invalid one by the status code alone.
+func TestValidateContract(t *testing.T) {
+	initDB()
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		reason string
+	}{
+		{name: "known customer", body: `{"customer_id":"user1"}`, status: http.StatusOK},
+		{name: "unknown customer", body: `{"customer_id":"nobody"}`, status: http.StatusUnauthorized, reason: events.ReasonInvalidCustomer},
+		{name: "malformed body", body: `{`, status: http.StatusBadRequest, reason: events.ReasonInvalidRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			validateHandler(rec, httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(tc.body)))
+			if rec.Code != tc.status {
+				t.Fatalf("answered %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+			var envelope events.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			if envelope.ReasonCode != tc.reason || (tc.reason != "" && envelope.Message == "") {
+				t.Errorf("envelope = %+v, want reason %q", envelope, tc.reason)
+			}
+			if strings.Contains(rec.Body.String(), `"status"`) {
+				t.Errorf("body %s still carries a status field", rec.Body)
+			}
+		})
+	}
+}
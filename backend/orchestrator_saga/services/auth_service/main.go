@@ -7,7 +7,13 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/StitchMl/saga-demo/common/buildinfo"
+	"github.com/StitchMl/saga-demo/common/correlation"
+	"github.com/StitchMl/saga-demo/common/diagnostics"
+	"github.com/StitchMl/saga-demo/common/responses"
+	"github.com/StitchMl/saga-demo/common/sessions"
 	events "github.com/StitchMl/saga-demo/common/types"
 	"github.com/google/uuid"
 )
@@ -119,11 +125,14 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 			UsersDB.Unlock()
 			UsersDB.RLock()
 
+			token, session := sessions.Issue(sid)
 			w.Header().Set(ContentType, ContentTypeJSON)
 			_ = json.NewEncoder(w).Encode(map[string]string{
 				"customer_id": sid,
 				"status":      "success",
 				"ns":          req.NS,
+				"token":       token,
+				"expires_at":  session.ExpiresAt.Format(time.RFC3339),
 			})
 			return
 		}
@@ -184,7 +193,7 @@ func validateHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req events.AuthResponse
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid body", http.StatusBadRequest)
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "invalid body")
 		return
 	}
 
@@ -195,23 +204,14 @@ func validateHandler(w http.ResponseWriter, r *http.Request) {
 		normalizeUserIDInUsersDB(toNormalizeUser, newSID)
 	}
 
-	w.Header().Set(ContentType, ContentTypeJSON)
 	if valid {
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		responses.WriteJSON(w, http.StatusOK, map[string]interface{}{
 			"customer_id": req.CustomerID,
 			"valid":       true,
-			"status":      "success",
 		})
 		return
 	}
-
-	w.WriteHeader(http.StatusUnauthorized)
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
-		"customer_id": req.CustomerID,
-		"valid":       false,
-		"status":      "error",
-		"message":     "Invalid customer ID",
-	})
+	responses.WriteError(w, http.StatusUnauthorized, events.ReasonInvalidCustomer, "Invalid customer ID")
 }
 
 func healthHandler(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
@@ -223,12 +223,16 @@ func main() {
 	}
 
 	initDB()
+	sessions.Start()
 
 	http.HandleFunc("/register", registerHandler)
 	http.HandleFunc("/login", loginHandler)
-	http.HandleFunc("/validate", validateHandler)
+	http.HandleFunc("/validate", correlation.Middleware(validateHandler))
+	http.HandleFunc("/validate_token", sessions.ValidateTokenHandler)
+	http.HandleFunc("/logout", sessions.LogoutHandler)
 	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/version", buildinfo.Handler("orchestrator-auth-service"))
 
 	log.Printf("[Auth‑O] listening on :%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Fatal(http.ListenAndServe(":"+port, diagnostics.Handler(http.DefaultServeMux)))
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// admin calls the admin endpoints through the routes of the service, with the admin token.
+func admin(mux *http.ServeMux, method, path, body string) (int, string) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(adminauth.Header, "test-admin")
+	mux.ServeHTTP(rec, req)
+	var resp events.ErrorResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec.Code, resp.ReasonCode
+}
+
+func catalogProduct(mux *http.ServeMux, id string) (events.Product, bool) {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/catalog", nil))
+	var products []events.Product
+	_ = json.Unmarshal(rec.Body.Bytes(), &products)
+	for _, p := range products {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return events.Product{}, false
+}
+
+// Products created, restocked and deleted at runtime show up in the catalog at once; invalid
+// requests and stock changes out of range are refused without changing anything.
+func TestAdminProducts(t *testing.T) {
+	resetInventory()
+	adminauth.SetTokens("test-admin")
+	t.Cleanup(func() { adminauth.SetTokens("") })
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/products", strings.NewReader(`{"id":"desk-lamp","name":"Desk lamp","price":19,"available":5}`)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("create without a token answered %d, want 401", rec.Code)
+	}
+
+	for name, body := range map[string]string{
+		"missing id":      `{"name":"Desk lamp","price":19,"available":5}`,
+		"missing name":    `{"id":"desk-lamp","price":19,"available":5}`,
+		"no price":        `{"id":"desk-lamp","name":"Desk lamp","available":5}`,
+		"negative stock":  `{"id":"desk-lamp","name":"Desk lamp","price":19,"available":-1}`,
+		"malformed body":  `{"id":`,
+		"slash in the id": `{"id":"desk/lamp","name":"Desk lamp","price":19,"available":5}`,
+	} {
+		if code, reason := admin(mux, http.MethodPost, "/admin/products", body); code != http.StatusBadRequest || reason != events.ReasonInvalidRequest {
+			t.Errorf("%s: answered %d %s, want 400 %s", name, code, reason, events.ReasonInvalidRequest)
+		}
+	}
+	if _, ok := catalogProduct(mux, "desk-lamp"); ok {
+		t.Fatal("an invalid product reached the catalog")
+	}
+
+	if code, _ := admin(mux, http.MethodPost, "/admin/products", `{"id":"desk-lamp","name":"Desk lamp","price":19,"available":5}`); code != http.StatusCreated {
+		t.Fatalf("create answered %d, want 201", code)
+	}
+	if p, ok := catalogProduct(mux, "desk-lamp"); !ok || p.Available != 5 || p.Price != 19 {
+		t.Fatalf("catalog shows %+v (%t), want the new product with 5 available", p, ok)
+	}
+	if code, _ := admin(mux, http.MethodPost, "/admin/products", `{"id":"desk-lamp","name":"Desk lamp","price":21,"available":5}`); code != http.StatusOK {
+		t.Errorf("update answered %d, want 200", code)
+	}
+
+	if code, reason := admin(mux, http.MethodPost, "/admin/products/desk-lamp/adjust_stock", `{"delta":-6}`); code != http.StatusConflict || reason != events.ReasonStockOutOfRange {
+		t.Errorf("adjustment below zero answered %d %s, want 409 %s", code, reason, events.ReasonStockOutOfRange)
+	}
+	if code, _ := admin(mux, http.MethodPost, "/admin/products/desk-lamp/adjust_stock", `{"delta":0}`); code != http.StatusBadRequest {
+		t.Errorf("zero adjustment answered %d, want 400", code)
+	}
+	if code, _ := admin(mux, http.MethodPost, "/admin/products/no-such-product/adjust_stock", `{"delta":1}`); code != http.StatusNotFound {
+		t.Errorf("adjustment of an unknown product answered %d, want 404", code)
+	}
+	if code, _ := admin(mux, http.MethodPost, "/admin/products/desk-lamp/adjust_stock", `{"delta":3}`); code != http.StatusOK {
+		t.Errorf("restock answered %d", code)
+	}
+	if p, _ := catalogProduct(mux, "desk-lamp"); p.Available != 8 || p.Price != 21 {
+		t.Errorf("catalog shows %d available at %.2f, want 8 at 21", p.Available, p.Price)
+	}
+
+	if rec := reserve(`{"order_id":"admin-1","items":[{"product_id":"desk-lamp","quantity":2}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("reserve answered %d: %s", rec.Code, rec.Body)
+	}
+	if code, reason := admin(mux, http.MethodDelete, "/admin/products/desk-lamp", ""); code != http.StatusConflict || reason != events.ReasonProductReserved {
+		t.Errorf("delete of a reserved product answered %d %s, want 409 %s", code, reason, events.ReasonProductReserved)
+	}
+	post(cancelReservationHandler, "admin-1", 2)
+	if code, _ := admin(mux, http.MethodDelete, "/admin/products/desk-lamp", ""); code != http.StatusOK {
+		t.Errorf("delete answered %d, want 200", code)
+	}
+	if _, ok := catalogProduct(mux, "desk-lamp"); ok {
+		t.Error("deleted product still in the catalog")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// The orchestrator cancels a reservation with POST /cancel_reservation and the request it
+// builds; served by the real routes, the call succeeds and puts the stock back.
+func TestCompensationRoute(t *testing.T) {
+	resetInventory()
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	req := events.InventoryRequestPayload{OrderID: "route-1", Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 3}}}
+	for _, path := range []string{"/reserve", "/cancel_reservation"} {
+		if path == "/cancel_reservation" {
+			if got := available("mouse-wireless"); got != 47 {
+				t.Fatalf("%d available after the reservation, want 47", got)
+			}
+			req.Reason = "payment failed"
+		}
+		body, _ := json.Marshal(req)
+		resp, err := http.Post(srv.URL+path, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s answered %d", path, resp.StatusCode)
+		}
+	}
+	if got := available("mouse-wireless"); got != 50 {
+		t.Errorf("%d available after the compensation, want 50", got)
+	}
+}
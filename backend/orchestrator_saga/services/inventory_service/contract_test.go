@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// The orchestrator tells success from failure by the status code alone: a 2xx carries no
+// reason code, every failure carries one with a message. The cases run in order on one
+// reservation.
+func TestStatusContract(t *testing.T) {
+	resetInventory()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+		status  int
+		reason  string
+	}{
+		{name: "reserved", handler: reserveInventoryHandler, status: http.StatusOK,
+			body: `{"order_id":"contract-1","items":[{"product_id":"mouse-wireless","quantity":1}]}`},
+		{name: "reservation replayed", handler: reserveInventoryHandler, status: http.StatusOK,
+			body: `{"order_id":"contract-1","items":[{"product_id":"mouse-wireless","quantity":1}]}`},
+		{name: "reservation with other items", handler: reserveInventoryHandler, status: http.StatusConflict, reason: events.ReasonReservationClash,
+			body: `{"order_id":"contract-1","items":[{"product_id":"mouse-wireless","quantity":2}]}`},
+		{name: "unknown product", handler: reserveInventoryHandler, status: http.StatusNotFound, reason: events.ReasonUnknownProduct,
+			body: `{"order_id":"contract-2","items":[{"product_id":"no-such-product","quantity":1}]}`},
+		{name: "short of stock", handler: reserveInventoryHandler, status: http.StatusConflict, reason: events.ReasonInsufficientQty,
+			body: `{"order_id":"contract-3","items":[{"product_id":"mouse-wireless","quantity":60}]}`},
+		{name: "zero quantity", handler: reserveInventoryHandler, status: http.StatusUnprocessableEntity, reason: events.ReasonInvalidQuantity,
+			body: `{"order_id":"contract-4","items":[{"product_id":"mouse-wireless","quantity":0}]}`},
+		{name: "malformed reservation", handler: reserveInventoryHandler, body: `{`, status: http.StatusBadRequest, reason: events.ReasonInvalidRequest},
+		{name: "committed", handler: commitReservationHandler, body: `{"order_id":"contract-1"}`, status: http.StatusOK},
+		{name: "canceled", handler: cancelReservationHandler, body: `{"order_id":"contract-1"}`, status: http.StatusOK},
+		{name: "cancellation replayed", handler: cancelReservationHandler, body: `{"order_id":"contract-1"}`, status: http.StatusOK},
+		{name: "nothing to cancel", handler: cancelReservationHandler, body: `{"order_id":"contract-2"}`, status: http.StatusOK},
+		{name: "commit after cancel", handler: commitReservationHandler, body: `{"order_id":"contract-1"}`,
+			status: http.StatusConflict, reason: events.ReasonInvalidRequest},
+		{name: "prices", handler: getPricesHandler, body: `{"product_ids":["mouse-wireless"]}`, status: http.StatusOK},
+		{name: "price of an unknown product", handler: getPricesHandler, body: `{"product_ids":["mouse-wireless","no-such-product"]}`,
+			status: http.StatusNotFound, reason: events.ReasonUnknownProduct},
+		{name: "no product ids", handler: getPricesHandler, body: `{"product_ids":[]}`, status: http.StatusBadRequest, reason: events.ReasonInvalidRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tc.handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body)))
+			if rec.Code != tc.status {
+				t.Fatalf("answered %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+			var envelope events.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			if envelope.ReasonCode != tc.reason || (tc.reason != "" && envelope.Message == "") {
+				t.Errorf("envelope = %+v, want reason %q", envelope, tc.reason)
+			}
+			if strings.Contains(rec.Body.String(), `"status":"success"`) {
+				t.Errorf("body %s still reports a success status", rec.Body)
+			}
+		})
+	}
+
+	// A commit for an order that never reserved is a plain 404 on the reservation.
+	rec := httptest.NewRecorder()
+	commitReservationHandler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"order_id":"contract-missing"}`)))
+	var notFound events.NotFoundResponse
+	if err := json.NewDecoder(rec.Body).Decode(&notFound); err != nil || rec.Code != http.StatusNotFound || notFound.Resource != "reservation" {
+		t.Errorf("commit of an unknown reservation answered %d %+v", rec.Code, notFound)
+	}
+	ProductsDB.RLock()
+	available := ProductsDB.Data["mouse-wireless"].Available
+	ProductsDB.RUnlock()
+	if available != 50 {
+		t.Errorf("%d mice available after the cancellation, want all 50 back", available)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// A retried cancellation, even one naming more items than were reserved, restores exactly
+// the recorded reservation once.
+func TestCancelReservationTwice(t *testing.T) {
+	resetInventory()
+	before := available("mouse-wireless")
+	if code, _ := post(reserveInventoryHandler, "twice-1", 4); code != http.StatusOK {
+		t.Fatalf("reserve answered %d", code)
+	}
+
+	for i := 0; i < 2; i++ {
+		if code, _ := post(cancelReservationHandler, "twice-1", 40); code != http.StatusOK {
+			t.Fatalf("cancel %d answered %d", i+1, code)
+		}
+		if got := available("mouse-wireless"); got != before {
+			t.Fatalf("%d available after cancel %d, want %d", got, i+1, before)
+		}
+	}
+}
@@ -6,9 +6,23 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/buildinfo"
+	"github.com/StitchMl/saga-demo/common/chaos"
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/correlation"
+	"github.com/StitchMl/saga-demo/common/diagnostics"
+	"github.com/StitchMl/saga-demo/common/order_policy"
+	"github.com/StitchMl/saga-demo/common/responses"
 	events "github.com/StitchMl/saga-demo/common/types"
+	"github.com/StitchMl/saga-demo/common/warehouse"
 )
 
 const (
@@ -23,14 +37,84 @@ var ProductsDB = struct {
 	Data map[string]events.Product
 }{Data: make(map[string]events.Product)}
 
+// reservation is the record of the stock reserved for an order.
+type reservation struct {
+	Items      map[string]int       // quantity by product
+	Allocation warehouse.Allocation // warehouses the stock was taken from
+	Active     bool                 // false once canceled or expired
+	Committed  bool                 // set by /commit_reservation: the reservation no longer expires
+	Expired    bool                 // released by the janitor after ExpiresAt
+	ExpiresAt  time.Time
+}
+
+// Reservations keyed by order id, used to make /reserve idempotent. Guarded by ProductsDB.
+var reservations = make(map[string]*reservation)
+
+// reservationTTL is how long an uncommitted reservation holds its stock (RESERVATION_TTL_SECONDS).
+var reservationTTL = 300 * time.Second
+
+// releaseExpiredReservations gives back the stock of the active, uncommitted reservations
+// expired at now, so a saga that never reached payment does not hold it forever.
+func releaseExpiredReservations(now time.Time) {
+	ProductsDB.Lock()
+	defer ProductsDB.Unlock()
+	for orderID, res := range reservations {
+		if !res.Active || res.Committed || now.Before(res.ExpiresAt) {
+			continue
+		}
+		if err := warehouse.Restore(ProductsDB.Data, res.Allocation); err != nil {
+			log.Printf("[ServiceInventory] Could not release expired reservation of Order %s: %v", orderID, err)
+			continue
+		}
+		res.Active = false
+		res.Expired = true
+		log.Printf("[ServiceInventory] Released expired reservation of Order %s: %v", orderID, res.Allocation)
+	}
+}
+
+// startReservationJanitor releases the expired reservations in the background.
+func startReservationJanitor() {
+	interval := min(reservationTTL/2, 10*time.Second)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			releaseExpiredReservations(now)
+		}
+	}()
+	log.Printf("[ServiceInventory] Reservation janitor started (TTL %s, interval %s)", reservationTTL, interval)
+}
+
+// quantities sums the requested quantities by product.
+func quantities(items []events.OrderItem) map[string]int {
+	out := make(map[string]int, len(items))
+	for _, item := range items {
+		out[item.ProductID] += item.Quantity
+	}
+	return out
+}
+
+// sameQuantities reports whether two reservations hold the same products and quantities.
+func sameQuantities(a, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, qty := range a {
+		if b[id] != qty {
+			return false
+		}
+	}
+	return true
+}
+
 func initDB() {
 	ProductsDB.Lock()
 	defer ProductsDB.Unlock()
 
 	ProductsDB.Data = map[string]events.Product{
-		"laptop-pro":          {ID: "laptop-pro", Name: "Laptop Pro", Description: "A powerful laptop for professionals.", Price: 1299.99, Available: 100, ImageURL: "https://m.media-amazon.com/images/I/61UcV2bDnoL._AC_SL1500_.jpg"},
-		"mouse-wireless":      {ID: "mouse-wireless", Name: "Mouse Wireless", Description: "Ergonomic and precise mouse.", Price: 49.50, Available: 50, ImageURL: "https://m.media-amazon.com/images/I/711bP+FjSQL._AC_SL1500_.jpg"},
-		"mechanical-keyboard": {ID: "mechanical-keyboard", Name: "Mechanical Keyboard", Description: "Keyboard with mechanical switches for gaming.", Price: 120.00, Available: 200, ImageURL: "https://m.media-amazon.com/images/I/71kq6u7NA4L._AC_SL1500_.jpg"},
+		"laptop-pro":          {ID: "laptop-pro", Name: "Laptop Pro", Description: "A powerful laptop for professionals.", Price: 1299.99, Available: 100, ImageURL: "https://m.media-amazon.com/images/I/61UcV2bDnoL._AC_SL1500_.jpg", Warehouses: map[string]int{"wh-north": 60, "wh-south": 40}},
+		"mouse-wireless":      {ID: "mouse-wireless", Name: "Mouse Wireless", Description: "Ergonomic and precise mouse.", Price: 49.50, Available: 50, ImageURL: "https://m.media-amazon.com/images/I/711bP+FjSQL._AC_SL1500_.jpg", Warehouses: map[string]int{"wh-north": 20, "wh-south": 30}},
+		"mechanical-keyboard": {ID: "mechanical-keyboard", Name: "Mechanical Keyboard", Description: "Keyboard with mechanical switches for gaming.", Price: 120.00, Available: 200, ImageURL: "https://m.media-amazon.com/images/I/71kq6u7NA4L._AC_SL1500_.jpg", Warehouses: map[string]int{"wh-north": 120, "wh-south": 80}},
 	}
 	log.Println("[ServiceInventory] In-memory database initialized.")
 }
@@ -40,13 +124,38 @@ func main() {
 	if port == "" {
 		log.Fatal("INVENTORY_SERVICE_PORT environment variable not set.")
 	}
+	if v := os.Getenv("RESERVATION_TTL_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid RESERVATION_TTL_SECONDS: %q", v)
+		}
+		reservationTTL = time.Duration(n) * time.Second
+	}
+	config.Set("RESERVATION_TTL_SECONDS", int(reservationTTL.Seconds()))
 	initDB()
-	http.HandleFunc("/reserve", reserveInventoryHandler)
-	http.HandleFunc("/cancel_reservation", cancelReservationHandler)
-	http.HandleFunc("/catalog", catalogHandler)
-	http.HandleFunc("/get_price", getPriceHandler) // Nuovo endpoint per i prezzi
+	startReservationJanitor()
+	registerRoutes(http.DefaultServeMux)
 	log.Printf("Servizio Inventario avviato sulla porta %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Fatal(http.ListenAndServe(":"+port, diagnostics.Handler(http.DefaultServeMux)))
+}
+
+// registerRoutes registers the routes of the inventory service on mux.
+func registerRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/reserve", correlation.Middleware(reserveInventoryHandler))
+	mux.HandleFunc("/cancel_reservation", correlation.Middleware(cancelReservationHandler))
+	mux.HandleFunc("/commit_reservation", correlation.Middleware(commitReservationHandler))
+	mux.HandleFunc("/catalog", catalogHandler)
+	mux.HandleFunc("/admin/warehouses/stock", adminauth.Require(warehouseStockHandler))
+	mux.HandleFunc("/admin/products", adminauth.Require(upsertProductHandler))
+	mux.HandleFunc("/admin/products/", adminauth.Require(productAdminHandler))
+	mux.HandleFunc("/admin/chaos", adminauth.Require(chaos.AdminHandler))
+	mux.HandleFunc("/get_price", correlation.Middleware(getPriceHandler)) // Nuovo endpoint per i prezzi
+	mux.HandleFunc("/get_prices", correlation.Middleware(getPricesHandler))
+	mux.HandleFunc("/version", buildinfo.Handler("orchestrator-inventory-service"))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "Orchestrator Inventory Service is healthy!")
+	})
 }
 
 // getPriceHandler returns the price of a single product.
@@ -59,7 +168,7 @@ func getPriceHandler(w http.ResponseWriter, r *http.Request) {
 		ProductID string `json:"product_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request body")
 		return
 	}
 
@@ -68,29 +177,170 @@ func getPriceHandler(w http.ResponseWriter, r *http.Request) {
 	ProductsDB.RUnlock()
 
 	if !ok {
-		http.Error(w, "Product not found", http.StatusNotFound)
+		responses.WriteError(w, http.StatusNotFound, events.ReasonUnknownProduct, "Product not found: "+req.ProductID)
 		return
 	}
 
-	w.Header().Set(contentType, contentTypeJSON)
-	_ = json.NewEncoder(w).Encode(map[string]string{
+	responses.WriteJSON(w, http.StatusOK, map[string]string{
 		"product_id": req.ProductID,
 		"price":      fmt.Sprintf("%.2f", product.Price),
-		"status":     "success",
 	})
 }
 
-// catalogHandler manages requests to get the product catalog.
-func catalogHandler(w http.ResponseWriter, _ *http.Request) {
+// getPricesHandler returns the prices of several products in one call. It answers 404
+// UNKNOWN_PRODUCT naming every missing product when any of them is not in the catalog.
+func getPricesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, errorMethodNotAllowed, http.StatusMethodNotAllowed)
+		return
+	}
+	var req events.PricesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.ProductIDs) == 0 {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "product_ids is required")
+		return
+	}
+
+	prices := make(map[string]float64, len(req.ProductIDs))
+	var missing []string
 	ProductsDB.RLock()
-	defer ProductsDB.RUnlock()
+	for _, id := range req.ProductIDs {
+		if product, ok := ProductsDB.Data[id]; ok {
+			prices[id] = product.Price
+		} else if !slices.Contains(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+	ProductsDB.RUnlock()
 
-	list := make([]events.Product, 0, len(ProductsDB.Data))
-	for _, p := range ProductsDB.Data {
-		list = append(list, p)
+	if len(missing) > 0 {
+		responses.WriteError(w, http.StatusNotFound, events.ReasonUnknownProduct, "Product not found: "+strings.Join(missing, ", "))
+		return
 	}
+	responses.WriteJSON(w, http.StatusOK, events.PricesResponse{Prices: prices})
+}
+
+// catalogHandler manages requests to get the product catalog; ?warehouses=true adds the stock by warehouse.
+func catalogHandler(w http.ResponseWriter, r *http.Request) {
+	withWarehouses, _ := strconv.ParseBool(r.URL.Query().Get("warehouses"))
+
+	ProductsDB.RLock()
+	defer ProductsDB.RUnlock()
+
 	w.Header().Set(contentType, contentTypeJSON)
-	_ = json.NewEncoder(w).Encode(list)
+	_ = json.NewEncoder(w).Encode(warehouse.Catalog(ProductsDB.Data, withWarehouses))
+}
+
+// warehouseStockHandler sets the stock of a product in a warehouse.
+func warehouseStockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, errorMethodNotAllowed, http.StatusMethodNotAllowed)
+		return
+	}
+	req, ok := warehouse.DecodeStockRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ProductsDB.Lock()
+	defer ProductsDB.Unlock()
+	product, ok := ProductsDB.Data[req.ProductID]
+	if !ok {
+		responses.WriteNotFound(w, "product", req.ProductID)
+		return
+	}
+	product = warehouse.SetStock(product, req.WarehouseID, req.Available)
+	ProductsDB.Data[req.ProductID] = product
+
+	log.Printf("Stock of %s in %s set to %d", req.ProductID, req.WarehouseID, req.Available)
+	responses.WriteJSON(w, http.StatusOK, product)
+}
+
+// upsertProductHandler serves POST /admin/products, creating or updating a product.
+func upsertProductHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req, ok := warehouse.DecodeProductRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ProductsDB.Lock()
+	defer ProductsDB.Unlock()
+	product, created := warehouse.Upsert(ProductsDB.Data, req)
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	log.Printf("Product %s saved (created: %t, stock of %s: %d)", req.ID, created, req.WarehouseID, req.Available)
+	responses.WriteJSON(w, status, product)
+}
+
+// productAdminHandler serves POST /admin/products/{id}/adjust_stock and DELETE /admin/products/{id}.
+func productAdminHandler(w http.ResponseWriter, r *http.Request) {
+	id, action := warehouse.ProductPath(r.URL.Path)
+	switch {
+	case r.Method == http.MethodPost && action == "adjust_stock":
+		adjustStock(w, r, id)
+	case r.Method == http.MethodDelete && action == "":
+		deleteProduct(w, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// adjustStock changes the stock of a product by a signed delta.
+func adjustStock(w http.ResponseWriter, r *http.Request, id string) {
+	req, ok := warehouse.DecodeAdjustRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ProductsDB.Lock()
+	defer ProductsDB.Unlock()
+	if _, ok := ProductsDB.Data[id]; !ok {
+		responses.WriteNotFound(w, "product", id)
+		return
+	}
+	product, err := warehouse.Adjust(ProductsDB.Data, id, req)
+	if err != nil {
+		responses.WriteError(w, http.StatusConflict, events.ReasonStockOutOfRange, "Adjustment rejected: "+err.Error())
+		return
+	}
+	log.Printf("Stock of %s adjusted by %d, now %d", id, req.Delta, product.Available)
+	responses.WriteJSON(w, http.StatusOK, product)
+}
+
+// deleteProduct removes a product from the catalog, unless an active reservation holds it.
+func deleteProduct(w http.ResponseWriter, id string) {
+	ProductsDB.Lock()
+	defer ProductsDB.Unlock()
+	if _, ok := ProductsDB.Data[id]; !ok {
+		responses.WriteNotFound(w, "product", id)
+		return
+	}
+	if orders := reservedBy(id); len(orders) > 0 {
+		responses.WriteError(w, http.StatusConflict, events.ReasonProductReserved,
+			"Product "+id+" is reserved by orders "+strings.Join(orders, ", "))
+		return
+	}
+	delete(ProductsDB.Data, id)
+	log.Printf("Product %s deleted", id)
+	responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Product deleted"})
+}
+
+// reservedBy returns the orders, sorted, with an active reservation holding the product. The caller holds the lock.
+func reservedBy(productID string) []string {
+	var orders []string
+	for orderID, res := range reservations {
+		if res.Active && res.Items[productID] > 0 {
+			orders = append(orders, orderID)
+		}
+	}
+	sort.Strings(orders)
+	return orders
 }
 
 // reserveInventoryHandler manages product reservation.
@@ -102,37 +352,72 @@ func reserveInventoryHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req events.InventoryRequestPayload
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request body")
+		return
+	}
+	if v := order_policy.ValidateItems(req.Items); v != nil {
+		order_policy.WriteViolation(w, v)
 		return
 	}
 
 	ProductsDB.Lock()
 	defer ProductsDB.Unlock()
 
-	// Check availability before making changes
+	// The order id is the idempotency key: a retry whose first response was lost must not reserve twice.
+	requested := quantities(req.Items)
+	if existing, ok := reservations[req.OrderID]; ok && existing.Active {
+		if !sameQuantities(existing.Items, requested) {
+			correlation.Printf(r.Context(), "Reservation for Order %s already exists with different items", req.OrderID)
+			responses.WriteError(w, http.StatusConflict, events.ReasonReservationClash,
+				"Order "+req.OrderID+" already has a reservation with different items")
+			return
+		}
+		correlation.Printf(r.Context(), "Inventory already booked for Order %s, replaying the original response", req.OrderID)
+		responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Booked inventory"})
+		return
+	}
+
+	// Check availability before making changes, collecting every item short of stock
+	var shortages []events.StockShortage
 	for _, item := range req.Items {
 		product, ok := ProductsDB.Data[item.ProductID]
-		if !ok || product.Available < item.Quantity {
-			w.Header().Set(contentType, contentTypeJSON)
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]string{
-				"status":  "error",
-				"message": "Insufficient quantity or product not found for " + item.ProductID,
-			})
+		if !ok {
+			responses.WriteError(w, http.StatusNotFound, events.ReasonUnknownProduct, "Product not found: "+item.ProductID)
 			return
 		}
+		if product.Available < item.Quantity {
+			shortages = append(shortages, order_policy.Shortage(item.ProductID, item.Quantity, product.Available))
+		}
+	}
+	if len(shortages) == 0 && chaos.Take(chaos.FaultReservation) {
+		responses.WriteError(w, http.StatusConflict, events.ReasonInsufficientQty, "Insufficient quantity (injected by chaos)")
+		return
+	}
+	if len(shortages) > 0 {
+		responses.WriteJSON(w, http.StatusConflict, events.ErrorResponse{
+			ReasonCode: events.ReasonInsufficientQty,
+			Message:    "Insufficient quantity for " + shortages[0].ProductID,
+			OrderID:    req.OrderID,
+			Shortages:  shortages,
+		})
+		return
 	}
 
-	// Book articles
-	for _, item := range req.Items {
-		product := ProductsDB.Data[item.ProductID]
-		product.Available -= item.Quantity
-		ProductsDB.Data[item.ProductID] = product
+	// Book articles, choosing the warehouses
+	alloc, ok := warehouse.Allocate(ProductsDB.Data, req.Items)
+	if !ok {
+		responses.WriteError(w, http.StatusConflict, events.ReasonInsufficientQty, "The stock of the warehouses cannot cover the order")
+		return
+	}
+	if err := warehouse.Take(ProductsDB.Data, alloc); err != nil {
+		correlation.Printf(r.Context(), "Reservation for Order %s rejected: %v", req.OrderID, err)
+		responses.WriteError(w, http.StatusConflict, events.ReasonStockOutOfRange, "Reservation rejected: "+err.Error())
+		return
 	}
+	reservations[req.OrderID] = &reservation{Items: requested, Allocation: alloc, Active: true, ExpiresAt: time.Now().Add(reservationTTL)}
 
-	log.Printf("Inventory booked for Order %s", req.OrderID)
-	w.Header().Set(contentType, contentTypeJSON)
-	_ = json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Booked inventory"})
+	correlation.Printf(r.Context(), "Inventory booked for Order %s from %v", req.OrderID, alloc)
+	responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Booked inventory"})
 }
 
 // cancelReservationHandler manages the cancellation of a reservation (compensation).
@@ -144,30 +429,73 @@ func cancelReservationHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req events.InventoryRequestPayload
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request")
 		return
 	}
 
 	ProductsDB.Lock()
 	defer ProductsDB.Unlock()
 
-	for _, item := range req.Items {
-		product := ProductsDB.Data[item.ProductID]
-		product.Available += item.Quantity
-		ProductsDB.Data[item.ProductID] = product
+	// A repeated cancellation, e.g. a dead-letter retry, must not restore the stock twice,
+	// and neither must the cancellation of a reservation the janitor already released.
+	if existing, ok := reservations[req.OrderID]; ok && !existing.Active {
+		if existing.Expired {
+			responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Reservation already released after expiring"})
+			return
+		}
+		responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Reservation already canceled"})
+		return
 	}
-
-	log.Printf("Canceled inventory reservation for Order %s", req.OrderID)
-	w.Header().Set(contentType, contentTypeJSON)
-	if err := json.NewEncoder(w).Encode(map[string]string{
-		"status":  "success",
-		"message": "Reservation canceled and inventory restored",
-	}); err != nil {
-		printEncodeError(err, w)
+	// The stock goes back to the warehouses it was taken from; the request items are not trusted.
+	existing, ok := reservations[req.OrderID]
+	if !ok {
+		correlation.Printf(r.Context(), "No reservation to cancel for Order %s, ignoring", req.OrderID)
+		responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "No reservation to cancel"})
+		return
+	}
+	if err := warehouse.Restore(ProductsDB.Data, existing.Allocation); err != nil {
+		correlation.Printf(r.Context(), "Cancellation for Order %s rejected: %v", req.OrderID, err)
+		responses.WriteError(w, http.StatusConflict, events.ReasonStockOutOfRange, "Cancellation rejected: "+err.Error())
+		return
 	}
+	existing.Active = false
+
+	correlation.Printf(r.Context(), "Canceled inventory reservation for Order %s", req.OrderID)
+	responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Reservation canceled and inventory restored"})
 }
 
-func printEncodeError(err error, w http.ResponseWriter) {
-	log.Printf("Error in response coding: %v", err)
-	http.Error(w, "Internal server error", http.StatusInternalServerError)
+// commitReservationHandler confirms the reservation of a paid order, so it no longer expires.
+// It can still be canceled by a later compensation.
+func commitReservationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, errorMethodNotAllowed, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req events.InventoryRequestPayload
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OrderID == "" {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request")
+		return
+	}
+
+	ProductsDB.Lock()
+	defer ProductsDB.Unlock()
+
+	existing, ok := reservations[req.OrderID]
+	switch {
+	case !ok:
+		responses.WriteNotFound(w, "reservation", req.OrderID)
+		return
+	case existing.Expired:
+		correlation.Printf(r.Context(), "Commit for Order %s refused: the reservation expired and its stock was released", req.OrderID)
+		responses.WriteError(w, http.StatusConflict, events.ReasonHoldExpired, "The reservation of Order "+req.OrderID+" expired")
+		return
+	case !existing.Active:
+		responses.WriteError(w, http.StatusConflict, events.ReasonInvalidRequest, "The reservation of Order "+req.OrderID+" was canceled")
+		return
+	}
+	existing.Committed = true
+
+	correlation.Printf(r.Context(), "Committed inventory reservation for Order %s", req.OrderID)
+	responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Reservation committed"})
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/order_policy"
+	events "github.com/StitchMl/saga-demo/common/types"
+	"github.com/StitchMl/saga-demo/common/warehouse"
+)
+
+func post(handler http.HandlerFunc, orderID string, quantity int) (int, string) {
+	body := fmt.Sprintf(`{"order_id":%q,"items":[{"product_id":"mouse-wireless","quantity":%d}]}`, orderID, quantity)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	var resp events.ErrorResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec.Code, resp.ReasonCode
+}
+
+// Reservations with negative, zero or oversized quantities are rejected, and a cancellation
+// does not trust the quantities it is sent: none of them changes the stock.
+func TestQuantityGuards(t *testing.T) {
+	resetInventory()
+	before := available("mouse-wireless")
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		orderID  string
+		quantity int
+		status   int
+		reason   string
+	}{
+		{"negative reservation", reserveInventoryHandler, "qty-1", -3, http.StatusUnprocessableEntity, events.ReasonInvalidQuantity},
+		{"zero reservation", reserveInventoryHandler, "qty-2", 0, http.StatusUnprocessableEntity, events.ReasonInvalidQuantity},
+		{"oversized reservation", reserveInventoryHandler, "qty-3", order_policy.MaxQuantityPerItem + 1, http.StatusUnprocessableEntity, events.ReasonQuantityExceeded},
+		{"negative cancellation", cancelReservationHandler, "qty-4", -5, http.StatusOK, ""},
+		{"cancellation of more than reserved", cancelReservationHandler, "qty-5", 10, http.StatusOK, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if code, reason := post(tc.handler, tc.orderID, tc.quantity); code != tc.status || reason != tc.reason {
+				t.Errorf("answered %d %s, want %d %s", code, reason, tc.status, tc.reason)
+			}
+			if got := available("mouse-wireless"); got != before {
+				t.Errorf("%d available, want %d", got, before)
+			}
+		})
+	}
+}
+
+// A cancellation that would take a warehouse past INVENTORY_MAX_STOCK is refused and keeps
+// the reservation, so that it can be canceled once the stock is back in range.
+func TestCancellationPastMaxStock(t *testing.T) {
+	resetInventory()
+	if code, _ := post(reserveInventoryHandler, "qty-ceiling", 10); code != http.StatusOK {
+		t.Fatalf("reservation answered %d", code)
+	}
+	reserved := available("mouse-wireless")
+
+	prev := warehouse.MaxStock
+	warehouse.MaxStock = 5
+	code, reason := post(cancelReservationHandler, "qty-ceiling", 10)
+	warehouse.MaxStock = prev
+	if code != http.StatusConflict || reason != events.ReasonStockOutOfRange {
+		t.Errorf("answered %d %s, want 409 %s", code, reason, events.ReasonStockOutOfRange)
+	}
+	if got := available("mouse-wireless"); got != reserved {
+		t.Errorf("%d available, want %d", got, reserved)
+	}
+
+	if code, _ := post(cancelReservationHandler, "qty-ceiling", 10); code != http.StatusOK || available("mouse-wireless") != reserved+10 {
+		t.Errorf("retried cancellation answered %d, %d available, want %d", code, available("mouse-wireless"), reserved+10)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// An uncommitted reservation holds its stock until its TTL, then the janitor releases it once;
+// cancelling it afterwards is a no-op and committing it is refused.
+func TestReservationExpiry(t *testing.T) {
+	resetInventory()
+	before := available("mouse-wireless")
+	if code, _ := post(reserveInventoryHandler, "ttl-1", 2); code != http.StatusOK {
+		t.Fatalf("reserve answered %d", code)
+	}
+
+	releaseExpiredReservations(time.Now())
+	if got := available("mouse-wireless"); got != before-2 {
+		t.Fatalf("%d available before the TTL, want %d", got, before-2)
+	}
+	expired := time.Now().Add(reservationTTL + time.Second)
+	releaseExpiredReservations(expired)
+	releaseExpiredReservations(expired)
+	if got := available("mouse-wireless"); got != before {
+		t.Fatalf("%d available after the TTL, want %d released once", got, before)
+	}
+
+	if code, _ := post(cancelReservationHandler, "ttl-1", 2); code != http.StatusOK {
+		t.Errorf("cancel after expiry answered %d, want 200", code)
+	}
+	if got := available("mouse-wireless"); got != before {
+		t.Errorf("%d available after cancelling an expired reservation, want %d", got, before)
+	}
+	if code, reason := post(commitReservationHandler, "ttl-1", 2); code != http.StatusConflict || reason != events.ReasonHoldExpired {
+		t.Errorf("commit after expiry answered %d %s, want 409 %s", code, reason, events.ReasonHoldExpired)
+	}
+}
+
+// A committed reservation is never released by the janitor, but a compensation can still
+// cancel it.
+func TestCommittedReservationDoesNotExpire(t *testing.T) {
+	resetInventory()
+	before := available("mouse-wireless")
+	post(reserveInventoryHandler, "ttl-2", 3)
+	if code, _ := post(commitReservationHandler, "ttl-2", 3); code != http.StatusOK {
+		t.Fatalf("commit answered %d", code)
+	}
+
+	releaseExpiredReservations(time.Now().Add(reservationTTL + time.Second))
+	if got := available("mouse-wireless"); got != before-3 {
+		t.Fatalf("%d available after the TTL, want the committed %d still held", got, before-3)
+	}
+	if code, _ := post(cancelReservationHandler, "ttl-2", 3); code != http.StatusOK {
+		t.Errorf("cancel of a committed reservation answered %d", code)
+	}
+	if got := available("mouse-wireless"); got != before {
+		t.Errorf("%d available after the cancel, want %d", got, before)
+	}
+
+	if code, _ := post(commitReservationHandler, "ttl-unknown", 1); code != http.StatusNotFound {
+		t.Errorf("commit without a reservation answered %d, want 404", code)
+	}
+}
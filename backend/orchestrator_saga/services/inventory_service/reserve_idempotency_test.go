@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetInventory restores the seeded stock and forgets every reservation.
+func resetInventory() {
+	initDB()
+	ProductsDB.Lock()
+	reservations = make(map[string]*reservation)
+	ProductsDB.Unlock()
+}
+
+func available(productID string) int {
+	ProductsDB.RLock()
+	defer ProductsDB.RUnlock()
+	return ProductsDB.Data[productID].Available
+}
+
+func reserve(body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	reserveInventoryHandler(rec, httptest.NewRequest(http.MethodPost, "/reserve", strings.NewReader(body)))
+	return rec
+}
+
+// The first response is lost after the stock was taken: the client times out and retries,
+// and the retry gets the original success without taking the stock a second time.
+func TestReserveLostResponseRetry(t *testing.T) {
+	resetInventory()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		reserveInventoryHandler(rec, r)
+		if requests.Add(1) == 1 {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.WriteHeader(rec.Code)
+		_, _ = w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+
+	body := `{"order_id":"lost-response","items":[{"product_id":"mouse-wireless","quantity":2}]}`
+	client := &http.Client{Timeout: 100 * time.Millisecond}
+	if resp, err := client.Post(srv.URL, "application/json", strings.NewReader(body)); err == nil {
+		_ = resp.Body.Close()
+		t.Fatal("the first response was not lost")
+	}
+	if n := available("mouse-wireless"); n != 48 {
+		t.Fatalf("%d mice available after the lost response, want 48", n)
+	}
+
+	client.Timeout = time.Second
+	resp, err := client.Post(srv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("retry answered %d, want the original 200", resp.StatusCode)
+	}
+	if n := available("mouse-wireless"); n != 48 {
+		t.Errorf("%d mice available after the retry, want still 48", n)
+	}
+}
+
+// A retry carrying other items than the reservation of its order is refused and takes nothing.
+func TestReserveMismatchedItemsRetry(t *testing.T) {
+	resetInventory()
+	if rec := reserve(`{"order_id":"mismatch","items":[{"product_id":"mouse-wireless","quantity":2}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("reservation answered %d", rec.Code)
+	}
+	for _, items := range []string{
+		`{"product_id":"mouse-wireless","quantity":3}`,
+		`{"product_id":"mouse-wireless","quantity":2},{"product_id":"laptop-pro","quantity":1}`,
+		`{"product_id":"laptop-pro","quantity":2}`,
+	} {
+		if rec := reserve(`{"order_id":"mismatch","items":[` + items + `]}`); rec.Code != http.StatusConflict {
+			t.Errorf("retry with %s answered %d, want 409", items, rec.Code)
+		}
+	}
+	if mice, laptops := available("mouse-wireless"), available("laptop-pro"); mice != 48 || laptops != 100 {
+		t.Errorf("%d mice and %d laptops available, want 48 and 100", mice, laptops)
+	}
+
+	// Once canceled, the order id can reserve again, with any items.
+	cancel := httptest.NewRecorder()
+	cancelReservationHandler(cancel, httptest.NewRequest(http.MethodPost, "/cancel_reservation", strings.NewReader(`{"order_id":"mismatch"}`)))
+	if rec := reserve(`{"order_id":"mismatch","items":[{"product_id":"mouse-wireless","quantity":3}]}`); rec.Code != http.StatusOK {
+		t.Errorf("reservation after the cancellation answered %d", rec.Code)
+	}
+	if n := available("mouse-wireless"); n != 47 {
+		t.Errorf("%d mice available, want 47", n)
+	}
+}
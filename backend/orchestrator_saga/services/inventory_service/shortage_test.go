@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func setAvailable(productID string, n int) {
+	ProductsDB.Lock()
+	p := ProductsDB.Data[productID]
+	p.Available = n
+	ProductsDB.Data[productID] = p
+	ProductsDB.Unlock()
+}
+
+// A reservation short of stock lists every item it could not take, suggesting the quantity
+// left when there is some, and takes nothing.
+func TestReserveShortages(t *testing.T) {
+	resetInventory()
+	setAvailable("mouse-wireless", 0)
+	setAvailable("laptop-pro", 2)
+
+	rec := reserve(`{"order_id":"short-1","items":[{"product_id":"mouse-wireless","quantity":1},{"product_id":"laptop-pro","quantity":5},{"product_id":"mechanical-keyboard","quantity":1}]}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("answered %d, want 409", rec.Code)
+	}
+	var resp events.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []events.StockShortage{
+		{ProductID: "mouse-wireless", Requested: 1, Available: 0},
+		{ProductID: "laptop-pro", Requested: 5, Available: 2, SuggestedQuantity: 2},
+	}
+	if resp.ReasonCode != events.ReasonInsufficientQty || resp.OrderID != "short-1" || len(resp.Shortages) != len(want) {
+		t.Fatalf("error = %+v", resp)
+	}
+	for i, s := range want {
+		if resp.Shortages[i] != s {
+			t.Errorf("shortage %d = %+v, want %+v", i, resp.Shortages[i], s)
+		}
+	}
+	if available("laptop-pro") != 2 || available("mechanical-keyboard") != 200 {
+		t.Error("a failed reservation took stock")
+	}
+}
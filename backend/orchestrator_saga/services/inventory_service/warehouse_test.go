@@ -0,0 +1,48 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func warehouses(productID string) map[string]int {
+	ProductsDB.RLock()
+	defer ProductsDB.RUnlock()
+	return maps.Clone(ProductsDB.Data[productID].Warehouses)
+}
+
+// A reservation no warehouse can fill alone is split, and its cancellation restores each
+// warehouse to its stock before the reservation.
+func TestReserveSplitAndCancel(t *testing.T) {
+	resetInventory()
+	before := warehouses("mouse-wireless")
+
+	if rec := reserve(`{"order_id":"split-1","items":[{"product_id":"mouse-wireless","quantity":35}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("reserve answered %d: %s", rec.Code, rec.Body)
+	}
+	ProductsDB.RLock()
+	alloc := reservations["split-1"].Allocation
+	ProductsDB.RUnlock()
+	if got := alloc["mouse-wireless"]; !maps.Equal(got, map[string]int{"wh-north": 20, "wh-south": 15}) {
+		t.Errorf("allocation = %v, want 20 from wh-north and 15 from wh-south", got)
+	}
+	if got := warehouses("mouse-wireless"); got["wh-north"] != 0 || got["wh-south"] != 15 {
+		t.Errorf("stock after the reservation = %v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	cancelReservationHandler(rec, httptest.NewRequest(http.MethodPost, "/cancel_reservation",
+		strings.NewReader(`{"order_id":"split-1","items":[{"product_id":"mouse-wireless","quantity":35}]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cancel answered %d: %s", rec.Code, rec.Body)
+	}
+	if got := warehouses("mouse-wireless"); !maps.Equal(got, before) {
+		t.Errorf("stock after the cancellation = %v, want %v", got, before)
+	}
+	if available("mouse-wireless") != 50 {
+		t.Errorf("available = %d, want 50", available("mouse-wireless"))
+	}
+}
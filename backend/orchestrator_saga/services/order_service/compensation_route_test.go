@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// The orchestrator rejects an order with POST /update_status and the request it builds;
+// served by the real routes, the call succeeds and GET /orders/{id} shows the rejection.
+func TestCompensationRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	orderID := fmt.Sprintf("route-%d", time.Now().UnixNano())
+
+	resp, err := http.Post(srv.URL+"/create_order", "application/json", strings.NewReader(
+		`{"order_id":"`+orderID+`","customer_id":"customer-1","items":[{"product_id":"mouse-wireless","quantity":1}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /create_order answered %d", resp.StatusCode)
+	}
+
+	body, _ := json.Marshal(events.OrderStatusUpdatePayload{OrderID: orderID, Status: "rejected", Reason: "payment failed"})
+	resp, err = http.Post(srv.URL+"/update_status", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /update_status answered %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/orders/" + orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var order events.Order
+	if err := json.NewDecoder(resp.Body).Decode(&order); err != nil || order.Status != "rejected" || order.Reason != "payment failed" {
+		t.Errorf("order = %+v (%v), want rejected for the payment", order, err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// post calls handler with body and decodes the error envelope of a failed response.
+func post(t *testing.T, handler http.HandlerFunc, body string) (*httptest.ResponseRecorder, events.ErrorResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	var envelope events.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+	}
+	return rec, envelope
+}
+
+// The orchestrator tells success from failure by the status code alone: a 2xx carries no
+// reason code, every failure carries one with a message.
+func TestStatusContract(t *testing.T) {
+	catalog := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]events.Product{{ID: "mouse-wireless"}})
+	}))
+	defer catalog.Close()
+	prevURL := inventoryServiceURL
+	inventoryServiceURL = catalog.URL
+	defer func() { inventoryServiceURL = prevURL }()
+	catalogCache.Lock()
+	catalogCache.IDs = nil
+	catalogCache.Unlock()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+		status  int
+		reason  string
+	}{
+		{name: "order created", handler: createOrderHandler, status: http.StatusCreated,
+			body: `{"order_id":"contract-1","customer_id":"user1","items":[{"product_id":"mouse-wireless","quantity":1}]}`},
+		{name: "malformed order", handler: createOrderHandler, body: `{`, status: http.StatusBadRequest, reason: events.ReasonInvalidRequest},
+		{name: "unknown product", handler: createOrderHandler, status: http.StatusUnprocessableEntity, reason: events.ReasonUnknownProduct,
+			body: `{"order_id":"contract-2","customer_id":"user1","items":[{"product_id":"no-such-product","quantity":1}]}`},
+		{name: "status updated", handler: updateOrderStatusHandler, body: `{"order_id":"contract-1","status":"approved"}`, status: http.StatusOK},
+		{name: "unknown order", handler: updateOrderStatusHandler, body: `{"order_id":"contract-missing","status":"approved"}`,
+			status: http.StatusNotFound, reason: events.ReasonOrderNotFound},
+		{name: "malformed update", handler: updateOrderStatusHandler, body: `[]`, status: http.StatusBadRequest, reason: events.ReasonInvalidRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, envelope := post(t, tc.handler, tc.body)
+			if rec.Code != tc.status {
+				t.Fatalf("answered %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+			if envelope.ReasonCode != tc.reason || (tc.reason != "" && envelope.Message == "") {
+				t.Errorf("envelope = %+v, want reason %q", envelope, tc.reason)
+			}
+			if strings.Contains(rec.Body.String(), `"status":"success"`) {
+				t.Errorf("body %s still reports a success status", rec.Body)
+			}
+		})
+	}
+
+	if order, ok := getOrder("contract-1"); !ok || order.Status != "approved" {
+		t.Errorf("order = %+v, want it approved", order)
+	}
+	if _, ok := getOrder("contract-2"); ok {
+		t.Error("the order with an unknown product was stored")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func pendingOrder(id string) {
+	OrdersDB.Lock()
+	OrdersDB.Data[id] = events.Order{OrderID: id, Status: "pending"}
+	OrdersDB.Unlock()
+}
+
+func getOrderAfter(query string, id string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	getOrderHandler(rec, httptest.NewRequest(http.MethodGet, "/orders/"+id+query, nil))
+	return rec
+}
+
+func TestLongPollOrderStatus(t *testing.T) {
+	t.Run("status already changed", func(t *testing.T) {
+		pendingOrder("poll-immediate")
+		start := time.Now()
+		rec := getOrderAfter("?wait=30s&since_status=created", "poll-immediate")
+		if rec.Code != http.StatusOK || time.Since(start) > time.Second {
+			t.Fatalf("answered %d after %s, want 200 at once", rec.Code, time.Since(start))
+		}
+		var order events.Order
+		if err := json.NewDecoder(rec.Body).Decode(&order); err != nil || order.Status != "pending" {
+			t.Errorf("order = %+v (%v)", order, err)
+		}
+	})
+	t.Run("wait expires", func(t *testing.T) {
+		pendingOrder("poll-timeout")
+		start := time.Now()
+		rec := getOrderAfter("?wait=50ms&since_status=pending", "poll-timeout")
+		if rec.Code != http.StatusNotModified || time.Since(start) < 50*time.Millisecond {
+			t.Errorf("answered %d after %s, want 304 once the wait is over", rec.Code, time.Since(start))
+		}
+	})
+	t.Run("concurrent waiters woken by the update", func(t *testing.T) {
+		pendingOrder("poll-wakeup")
+		var wg sync.WaitGroup
+		codes := make(chan int, 3)
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rec := getOrderAfter("?wait=5s&since_status=pending", "poll-wakeup")
+				var order events.Order
+				_ = json.NewDecoder(rec.Body).Decode(&order)
+				if order.Status != "approved" {
+					codes <- 0
+					return
+				}
+				codes <- rec.Code
+			}()
+		}
+		time.Sleep(50 * time.Millisecond) // let the requests park
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		updateOrderStatusHandler(rec, httptest.NewRequest(http.MethodPost, "/update_status", strings.NewReader(`{"order_id":"poll-wakeup","status":"approved"}`)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status update answered %d", rec.Code)
+		}
+		wg.Wait()
+		close(codes)
+		for code := range codes {
+			if code != http.StatusOK {
+				t.Errorf("a waiter got %d or a stale order, want 200 with the approved order", code)
+			}
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("waiters answered %s after the update", elapsed)
+		}
+	})
+	t.Run("invalid wait", func(t *testing.T) {
+		pendingOrder("poll-invalid")
+		if rec := getOrderAfter("?wait=forever", "poll-invalid"); rec.Code != http.StatusBadRequest {
+			t.Errorf("answered %d, want 400", rec.Code)
+		}
+	})
+}
@@ -6,10 +6,20 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/buildinfo"
+	"github.com/StitchMl/saga-demo/common/chaos"
+	"github.com/StitchMl/saga-demo/common/correlation"
+	"github.com/StitchMl/saga-demo/common/diagnostics"
+	"github.com/StitchMl/saga-demo/common/idgen"
+	"github.com/StitchMl/saga-demo/common/longpoll"
+	"github.com/StitchMl/saga-demo/common/ordernotes"
+	"github.com/StitchMl/saga-demo/common/responses"
 	events "github.com/StitchMl/saga-demo/common/types"
 )
 
@@ -24,15 +34,42 @@ var OrdersDB = struct {
 	Data map[string]events.Order
 }{Data: make(map[string]events.Order)}
 
+// Product check at order creation: the catalog of INVENTORY_SERVICE_URL, cached for catalogCacheTTL.
+// A failed fetch is remembered for catalogFailureTTL, so an unreachable inventory does not slow down
+// every order.
+var (
+	inventoryServiceURL string
+	catalogCacheTTL     = 30 * time.Second
+	catalogFailureTTL   = 5 * time.Second
+)
+
+// Product ids of the last catalog fetched from the inventory service, or the error of the last fetch.
+// Fetching is closed when the fetch in progress ends; the requests arriving meanwhile wait for it
+// instead of fetching again.
+var catalogCache = struct {
+	sync.Mutex
+	IDs        map[string]bool
+	Expires    time.Time
+	Err        error
+	ErrExpires time.Time
+	Fetching   chan struct{}
+}{}
+
+// statusChanges wakes up the long-poll requests of GET /orders/{id}.
+var statusChanges = longpoll.NewNotifier()
+
 func main() {
-	http.HandleFunc("/create_order", createOrderHandler)
-	http.HandleFunc("/orders/", getOrderHandler)
-	http.HandleFunc("/orders", listOrdersHandler)
-	http.HandleFunc("/update_status", updateOrderStatusHandler)
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = fmt.Fprintln(w, "Orchestrator Order Service is healthy!")
-	})
+	// Optional: without it orders are created without the product check.
+	inventoryServiceURL = os.Getenv("INVENTORY_SERVICE_URL")
+	if v := os.Getenv("CATALOG_CACHE_TTL_SECONDS"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			log.Fatalf("Invalid CATALOG_CACHE_TTL_SECONDS: %q", v)
+		}
+		catalogCacheTTL = time.Duration(secs) * time.Second
+	}
+
+	registerRoutes(http.DefaultServeMux)
 
 	port := os.Getenv("ORDER_SERVICE_PORT")
 	if port == "" {
@@ -40,7 +77,21 @@ func main() {
 	}
 
 	log.Printf("Order Service listening on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Fatal(http.ListenAndServe(":"+port, diagnostics.Handler(http.DefaultServeMux)))
+}
+
+// registerRoutes registers the routes of the order service on mux.
+func registerRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/create_order", correlation.Middleware(createOrderHandler))
+	mux.HandleFunc("/orders/", getOrderHandler)
+	mux.HandleFunc("/orders", listOrdersHandler)
+	mux.HandleFunc("/update_status", correlation.Middleware(updateOrderStatusHandler))
+	mux.HandleFunc("/admin/chaos", adminauth.Require(chaos.AdminHandler))
+	mux.HandleFunc("/version", buildinfo.Handler("orchestrator-order-service"))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "Orchestrator Order Service is healthy!")
+	})
 }
 
 // listOrdersHandler returns all orders
@@ -60,17 +111,58 @@ func listOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(out)
 }
 
-// getOrderHandler retrieves an order by its ID.
-func getOrderHandler(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/orders/")
+// getOrder returns the order with the given ID.
+func getOrder(id string) (events.Order, bool) {
 	OrdersDB.RLock()
 	defer OrdersDB.RUnlock()
-	if order, ok := OrdersDB.Data[id]; ok {
-		w.Header().Set(contentType, contentTypeJSON)
-		_ = json.NewEncoder(w).Encode(order)
+	order, ok := OrdersDB.Data[id]
+	return order, ok
+}
+
+// notesHandler serves the support notes of /orders/{id}/notes.
+var notesHandler = adminauth.Require(ordernotes.Handler(func(id string) bool {
+	_, ok := getOrder(id)
+	return ok
+}))
+
+// getOrderHandler retrieves an order by its ID. With ?wait=30s&since_status=pending it answers as soon
+// as the status differs from since_status, or with 304 once the wait expires. ?include=notes adds the notes.
+func getOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := ordernotes.IsNotesPath(r.URL.Path); ok {
+		notesHandler(w, r)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/orders/")
+	wait, since, err := longpoll.Params(r)
+	if err != nil {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, err.Error())
+		return
+	}
+	order, ok := getOrder(id)
+	if !ok {
+		responses.WriteNotFound(w, "order", id)
 		return
 	}
-	http.Error(w, "order not found", http.StatusNotFound)
+	if wait > 0 && order.Status == since {
+		changed, err := statusChanges.WaitFor(r.Context(), id, wait, func() bool {
+			order, _ = getOrder(id)
+			return order.Status != since
+		})
+		if err != nil {
+			http.Error(w, "too many requests waiting for this order", http.StatusTooManyRequests)
+			return
+		}
+		if !changed {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set(contentType, contentTypeJSON)
+	if ordernotes.Included(r) {
+		_ = json.NewEncoder(w).Encode(ordernotes.OrderDetail{Order: order, Notes: ordernotes.List(id)})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(order)
 }
 
 // createOrderHandler handles the initial order creation request from the Orchestrator.
@@ -82,33 +174,139 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 
 	var order events.Order
 	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		log.Printf("Order Service: Invalid request body: %v", err)
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request body")
+		correlation.Printf(r.Context(), "Order Service: Invalid request body: %v", err)
 		return
 	}
 
-	if order.OrderID == "" {
-		order.OrderID = fmt.Sprintf("order-%d", time.Now().UnixNano())
+	// Unknown products are rejected before anything is stored. The check is best-effort:
+	// when the inventory cannot be reached the order goes on, and the saga catches them later.
+	unknown, err := unknownProducts(order.Items)
+	if err != nil {
+		correlation.Printf(r.Context(), "Order Service: Product check skipped: %v", err)
+		order.Tags = append(order.Tags, events.TagPrecheckSkipped)
 	}
+	if len(unknown) > 0 {
+		correlation.Printf(r.Context(), "Order Service: Rejecting order with unknown products %v", unknown)
+		responses.WriteJSON(w, http.StatusUnprocessableEntity, events.ErrorResponse{
+			ReasonCode:      events.ReasonUnknownProduct,
+			Message:         "Unknown products: " + strings.Join(unknown, ", "),
+			OrderID:         order.OrderID,
+			UnknownProducts: unknown,
+		})
+		return
+	}
+
 	order.Status = "pending"
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = time.Now()
+	}
 
 	OrdersDB.Lock()
+	// The orchestrator normally assigns the ID; direct calls without one get an "orc-" ID
+	if order.OrderID == "" {
+		order.OrderID = idgen.NewUnique(idgen.FlowOrchestrated, func(id string) bool {
+			_, ok := OrdersDB.Data[id]
+			return ok
+		})
+	}
 	OrdersDB.Data[order.OrderID] = order
 	OrdersDB.Unlock()
 
-	log.Printf("Order Service: Created order %s for Customer %s. Status: %s", order.OrderID, order.CustomerID, order.Status)
+	correlation.Printf(r.Context(), "Order Service: Created order %s for Customer %s. Status: %s", order.OrderID, order.CustomerID, order.Status)
 	for _, item := range order.Items {
-		log.Printf(" - Item: ProductID: %s, Quantity: %d", item.ProductID, item.Quantity)
+		correlation.Printf(r.Context(), " - Item: ProductID: %s, Quantity: %d", item.ProductID, item.Quantity)
 	}
 
-	w.Header().Set(contentType, contentTypeJSON)
-	_ = json.NewEncoder(w).Encode(map[string]string{
+	responses.WriteJSON(w, http.StatusCreated, map[string]string{
 		"order_id": order.OrderID,
-		"status":   "success",
 		"message":  "Order created successfully",
 	})
 }
 
+// unknownProducts returns the product ids of the items that are not in the inventory catalog.
+func unknownProducts(items []events.OrderItem) ([]string, error) {
+	known, err := catalogIDs()
+	if err != nil {
+		return nil, err
+	}
+	var unknown []string
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if !known[item.ProductID] && !seen[item.ProductID] {
+			seen[item.ProductID] = true
+			unknown = append(unknown, item.ProductID)
+		}
+	}
+	return unknown, nil
+}
+
+// catalogIDs returns the product ids of the inventory catalog, using a short-lived cache. The
+// catalog is fetched without holding the cache lock, once for all the requests needing it.
+func catalogIDs() (map[string]bool, error) {
+	if inventoryServiceURL == "" {
+		return nil, fmt.Errorf("INVENTORY_SERVICE_URL not set")
+	}
+	for {
+		catalogCache.Lock()
+		now := time.Now()
+		if catalogCache.IDs != nil && now.Before(catalogCache.Expires) {
+			ids := catalogCache.IDs
+			catalogCache.Unlock()
+			return ids, nil
+		}
+		if catalogCache.Err != nil && now.Before(catalogCache.ErrExpires) {
+			err := catalogCache.Err
+			catalogCache.Unlock()
+			return nil, err
+		}
+		if fetching := catalogCache.Fetching; fetching != nil {
+			catalogCache.Unlock()
+			<-fetching
+			continue
+		}
+		fetching := make(chan struct{})
+		catalogCache.Fetching = fetching
+		catalogCache.Unlock()
+
+		ids, err := fetchCatalogIDs()
+
+		catalogCache.Lock()
+		if err != nil {
+			catalogCache.Err, catalogCache.ErrExpires = err, time.Now().Add(catalogFailureTTL)
+		} else {
+			catalogCache.IDs, catalogCache.Expires = ids, time.Now().Add(catalogCacheTTL)
+			catalogCache.Err = nil
+		}
+		catalogCache.Fetching = nil
+		close(fetching)
+		catalogCache.Unlock()
+		return ids, err
+	}
+}
+
+// fetchCatalogIDs reads the product ids of the inventory catalog.
+func fetchCatalogIDs() (map[string]bool, error) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(inventoryServiceURL + "/catalog")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("inventory service responded with status %d", resp.StatusCode)
+	}
+	var products []events.Product
+	if err := json.NewDecoder(resp.Body).Decode(&products); err != nil {
+		return nil, fmt.Errorf("decode catalog: %w", err)
+	}
+	ids := make(map[string]bool, len(products))
+	for _, p := range products {
+		ids[p.ID] = true
+	}
+	return ids, nil
+}
+
 // updateOrderStatusHandler handles updating the status of an order.
 func updateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -118,7 +316,12 @@ func updateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req events.OrderStatusUpdatePayload
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if req.Status == "approved" && chaos.Take(chaos.FaultConfirmation) {
+		responses.WriteError(w, http.StatusInternalServerError, events.ReasonInjectedFailure, "Order approval failed (injected by chaos)")
 		return
 	}
 
@@ -126,21 +329,21 @@ func updateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
 	defer OrdersDB.Unlock()
 	order, exists := OrdersDB.Data[req.OrderID]
 	if !exists {
-		http.Error(w, "Order not found", http.StatusNotFound)
+		responses.WriteError(w, http.StatusNotFound, events.ReasonOrderNotFound, "Order not found")
 		return
 	}
 
-	log.Printf("Updating status for order %s from %s to %s. Reason: %s", req.OrderID, order.Status, req.Status, req.Reason)
+	correlation.Printf(r.Context(), "Updating status for order %s from %s to %s. Reason: %s", req.OrderID, order.Status, req.Status, req.Reason)
 	order.Status = req.Status
 	order.Reason = req.Reason
 	if req.Total > 0 {
 		order.Total = req.Total
 	}
+	if req.ShippingCost > 0 {
+		order.ShippingCost = req.ShippingCost
+	}
 	OrdersDB.Data[req.OrderID] = order
+	statusChanges.Notify(req.OrderID)
 
-	w.Header().Set(contentType, contentTypeJSON)
-	_ = json.NewEncoder(w).Encode(map[string]string{
-		"status":  "success",
-		"message": "Order status updated",
-	})
+	responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Order status updated"})
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/ordernotes"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func orderRequest(method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set(adminauth.Header, token)
+	}
+	rec := httptest.NewRecorder()
+	getOrderHandler(rec, req)
+	return rec
+}
+
+// Notes need the admin token, and show in the order detail with ?include=notes only.
+func TestOrderNotes(t *testing.T) {
+	adminauth.SetTokens("admin-secret")
+	defer adminauth.SetTokens("")
+	id := fmt.Sprintf("orc-notes-%d", time.Now().UnixNano())
+	OrdersDB.Lock()
+	OrdersDB.Data[id] = events.Order{OrderID: id, Status: "pending", CreatedAt: time.Now()}
+	OrdersDB.Unlock()
+
+	if rec := orderRequest(http.MethodPost, "/orders/"+id+"/notes", "", `{"text":"anonymous"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("note without the admin token answered %d, want 401", rec.Code)
+	}
+	for _, text := range []string{"customer called", "payment retried"} {
+		if rec := orderRequest(http.MethodPost, "/orders/"+id+"/notes", "admin-secret", `{"author":"support","text":"`+text+`"}`); rec.Code != http.StatusCreated {
+			t.Fatalf("note answered %d: %s", rec.Code, rec.Body)
+		}
+	}
+	if rec := orderRequest(http.MethodPost, "/orders/orc-unknown/notes", "admin-secret", `{"text":"lost"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("note on an unknown order answered %d, want 404", rec.Code)
+	}
+
+	var detail ordernotes.OrderDetail
+	rec := orderRequest(http.MethodGet, "/orders/"+id+"?include=notes", "", "")
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&detail) != nil {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	if detail.OrderID != id || len(detail.Notes) != 2 || detail.Notes[0].Text != "customer called" || detail.Notes[1].Text != "payment retried" {
+		t.Errorf("detail = %+v, want the order with both notes, oldest first", detail)
+	}
+	rec = orderRequest(http.MethodGet, "/orders/"+id, "", "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"notes"`) {
+		t.Errorf("order without ?include=notes answered %d: %s", rec.Code, rec.Body)
+	}
+}
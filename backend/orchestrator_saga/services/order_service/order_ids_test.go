@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/idgen"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Orders created without an ID at the same time get distinct "orc-" IDs.
+func TestOrderIDsParallel(t *testing.T) {
+	withCatalog(t, "mouse-wireless")
+	const orders = 50
+	ids := make([]string, orders)
+	var wg sync.WaitGroup
+	for i := 0; i < orders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := createOrder("", "mouse-wireless")
+			var body map[string]string
+			if rec.Code != http.StatusCreated || json.NewDecoder(rec.Body).Decode(&body) != nil {
+				t.Errorf("order %d answered %d: %s", i, rec.Code, rec.Body)
+				return
+			}
+			ids[i] = body["order_id"]
+		}(i)
+	}
+	wg.Wait()
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if idgen.Flow(id) != idgen.FlowOrchestrated {
+			t.Errorf("order ID %q has no orc- prefix", id)
+		}
+		if seen[id] {
+			t.Errorf("order ID %s given twice", id)
+		}
+		seen[id] = true
+		if _, ok := getOrder(id); !ok {
+			t.Errorf("order %s not stored", id)
+		}
+	}
+}
+
+// Orders stored before the switch to prefixed IDs can still be read and updated.
+func TestLegacyOrderIDRead(t *testing.T) {
+	const legacy = "order-1700000000000000000"
+	OrdersDB.Lock()
+	OrdersDB.Data[legacy] = events.Order{OrderID: legacy, Status: "pending", CreatedAt: time.Now()}
+	OrdersDB.Unlock()
+
+	rec := httptest.NewRecorder()
+	getOrderHandler(rec, httptest.NewRequest(http.MethodGet, "/orders/"+legacy, nil))
+	var order events.Order
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&order) != nil {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	if order.OrderID != legacy {
+		t.Errorf("read order %q, want %q", order.OrderID, legacy)
+	}
+
+	rec = httptest.NewRecorder()
+	updateOrderStatusHandler(rec, httptest.NewRequest(http.MethodPost, "/update_order_status",
+		strings.NewReader(`{"order_id":"`+legacy+`","status":"approved"}`)))
+	if order, _ := getOrder(legacy); rec.Code != http.StatusOK || order.Status != "approved" {
+		t.Errorf("update answered %d, status %q, want approved", rec.Code, order.Status)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// withCatalog points the product check at a stub inventory service listing ids, or failing
+// every request when ids is nil. It returns the number of catalog fetches.
+func withCatalog(t *testing.T, ids ...string) *atomic.Int32 {
+	t.Helper()
+	return withSlowCatalog(t, 0, ids...)
+}
+
+// withSlowCatalog is withCatalog with an inventory service taking delay to answer.
+func withSlowCatalog(t *testing.T, delay time.Duration, ids ...string) *atomic.Int32 {
+	t.Helper()
+	var fetches atomic.Int32
+	inventory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		time.Sleep(delay)
+		if ids == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		products := make([]events.Product, 0, len(ids))
+		for _, id := range ids {
+			products = append(products, events.Product{ID: id})
+		}
+		_ = json.NewEncoder(w).Encode(products)
+	}))
+	t.Cleanup(inventory.Close)
+	prevURL, prevTTL, prevFailureTTL := inventoryServiceURL, catalogCacheTTL, catalogFailureTTL
+	inventoryServiceURL, catalogCacheTTL, catalogFailureTTL = inventory.URL, time.Minute, time.Minute
+	t.Cleanup(func() { inventoryServiceURL, catalogCacheTTL, catalogFailureTTL = prevURL, prevTTL, prevFailureTTL })
+	catalogCache.Lock()
+	catalogCache.IDs, catalogCache.Err = nil, nil
+	catalogCache.Unlock()
+	return &fetches
+}
+
+func createOrder(orderID string, products ...string) *httptest.ResponseRecorder {
+	items := make([]string, 0, len(products))
+	for _, p := range products {
+		items = append(items, `{"product_id":"`+p+`","quantity":1}`)
+	}
+	body := `{"order_id":"` + orderID + `","customer_id":"customer-1","items":[` + strings.Join(items, ",") + `]}`
+	rec := httptest.NewRecorder()
+	createOrderHandler(rec, httptest.NewRequest(http.MethodPost, "/create_order", strings.NewReader(body)))
+	return rec
+}
+
+// Unknown products are listed once each, and nothing is stored.
+func TestCreateOrderUnknownProducts(t *testing.T) {
+	withCatalog(t, "mouse-wireless")
+	rec := createOrder("precheck-unknown", "mouse-wireless", "ghost", "phantom", "ghost")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("answered %d, want 422: %s", rec.Code, rec.Body)
+	}
+	var resp events.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ReasonCode != events.ReasonUnknownProduct || strings.Join(resp.UnknownProducts, ",") != "ghost,phantom" {
+		t.Errorf("error = %+v, want ghost and phantom", resp)
+	}
+	if _, ok := getOrder("precheck-unknown"); ok {
+		t.Error("the rejected order was stored")
+	}
+}
+
+// The catalog is fetched once for several orders while the cache is fresh.
+func TestCreateOrderCatalogCached(t *testing.T) {
+	fetches := withCatalog(t, "mouse-wireless", "keyboard")
+	for _, id := range []string{"precheck-cached-1", "precheck-cached-2"} {
+		if rec := createOrder(id, "mouse-wireless", "keyboard"); rec.Code != http.StatusCreated {
+			t.Fatalf("%s answered %d: %s", id, rec.Code, rec.Body)
+		}
+		if order, _ := getOrder(id); len(order.Tags) != 0 {
+			t.Errorf("%s tags = %v, want none", id, order.Tags)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("catalog fetched %d times, want once", n)
+	}
+}
+
+// With the inventory service down the order is created anyway, tagged as unchecked; the failure
+// is remembered for a while, then the inventory is asked again.
+func TestCreateOrderInventoryDown(t *testing.T) {
+	fetches := withCatalog(t)
+	for _, id := range []string{"precheck-down-1", "precheck-down-2"} {
+		if rec := createOrder(id, "ghost"); rec.Code != http.StatusCreated {
+			t.Fatalf("%s answered %d: %s", id, rec.Code, rec.Body)
+		}
+		order, ok := getOrder(id)
+		if !ok || order.Status != "pending" || len(order.Tags) != 1 || order.Tags[0] != events.TagPrecheckSkipped {
+			t.Errorf("%s stored %t as %+v, want a pending order tagged %s", id, ok, order, events.TagPrecheckSkipped)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("catalog fetched %d times, want the failure cached", n)
+	}
+
+	catalogCache.Lock()
+	catalogCache.ErrExpires = time.Now()
+	catalogCache.Unlock()
+	if rec := createOrder("precheck-down-3", "ghost"); rec.Code != http.StatusCreated {
+		t.Fatalf("answered %d: %s", rec.Code, rec.Body)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("catalog fetched %d times, want it asked again once the failure expired", n)
+	}
+}
+
+// Orders arriving together while the inventory is slow share one catalog fetch, instead of
+// queueing behind each other's.
+func TestCreateOrderSlowCatalogFetchedOnce(t *testing.T) {
+	const orders, delay = 8, 300 * time.Millisecond
+	fetches := withSlowCatalog(t, delay, "mouse-wireless")
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < orders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("precheck-slow-%d-%d", started.UnixNano(), i)
+			if rec := createOrder(id, "mouse-wireless"); rec.Code != http.StatusCreated {
+				t.Errorf("%s answered %d: %s", id, rec.Code, rec.Body)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("catalog fetched %d times for %d concurrent orders, want once", n, orders)
+	}
+	if elapsed := time.Since(started); elapsed > 2*delay {
+		t.Errorf("%d orders took %v with a %v catalog fetch, want them to wait for a single fetch", orders, elapsed, delay)
+	}
+}
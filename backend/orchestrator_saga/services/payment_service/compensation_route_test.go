@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/payment_gateway"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// The orchestrator refunds a payment with POST /revert and the request it builds; served by
+// the real routes, the call succeeds and the transaction reads as reverted.
+func TestCompensationRoute(t *testing.T) {
+	payment_gateway.SetFailureRate(0)
+	prevLimit := paymentAmountLimit
+	paymentAmountLimit = 500
+	defer func() { paymentAmountLimit = prevLimit }()
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	orderID := fmt.Sprintf("route-%d", time.Now().UnixNano())
+
+	post := func(path string, payload interface{}) int {
+		body, _ := json.Marshal(payload)
+		resp, err := http.Post(srv.URL+path, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post("/process", map[string]interface{}{"order_id": orderID, "customer_id": "user1", "amount": 50}); code != http.StatusOK {
+		t.Fatalf("POST /process answered %d", code)
+	}
+	// The simulated gateway fails some refunds at random; the orchestrator retries them.
+	code := http.StatusBadGateway
+	for attempt := 0; attempt < 20 && code == http.StatusBadGateway; attempt++ {
+		code = post("/revert", map[string]interface{}{"order_id": orderID, "reason": "shipping failed"})
+	}
+	if code != http.StatusOK {
+		t.Fatalf("POST /revert answered %d", code)
+	}
+
+	resp, err := http.Get(srv.URL + "/payments/" + orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var tx events.Transaction
+	if err := json.NewDecoder(resp.Body).Decode(&tx); err != nil || tx.Status != "reverted" {
+		t.Errorf("transaction = %+v (%v), want reverted", tx, err)
+	}
+}
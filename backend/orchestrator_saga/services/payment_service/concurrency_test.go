@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/payment_gateway"
+)
+
+// Payments and reversals of the same order racing each other reach the gateway once, answer
+// only with the documented statuses, and leave the order reverted once a reversal has gone
+// through; a payment can then no longer be taken.
+func TestPayRevertConcurrent(t *testing.T) {
+	payment_gateway.SetFailureRate(0)
+	prevLimit := paymentAmountLimit
+	paymentAmountLimit = 500
+	defer func() { paymentAmountLimit = prevLimit }()
+
+	const orders, callers = 5, 10
+	allowed := map[string]map[int]bool{
+		"process": {http.StatusOK: true, http.StatusServiceUnavailable: true, http.StatusConflict: true},
+		"revert":  {http.StatusOK: true, http.StatusServiceUnavailable: true, http.StatusBadGateway: true},
+	}
+	post := func(handler http.HandlerFunc, body string) int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	prefix := fmt.Sprintf("race-%d", time.Now().UnixNano())
+	var mu sync.Mutex
+	unexpected := make(map[string]int)
+	var wg sync.WaitGroup
+	for o := 0; o < orders; o++ {
+		orderID := fmt.Sprintf("%s-%d", prefix, o)
+		pay := `{"order_id":"` + orderID + `","customer_id":"user1","amount":40}`
+		revert := `{"order_id":"` + orderID + `","reason":"shipping failed"}`
+		for c := 0; c < callers; c++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if code := post(processPaymentHandler, pay); !allowed["process"][code] {
+					mu.Lock()
+					unexpected[fmt.Sprintf("process answered %d", code)]++
+					mu.Unlock()
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if code := post(revertPaymentHandler, revert); !allowed["revert"][code] {
+					mu.Lock()
+					unexpected[fmt.Sprintf("revert answered %d", code)]++
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	if len(unexpected) > 0 {
+		t.Errorf("unexpected answers: %v", unexpected)
+	}
+
+	for o := 0; o < orders; o++ {
+		orderID := fmt.Sprintf("%s-%d", prefix, o)
+		// Every reversal may have run before the payment: the compensation retries until it sticks.
+		code := 0
+		for attempt := 0; attempt < 20 && code != http.StatusOK; attempt++ {
+			code = post(revertPaymentHandler, `{"order_id":"`+orderID+`"}`)
+		}
+		tx, ok := getTransaction(orderID)
+		if code != http.StatusOK || !ok || tx.Status != "reverted" || tx.RevertedAt == nil {
+			t.Errorf("%s: revert answered %d, transaction %+v, want reverted", orderID, code, tx)
+		}
+		if tx.Attempts != 1 || tx.Amount != 40 {
+			t.Errorf("%s: %d gateway attempts for %.2f, want one payment of 40", orderID, tx.Attempts, tx.Amount)
+		}
+		if gw, _ := payment_gateway.GetTransaction(orderID); gw.Captured != 40 {
+			t.Errorf("%s: gateway captured %.2f, want 40", orderID, gw.Captured)
+		}
+		if code := post(processPaymentHandler, `{"order_id":"`+orderID+`","customer_id":"user1","amount":40}`); code != http.StatusConflict {
+			t.Errorf("%s: payment after the reversal answered %d, want 409", orderID, code)
+		}
+	}
+}
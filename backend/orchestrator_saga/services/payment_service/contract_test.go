@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/payment_gateway"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func call(t *testing.T, handler http.HandlerFunc, body string) (*httptest.ResponseRecorder, events.ErrorResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	var envelope events.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+	}
+	return rec, envelope
+}
+
+// The orchestrator tells success from failure by the status code alone: a 2xx carries no
+// reason code, every failure carries one with a message. The cases run in order.
+func TestStatusContract(t *testing.T) {
+	payment_gateway.SetFailureRate(0)
+	prevLimit := paymentAmountLimit
+	paymentAmountLimit = 500
+	defer func() { paymentAmountLimit = prevLimit }()
+	transactionsDB.Lock()
+	transactionsDB.Data = map[string]*events.Transaction{"contract-pending": {OrderID: "contract-pending", Status: "pending"}}
+	transactionsDB.Unlock()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+		status  int
+		reason  string
+	}{
+		{name: "paid", handler: processPaymentHandler, body: `{"order_id":"contract-1","customer_id":"user1","amount":50}`, status: http.StatusOK},
+		{name: "payment replayed", handler: processPaymentHandler, body: `{"order_id":"contract-1","customer_id":"user1","amount":50}`, status: http.StatusOK},
+		{name: "paid again with another amount", handler: processPaymentHandler, body: `{"order_id":"contract-1","customer_id":"user1","amount":70}`,
+			status: http.StatusConflict, reason: events.ReasonInvalidRequest},
+		{name: "over the limit", handler: processPaymentHandler, body: `{"order_id":"contract-2","customer_id":"user1","amount":600}`,
+			status: http.StatusBadRequest, reason: events.ReasonLimitExceeded},
+		{name: "declined by the gateway", handler: processPaymentHandler, body: `{"order_id":"` + payment_gateway.FailPrefix + `contract","customer_id":"user1","amount":50}`,
+			status: http.StatusBadRequest, reason: events.ReasonInjectedFailure},
+		{name: "payment still pending", handler: processPaymentHandler, body: `{"order_id":"contract-pending","customer_id":"user1","amount":50}`,
+			status: http.StatusServiceUnavailable, reason: events.ReasonInProgress},
+		{name: "revert while pending", handler: revertPaymentHandler, body: `{"order_id":"contract-pending"}`,
+			status: http.StatusServiceUnavailable, reason: events.ReasonInProgress},
+		{name: "revert of an unpaid order", handler: revertPaymentHandler, body: `{"order_id":"contract-unpaid"}`, status: http.StatusOK},
+		{name: "malformed payment", handler: processPaymentHandler, body: `{`, status: http.StatusBadRequest, reason: events.ReasonInvalidRequest},
+		{name: "malformed revert", handler: revertPaymentHandler, body: `[]`, status: http.StatusBadRequest, reason: events.ReasonInvalidRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, envelope := call(t, tc.handler, tc.body)
+			if rec.Code != tc.status {
+				t.Fatalf("answered %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+			if envelope.ReasonCode != tc.reason || (tc.reason != "" && envelope.Message == "") {
+				t.Errorf("envelope = %+v, want reason %q", envelope, tc.reason)
+			}
+			if tc.status == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+				t.Error("503 without Retry-After")
+			}
+			if strings.Contains(rec.Body.String(), `"status":"success"`) {
+				t.Errorf("body %s still reports a success status", rec.Body)
+			}
+		})
+	}
+
+	// The simulated gateway fails some refunds at random with a 502; the retried revert then
+	// finds nothing left to refund and succeeds.
+	rec, envelope := call(t, revertPaymentHandler, `{"order_id":"contract-1","reason":"shipping failed"}`)
+	if rec.Code == http.StatusBadGateway {
+		if envelope.ReasonCode != events.ReasonRevertFailed {
+			t.Errorf("failed revert envelope = %+v", envelope)
+		}
+		rec, _ = call(t, revertPaymentHandler, `{"order_id":"contract-1","reason":"shipping failed"}`)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revert answered %d: %s", rec.Code, rec.Body)
+	}
+	if rec, _ := call(t, revertPaymentHandler, `{"order_id":"contract-1"}`); rec.Code != http.StatusOK {
+		t.Errorf("repeated revert answered %d", rec.Code)
+	}
+	rec, envelope = call(t, processPaymentHandler, `{"order_id":"contract-1","customer_id":"user1","amount":50}`)
+	if rec.Code != http.StatusConflict || envelope.ReasonCode != events.ReasonInvalidRequest {
+		t.Errorf("payment after the revert answered %d %+v, want 409", rec.Code, envelope)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/clock"
+	"github.com/StitchMl/saga-demo/common/payment_gateway"
+)
+
+// slowGateway holds every gateway call until the returned clock is advanced.
+func slowGateway(t *testing.T) *clock.Fake {
+	t.Helper()
+	fake := clock.NewFake(time.Now())
+	prev := payment_gateway.Clock
+	payment_gateway.Clock = fake
+	payment_gateway.SetFailureRate(0)
+	prevLimit := paymentAmountLimit
+	paymentAmountLimit = 500
+	t.Cleanup(func() { payment_gateway.Clock, paymentAmountLimit = prev, prevLimit })
+	return fake
+}
+
+// atGateway waits for a payment to be held by the slow gateway.
+func atGateway(t *testing.T, gateway *clock.Fake) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); gateway.Waiters() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no payment reached the gateway")
+		}
+	}
+}
+
+func pay(orderID string, amount float64) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"order_id":%q,"customer_id":"user1","amount":%.2f}`, orderID, amount)
+	processPaymentHandler(rec, httptest.NewRequest(http.MethodPost, "/process", strings.NewReader(body)))
+	return rec
+}
+
+func attempts(orderID string) int {
+	transactionsDB.RLock()
+	defer transactionsDB.RUnlock()
+	if tx := transactionsDB.Data[orderID]; tx != nil {
+		return tx.Attempts
+	}
+	return 0
+}
+
+// Retries arriving while the payment is still at a slow gateway are told to come back, and
+// once it is settled they get the original success: the gateway is called once.
+func TestProcessRetriedDuringSlowGateway(t *testing.T) {
+	gateway := slowGateway(t)
+	orderID := fmt.Sprintf("idem-%d", time.Now().UnixNano())
+
+	first := make(chan *httptest.ResponseRecorder, 1)
+	go func() { first <- pay(orderID, 40) }()
+	atGateway(t, gateway)
+
+	const retries = 10
+	var wg sync.WaitGroup
+	codes := make(chan *httptest.ResponseRecorder, retries)
+	for i := 0; i < retries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- pay(orderID, 40)
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	for rec := range codes {
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("retry during the gateway call answered %d (Retry-After %q), want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	gateway.Advance(time.Second)
+	if rec := <-first; rec.Code != http.StatusOK {
+		t.Fatalf("payment answered %d: %s", rec.Code, rec.Body)
+	}
+	if rec := pay(orderID, 40); rec.Code != http.StatusOK {
+		t.Errorf("retry after the payment answered %d, want the original 200", rec.Code)
+	}
+	if rec := pay(orderID, 55); rec.Code != http.StatusConflict {
+		t.Errorf("retry with another amount answered %d, want 409", rec.Code)
+	}
+	if n := attempts(orderID); n != 1 {
+		t.Errorf("gateway called %d times, want once", n)
+	}
+}
+
+// Only a failed payment goes back to the gateway, and its last error is kept.
+func TestProcessRetriedAfterFailure(t *testing.T) {
+	gateway := slowGateway(t)
+	orderID := fmt.Sprintf("idem-failed-%d", time.Now().UnixNano())
+	payment_gateway.SetFailureForOrder(orderID, "card declined")
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- pay(orderID, 40) }()
+	atGateway(t, gateway)
+	gateway.Advance(time.Second)
+	if rec := <-done; rec.Code != http.StatusBadRequest {
+		t.Fatalf("declined payment answered %d", rec.Code)
+	}
+	transactionsDB.RLock()
+	reason := transactionsDB.Data[orderID].Reason
+	transactionsDB.RUnlock()
+	if !strings.Contains(reason, "card declined") {
+		t.Errorf("last error %q, want the decline", reason)
+	}
+
+	payment_gateway.ClearFailureForOrder(orderID)
+	go func() { done <- pay(orderID, 40) }()
+	atGateway(t, gateway)
+	gateway.Advance(time.Second)
+	if rec := <-done; rec.Code != http.StatusOK {
+		t.Fatalf("retried payment answered %d: %s", rec.Code, rec.Body)
+	}
+	if n := attempts(orderID); n != 2 {
+		t.Errorf("%d gateway attempts, want 2", n)
+	}
+}
@@ -2,22 +2,29 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/StitchMl/saga-demo/common/adminauth"
+	"github.com/StitchMl/saga-demo/common/buildinfo"
+	"github.com/StitchMl/saga-demo/common/chaos"
+	"github.com/StitchMl/saga-demo/common/correlation"
+	"github.com/StitchMl/saga-demo/common/diagnostics"
 	"github.com/StitchMl/saga-demo/common/payment_gateway"
+	"github.com/StitchMl/saga-demo/common/responses"
+	"github.com/StitchMl/saga-demo/common/transactions"
 	events "github.com/StitchMl/saga-demo/common/types"
 )
 
 const (
-	errorBody       = "Invalid request body"
-	errorMethod     = "Method not allowed"
-	contentTypeJSON = "application/json"
-	contentType     = "Content-Type"
+	errorBody   = "Invalid request body"
+	errorMethod = "Method not allowed"
 )
 
 var paymentAmountLimit float64
@@ -25,8 +32,46 @@ var paymentAmountLimit float64
 // In-memory database for payment transactions (local record of the Payment Service)
 var transactionsDB = struct {
 	sync.RWMutex
-	Data map[string]string // Map OrderID to transaction status (for example, “pending”, “processed”, “reverted”, “failed”)
-}{Data: make(map[string]string)}
+	Data map[string]*events.Transaction
+}{Data: make(map[string]*events.Transaction)}
+
+// setStatus records the status of the payment of an order; the caller holds the lock.
+func setStatus(orderID, status string) *events.Transaction {
+	now := time.Now()
+	tx, ok := transactionsDB.Data[orderID]
+	if !ok {
+		tx = &events.Transaction{OrderID: orderID, CreatedAt: now}
+		transactionsDB.Data[orderID] = tx
+	}
+	tx.Status = status
+	tx.UpdatedAt = now
+	if status == "reverted" {
+		tx.RevertedAt = &now
+	}
+	return tx
+}
+
+// listTransactions returns a copy of every transaction.
+func listTransactions() []events.Transaction {
+	transactionsDB.RLock()
+	defer transactionsDB.RUnlock()
+	out := make([]events.Transaction, 0, len(transactionsDB.Data))
+	for _, tx := range transactionsDB.Data {
+		out = append(out, *tx)
+	}
+	return out
+}
+
+// getTransaction returns a copy of the transaction of an order.
+func getTransaction(orderID string) (events.Transaction, bool) {
+	transactionsDB.RLock()
+	defer transactionsDB.RUnlock()
+	tx, ok := transactionsDB.Data[orderID]
+	if !ok {
+		return events.Transaction{}, false
+	}
+	return *tx, true
+}
 
 func main() {
 	port := os.Getenv("PAYMENT_SERVICE_PORT")
@@ -44,10 +89,25 @@ func main() {
 		log.Fatalf("Invalid PAYMENT_AMOUNT_LIMIT: %v", err)
 	}
 
-	http.HandleFunc("/process", processPaymentHandler)
-	http.HandleFunc("/revert", revertPaymentHandler)
+	registerRoutes(http.DefaultServeMux)
 	log.Printf("Payment Service started on the port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Fatal(http.ListenAndServe(":"+port, diagnostics.Handler(http.DefaultServeMux)))
+}
+
+// registerRoutes registers the routes of the payment service on mux.
+func registerRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/process", correlation.Middleware(processPaymentHandler))
+	mux.HandleFunc("/revert", correlation.Middleware(revertPaymentHandler))
+	mux.HandleFunc("/refund_partial", correlation.Middleware(refundPartialHandler))
+	mux.HandleFunc("/payments/", transactions.GetHandler("/payments/", getTransaction))
+	mux.HandleFunc("/transactions", transactions.ListHandler(listTransactions))
+	mux.HandleFunc("/transactions/", transactions.GetHandler("/transactions/", getTransaction))
+	mux.HandleFunc("/admin/chaos", adminauth.Require(chaos.AdminHandler))
+	mux.HandleFunc("/version", buildinfo.Handler("orchestrator-payment-service"))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "Orchestrator Payment Service is healthy!")
+	})
 }
 
 // Manager to process a payment
@@ -60,28 +120,47 @@ func processPaymentHandler(w http.ResponseWriter, r *http.Request) {
 	var req events.PaymentPayload
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		// ALWAYS respond in JSON: the Orchestrator expects JSON
-		w.Header().Set(contentType, contentTypeJSON)
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"status":  "error",
-			"message": errorBody,
-		})
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, errorBody)
 		return
 	}
 
 	// Check payment limit
 	if req.Amount > paymentAmountLimit {
-		w.Header().Set(contentType, contentTypeJSON)
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"status":  "error",
-			"message": fmt.Sprintf("Payment processing failed: amount %.2f exceeds limit", req.Amount),
-		})
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonLimitExceeded,
+			fmt.Sprintf("Payment processing failed: amount %.2f exceeds limit", req.Amount))
 		return
 	}
 
+	// The order id is the idempotency key: only a failed or unknown payment reaches the gateway again.
 	transactionsDB.Lock()
-	transactionsDB.Data[req.OrderID] = "pending"
+	rec := transactionsDB.Data[req.OrderID]
+	switch {
+	case rec != nil && rec.Status == "processed":
+		paid := rec.Amount
+		transactionsDB.Unlock()
+		if paid != req.Amount {
+			responses.WriteError(w, http.StatusConflict, events.ReasonInvalidRequest,
+				fmt.Sprintf("Order %s was already paid with a different amount (%.2f)", req.OrderID, paid))
+			return
+		}
+		correlation.Printf(r.Context(), "Payment for order %s already processed, replaying the original response", req.OrderID)
+		responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Payment processed"})
+		return
+	case rec != nil && rec.Status == "pending":
+		transactionsDB.Unlock()
+		// An earlier attempt is still at the gateway: ask the caller to retry once it is settled.
+		w.Header().Set("Retry-After", "1")
+		responses.WriteError(w, http.StatusServiceUnavailable, events.ReasonInProgress, "Payment still in progress, retry later")
+		return
+	case rec != nil && rec.Status == "reverted":
+		transactionsDB.Unlock()
+		responses.WriteError(w, http.StatusConflict, events.ReasonInvalidRequest, "Payment for order "+req.OrderID+" was already reverted")
+		return
+	}
+	tx := setStatus(req.OrderID, "pending")
+	tx.CustomerID = req.CustomerID
+	tx.Amount = req.Amount
+	tx.Attempts++
 	transactionsDB.Unlock()
 
 	err := payment_gateway.ProcessPayment(req.OrderID, req.CustomerID, req.Amount)
@@ -89,25 +168,21 @@ func processPaymentHandler(w http.ResponseWriter, r *http.Request) {
 	transactionsDB.Lock()
 	defer transactionsDB.Unlock()
 	if err != nil {
-		transactionsDB.Data[req.OrderID] = "failed"
-		w.Header().Set(contentType, contentTypeJSON)
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"status": "error",
-			"message": "Payment processing failed" + func() string {
-				if err != nil {
-					return ": " + err.Error()
-				} else {
-					return ""
-				}
-			}(),
-		})
-		return
-	}
-
-	transactionsDB.Data[req.OrderID] = "processed"
-	w.Header().Set(contentType, contentTypeJSON)
-	_ = json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Payment processed"})
+		code := events.ReasonGatewayDeclined
+		switch {
+		case errors.Is(err, payment_gateway.ErrAmountLimitExceeded):
+			code = events.ReasonLimitExceeded
+		case errors.Is(err, payment_gateway.ErrInjectedFailure):
+			code = events.ReasonInjectedFailure
+		}
+		tx = setStatus(req.OrderID, "failed")
+		tx.ReasonCode, tx.Reason = code, err.Error()
+		responses.WriteError(w, http.StatusBadRequest, code, "Payment processing failed: "+err.Error())
+		return
+	}
+
+	setStatus(req.OrderID, "processed")
+	responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Payment processed"})
 }
 
 // Manager to cancel a payment (offsetting)
@@ -122,35 +197,62 @@ func revertPaymentHandler(w http.ResponseWriter, r *http.Request) {
 		Reason  string `json:"reason"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set(contentType, contentTypeJSON)
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"status":  "error",
-			"message": errorBody,
-		})
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, errorBody)
 		return
 	}
 
 	transactionsDB.Lock()
 	defer transactionsDB.Unlock()
 
-	if transactionsDB.Data[req.OrderID] != "processed" {
+	rec := transactionsDB.Data[req.OrderID]
+	switch {
+	case rec != nil && rec.Status == "reverted":
+		// A retried compensation: the refund is already done.
+		correlation.Printf(r.Context(), "Payment for order %s already reverted.", req.OrderID)
+		responses.WriteJSON(w, http.StatusOK, rec)
+		return
+	case rec != nil && rec.Status == "pending":
+		// The payment is still at the gateway: ask the caller to retry once it is settled.
+		w.Header().Set("Retry-After", "1")
+		responses.WriteError(w, http.StatusServiceUnavailable, events.ReasonInProgress, "Payment still in progress, retry the reversal")
+		return
+	case rec == nil || rec.Status != "processed":
 		// If the payment has not been processed, we consider the compensation a success.
-		log.Printf("Payment for order %s was not processed, no need to revert.", req.OrderID)
-		w.Header().Set(contentType, contentTypeJSON)
-		_ = json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Payment not processed, no action taken"})
+		correlation.Printf(r.Context(), "Payment for order %s was not processed, no need to revert.", req.OrderID)
+		responses.WriteJSON(w, http.StatusOK, map[string]string{"message": "Payment not processed, no action taken"})
 		return
 	}
 
 	gatewayErr := payment_gateway.RevertPayment(req.OrderID, req.Reason)
 	if gatewayErr != nil {
-		log.Printf("Payment reversal failed at gateway for order %s: %v", req.OrderID, gatewayErr)
-		http.Error(w, "Payment reversal failed at gateway", http.StatusInternalServerError)
+		correlation.Printf(r.Context(), "Payment reversal failed at gateway for order %s: %v", req.OrderID, gatewayErr)
+		responses.WriteError(w, http.StatusBadGateway, events.ReasonRevertFailed, "Payment reversal failed at gateway")
 		return
 	}
 
-	transactionsDB.Data[req.OrderID] = "reverted"
-	log.Printf("Reverted payment for order %s", req.OrderID)
-	w.Header().Set(contentType, contentTypeJSON)
-	_ = json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Payment reverted"})
+	rec = setStatus(req.OrderID, "reverted")
+	correlation.Printf(r.Context(), "Reverted payment for order %s", req.OrderID)
+	responses.WriteJSON(w, http.StatusOK, rec)
+}
+
+// refundPartialHandler serves POST /refund_partial, giving back part of a processed payment.
+func refundPartialHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, errorMethod, http.StatusMethodNotAllowed)
+		return
+	}
+	req, ok := transactions.DecodeRefundRequest(w, r)
+	if !ok {
+		return
+	}
+
+	transactionsDB.Lock()
+	defer transactionsDB.Unlock()
+	refund, ok := transactions.Refund(w, transactionsDB.Data[req.OrderID], req)
+	if !ok {
+		correlation.Printf(r.Context(), "Partial refund of %.2f for order %s refused", req.Amount, req.OrderID)
+		return
+	}
+	correlation.Printf(r.Context(), "Refunded %.2f for order %s, %.2f left", refund.Amount, req.OrderID, refund.Remaining)
+	responses.WriteJSON(w, http.StatusOK, refund)
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/StitchMl/saga-demo/common/buildinfo"
+	"github.com/StitchMl/saga-demo/common/config"
+	"github.com/StitchMl/saga-demo/common/correlation"
+	"github.com/StitchMl/saga-demo/common/diagnostics"
+	"github.com/StitchMl/saga-demo/common/responses"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// defaultZone is the zone of the addresses whose country has no entry in the zone table.
+const defaultZone = "*"
+
+// zoneRates is the base shipping cost by country code (SHIPPING_ZONES, e.g. "IT=4.90,*=19.90").
+var zoneRates = map[string]float64{"IT": 4.90, "FR": 9.90, "DE": 9.90, "ES": 9.90, defaultZone: 19.90}
+
+// perItemCost is added to the base cost for every unit shipped (SHIPPING_PER_ITEM_COST).
+var perItemCost = 0.50
+
+func main() {
+	port := os.Getenv("SHIPPING_SERVICE_PORT")
+	if port == "" {
+		log.Fatal("SHIPPING_SERVICE_PORT environment variable not set.")
+	}
+	if v := os.Getenv("SHIPPING_ZONES"); v != "" {
+		zones, err := parseZones(v)
+		if err != nil {
+			log.Fatalf("Invalid SHIPPING_ZONES %q: %v", v, err)
+		}
+		zoneRates = zones
+	}
+	if v := os.Getenv("SHIPPING_PER_ITEM_COST"); v != "" {
+		c, err := strconv.ParseFloat(v, 64)
+		if err != nil || c < 0 {
+			log.Fatalf("Invalid SHIPPING_PER_ITEM_COST: %q", v)
+		}
+		perItemCost = c
+	}
+	config.Set("SHIPPING_ZONES", zoneRates)
+	config.Set("SHIPPING_PER_ITEM_COST", perItemCost)
+
+	http.HandleFunc("/quote", correlation.Middleware(quoteHandler))
+	http.HandleFunc("/version", buildinfo.Handler("orchestrator-shipping-service"))
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "Orchestrator Shipping Service is healthy!")
+	})
+	log.Printf("Shipping Service started on the port %s", port)
+	log.Fatal(http.ListenAndServe(":"+port, diagnostics.Handler(http.DefaultServeMux)))
+}
+
+// parseZones reads a comma-separated list of ZONE=cost; the table must have a "*" entry.
+func parseZones(v string) (map[string]float64, error) {
+	zones := make(map[string]float64)
+	for _, part := range strings.Split(v, ",") {
+		zone, cost, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not ZONE=cost", part)
+		}
+		c, err := strconv.ParseFloat(strings.TrimSpace(cost), 64)
+		if err != nil || c < 0 {
+			return nil, fmt.Errorf("invalid cost for zone %s", zone)
+		}
+		zones[strings.ToUpper(strings.TrimSpace(zone))] = c
+	}
+	if _, ok := zones[defaultZone]; !ok {
+		return nil, fmt.Errorf("missing the %q zone", defaultZone)
+	}
+	return zones, nil
+}
+
+// zoneOf returns the zone of an address: its last comma-separated part, the country code,
+// when the zone table has it, the default zone otherwise.
+func zoneOf(address string) string {
+	parts := strings.Split(address, ",")
+	country := strings.ToUpper(strings.TrimSpace(parts[len(parts)-1]))
+	if _, ok := zoneRates[country]; ok && country != "" {
+		return country
+	}
+	return defaultZone
+}
+
+// quoteHandler serves POST /quote: the base cost of the zone plus perItemCost per unit.
+func quoteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req events.ShippingQuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Items) == 0 {
+		responses.WriteError(w, http.StatusBadRequest, events.ReasonInvalidRequest, "Invalid request body")
+		return
+	}
+
+	units := 0
+	for _, item := range req.Items {
+		units += item.Quantity
+	}
+	zone := zoneOf(req.Address)
+	cost := math.Round((zoneRates[zone]+perItemCost*float64(units))*100) / 100
+	correlation.Printf(r.Context(), "Shipping quote for order %s: zone %s, %d units, %.2f", req.OrderID, zone, units, cost)
+	responses.WriteJSON(w, http.StatusOK, events.ShippingQuote{OrderID: req.OrderID, Zone: zone, Cost: cost})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		zone string
+		cost float64
+	}{
+		{name: "domestic", body: `{"order_id":"o1","address":"Via Roma 1, Milano, it","items":[{"product_id":"a","quantity":2},{"product_id":"b","quantity":1}]}`,
+			zone: "IT", cost: 6.40},
+		{name: "EU", body: `{"order_id":"o2","address":"1 Rue de Rivoli, Paris, FR","items":[{"product_id":"a","quantity":1}]}`,
+			zone: "FR", cost: 10.40},
+		{name: "unknown country", body: `{"order_id":"o3","address":"1 Main St, Springfield, US","items":[{"product_id":"a","quantity":4}]}`,
+			zone: defaultZone, cost: 21.90},
+		{name: "no address", body: `{"order_id":"o4","items":[{"product_id":"a","quantity":1}]}`, zone: defaultZone, cost: 20.40},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			quoteHandler(rec, httptest.NewRequest(http.MethodPost, "/quote", strings.NewReader(tc.body)))
+			var quote events.ShippingQuote
+			if err := json.NewDecoder(rec.Body).Decode(&quote); err != nil || rec.Code != http.StatusOK {
+				t.Fatalf("answered %d (%v)", rec.Code, err)
+			}
+			if quote.Zone != tc.zone || quote.Cost != tc.cost {
+				t.Errorf("quote = %+v, want %.2f in zone %s", quote, tc.cost, tc.zone)
+			}
+		})
+	}
+
+	for _, body := range []string{`{`, `{"order_id":"o5","address":"Milano, IT","items":[]}`} {
+		rec := httptest.NewRecorder()
+		quoteHandler(rec, httptest.NewRequest(http.MethodPost, "/quote", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s answered %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestParseZones(t *testing.T) {
+	zones, err := parseZones(" it = 5, *=15.5 ")
+	if err != nil || len(zones) != 2 || zones["IT"] != 5 || zones[defaultZone] != 15.5 {
+		t.Errorf("parseZones = %v, %v", zones, err)
+	}
+	for _, v := range []string{"IT=5", "IT=5,*=x", "IT=-1,*=2", "IT:5,*=2"} {
+		if _, err := parseZones(v); err == nil {
+			t.Errorf("parseZones(%q) accepted", v)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// fakeServices stands in for every downstream service of the saga: customers are valid and
+// every product costs 10 unless set in Prices. It records the calls as "path" or, for status
+// updates, "path status", and answers the paths set in Fail with that status.
+type fakeServices struct {
+	mu     sync.Mutex
+	calls  []string
+	Fail   map[string]int
+	Prices map[string]float64
+}
+
+func newFakeServices(t testing.TB) *fakeServices {
+	t.Helper()
+	f := &fakeServices{Fail: make(map[string]int), Prices: make(map[string]float64)}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	appConfig = Config{
+		OrderServiceURL:     srv.URL,
+		InventoryServiceURL: srv.URL,
+		PaymentServiceURL:   srv.URL,
+		AuthServiceURL:      srv.URL,
+		ServiceCallTimeout:  time.Second,
+		SagaTimeout:         5 * time.Second,
+		SagaLogRetention:    time.Hour,
+		StepPolicies: map[string]StepPolicy{
+			policyOrder:        {MaxAttempts: 1, Timeout: time.Second},
+			policyAuth:         {MaxAttempts: 1, Timeout: time.Second},
+			policyInventory:    {MaxAttempts: 1, Timeout: time.Second},
+			policyPayment:      {MaxAttempts: 1, Timeout: time.Second},
+			policyShipping:     {MaxAttempts: 1, Timeout: time.Second},
+			policyCompensation: {MaxAttempts: 1, Timeout: time.Second},
+		},
+	}
+	return f
+}
+
+func (f *fakeServices) serve(w http.ResponseWriter, r *http.Request) {
+	call := r.URL.Path
+	var body struct {
+		events.OrderStatusUpdatePayload
+		events.PricesRequest
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	if r.URL.Path == "/update_status" {
+		call += " " + body.Status
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	status, fail := f.Fail[r.URL.Path]
+	prices := make(map[string]float64)
+	for _, id := range body.ProductIDs {
+		prices[id] = 10
+		if p, ok := f.Prices[id]; ok {
+			prices[id] = p
+		}
+	}
+	f.mu.Unlock()
+
+	if fail {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(events.ErrorResponse{ReasonCode: "FAKE_FAILURE", Message: "failed by the test"})
+		return
+	}
+	switch r.URL.Path {
+	case "/validate":
+		_ = json.NewEncoder(w).Encode(map[string]bool{"valid": true})
+	case "/get_prices":
+		_ = json.NewEncoder(w).Encode(events.PricesResponse{Prices: prices})
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (f *fakeServices) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
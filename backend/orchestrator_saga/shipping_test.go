@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// The shipping quote is added to the total charged, and a shipping service that keeps failing,
+// or none at all, costs the flat rate instead of failing the saga.
+func TestShippingQuoteInTotal(t *testing.T) {
+	tests := []struct {
+		name     string
+		noURL    bool
+		fail     bool
+		shipping float64
+		quotes   int32
+	}{
+		{name: "quoted", shipping: 7.40, quotes: 1},
+		{name: "quote failing", fail: true, shipping: 9.90, quotes: 2},
+		{name: "no shipping service", noURL: true, shipping: 9.90},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			services := newFakeServices(t)
+			var charged float64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/process" {
+					body, _ := io.ReadAll(r.Body)
+					var payment events.PaymentPayload
+					_ = json.Unmarshal(body, &payment)
+					charged = payment.Amount
+					r.Body = io.NopCloser(bytes.NewReader(body))
+				}
+				services.serve(w, r)
+			}))
+			defer srv.Close()
+			appConfig.PaymentServiceURL = srv.URL
+
+			var quotes atomic.Int32
+			shipping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				quotes.Add(1)
+				var req events.ShippingQuoteRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Items) != 1 || req.Address != "Via Roma 1, Milano, IT" {
+					t.Errorf("quote request %+v (%v), want the order's items and address", req, err)
+				}
+				if tc.fail {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(events.ShippingQuote{OrderID: req.OrderID, Zone: "IT", Cost: 7.40})
+			}))
+			defer shipping.Close()
+			if !tc.noURL {
+				appConfig.ShippingServiceURL = shipping.URL
+			}
+			appConfig.ShippingFlatRate = 9.90
+			appConfig.StepPolicies[policyShipping] = StepPolicy{MaxAttempts: 2, Timeout: appConfig.ServiceCallTimeout, Backoff: 10 * time.Millisecond}
+
+			result, err := executeOrderSaga(correlation.NewID(), newSagaOrder(events.Order{
+				CustomerID: "user1",
+				Address:    "Via Roma 1, Milano, IT",
+				Items:      []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 2}},
+			}))
+			if err != nil {
+				t.Fatalf("saga failed: %v", err)
+			}
+			if result.ShippingCost != tc.shipping || result.Total != 20+tc.shipping || result.Status != "approved" {
+				t.Errorf("order %s with shipping %.2f and total %.2f, want approved with %.2f on top of 20",
+					result.Status, result.ShippingCost, result.Total, tc.shipping)
+			}
+			if charged != result.Total {
+				t.Errorf("charged %.2f, want the total %.2f", charged, result.Total)
+			}
+			if n := quotes.Load(); n != tc.quotes {
+				t.Errorf("%d quote requests, want %d", n, tc.quotes)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// The shortages of a reservation refused by the inventory service end up on the rejected order.
+func TestSagaShortages(t *testing.T) {
+	services := newFakeServices(t)
+	shortages := []events.StockShortage{
+		{ProductID: "mouse-wireless", Requested: 3, Available: 0},
+		{ProductID: "laptop-pro", Requested: 5, Available: 2, SuggestedQuantity: 2},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/reserve" {
+			services.serve(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(events.ErrorResponse{ReasonCode: events.ReasonInsufficientQty, Message: "Insufficient quantity for mouse-wireless", Shortages: shortages})
+	}))
+	defer srv.Close()
+	appConfig.InventoryServiceURL = srv.URL
+
+	result, err := executeOrderSaga(correlation.NewID(), newSagaOrder(events.Order{
+		CustomerID: "user1",
+		Items:      []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 3}, {ProductID: "laptop-pro", Quantity: 5}},
+	}))
+	if err == nil {
+		t.Fatal("the saga succeeded without stock")
+	}
+	order := result.Order
+	if order.Status != "rejected" || order.ReasonCode != events.ReasonInsufficientQty || len(order.Shortages) != 2 {
+		t.Fatalf("order = %+v, want it rejected with both shortages", order)
+	}
+	for i, s := range shortages {
+		if order.Shortages[i] != s {
+			t.Errorf("shortage %d = %+v, want %+v", i, order.Shortages[i], s)
+		}
+	}
+}
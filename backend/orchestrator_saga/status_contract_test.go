@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// makeServiceCall judges a response by its status code: any 2xx is a success whatever its body
+// says, anything else is a *ServiceError carrying the reason code of the envelope.
+func TestServiceCallStatusContract(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr bool
+		reason  string
+		message string
+	}{
+		{name: "200 with a status string", status: http.StatusOK, body: `{"status":"ok"}`},
+		{name: "201 created", status: http.StatusCreated, body: `{"order_id":"o-1"}`},
+		{name: "202 accepted without a body", status: http.StatusAccepted},
+		{name: "404 envelope", status: http.StatusNotFound, body: `{"reason_code":"UNKNOWN_PRODUCT","message":"Product not found: x"}`,
+			wantErr: true, reason: events.ReasonUnknownProduct, message: "Product not found: x"},
+		{name: "409 envelope", status: http.StatusConflict, body: `{"reason_code":"INSUFFICIENT_STOCK","message":"short"}`,
+			wantErr: true, reason: events.ReasonInsufficientQty, message: "short"},
+		{name: "500 plain text", status: http.StatusInternalServerError, body: "boom\n", wantErr: true, message: "boom"},
+		{name: "200 reporting a failure status", status: http.StatusOK, body: `{"status":"failed"}`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+			appConfig.MaxCallsPerSaga = 10
+
+			err := makeServiceCall(context.Background(), StepPolicy{MaxAttempts: 1, Timeout: time.Second}, srv.URL+"/step", struct{}{}, nil)
+			if !tc.wantErr {
+				if err != nil {
+					t.Fatalf("err = %v, want success on %d", err, tc.status)
+				}
+				return
+			}
+			var serr *ServiceError
+			if !errors.As(err, &serr) {
+				t.Fatalf("err = %v, want a *ServiceError", err)
+			}
+			if serr.Status != tc.status || serr.ReasonCode != tc.reason || serr.Message != tc.message {
+				t.Errorf("error = %+v, want status %d reason %q message %q", serr, tc.status, tc.reason, tc.message)
+			}
+		})
+	}
+}
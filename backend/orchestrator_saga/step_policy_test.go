@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// Every step defaults to the global call settings, compensations get twice the attempts, and
+// the environment overrides single fields of a step.
+func TestLoadStepPolicies(t *testing.T) {
+	t.Setenv("PAYMENT_STEP_MAX_ATTEMPTS", "5")
+	t.Setenv("SHIPPING_STEP_TIMEOUT_MS", "2500")
+	t.Setenv("SHIPPING_STEP_BACKOFF_MS", "50")
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev })
+	appConfig = Config{MaxCallAttempts: 3, ServiceCallTimeout: time.Second}
+
+	loadStepPolicies()
+	want := map[string]StepPolicy{
+		policyOrder:        {MaxAttempts: 3, Timeout: time.Second, Backoff: retryBaseDelay},
+		policyPayment:      {MaxAttempts: 5, Timeout: time.Second, Backoff: retryBaseDelay},
+		policyShipping:     {MaxAttempts: 3, Timeout: 2500 * time.Millisecond, Backoff: 50 * time.Millisecond},
+		policyCompensation: {MaxAttempts: 6, Timeout: time.Second, Backoff: retryBaseDelay},
+	}
+	for name, p := range want {
+		if got := policy(name); got != p {
+			t.Errorf("%s policy = %+v, want %+v", name, got, p)
+		}
+	}
+}
+
+// An invalid value stops the orchestrator at startup, naming the variable. The check runs in a
+// child process since it exits.
+func TestInvalidStepPolicy(t *testing.T) {
+	if os.Getenv("STEP_POLICY_CHILD") == "1" {
+		loadStepPolicies()
+		return
+	}
+	for _, env := range []string{"PAYMENT_STEP_TIMEOUT_MS=abc", "ORDER_STEP_MAX_ATTEMPTS=0", "SHIPPING_STEP_BACKOFF_MS=-10"} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestInvalidStepPolicy$")
+		cmd.Env = append(os.Environ(), "STEP_POLICY_CHILD=1", env)
+		out, err := cmd.CombinedOutput()
+		key, _, _ := strings.Cut(env, "=")
+		if err == nil {
+			t.Errorf("%s: the orchestrator started", env)
+		} else if !strings.Contains(string(out), "Invalid "+key) {
+			t.Errorf("%s: output %q does not name the variable", env, out)
+		}
+	}
+}
+
+func countCalls(calls []string, call string) int {
+	n := 0
+	for _, c := range calls {
+		if c == call {
+			n++
+		}
+	}
+	return n
+}
+
+// A saga makes as many attempts at a busy service as the policy of the step allows, and the
+// compensations as many as theirs.
+func TestStepPolicyAttempts(t *testing.T) {
+	services := newFakeServices(t)
+	appConfig.CompensationStrategy = strategyFull
+	appConfig.StepPolicies[policyPayment] = StepPolicy{MaxAttempts: 2, Timeout: time.Second, Backoff: time.Millisecond}
+	appConfig.StepPolicies[policyCompensation] = StepPolicy{MaxAttempts: 4, Timeout: time.Second, Backoff: time.Millisecond}
+	services.Fail["/process"] = http.StatusServiceUnavailable
+	services.Fail["/cancel_reservation"] = http.StatusServiceUnavailable
+
+	if _, err := executeOrderSaga(correlation.NewID(), newSagaOrder(events.Order{
+		CustomerID: "user1",
+		Items:      []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 1}},
+	})); err == nil {
+		t.Fatal("the saga succeeded with the payment service busy")
+	}
+	calls := services.Calls()
+	if n := countCalls(calls, "/process"); n != 2 {
+		t.Errorf("payment attempted %d times, want 2", n)
+	}
+	if n := countCalls(calls, "/cancel_reservation"); n != 4 {
+		t.Errorf("reservation cancel attempted %d times, want 4", n)
+	}
+	if n := countCalls(calls, "/reserve"); n != 1 {
+		t.Errorf("reservation attempted %d times, want once", n)
+	}
+}
+
+// Each attempt gives up after the timeout of the policy.
+func TestStepPolicyTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	appConfig.MaxCallsPerSaga = 10
+
+	start := time.Now()
+	err := makeServiceCall(context.Background(), StepPolicy{MaxAttempts: 1, Timeout: 50 * time.Millisecond}, srv.URL+"/quote", struct{}{}, nil)
+	if err == nil {
+		t.Fatal("the call outlived its timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("gave up after %s, want about 50ms", elapsed)
+	}
+}
+
+// The wait between attempts doubles from the backoff of the policy up to maxRetryBackoff.
+func TestRetryDelayCapped(t *testing.T) {
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, maxRetryBackoff, maxRetryBackoff}
+	for i, w := range want {
+		if got, ok := retryDelay(context.Background(), time.Second, "", i+1); !ok || got != w {
+			t.Errorf("attempt %d: waits %s, want %s", i+1, got, w)
+		}
+	}
+	if got, _ := retryDelay(context.Background(), time.Second, "", 70); got != maxRetryBackoff {
+		t.Errorf("attempt 70: waits %s, want the cap of %s", got, maxRetryBackoff)
+	}
+}
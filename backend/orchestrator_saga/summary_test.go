@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/StitchMl/saga-demo/common/analytics"
+	"github.com/StitchMl/saga-demo/common/correlation"
+	events "github.com/StitchMl/saga-demo/common/types"
+)
+
+// withAnalytics points the analytics webhook at a server sending the summaries it receives on
+// the returned channel.
+func withAnalytics(t *testing.T) <-chan events.SagaCompletedPayload {
+	t.Helper()
+	got := make(chan events.SagaCompletedPayload, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var summary events.SagaCompletedPayload
+		if err := json.NewDecoder(r.Body).Decode(&summary); err == nil {
+			got <- summary
+		}
+	}))
+	t.Cleanup(srv.Close)
+	// A summary still being sent by an earlier test must not reach this server.
+	analytics.Wait()
+	analytics.SetWebhookURL(srv.URL)
+	t.Cleanup(func() {
+		analytics.SetWebhookURL("")
+		analytics.Wait()
+	})
+	return got
+}
+
+// Every saga, approved or compensated, sends exactly one summary.
+func TestSagaCompletedOncePerOrder(t *testing.T) {
+	tests := []struct {
+		name          string
+		fail          string
+		status        string
+		compensations []string
+	}{
+		{name: "approved", status: "approved"},
+		{name: "payment failed", fail: "/process", status: "rejected", compensations: []string{"CANCEL_RESERVATION"}},
+		{name: "inventory failed", fail: "/reserve", status: "rejected"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			services := newFakeServices(t)
+			appConfig.CompensationStrategy = strategyFull
+			if tc.fail != "" {
+				services.Fail[tc.fail] = http.StatusInternalServerError
+			}
+			summaries := withAnalytics(t)
+
+			order := newSagaOrder(events.Order{CustomerID: "user1", Items: []events.OrderItem{{ProductID: "mouse-wireless", Quantity: 2}}})
+			result, _ := executeOrderSaga(correlation.NewID(), order)
+			if result.Order.Status != tc.status {
+				t.Fatalf("saga ended %q, want %q", result.Order.Status, tc.status)
+			}
+
+			var summary events.SagaCompletedPayload
+			select {
+			case summary = <-summaries:
+			case <-time.After(2 * time.Second):
+				t.Fatal("no summary sent")
+			}
+			if summary.OrderID != order.OrderID || summary.Flow != "orchestrated" || summary.Status != tc.status {
+				t.Errorf("summary = %+v, want order %s %s", summary, order.OrderID, tc.status)
+			}
+			if !slices.Equal(summary.CompensationsRun, tc.compensations) {
+				t.Errorf("compensations = %v, want %v", summary.CompensationsRun, tc.compensations)
+			}
+			if !slices.Contains(summary.StepsExecuted, "CREATE_ORDER") {
+				t.Errorf("steps executed = %v", summary.StepsExecuted)
+			}
+			if (tc.status != "approved") != (summary.FailureReasonCode != "") {
+				t.Errorf("failure reason code = %q for a %s saga", summary.FailureReasonCode, tc.status)
+			}
+			analytics.Wait()
+			select {
+			case extra := <-summaries:
+				t.Errorf("second summary sent: %+v", extra)
+			default:
+			}
+		})
+	}
+}
@@ -126,8 +126,19 @@ export default function CreateOrder() {
                 pollOrderStatus(data.order_id);
             }
         } catch (err) {
-            const errorMsg = err.response?.data?.reason || err.response?.data?.message || "Unknown error";
-            const finalMessage = `Order Rejected: ${errorMsg}`;
+            const data = err.response?.data;
+            const errorMsg = data?.reason || data?.message || "Unknown error";
+            // Orchestrated failures carry an outcome with guidance for the customer
+            // Items short of stock come with the quantity that can still be ordered
+            const hints = (data?.shortages || [])
+                .filter(s => s.suggested_quantity)
+                .map(s => `${s.product_id}: reduce to ${s.suggested_quantity}`);
+            let finalMessage = data?.outcome
+                ? `Order Rejected: ${errorMsg}. ${data.message}`
+                : `Order Rejected: ${errorMsg}`;
+            if (hints.length > 0) {
+                finalMessage += ` (${hints.join(", ")})`;
+            }
             setError(finalMessage);
             setSnack({ open: true, msg: finalMessage, severity: "error" });
             setLoading(false);
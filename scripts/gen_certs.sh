@@ -0,0 +1,42 @@
+#!/bin/sh
+
+# Generates a local CA, a server certificate valid for the orchestrated services and the gateway,
+# and a client certificate for mTLS, in the directory given as argument (default ./certs).
+
+set -e
+
+OUT="${1:-./certs}"
+DAYS=365
+HOSTS="localhost orchestrator api-gateway orchestrator-order-service orchestrator-inventory-service orchestrator-payment-service orchestrator-auth-service"
+
+mkdir -p "$OUT"
+cd "$OUT"
+
+if [ -f ca.pem ]; then
+    echo "INFO: $OUT/ca.pem already exists, nothing to do."
+    exit 0
+fi
+
+# --- Certificate authority ---
+openssl req -x509 -newkey rsa:2048 -nodes -days "$DAYS" \
+    -keyout ca-key.pem -out ca.pem -subj "/CN=saga-demo local CA"
+
+# --- Server certificate, one SAN per service name ---
+SAN=""
+for h in $HOSTS; do
+    SAN="${SAN:+$SAN,}DNS:$h"
+done
+openssl req -newkey rsa:2048 -nodes -keyout server-key.pem -out server.csr -subj "/CN=saga-demo"
+printf "subjectAltName=%s\nextendedKeyUsage=serverAuth\n" "$SAN" > server.ext
+openssl x509 -req -in server.csr -CA ca.pem -CAkey ca-key.pem -CAcreateserial \
+    -days "$DAYS" -extfile server.ext -out server.pem
+
+# --- Client certificate for mTLS ---
+openssl req -newkey rsa:2048 -nodes -keyout client-key.pem -out client.csr -subj "/CN=saga-demo client"
+printf "extendedKeyUsage=clientAuth\n" > client.ext
+openssl x509 -req -in client.csr -CA ca.pem -CAkey ca-key.pem -CAcreateserial \
+    -days "$DAYS" -extfile client.ext -out client.pem
+
+rm -f server.csr client.csr server.ext client.ext
+chmod 644 ./*.pem
+echo "INFO: certificates written to $OUT"